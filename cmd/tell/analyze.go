@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/progress"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// newAnalyzeCmd creates the analyze command, which lists the side effects of a command from history
+func newAnalyzeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "analyze [id]",
+		Short: "List the side effects of a command from history",
+		Long: `Ask the model which files a command from history writes or deletes, which network calls it
+makes and which privileges it needs, before you decide to run it. Use 'tell prompt --analyze'
+to analyze a command right after generating it.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			cfg := loadConfig()
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			entry, err := db.GetHistoryEntry(id)
+			if err != nil {
+				slog.Error("Failed to retrieve history entry", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if entry.EntryType != model.EntryTypeCommand || entry.Command == "" {
+				fmt.Fprintf(os.Stderr, "Error: history entry %d has no command to analyze\n", id)
+				os.Exit(1)
+			}
+
+			var clientOpts []llm.Option
+			if override := overrideModel(); override != nil {
+				clientOpts = append(clientOpts, llm.WithModel(override.Model))
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
+
+			analysis, usage, err := analyzeCommand(db, client, ticker, entry.Command, entry.ID)
+			if err != nil {
+				slog.Error("Failed to analyze command", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			// Display debug info if requested
+			if verboseFlag && usage != nil {
+				fmt.Fprintf(os.Stderr, "Model: %s\n", usage.Model)
+				fmt.Fprintf(os.Stderr, "Tokens used: input=%d, output=%d\n", usage.InputTokens, usage.OutputTokens)
+				if cost := requestCost(cfg, usage.Model, usage.InputTokens, usage.OutputTokens); cost != "" {
+					fmt.Fprintf(os.Stderr, "Cost: %s\n", cost)
+				}
+			}
+
+			if formatFlag == "json" {
+				jsonData, err := json.Marshal(analysis)
+				if err != nil {
+					slog.Error("Failed to marshal analysis to JSON", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(jsonData))
+				return
+			}
+
+			fmt.Printf("%s\n\n", entry.Command)
+			fmt.Print(formatAnalysis(analysis))
+		},
+	}
+
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json")
+	cmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	cmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
+
+	return cmd
+}
+
+// analyzeCommand asks for the side effects of command and saves the analysis to history as
+// a child of the command's entry (parentID, 0 if it wasn't saved)
+func analyzeCommand(
+	db *storage.DB,
+	client *llm.Client,
+	ticker *progress.Ticker,
+	command string,
+	parentID int64,
+) (*model.Analysis, *model.LLMUsage, error) {
+	var analysis *model.Analysis
+	var usage *model.LLMUsage
+	var genErr error
+	withProgress(ticker, func() {
+		analysis, usage, genErr = client.Analyze(command)
+	})
+
+	// The analyzed command is stored as the command, with the analysis as its details
+	response := &model.CommandResponse{Command: command, ShowDetails: true}
+	if analysis != nil {
+		response.Details = formatAnalysis(analysis)
+	}
+	saveHistory(db, "analyze "+command, response, usage, genErr,
+		sql.NullInt64{Int64: parentID, Valid: parentID != 0}, model.EntryTypeAnalysis)
+
+	return analysis, usage, genErr
+}
+
+// formatAnalysis renders an analysis as text: the risk and summary, then each kind of
+// side effect the command has
+func formatAnalysis(analysis *model.Analysis) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Risk: %s. %s\n", analysis.Risk, analysis.Summary)
+
+	sections := []struct {
+		title string
+		items []string
+	}{
+		{"Writes", analysis.Writes},
+		{"Deletes", analysis.Deletes},
+		{"Network", analysis.Network},
+		{"Privileges", analysis.Privileges},
+	}
+	for _, section := range sections {
+		if len(section.items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n%s:\n", section.title)
+		for _, item := range section.items {
+			fmt.Fprintf(&sb, "  - %s\n", item)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// askResponse is the JSON output of the ask command
+type askResponse struct {
+	Answer string `json:"answer"`
+}
+
+// newAskCmd creates the ask command, which answers conceptual questions about the
+// terminal with a short explanation instead of a command
+func newAskCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ask [question]",
+		Short: "Ask a general question about the terminal",
+		Long:  "Get a concise, terminal-focused explanation for a conceptual question, e.g. the difference between two tools",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			question := strings.Join(args, " ")
+
+			cfg := loadConfig()
+
+			// Initialize database
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				// Don't exit if just the database fails; we can still answer the question
+			}
+
+			clientOpts := []llm.Option{llm.WithContext(collectContext(cfg, db, question))}
+			if target := targetHost(cfg); target != nil {
+				clientOpts = append(clientOpts, llm.WithTargetHost(target))
+			}
+			override := overrideModel()
+			if override != nil {
+				clientOpts = append(clientOpts, llm.WithModel(override.Model))
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
+
+			var answer string
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				answer, usage, genErr = client.Ask(question)
+			})
+
+			// Record that the model was overridden
+			if override != nil && usage != nil {
+				usage.Route = override.Tier
+			}
+
+			// Answers are stored in the details column, with no command
+			if db != nil {
+				response := &model.CommandResponse{Details: answer, ShowDetails: true}
+				saveHistory(db, question, response, usage, genErr, sql.NullInt64{}, model.EntryTypeAnswer)
+				db.Close()
+			}
+
+			if genErr != nil {
+				slog.Error("Failed to answer question", "error", genErr)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", genErr)
+				os.Exit(1)
+			}
+
+			// Display debug info if requested
+			if verboseFlag && usage != nil {
+				fmt.Fprintf(os.Stderr, "Model: %s\n", usage.Model)
+				if usage.Retries > 0 {
+					fmt.Fprintf(os.Stderr, "Retried: %d times\n", usage.Retries)
+				}
+				fmt.Fprintf(os.Stderr, "Tokens used: input=%d, output=%d\n", usage.InputTokens, usage.OutputTokens)
+				if cost := requestCost(cfg, usage.Model, usage.InputTokens, usage.OutputTokens); cost != "" {
+					fmt.Fprintf(os.Stderr, "Cost: %s\n", cost)
+				}
+			}
+
+			if formatFlag == "json" {
+				jsonData, err := json.Marshal(askResponse{Answer: answer})
+				if err != nil {
+					slog.Error("Failed to marshal answer to JSON", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(jsonData))
+				return
+			}
+
+			fmt.Println(answer)
+		},
+	}
+
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json")
+	cmd.Flags().StringArrayVarP(&contextFileFlag, "context-file", "F", nil, "Attach a file as context (repeatable)")
+	cmd.Flags().BoolVar(&noStdinFlag, "no-stdin", false, "Don't send data piped to stdin as context")
+	cmd.Flags().BoolVar(&pasteFlag, "paste", false, "Attach the clipboard as context")
+	addTmuxPaneFlag(cmd)
+	cmd.Flags().StringVar(&targetHostFlag, "target-host", "", "Answer for this SSH host instead of the local system")
+	cmd.Flags().StringVar(&targetOSFlag, "target-os", "", "Answer for this OS or distribution (linux, macos, ubuntu:22.04, ...) instead of the local system")
+	cmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	cmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
+
+	return cmd
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/probe"
+	"github.com/jonfk/tell/internal/progress"
+	"github.com/jonfk/tell/internal/storage"
+)
+
+// interruptedExitCode is the exit code of a command stopped with Ctrl-C (128 + SIGINT)
+const interruptedExitCode = 130
+
+// autoFix runs command and, each time it fails, asks the model for a fix from its exit code and
+// output, shows it and runs it once the user confirms, up to --auto-fix times. Every fix is saved
+// to history as a continuation of the command it fixes, with its own execution recorded. Exits
+// with the exit code of the last command run when it failed.
+func autoFix(
+	cfg *config.Config,
+	db *storage.DB,
+	client *llm.Client,
+	ticker *progress.Ticker,
+	tty *terminal,
+	command string,
+	entryID int64,
+) {
+	for attempt := 1; ; attempt++ {
+		execution := runRecorded(cfg, db, tty, command, entryID, true)
+		if execution.ExitCode == 0 {
+			return
+		}
+
+		// A command the user interrupted isn't broken
+		if attempt > autoFixFlag || execution.ExitCode == interruptedExitCode {
+			exitWithCode(db, execution.ExitCode)
+		}
+
+		fmt.Fprintf(tty, "\nThe command failed with exit code %d, asking for a fix (%d of %d).\n",
+			execution.ExitCode, attempt, autoFixFlag)
+
+		failed := model.FailedCommand{
+			Command:  command,
+			ExitCode: execution.ExitCode,
+			Stderr:   probe.Truncate(strings.TrimSpace(execution.Output), cfg.Context.MaxStdinBytes),
+		}
+
+		var fixed *model.CommandResponse
+		var usage *model.LLMUsage
+		var genErr error
+		withProgress(ticker, func() {
+			fixed, usage, genErr = client.FixCommand(failed)
+		})
+
+		warnIfPreviouslyFailed(db, fixed)
+		fixedID := saveHistory(db, "fix: "+command, fixed, usage, genErr,
+			sql.NullInt64{Int64: entryID, Valid: entryID != 0}, model.EntryTypeCommand)
+
+		if genErr != nil {
+			slog.Error("Failed to fix command", "error", genErr)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", genErr)
+			exitWithCode(db, execution.ExitCode)
+		}
+
+		showCommand(tty, fixed)
+		if yes, err := askYesNo(tty, "Run the fixed command?"); err != nil || !yes {
+			exitWithCode(db, execution.ExitCode)
+		}
+
+		command, entryID = fixed.Command, fixedID
+	}
+}
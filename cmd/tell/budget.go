@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/storage"
+)
+
+// budgetWarnShare is the share of the monthly budget tell warns about before it is all spent
+const budgetWarnShare = 0.8
+
+// budget is what requests cost this month, as of the last request, when there is a monthly
+// budget. checkBudget sets it before the first request, and saveHistory updates it after each one.
+var budget *budgetSpending
+
+// budgetSpending is what requests cost this month against the monthly budget
+type budgetSpending struct {
+	cfg   *config.Config
+	spent float64
+	// estimate is what the next request is expected to cost: the average cost of this month's requests
+	estimate float64
+}
+
+// checkBudget refuses to send requests once this month's requests cost monthly_budget_usd, when
+// budget_hard_cap is set and --over-budget isn't given
+func checkBudget(cfg *config.Config, db *storage.DB) error {
+	if cfg.MonthlyBudgetUSD <= 0 || db == nil {
+		return nil
+	}
+
+	spent, estimate, err := monthSpending(cfg, db)
+	if err != nil {
+		slog.Warn("Failed to check the monthly budget", "error", err)
+		return nil
+	}
+
+	budget = &budgetSpending{cfg: cfg, spent: spent, estimate: estimate}
+	return budget.allow()
+}
+
+// allow refuses the next request once this month's requests cost the monthly budget, when
+// budget_hard_cap is set and --over-budget isn't given. It is checked before each request, so
+// regenerating in a loop stops at the budget too.
+func (b *budgetSpending) allow() error {
+	if b.spent >= b.cfg.MonthlyBudgetUSD && b.cfg.BudgetHardCap && !overBudgetFlag {
+		return fmt.Errorf("requests cost %s this month, the monthly budget is %s: use --over-budget to send this one anyway, or raise monthly_budget_usd",
+			formatCost(b.spent), formatCost(b.cfg.MonthlyBudgetUSD))
+	}
+	return nil
+}
+
+// warning returns a warning when the request about to be saved makes this month's requests cost
+// 80% or all of the monthly budget, or an empty string. What it cost is compared, or the average
+// cost of a request when that is more, since the projection made before the request was sent
+// may have been too low. The spending is then updated with what the request cost, for the
+// requests after it.
+func (b *budgetSpending) warning(usage *model.LLMUsage) string {
+	before := b.spent
+	cost := 0.0
+	if price, ok := b.cfg.Price(usage.Model); ok {
+		cost = price.Cost(int64(usage.InputTokens), int64(usage.OutputTokens))
+	}
+	projected := before + max(cost, b.estimate)
+	b.spent += cost
+
+	for _, share := range []float64{1, budgetWarnShare} {
+		threshold := share * b.cfg.MonthlyBudgetUSD
+		if before < threshold && projected >= threshold {
+			return fmt.Sprintf("Requests cost about %s this month with this one, %.0f%% of the monthly budget of %s",
+				formatCost(projected), projected*100/b.cfg.MonthlyBudgetUSD, formatCost(b.cfg.MonthlyBudgetUSD))
+		}
+	}
+	return ""
+}
+
+// monthSpending returns what the requests made this month cost, and what one of them cost on average
+func monthSpending(cfg *config.Config, db *storage.DB) (spent float64, average float64, err error) {
+	usage, err := db.GetMonthlyUsage(time.Now().Format("2006-01"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	report := newCostReport(cfg, usage, true)
+	requests := 0
+	for _, line := range report.Lines {
+		requests += line.Requests
+	}
+	if requests == 0 {
+		return report.Total, 0, nil
+	}
+	return report.Total, report.Total / float64(requests), nil
+}
+
+// warnBudget adds the budget warning for a request to its response, which the output of
+// commands shows, and prints it for answers and other entries whose output has no warnings
+func warnBudget(response *model.CommandResponse, usage *model.LLMUsage, entryType string) {
+	message := budget.warning(usage)
+	if message == "" {
+		return
+	}
+
+	if response != nil && entryType == model.EntryTypeCommand {
+		response.AddWarning(model.WarningBudget, message)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", message)
+}
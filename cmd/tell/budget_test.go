@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/jonfk/tell/internal/storage/storagetest"
+)
+
+// budgetDB returns a history database where this month's requests cost $0.79, $0.005 each, and
+// a configuration with a $1 monthly budget and a model costing $0.001 per input token
+func budgetDB(t *testing.T, hardCap bool) (*storage.DB, *config.Config) {
+	t.Helper()
+	t.Cleanup(func() { budget = nil })
+
+	db := storagetest.Open(t)
+	for i := 0; i < 158; i++ {
+		_, err := db.AddHistoryEntry("list files", &model.CommandResponse{Command: "ls"},
+			&model.LLMUsage{Model: "test-model", InputTokens: 5}, "", sql.NullInt64{}, model.EntryTypeCommand)
+		if err != nil {
+			t.Fatalf("AddHistoryEntry: %v", err)
+		}
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.MonthlyBudgetUSD = 1
+	cfg.BudgetHardCap = hardCap
+	cfg.Pricing = map[string]config.ModelPrice{"test-model": {Input: 1000}}
+	return db, cfg
+}
+
+// saveRequest saves a command whose request used inputTokens, and returns its warnings
+func saveRequest(db *storage.DB, inputTokens int) []model.Warning {
+	response := &model.CommandResponse{Command: "ls"}
+	usage := &model.LLMUsage{Model: "test-model", InputTokens: inputTokens}
+	saveHistory(db, "list files", response, usage, nil, sql.NullInt64{}, model.EntryTypeCommand)
+	return response.Warnings
+}
+
+func TestBudgetWarnsWithTheRequestCost(t *testing.T) {
+	db, cfg := budgetDB(t, false)
+	if err := checkBudget(cfg, db); err != nil {
+		t.Fatalf("checkBudget: %v", err)
+	}
+
+	// $0.02 is more than the average request, and crosses 80% of the budget
+	warnings := saveRequest(db, 20)
+	if len(warnings) != 1 || warnings[0].Kind != model.WarningBudget {
+		t.Fatalf("warnings = %+v, want a budget warning", warnings)
+	}
+
+	// Requests after it don't warn again until the whole budget is spent
+	if warnings := saveRequest(db, 5); len(warnings) != 0 {
+		t.Errorf("warnings = %+v, want none", warnings)
+	}
+	if warnings := saveRequest(db, 200); len(warnings) != 1 || warnings[0].Kind != model.WarningBudget {
+		t.Errorf("warnings = %+v, want a budget warning", warnings)
+	}
+}
+
+func TestBudgetHardCapIsCheckedBeforeEachRequest(t *testing.T) {
+	db, cfg := budgetDB(t, true)
+	if err := checkBudget(cfg, db); err != nil {
+		t.Fatalf("checkBudget: %v", err)
+	}
+
+	// A regenerated command spends the rest of the budget, the next request is refused
+	saveRequest(db, 300)
+	if err := budget.allow(); err == nil {
+		t.Error("allow succeeded with the budget spent, want the request refused")
+	}
+
+	overBudgetFlag = true
+	t.Cleanup(func() { overBudgetFlag = false })
+	if err := budget.allow(); err != nil {
+		t.Errorf("allow with --over-budget: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/sysinfo"
+	"github.com/spf13/cobra"
+)
+
+// maxCompletedHistoryEntries bounds the history IDs offered when completing history commands
+const maxCompletedHistoryEntries = 50
+
+// registerCompletions adds dynamic shell completion for values cobra can't know: --model and
+// --target-os wherever they are defined. Completion scripts come from cobra's completion
+// command, e.g. tell completion zsh.
+func registerCompletions(root *cobra.Command) {
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		if cmd.Flags().Lookup("model") != nil {
+			cmd.RegisterFlagCompletionFunc("model", completeModels)
+		}
+		if cmd.Flags().Lookup("target-os") != nil {
+			cmd.RegisterFlagCompletionFunc("target-os", cobra.FixedCompletions(sysinfo.TargetOSNames(), cobra.ShellCompDirectiveNoFileComp))
+		}
+		for _, child := range cmd.Commands() {
+			walk(child)
+		}
+	}
+	walk(root)
+}
+
+// completeModels offers the configured models first, then the well known models of the provider
+// given with --provider or configured
+func completeModels(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Debug("Could not load configuration to complete models", "error", err)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	provider := cfg.ActiveProvider()
+	if providerFlag != "" {
+		provider = providerFlag
+	}
+
+	var models []string
+	seen := make(map[string]bool)
+	add := func(model string, description string) {
+		if model == "" || seen[model] || !strings.HasPrefix(model, toComplete) {
+			return
+		}
+		seen[model] = true
+		models = append(models, model+"\t"+description)
+	}
+
+	add(cfg.ActiveModel(), "configured")
+	add(cfg.Routing.SimpleModel, "routing simple model")
+	add(cfg.Routing.ComplexModel, "routing complex model")
+	for _, model := range cfg.Routing.FallbackModels {
+		add(model, "fallback model")
+	}
+	for _, model := range config.KnownModels(provider) {
+		add(model, provider)
+	}
+
+	return models, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+// completeHistoryIDs offers the IDs of the most recent history entries, newest first, with their
+// prompt as the description. Only the first argument is an ID.
+func completeHistoryIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	db, err := initializeDatabase()
+	if err != nil {
+		slog.Debug("Could not open the database to complete history IDs", "error", err)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	defer db.Close()
+
+	entries, err := db.GetHistoryEntries(maxCompletedHistoryEntries, 0, false, "", "", "", model.HistorySortRecent)
+	if err != nil {
+		slog.Debug("Could not read history to complete IDs", "error", err)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		id := fmt.Sprintf("%d", entry.ID)
+		if !strings.HasPrefix(id, toComplete) {
+			continue
+		}
+		// Descriptions are a single line
+		description := strings.Join(strings.Fields(entry.Prompt), " ")
+		if entry.Favorite {
+			description = "⭐ " + description
+		}
+		ids = append(ids, id+"\t"+description)
+	}
+
+	return ids, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/probe"
+	"github.com/spf13/cobra"
+)
+
+// newCompletionPromptCmd creates the completion-prompt command, which completes or
+// repairs a half-typed command line instead of generating one from English
+func newCompletionPromptCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion-prompt [command line]",
+		Short: "Complete or repair a partially typed command line",
+		Long:  "Send a half-typed or broken command line to the LLM and get back a completed, corrected version",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			commandLine := strings.Join(args, " ")
+
+			cfg := loadConfig()
+
+			// Initialize database
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				// Don't exit if just the database fails; we can still complete the command
+			}
+
+			contextItems := probe.Budget(gatherContext(cfg, db, commandLine), cfg.Context.MaxTokens)
+			clientOpts := []llm.Option{llm.WithContext(contextItems)}
+			override := overrideModel()
+			if override != nil {
+				clientOpts = append(clientOpts, llm.WithModel(override.Model))
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
+
+			var response *model.CommandResponse
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				response, usage, genErr = client.CompleteCommandLine(commandLine)
+			})
+
+			// Record that the model was overridden
+			if override != nil && usage != nil {
+				usage.Route = override.Tier
+			}
+
+			var historyID int64
+			if db != nil {
+				warnIfPreviouslyFailed(db, response)
+				historyID = saveHistory(db, commandLine, response, usage, genErr, sql.NullInt64{}, model.EntryTypeCommand)
+				db.Close()
+			}
+
+			if genErr != nil {
+				slog.Error("Failed to complete command line", "error", genErr)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", genErr)
+				os.Exit(1)
+			}
+
+			response.HistoryID = historyID
+			printCommandResponse(cfg, response, usage)
+		},
+	}
+
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json|shell|fish")
+	cmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	cmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
+	cmd.Flags().BoolVarP(&noExplainFlag, "no-explain", "n", false, "Skip command explanation")
+	cmd.Flags().BoolVar(&posixFlag, "posix", false, "Only use POSIX sh syntax and POSIX utility flags (default: posix in config)")
+	cmd.Flags().BoolVar(&busyboxFlag, "busybox", false, "Only use BusyBox applets and the options they support (default: busybox in config)")
+	cmd.Flags().BoolVar(&forceFlag, "force", false, "Allow destructive commands and commands with warnings when safety_level is strict")
+
+	return cmd
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/jonfk/tell/internal/clipboard"
+	"github.com/jonfk/tell/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newHistoryCopyCmd creates the history copy command, which puts the command of a history entry
+// in the system clipboard
+func newHistoryCopyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "copy [id]",
+		Short: "Copy the command of a history entry to the clipboard",
+		Long: `Put the command of a history entry in the system clipboard, with pbcopy on macOS, wl-copy, xclip or
+xsel on Linux, or PowerShell on Windows and WSL. Without any of them, as over SSH, the terminal is
+asked to set the clipboard with an OSC 52 escape sequence, which most terminals and tmux support.`,
+		Example:           `  tell history copy 42`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeHistoryIDs,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			// Copying calls no model, so no API key is needed
+			cfg, err := config.Load()
+			if err != nil {
+				slog.Error("Failed to load configuration", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			entry, err := db.GetHistoryEntry(id)
+			if err != nil {
+				slog.Error("Failed to retrieve history entry", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if entry.Command == "" {
+				fmt.Fprintf(os.Stderr, "Error: history entry %d has no command to copy\n", id)
+				os.Exit(1)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Context.ProbeTimeout)
+			err = clipboard.Write(ctx, entry.Command)
+			cancel()
+			if err != nil {
+				slog.Error("Failed to copy command", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if err := db.RecordUse(id); err != nil {
+				slog.Error("Failed to record use", "id", id, "error", err)
+			}
+			fmt.Fprintf(os.Stderr, "Copied to the clipboard.\n")
+		},
+	}
+}
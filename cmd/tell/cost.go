@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// costLine is what the requests of a model, or of a month, cost
+type costLine struct {
+	Month        string  `json:"month,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Requests     int     `json:"requests"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	Cost         float64 `json:"cost_usd"`
+	// Unpriced are the models without a price, whose requests aren't in Cost
+	Unpriced []string `json:"unpriced_models,omitempty"`
+}
+
+// costReport is the JSON output of 'tell cost'
+type costReport struct {
+	Lines    []costLine `json:"lines"`
+	Total    float64    `json:"total_usd"`
+	Unpriced []string   `json:"unpriced_models,omitempty"`
+}
+
+// newCostCmd creates the cost command, which adds up what requests cost from the tokens recorded
+// in the history
+func newCostCmd() *cobra.Command {
+	var formatFlag string
+	var monthFlag bool
+
+	cmd := &cobra.Command{
+		Use:   "cost",
+		Short: "Show what requests cost",
+		Long: `Show what requests cost, from the tokens recorded in the history and the price of each model: the
+total for each model, or for each month with --month.
+
+Prices are the list prices of well known models in US dollars, or those set under pricing in the
+config. Models run locally are free, and other models have no price until you set one.`,
+		Example: `  tell cost
+  tell cost --month
+  tell cost --month --format json`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if formatFlag != "text" && formatFlag != "json" {
+				fmt.Fprintf(os.Stderr, "Error: unknown format %q, use text or json\n", formatFlag)
+				os.Exit(1)
+			}
+
+			// Prices come from the config, no API key is needed
+			cfg, err := config.Load()
+			if err != nil {
+				slog.Error("Failed to load configuration", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			usage, err := db.GetMonthlyUsage("")
+			if err != nil {
+				slog.Error("Failed to retrieve usage", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			report := newCostReport(cfg, usage, monthFlag)
+
+			if formatFlag == "json" {
+				jsonData, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					slog.Error("Failed to marshal cost to JSON", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(jsonData))
+				return
+			}
+
+			if len(report.Lines) == 0 {
+				fmt.Println("No requests recorded yet.")
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			if monthFlag {
+				fmt.Fprintln(w, "MONTH\tREQUESTS\tINPUT TOKENS\tOUTPUT TOKENS\tCOST")
+			} else {
+				fmt.Fprintln(w, "MODEL\tREQUESTS\tINPUT TOKENS\tOUTPUT TOKENS\tCOST")
+			}
+			for _, line := range report.Lines {
+				cost := formatCost(line.Cost)
+				if len(line.Unpriced) > 0 {
+					// The requests of a model without a price cost something, but not known what
+					cost = "-"
+					if monthFlag {
+						cost = formatCost(line.Cost) + "*"
+					}
+				}
+				name := line.Model
+				if monthFlag {
+					name = line.Month
+				}
+				fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", name, line.Requests, line.InputTokens, line.OutputTokens, cost)
+			}
+			w.Flush()
+
+			fmt.Printf("\nTotal: %s\n", formatCost(report.Total))
+			if len(report.Unpriced) > 0 {
+				mark := ""
+				if monthFlag {
+					mark = "* "
+				}
+				fmt.Printf("%sNot counted: requests to %s, which have no price. Set one under pricing in the config.\n",
+					mark, strings.Join(report.Unpriced, ", "))
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&monthFlag, "month", false, "Show the cost of each month instead of each model")
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json")
+
+	return cmd
+}
+
+// newCostReport adds up the cost of usage for each model, or each month when byMonth is set
+func newCostReport(cfg *config.Config, usage []model.MonthlyUsage, byMonth bool) costReport {
+	report := costReport{Lines: []costLine{}}
+	// Index of the line of each model or month in report.Lines
+	lines := map[string]int{}
+	unpriced := map[string]bool{}
+
+	for _, u := range usage {
+		key := u.Model
+		if byMonth {
+			key = u.Month
+		}
+		i, ok := lines[key]
+		if !ok {
+			i = len(report.Lines)
+			lines[key] = i
+			if byMonth {
+				report.Lines = append(report.Lines, costLine{Month: u.Month})
+			} else {
+				report.Lines = append(report.Lines, costLine{Model: u.Model})
+			}
+		}
+		line := &report.Lines[i]
+
+		line.Requests += u.Requests
+		line.InputTokens += u.InputTokens
+		line.OutputTokens += u.OutputTokens
+
+		price, ok := cfg.Price(u.Model)
+		if !ok {
+			line.Unpriced = append(line.Unpriced, u.Model)
+			unpriced[u.Model] = true
+			continue
+		}
+		cost := price.Cost(u.InputTokens, u.OutputTokens)
+		line.Cost += cost
+		report.Total += cost
+	}
+
+	for name := range unpriced {
+		report.Unpriced = append(report.Unpriced, name)
+	}
+	sort.Strings(report.Unpriced)
+
+	// Months are newest first already, models are the most expensive first
+	if !byMonth {
+		sort.SliceStable(report.Lines, func(i, j int) bool {
+			return report.Lines[i].Cost > report.Lines[j].Cost
+		})
+	}
+
+	return report
+}
+
+// requestCost returns what a request to modelName with the given token counts cost, formatted,
+// or "" when the model has no price
+func requestCost(cfg *config.Config, modelName string, inputTokens int, outputTokens int) string {
+	price, ok := cfg.Price(modelName)
+	if !ok {
+		return ""
+	}
+	return formatCost(price.Cost(int64(inputTokens), int64(outputTokens)))
+}
+
+// formatCost formats a cost in US dollars, with the precision single requests need
+func formatCost(cost float64) string {
+	if cost < 1 {
+		return fmt.Sprintf("$%.4f", cost)
+	}
+	return fmt.Sprintf("$%.2f", cost)
+}
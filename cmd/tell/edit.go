@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// newHistoryEditCmd creates the history edit command, which amends the command or details of a
+// history entry in the user's editor
+func newHistoryEditCmd() *cobra.Command {
+	var details bool
+
+	cmd := &cobra.Command{
+		Use:   "edit [id]",
+		Short: "Edit the command or details of a history entry",
+		Long: `Open the command of a history entry in $VISUAL or $EDITOR and save what you change, so history
+keeps the version worth running again. With --details the explanation is edited instead; answers,
+summaries and other entries without a command always edit their text. Edited entries are marked
+as such in 'tell history' and 'tell history show', and edits are synced by 'tell sync'.`,
+		Example: `  tell history edit 42
+  tell history edit 42 --details`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeHistoryIDs,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			entry, err := db.GetHistoryEntry(id)
+			if err != nil {
+				slog.Error("Failed to retrieve history entry", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			tty, err := openTTY()
+			if err != nil {
+				slog.Error("No terminal to run the editor", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: tell history edit needs a terminal to run your editor: %v\n", err)
+				os.Exit(1)
+			}
+			defer tty.Close()
+
+			// Entries such as answers keep their text in the details
+			command, text := entry.Command, entry.Details
+			if details || entry.Command == "" {
+				text, err = editText(tty, entry.Details, "tell-*.md")
+			} else {
+				command, err = editCommand(tty, entry.Command)
+			}
+			if err != nil {
+				slog.Error("Failed to edit history entry", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if entry.Command != "" && command == "" {
+				fmt.Fprintf(os.Stderr, "Error: the command is empty, not saving it\n")
+				os.Exit(1)
+			}
+			if command == entry.Command && text == entry.Details {
+				fmt.Printf("History entry %d is unchanged.\n", id)
+				return
+			}
+
+			if err := db.EditHistoryEntry(id, command, text); err != nil {
+				slog.Error("Failed to edit history entry", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Edited history entry %d.\n", id)
+		},
+	}
+
+	cmd.Flags().BoolVar(&details, "details", false, "Edit the details of the entry instead of its command")
+
+	return cmd
+}
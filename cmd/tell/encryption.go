@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jonfk/tell/internal/keyring"
+)
+
+// historyKeyEnvVar holds the history encryption key in base64, for machines without a keyring
+const historyKeyEnvVar = "TELL_HISTORY_KEY"
+
+// The history encryption key is kept in the OS keyring under this service and account
+const (
+	keyringService = "tell-llm"
+	keyringAccount = "history-key"
+)
+
+// keyringTimeout bounds how long reading the keyring may take, including unlocking it
+const keyringTimeout = time.Minute
+
+// historyKey returns the key history is encrypted with, from TELL_HISTORY_KEY or the OS keyring.
+// When create is set and the keyring has no key yet, a new one is stored there.
+func historyKey(create bool) ([]byte, error) {
+	if encoded := os.Getenv(historyKeyEnvVar); encoded != "" {
+		return decodeHistoryKey(encoded, historyKeyEnvVar)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyringTimeout)
+	defer cancel()
+
+	encoded, err := keyring.Get(ctx, keyringService, keyringAccount)
+	if errors.Is(err, keyring.ErrNotFound) {
+		if !create {
+			return nil, fmt.Errorf("history is encrypted, but its key isn't in the keyring, set %s to it", historyKeyEnvVar)
+		}
+
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("could not create history encryption key: %w", err)
+		}
+		if err := keyring.Set(ctx, keyringService, keyringAccount, "tell history encryption key", base64.StdEncoding.EncodeToString(key)); err != nil {
+			return nil, fmt.Errorf("%w, set %s to a key of your own", err, historyKeyEnvVar)
+		}
+		slog.Info("Stored new history encryption key in the keyring", "service", keyringService, "account", keyringAccount)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w, set %s to keep the key yourself", err, historyKeyEnvVar)
+	}
+
+	return decodeHistoryKey(encoded, "the keyring")
+}
+
+// decodeHistoryKey decodes a base64 history encryption key read from source
+func decodeHistoryKey(encoded string, source string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("history encryption key in %s must be 32 bytes in base64, such as the output of 'openssl rand -base64 32'", source)
+	}
+	return key, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/diff"
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/routing"
+	"github.com/jonfk/tell/internal/storage"
+)
+
+// generateFunc generates a command with the given client, so the same request can be re-sent to another model
+type generateFunc func(client *llm.Client) (*model.CommandResponse, *model.LLMUsage, error)
+
+// isRegenerate reports whether prompt is the same as the most recent command prompt,
+// which is how users ask for another attempt at a command they didn't like
+func isRegenerate(db *storage.DB, prompt string) bool {
+	if db == nil {
+		return false
+	}
+
+	entries, err := db.GetHistoryEntries(1, 0, false, "", model.EntryTypeCommand, "", model.HistorySortRecent)
+	if err != nil {
+		slog.Warn("Failed to get most recent history entry", "error", err)
+		return false
+	}
+
+	return len(entries) > 0 && strings.TrimSpace(entries[0].Prompt) == strings.TrimSpace(prompt)
+}
+
+// offerEscalation asks whether to re-send a regenerated prompt to the next model in the fallback
+// chain, shows a diff between the two candidate commands and returns the one the user picks,
+// with the ID of its history entry. The stronger model's attempt is saved to history as a child
+// of the first one (firstID).
+func offerEscalation(
+	cfg *config.Config,
+	db *storage.DB,
+	contextItems []model.ContextItem,
+	generate generateFunc,
+	prompt string,
+	current string,
+	response *model.CommandResponse,
+	usage *model.LLMUsage,
+	firstID int64,
+) (*model.CommandResponse, *model.LLMUsage, int64) {
+	next, ok := routing.Escalate(cfg.Routing, current)
+	if !ok {
+		slog.Debug("No stronger model to escalate to", "model", current)
+		return response, usage, firstID
+	}
+
+	tty, err := openTTY()
+	if err != nil {
+		slog.Debug("No terminal to offer a stronger model", "error", err)
+		return response, usage, firstID
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%s\n", response.Command)
+	if yes, err := askYesNo(tty, fmt.Sprintf("Not what you wanted? Try a stronger model (%s)?", next.Model)); err != nil || !yes {
+		return response, usage, firstID
+	}
+
+	// Re-send the same conversation to the stronger model
+	clientOpts := []llm.Option{llm.WithContext(contextItems), llm.WithModel(next.Model)}
+	if withUndoFlag {
+		clientOpts = append(clientOpts, llm.WithUndo())
+	}
+	client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+	defer cleanup()
+
+	var escalated *model.CommandResponse
+	var escalatedUsage *model.LLMUsage
+	var genErr error
+	withProgress(ticker, func() {
+		escalated, escalatedUsage, genErr = generate(client)
+	})
+	if escalatedUsage != nil {
+		escalatedUsage.Route = next.Tier
+	}
+
+	var parentID sql.NullInt64
+	if firstID != 0 {
+		parentID = sql.NullInt64{Int64: firstID, Valid: true}
+	}
+	warnIfPreviouslyFailed(db, escalated)
+	escalatedID := saveHistory(db, prompt, escalated, escalatedUsage, genErr, parentID, model.EntryTypeCommand)
+
+	if genErr != nil {
+		slog.Error("Failed to generate command with stronger model", "model", next.Model, "error", genErr)
+		fmt.Fprintf(tty, "%s failed: %v\n", next.Model, genErr)
+		return response, usage, firstID
+	}
+
+	if escalated.Command == response.Command {
+		fmt.Fprintf(tty, "%s suggested the same command.\n", next.Model)
+		return response, usage, firstID
+	}
+
+	// Show how the stronger model's command differs and let the user pick
+	fmt.Fprintf(tty, "--- %s\n+++ %s\n%s", current, next.Model, diff.Lines(response.Command, escalated.Command))
+	useEscalated, err := askYesNo(tty, fmt.Sprintf("Use the command from %s?", next.Model))
+	if err != nil || !useEscalated {
+		return response, usage, firstID
+	}
+
+	return escalated, escalatedUsage, escalatedID
+}
+
+// canOfferEscalation reports whether the stronger model may be offered for this request.
+// JSON and shell output are read by the shell widgets, which own the terminal, the fallback chain
+// belongs to the configured provider, and interactive mode has its own way to regenerate.
+func canOfferEscalation() bool {
+	return !machineFormat() && providerFlag == "" && !interactiveFlag
+}
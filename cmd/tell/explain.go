@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/progress"
+	"github.com/spf13/cobra"
+)
+
+// newExplainCmd creates the explain command, the reverse of prompt: it takes an existing
+// command and explains what each part of it does
+func newExplainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "explain [command]",
+		Short: "Explain an existing shell command",
+		Long: `Break down an existing shell command, e.g. one found online, and explain each part of it.
+The command is read from the arguments, or from stdin when there are none:
+
+  tell explain "find . -name '*.log' -mtime +7 -exec rm {} +"
+  pbpaste | tell explain`,
+		Run: func(cmd *cobra.Command, args []string) {
+			command := strings.Join(args, " ")
+
+			// Read the command from stdin when it isn't given as arguments
+			if command == "" && !progress.IsTerminal(os.Stdin) {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					slog.Error("Failed to read stdin", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: could not read stdin: %v\n", err)
+					os.Exit(1)
+				}
+				command = string(data)
+			}
+			command = strings.TrimSpace(command)
+			if command == "" {
+				fmt.Fprintf(os.Stderr, "Error: no command to explain, pass it as an argument or on stdin\n")
+				os.Exit(1)
+			}
+
+			cfg := loadConfig()
+
+			// Initialize database
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				// Don't exit if just the database fails; we can still explain the command
+			}
+
+			var clientOpts []llm.Option
+			override := overrideModel()
+			if override != nil {
+				clientOpts = append(clientOpts, llm.WithModel(override.Model))
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
+
+			var explanation *model.Explanation
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				explanation, usage, genErr = client.Explain(command)
+			})
+
+			// Record that the model was overridden
+			if override != nil && usage != nil {
+				usage.Route = override.Tier
+			}
+
+			// The explained command is stored as the command, with the explanation as its details
+			if db != nil {
+				response := &model.CommandResponse{Command: command, ShowDetails: true}
+				if explanation != nil {
+					response.Details = formatExplanation(explanation)
+				}
+				saveHistory(db, "explain "+command, response, usage, genErr, sql.NullInt64{}, model.EntryTypeExplanation)
+				db.Close()
+			}
+
+			if genErr != nil {
+				slog.Error("Failed to explain command", "error", genErr)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", genErr)
+				os.Exit(1)
+			}
+
+			// Display debug info if requested
+			if verboseFlag && usage != nil {
+				fmt.Fprintf(os.Stderr, "Model: %s\n", usage.Model)
+				if usage.Retries > 0 {
+					fmt.Fprintf(os.Stderr, "Retried: %d times\n", usage.Retries)
+				}
+				fmt.Fprintf(os.Stderr, "Tokens used: input=%d, output=%d\n", usage.InputTokens, usage.OutputTokens)
+				if cost := requestCost(cfg, usage.Model, usage.InputTokens, usage.OutputTokens); cost != "" {
+					fmt.Fprintf(os.Stderr, "Cost: %s\n", cost)
+				}
+			}
+
+			if formatFlag == "json" {
+				jsonData, err := json.Marshal(explanation)
+				if err != nil {
+					slog.Error("Failed to marshal explanation to JSON", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(jsonData))
+				return
+			}
+
+			fmt.Print(formatExplanation(explanation))
+		},
+	}
+
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json")
+	cmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	cmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
+
+	return cmd
+}
+
+// formatExplanation renders an explanation as text: the summary, each part with its
+// explanation indented below it, then any caveats
+func formatExplanation(explanation *model.Explanation) string {
+	var sb strings.Builder
+
+	sb.WriteString(explanation.Summary)
+	sb.WriteString("\n")
+
+	if len(explanation.Parts) > 0 {
+		sb.WriteString("\n")
+		for _, part := range explanation.Parts {
+			fmt.Fprintf(&sb, "  %s\n      %s\n", part.Part, part.Explanation)
+		}
+	}
+
+	if len(explanation.Caveats) > 0 {
+		sb.WriteString("\nCaveats:\n")
+		for _, caveat := range explanation.Caveats {
+			fmt.Fprintf(&sb, "  - %s\n", caveat)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// historyExportVersion is the version of the JSON export format, increased on incompatible changes
+const historyExportVersion = 1
+
+// historyExport is the document written by 'tell history export --format json'
+type historyExport struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Entries    []exportedEntry `json:"entries"`
+}
+
+// exportedEntry is a history entry in the JSON export. Values that aren't known, such as the
+// exit code of a command that was never run, are left out.
+type exportedEntry struct {
+	ID           int64      `json:"id"`
+	UID          string     `json:"uid,omitempty"`
+	Timestamp    time.Time  `json:"timestamp"`
+	EntryType    string     `json:"entry_type"`
+	Prompt       string     `json:"prompt"`
+	Command      string     `json:"command,omitempty"`
+	Details      string     `json:"details,omitempty"`
+	ShowDetails  bool       `json:"show_details,omitempty"`
+	Undo         string     `json:"undo,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	Model        string     `json:"model,omitempty"`
+	InputTokens  int        `json:"input_tokens,omitempty"`
+	OutputTokens int        `json:"output_tokens,omitempty"`
+	ParentID     *int64     `json:"parent_id,omitempty"`
+	Favorite     bool       `json:"favorite,omitempty"`
+	Shortcut     string     `json:"shortcut,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	ExitCode     *int64     `json:"exit_code,omitempty"`
+	ExecutedAt   *time.Time `json:"executed_at,omitempty"`
+	DurationMS   *int64     `json:"duration_ms,omitempty"`
+	TimedOut     bool       `json:"timed_out,omitempty"`
+	Output       *string    `json:"output,omitempty"`
+	Outcome      string     `json:"outcome,omitempty"`
+	RanCommand   string     `json:"ran_command,omitempty"`
+	Edited       bool       `json:"edited,omitempty"`
+	UseCount     int        `json:"use_count,omitempty"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+}
+
+// newHistoryExportCmd creates the history export command, which writes history entries as JSON,
+// CSV or Markdown
+func newHistoryExportCmd() *cobra.Command {
+	var format string
+	var output string
+	var since string
+	var favorites bool
+	var entryType string
+	var tag string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export history as JSON, CSV or Markdown",
+		Long: `Write history entries, oldest first, to stdout or a file: JSON keeps everything for backups and
+'tell history import', CSV is for spreadsheets and analysis, and Markdown is a runbook of prompts and
+commands to share with teammates. Every entry type is exported unless --type is given.`,
+		Example: `  tell history export > tell-history.json
+  tell history export --format csv --since 30d -o history.csv
+  tell history export --format md --favorites --tag deploy > runbook.md`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			var write func(w io.Writer, entries []model.HistoryEntry) error
+			switch format {
+			case "json":
+				write = writeJSONExport
+			case "csv":
+				write = writeCSVExport
+			case "md", "markdown":
+				write = writeMarkdownExport
+			default:
+				fmt.Fprintf(os.Stderr, "Error: invalid format %q (expected json, csv or md)\n", format)
+				os.Exit(1)
+			}
+
+			var after time.Time
+			if since != "" {
+				var err error
+				if after, err = parseSince(since, time.Now()); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if entryType == "all" {
+				entryType = ""
+			}
+			if tag != "" {
+				var err error
+				if tag, err = normalizeTag(tag); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			// A negative limit returns every entry, newest first
+			entries, err := db.GetHistoryEntries(-1, 0, favorites, "", entryType, tag, model.HistorySortRecent)
+			if err != nil {
+				slog.Error("Failed to retrieve history", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !after.IsZero() {
+				entries = slices.DeleteFunc(entries, func(entry model.HistoryEntry) bool {
+					return entry.Timestamp.Before(after)
+				})
+			}
+			slices.Reverse(entries)
+
+			// History can hold secrets, so the file is only readable by the user
+			w := io.Writer(os.Stdout)
+			if output != "" && output != "-" {
+				f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+				if err != nil {
+					slog.Error("Failed to create export file", "path", output, "error", err)
+					fmt.Fprintf(os.Stderr, "Error: could not create %s: %v\n", output, err)
+					os.Exit(1)
+				}
+				defer f.Close()
+				w = f
+			}
+
+			if err := write(w, entries); err != nil {
+				slog.Error("Failed to export history", "format", format, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: could not export history: %v\n", err)
+				os.Exit(1)
+			}
+			if output != "" && output != "-" {
+				fmt.Fprintf(os.Stderr, "Exported %d entries to %s.\n", len(entries), output)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "json", "Output format: json|csv|md")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of stdout")
+	cmd.Flags().StringVar(&since, "since", "", "Only export entries from this date (2024-05-01) or this long ago (24h, 7d, 2w)")
+	cmd.Flags().BoolVarP(&favorites, "favorites", "f", false, "Only export favorite entries")
+	cmd.Flags().StringVarP(&entryType, "type", "t", "all", "Entry type to export: command|answer|summary|explanation|analysis|script|all")
+	cmd.Flags().StringVar(&tag, "tag", "", "Only export entries with this tag")
+	cmd.RegisterFlagCompletionFunc("tag", completeTags)
+
+	return cmd
+}
+
+// agePattern matches a number of days or weeks, which time.ParseDuration doesn't accept
+var agePattern = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// parseAge parses how long ago something was, such as 36h, 90d or 2w
+func parseAge(age string) (time.Duration, error) {
+	if match := agePattern.FindStringSubmatch(age); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			n *= 7
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	if d, err := time.ParseDuration(age); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid age %q: use a duration such as 24h, 90d or 2w", age)
+}
+
+// parseSince returns the time --since refers to: a date, a date and time in RFC 3339, or a
+// duration before now such as 36h, 7d or 2w
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if d, err := parseAge(since); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q: use a date (2024-05-01) or a duration (24h, 7d, 2w)", since)
+}
+
+// writeJSONExport writes entries as a historyExport document
+func writeJSONExport(w io.Writer, entries []model.HistoryEntry) error {
+	export := historyExport{
+		Version:    historyExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Entries:    make([]exportedEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		export.Entries = append(export.Entries, exportEntry(entry))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(export)
+}
+
+// exportEntry turns a history entry into an entry of the JSON export
+func exportEntry(entry model.HistoryEntry) exportedEntry {
+	exported := exportedEntry{
+		ID:           entry.ID,
+		UID:          entry.UID,
+		Timestamp:    entry.Timestamp,
+		EntryType:    entry.EntryType,
+		Prompt:       entry.Prompt,
+		Command:      entry.Command,
+		Details:      entry.Details,
+		ShowDetails:  entry.ShowDetails,
+		Undo:         entry.Undo,
+		Error:        entry.ErrorMessage,
+		Model:        entry.Model,
+		InputTokens:  entry.InputTokens,
+		OutputTokens: entry.OutputTokens,
+		Favorite:     entry.Favorite,
+		Shortcut:     entry.Shortcut,
+		Tags:         entry.Tags,
+		TimedOut:     entry.TimedOut,
+		Outcome:      entry.Outcome,
+		RanCommand:   entry.RanCommand,
+		Edited:       entry.Edited,
+		UseCount:     entry.UseCount,
+	}
+	if entry.ParentID.Valid {
+		exported.ParentID = &entry.ParentID.Int64
+	}
+	if entry.ExitCode.Valid {
+		exported.ExitCode = &entry.ExitCode.Int64
+	}
+	if entry.ExecutedAt.Valid {
+		exported.ExecutedAt = &entry.ExecutedAt.Time
+	}
+	if entry.DurationMS.Valid {
+		exported.DurationMS = &entry.DurationMS.Int64
+	}
+	if entry.Output.Valid {
+		exported.Output = &entry.Output.String
+	}
+	if entry.LastUsedAt.Valid {
+		exported.LastUsedAt = &entry.LastUsedAt.Time
+	}
+	return exported
+}
+
+// writeCSVExport writes entries as CSV with a header row, one row per entry
+func writeCSVExport(w io.Writer, entries []model.HistoryEntry) error {
+	csvWriter := csv.NewWriter(w)
+	csvWriter.Write([]string{
+		"id", "timestamp", "entry_type", "prompt", "command", "details", "favorite", "tags",
+		"exit_code", "duration_ms", "model", "input_tokens", "output_tokens", "error",
+	})
+
+	for _, entry := range entries {
+		var exitCode, durationMS string
+		if entry.ExitCode.Valid {
+			exitCode = strconv.FormatInt(entry.ExitCode.Int64, 10)
+		}
+		if entry.DurationMS.Valid {
+			durationMS = strconv.FormatInt(entry.DurationMS.Int64, 10)
+		}
+		csvWriter.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.Timestamp.Format(time.RFC3339),
+			entry.EntryType,
+			entry.Prompt,
+			entry.Command,
+			entry.Details,
+			strconv.FormatBool(entry.Favorite),
+			strings.Join(entry.Tags, " "),
+			exitCode,
+			durationMS,
+			entry.Model,
+			strconv.Itoa(entry.InputTokens),
+			strconv.Itoa(entry.OutputTokens),
+			entry.ErrorMessage,
+		})
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// writeMarkdownExport writes entries as a runbook: a section per entry, titled with its prompt,
+// with the command in a code block and its explanation. Failed generations are left out.
+func writeMarkdownExport(w io.Writer, entries []model.HistoryEntry) error {
+	var sb strings.Builder
+	sb.WriteString("# Command history\n")
+
+	for _, entry := range entries {
+		if entry.ErrorMessage != "" {
+			continue
+		}
+
+		fmt.Fprintf(&sb, "\n## %s\n\n", strings.Join(strings.Fields(entry.Prompt), " "))
+
+		// A line about the entry: when, how it went and its tags
+		meta := []string{entry.Timestamp.Format("2006-01-02 15:04")}
+		if entry.ExitCode.Valid {
+			meta = append(meta, fmt.Sprintf("exit code %d", entry.ExitCode.Int64))
+		}
+		if entry.Favorite {
+			meta = append(meta, "⭐")
+		}
+		for _, tag := range entry.Tags {
+			meta = append(meta, "`#"+tag+"`")
+		}
+		fmt.Fprintf(&sb, "_%s_\n\n", strings.Join(meta, " · "))
+
+		switch entry.EntryType {
+		case model.EntryTypeAnswer, model.EntryTypeSummary, model.EntryTypeExplanation, model.EntryTypeAnalysis:
+			if entry.Command != "" {
+				writeCodeBlock(&sb, entry.Command)
+				sb.WriteString("\n")
+			}
+			fmt.Fprintf(&sb, "%s\n", strings.TrimSpace(entry.Details))
+		default:
+			writeCodeBlock(&sb, entry.Command)
+			if entry.Details != "" {
+				fmt.Fprintf(&sb, "\n%s\n", strings.TrimSpace(entry.Details))
+			}
+			if entry.Undo != "" {
+				sb.WriteString("\nUndo:\n\n")
+				writeCodeBlock(&sb, entry.Undo)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeCodeBlock writes a fenced shell code block, with a fence longer than any run of
+// backticks in code so it can't end the block early
+func writeCodeBlock(sb *strings.Builder, code string) {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	fmt.Fprintf(sb, "%ssh\n%s\n%s\n", fence, strings.TrimRight(code, "\n"), fence)
+}
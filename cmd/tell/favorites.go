@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/placeholder"
+	"github.com/jonfk/tell/internal/shellenv"
+	"github.com/spf13/cobra"
+)
+
+// shortcutNamePattern matches the names fish, zsh, bash and PowerShell all accept for an
+// abbreviation, alias or function
+var shortcutNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// newFavoritesCmd creates the favorites command, which turns favorite history entries into
+// shell shortcuts
+func newFavoritesCmd() *cobra.Command {
+	favoritesCmd := &cobra.Command{
+		Use:   "favorites",
+		Short: "Turn favorite commands into shell shortcuts",
+		Long:  "Turn favorite history entries named with 'tell history favorite <id> --name <name>' into shell shortcuts",
+	}
+
+	exportAbbrCmd := &cobra.Command{
+		Use:   "export-abbr [shell]",
+		Short: "Print favorites as fish abbreviations or shell aliases",
+		Long: `Print the favorites that have a shortcut name as fish abbreviations, zsh or bash aliases, or
+PowerShell functions, for the detected shell by default. Favorites without a name are skipped. Aliases
+can't hold placeholders such as {{file}}, so commands with them are only exported as fish abbreviations,
+which are expanded on the command line to be filled in.`,
+		Example: `  tell favorites export-abbr fish | source
+  eval "$(tell favorites export-abbr zsh)"`,
+		Args:      cobra.MaximumNArgs(1),
+		ValidArgs: []string{"fish", "zsh", "bash", "pwsh"},
+		Run: func(cmd *cobra.Command, args []string) {
+			shell := "auto"
+			if len(args) > 0 {
+				shell = args[0]
+			}
+			shell = shellenv.ResolveShell(shell)
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			// A negative limit returns every favorite
+			entries, err := db.GetHistoryEntries(-1, 0, true, "", model.EntryTypeCommand, "", model.HistorySortRecent)
+			if err != nil {
+				slog.Error("Failed to retrieve favorites", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if err := writeShortcuts(os.Stdout, shell, entries); err != nil {
+				slog.Error("Failed to export favorites", "shell", shell, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	favoritesCmd.AddCommand(exportAbbrCmd)
+	return favoritesCmd
+}
+
+// writeShortcuts writes a shortcut definition for the shell for each named favorite in entries,
+// newest first. When two favorites have the same name, the newest one is kept. Skipped
+// favorites are reported on stderr.
+func writeShortcuts(w io.Writer, shell string, entries []model.HistoryEntry) error {
+	var define func(name string, command string) string
+	switch shell {
+	case "fish":
+		define = func(name string, command string) string {
+			quoted := "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(command) + "'"
+			return "abbr -a -- " + name + " " + quoted
+		}
+	case "zsh", "bash":
+		define = func(name string, command string) string {
+			return "alias " + name + "='" + strings.ReplaceAll(command, "'", `'\''`) + "'"
+		}
+	case shellenv.PowerShell:
+		// Arguments are passed on to single line commands
+		define = func(name string, command string) string {
+			if !strings.Contains(command, "\n") {
+				command += " @args"
+			}
+			return "function " + name + " {\n  " + strings.ReplaceAll(command, "\n", "\n  ") + "\n}"
+		}
+	default:
+		return fmt.Errorf("unsupported shell: %s (use fish, zsh, bash or pwsh)", shell)
+	}
+
+	unnamed := 0
+	seen := make(map[string]bool)
+	fmt.Fprintf(w, "# Favorites from tell, generated by 'tell favorites export-abbr %s'\n", shell)
+	for _, entry := range entries {
+		if entry.Shortcut == "" {
+			unnamed++
+			continue
+		}
+		if seen[entry.Shortcut] {
+			fmt.Fprintf(os.Stderr, "Skipped entry %d: a newer favorite is already named %s\n", entry.ID, entry.Shortcut)
+			continue
+		}
+		if shell != "fish" && len(placeholder.Names(entry.Command)) > 0 {
+			fmt.Fprintf(os.Stderr, "Skipped %s (entry %d): its command has placeholders, which only fish abbreviations can hold\n", entry.Shortcut, entry.ID)
+			continue
+		}
+		seen[entry.Shortcut] = true
+		fmt.Fprintln(w, define(entry.Shortcut, entry.Command))
+	}
+
+	if unnamed > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d favorites without a name, name them with 'tell history favorite <id> --name <name>'\n", unnamed)
+	}
+	return nil
+}
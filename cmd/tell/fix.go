@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/probe"
+	"github.com/jonfk/tell/internal/progress"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fixCommandFlag  string
+	fixExitCodeFlag int
+	fixStderrFlag   string
+)
+
+// newFixCmd creates the fix command, which asks for a corrected version of a command that failed
+func newFixCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fix [what went wrong]",
+		Short: "Fix a command that failed",
+		Long: `Ask for a corrected version of a command that failed, given its exit code and error output.
+Without --command, the most recent command from history is fixed. Error output can be piped in:
+
+  make 2>&1 | tell fix --command make --exit-code 2
+  tell fix --command "tar -xf backup.tgz -C /opt" "permission denied"
+
+The shell integration provides a tellfix function that passes the previous command and its exit code.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			failed := model.FailedCommand{
+				Command:  strings.TrimSpace(fixCommandFlag),
+				ExitCode: fixExitCodeFlag,
+				Stderr:   fixStderrFlag,
+				Note:     strings.Join(args, " "),
+			}
+
+			cfg := loadConfig()
+
+			// Piped input is the error output of the failed command, never generic context
+			if failed.Stderr == "" && !noStdinFlag && !progress.IsTerminal(os.Stdin) {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					slog.Error("Failed to read stdin", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: could not read stdin: %v\n", err)
+					os.Exit(1)
+				}
+				failed.Stderr = string(data)
+			}
+			noStdinFlag = true
+			failed.Stderr = probe.Truncate(strings.TrimSpace(failed.Stderr), cfg.Context.MaxStdinBytes)
+
+			// Initialize database
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				// Don't exit if just the database fails; we can still fix a command given with --command
+			}
+
+			// Find the failing entry in history, so the fix is stored as its continuation
+			failedEntry := failingEntry(db, &failed)
+			if failed.Command == "" {
+				fmt.Fprintf(os.Stderr, "Error: no command to fix, pass it with --command\n")
+				os.Exit(1)
+			}
+
+			clientOpts := []llm.Option{llm.WithContext(collectContext(cfg, db, failed.Command))}
+			override := overrideModel()
+			if override != nil {
+				clientOpts = append(clientOpts, llm.WithModel(override.Model))
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
+
+			var response *model.CommandResponse
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				response, usage, genErr = client.FixCommand(failed)
+			})
+
+			// Record that the model was overridden
+			if override != nil && usage != nil {
+				usage.Route = override.Tier
+			}
+
+			var historyID int64
+			var parentID sql.NullInt64
+			if failedEntry != nil {
+				parentID = sql.NullInt64{Int64: failedEntry.ID, Valid: true}
+				if response != nil {
+					response.AddWarning(model.WarningContinuation,
+						fmt.Sprintf("Fixing history entry %d: %s", failedEntry.ID, failedEntry.Command))
+				}
+			}
+
+			if db != nil {
+				warnIfPreviouslyFailed(db, response)
+				historyID = saveHistory(db, "fix: "+failed.Command, response, usage, genErr, parentID, model.EntryTypeCommand)
+				db.Close()
+			}
+
+			if genErr != nil {
+				slog.Error("Failed to fix command", "error", genErr)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", genErr)
+				os.Exit(1)
+			}
+
+			response.HistoryID = historyID
+			printCommandResponse(cfg, response, usage)
+		},
+	}
+
+	cmd.Flags().StringVar(&fixCommandFlag, "command", "", "The command that failed (default: the most recent command in history)")
+	cmd.Flags().IntVar(&fixExitCodeFlag, "exit-code", -1, "Exit code of the failed command")
+	cmd.Flags().StringVar(&fixStderrFlag, "stderr", "", "Error output of the failed command (or pipe it to stdin)")
+	cmd.Flags().BoolVar(&noStdinFlag, "no-stdin", false, "Don't read error output from stdin")
+	cmd.Flags().BoolVar(&pasteFlag, "paste", false, "Attach the clipboard as context")
+	addTmuxPaneFlag(cmd)
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json|shell|fish")
+	cmd.Flags().BoolVarP(&noExplainFlag, "no-explain", "n", false, "Skip command explanation")
+	cmd.Flags().BoolVar(&posixFlag, "posix", false, "Only use POSIX sh syntax and POSIX utility flags (default: posix in config)")
+	cmd.Flags().BoolVar(&busyboxFlag, "busybox", false, "Only use BusyBox applets and the options they support (default: busybox in config)")
+	cmd.Flags().BoolVar(&forceFlag, "force", false, "Allow destructive commands and commands with warnings when safety_level is strict")
+	cmd.Flags().StringArrayVarP(&contextFileFlag, "context-file", "F", nil, "Attach a file as context (repeatable)")
+	cmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	cmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
+
+	return cmd
+}
+
+// failingEntry returns the history entry of the command to fix, or nil if it isn't in history.
+// Without a command, the most recent failed command is used, falling back to the most recent
+// command, and failed is filled in from the entry. Output recorded when the command was run is
+// used when no error output was given.
+func failingEntry(db *storage.DB, failed *model.FailedCommand) *model.HistoryEntry {
+	if db == nil {
+		return nil
+	}
+
+	if failed.Command != "" {
+		entry, err := db.FindCommandEntry(failed.Command)
+		if err != nil {
+			slog.Warn("Failed to look up command in history", "error", err)
+			return nil
+		}
+		if entry != nil && failed.Stderr == "" && entry.Output.Valid {
+			failed.Stderr = entry.Output.String
+		}
+		return entry
+	}
+
+	entry, err := db.GetMostRecentFailedExecution()
+	if err != nil {
+		slog.Warn("Failed to get most recent failed command", "error", err)
+	}
+	if entry == nil {
+		// Skip recent entries where generation failed and there is no command
+		entries, err := db.GetHistoryEntries(10, 0, false, "", model.EntryTypeCommand, "", model.HistorySortRecent)
+		if err != nil {
+			slog.Warn("Failed to get most recent command", "error", err)
+			return nil
+		}
+		for i := range entries {
+			if entries[i].Command != "" {
+				entry = &entries[i]
+				break
+			}
+		}
+		if entry == nil {
+			return nil
+		}
+	}
+
+	// The exit code is that of the edited command when the user changed it before running it
+	failed.Command = entry.Command
+	if entry.RanCommand != "" {
+		failed.Command = entry.RanCommand
+	}
+	if failed.ExitCode < 0 && entry.ExitCode.Valid {
+		failed.ExitCode = int(entry.ExitCode.Int64)
+	}
+	// The recorded output stands in for the error output when none was given
+	if failed.Stderr == "" && entry.Output.Valid {
+		failed.Stderr = entry.Output.String
+	}
+	return entry
+}
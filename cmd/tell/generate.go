@@ -0,0 +1,715 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jonfk/tell/internal/clipboard"
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/probe"
+	"github.com/jonfk/tell/internal/progress"
+	"github.com/jonfk/tell/internal/routing"
+	"github.com/jonfk/tell/internal/shellenv"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/jonfk/tell/internal/sysinfo"
+	"github.com/spf13/cobra"
+)
+
+// loadConfig loads the configuration and checks that an API key is available, exiting on failure
+func loadConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Use the provider given with --provider for this request only
+	if providerFlag != "" {
+		cfg.Provider = providerFlag
+	}
+
+	// --posix and --busybox turn on their modes for this request even when the configuration doesn't
+	if posixFlag {
+		cfg.Posix = true
+	}
+	if busyboxFlag {
+		cfg.BusyBox = true
+	}
+
+	// Commands are for PowerShell when tell runs from it or --shell pwsh is given
+	if runShell() == shellenv.PowerShell {
+		cfg.PowerShell = true
+	}
+	if cfg.PowerShell && (cfg.Posix || cfg.BusyBox) {
+		fmt.Fprintf(os.Stderr, "Error: POSIX and BusyBox modes write sh commands, they can't be combined with PowerShell\n")
+		os.Exit(1)
+	}
+
+	// Commands are for cmd.exe when tell runs from it or --shell cmd is given, unless the
+	// configuration asks for PowerShell everywhere
+	if runShell() == shellenv.Cmd && !cfg.PowerShell {
+		cfg.Cmd = true
+	}
+	if cfg.Cmd && (cfg.PowerShell || cfg.Posix || cfg.BusyBox) {
+		fmt.Fprintf(os.Stderr, "Error: cmd mode writes commands for cmd.exe, it can't be combined with PowerShell, POSIX or BusyBox modes\n")
+		os.Exit(1)
+	}
+
+	// Check if API key is set (replayed responses don't need one)
+	provider := cfg.ActiveProvider()
+	settings, err := cfg.ProviderSettings(provider)
+	if err != nil {
+		slog.Error("Invalid provider", "provider", provider, "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if config.RequiresAPIKey(provider) && settings.APIKey == "" && replayFlag == "" {
+		slog.Error("API key not set", "provider", provider)
+		fmt.Fprintf(os.Stderr, "Error: API key for provider %s not set. Run 'tell config edit' to set it.\n", provider)
+		os.Exit(1)
+	}
+
+	return cfg
+}
+
+// newLLMClient creates an LLM client configured from the global flags (progress line,
+// tracing, fixtures), after checking the monthly budget against the history in db, which may
+// be nil. The returned cleanup function must be called once the client is no longer used.
+func newLLMClient(cfg *config.Config, db *storage.DB, opts ...llm.Option) (*llm.Client, *progress.Ticker, func()) {
+	clientOpts := append([]llm.Option{}, opts...)
+
+	cleanup := func() {}
+
+	// Refuse before anything is sent once the budget is spent
+	if err := checkBudget(cfg, db); err != nil {
+		slog.Error("Request refused", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Requests after the first, e.g. regenerated commands, are held to the budget too
+	if budget != nil {
+		clientOpts = append(clientOpts, llm.WithRequestCheck(func() error {
+			return budget.allow()
+		}))
+	}
+
+	// Show a live status line while generating when attached to a terminal.
+	// Skip it in verbose mode so it doesn't interleave with log output.
+	// The ticker is created once the client knows which model it uses.
+	var ticker *progress.Ticker
+	showProgress := !verboseFlag && progress.IsTerminal(os.Stderr)
+	if showProgress {
+		clientOpts = append(clientOpts, llm.WithProgress(func(outputTokens int) {
+			ticker.SetTokens(outputTokens)
+		}))
+	}
+
+	// Write request/response traces if requested
+	traceFile, err := openTraceFile(traceFileFlag)
+	if err != nil {
+		slog.Error("Failed to open trace file", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if traceFile != nil {
+		cleanup = func() { traceFile.Close() }
+		clientOpts = append(clientOpts, llm.WithTrace(traceFile))
+	}
+
+	// Catch commands the shell can't parse before they're printed, with a POSIX shell in POSIX
+	// and BusyBox modes, ash being close to dash
+	if cfg.ValidateSyntax {
+		shell := runShell()
+		if cfg.Posix || cfg.BusyBox {
+			shell = shellenv.PosixShell()
+		}
+		clientOpts = append(clientOpts, llm.WithSyntaxCheck(shell))
+	}
+
+	// Let destructive commands through at the strict safety level
+	if forceFlag {
+		clientOpts = append(clientOpts, llm.WithForce())
+	}
+
+	// Record or replay LLM responses for development and testing
+	httpClient, err := fixtureHTTPClient(recordFlag, replayFlag)
+	if err != nil {
+		slog.Error("Failed to set up fixture transport", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if httpClient != nil {
+		clientOpts = append(clientOpts, llm.WithHTTPClient(httpClient))
+	}
+
+	client, err := llm.NewClient(cfg, clientOpts...)
+	if err != nil {
+		cleanup()
+		slog.Error("Failed to create LLM client", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if showProgress {
+		ticker = progress.NewTicker(os.Stderr, client.Model())
+	}
+
+	return client, ticker, cleanup
+}
+
+// overrideModel returns the model given with --model, or nil if the configured model should be used
+func overrideModel() *routing.Decision {
+	if modelFlag == "" {
+		return nil
+	}
+	return &routing.Decision{Model: modelFlag, Tier: routing.TierOverride, Reason: "--model flag"}
+}
+
+// routeModel picks the model for a prompt: the --model override if given, otherwise the
+// routed model when routing is enabled. Returns nil to use the configured model.
+func routeModel(cfg *config.Config, db *storage.DB, prompt string) *routing.Decision {
+	if override := overrideModel(); override != nil {
+		return override
+	}
+	// Routed models belong to the configured provider, so don't route for another one
+	if !cfg.Routing.Enabled || providerFlag != "" {
+		return nil
+	}
+
+	// Prompts that failed before go to the stronger model
+	var priorFailure bool
+	if db != nil && cfg.Routing.EscalateOnFailure {
+		var err error
+		priorFailure, err = db.HasPriorFailure(prompt)
+		if err != nil {
+			slog.Warn("Failed to check history for prior failures", "error", err)
+		}
+	}
+
+	decision := routing.Route(cfg.Routing, cfg.ActiveModel(), prompt, priorFailure)
+	slog.Debug("Routed prompt", "model", decision.Model, "tier", decision.Tier, "reason", decision.Reason)
+
+	return &decision
+}
+
+// collectContext gathers all context for a request, ranked most important first: attached
+// files, piped input, the clipboard, the tmux pane, the shell's aliases, then the context probes. text is the
+// prompt, used to find the tools it mentions. The result is fit into the context token budget.
+func collectContext(cfg *config.Config, db *storage.DB, text string) []model.ContextItem {
+	items := append(contextFiles(cfg), stdinContext(cfg)...)
+	items = append(items, clipboardContext(cfg)...)
+	items = append(items, tmuxContext(cfg)...)
+	items = append(items, aliasContext(cfg)...)
+	items = append(items, gatherContext(cfg, db, text)...)
+	return probe.Budget(items, cfg.Context.MaxTokens)
+}
+
+// gatherContext runs the context probes enabled in the configuration concurrently
+// and returns whatever they produced within their timeouts. Nothing is collected
+// from a workspace the user hasn't trusted; tool help isn't workspace data and is
+// always collected when enabled. The probes describe the local machine, so none run
+// for a command meant for a --target-host.
+func gatherContext(cfg *config.Config, db *storage.DB, text string) []model.ContextItem {
+	if targetHostFlag != "" {
+		return nil
+	}
+
+	var probes []probe.Probe
+	if cfg.Context.Cwd {
+		probes = append(probes, probe.Cwd(cfg.Context.ProbeTimeout, cfg.Context.MaxEntries))
+	}
+	if cfg.Context.Git {
+		probes = append(probes, probe.Git(cfg.Context.ProbeTimeout))
+	}
+	if cfg.Context.Atuin {
+		probes = append(probes, probe.Atuin(cfg.Context.ProbeTimeout, cfg.Context.AtuinCommands))
+	}
+	for _, command := range cfg.ContextCommands {
+		maxTokens := command.MaxTokens
+		if maxTokens <= 0 {
+			maxTokens = config.DefaultContextCommandTokens
+		}
+		probes = append(probes, probe.Command(command.Name, command.Command, cfg.Context.ProbeTimeout, maxTokens*4))
+	}
+
+	if len(probes) > 0 && cfg.Context.RequireTrust && !workspaceTrusted(db) {
+		probes = nil
+	}
+
+	// Include the usage of the tools the prompt mentions, so flags match the installed versions
+	if cfg.Context.Help {
+		for _, tool := range probe.ReferencedTools(text, cfg.Context.MaxHelpTools) {
+			probes = append(probes, probe.Help(tool, cfg.Context.ProbeTimeout, cfg.Context.MaxHelpTokens*4))
+		}
+	}
+
+	if len(probes) == 0 {
+		return nil
+	}
+
+	return probe.Gather(context.Background(), probes)
+}
+
+// targetHost describes the host given with --target-host, connecting to it over ssh,
+// or returns nil when commands are for the local system. Exits if the host can't be reached.
+func targetHost(cfg *config.Config) *sysinfo.RemoteHost {
+	if targetHostFlag != "" && targetOSFlag != "" {
+		fmt.Fprintf(os.Stderr, "Error: --target-host and --target-os can't be combined, the host's system is detected\n")
+		os.Exit(1)
+	}
+
+	// A machine known only by its operating system, e.g. a server or CI runner
+	if targetOSFlag != "" {
+		target, err := sysinfo.TargetOS(targetOSFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		slog.Debug("Generating for target OS", "system", target.OS.String())
+		return target
+	}
+
+	if targetHostFlag == "" {
+		return nil
+	}
+
+	target, err := sysinfo.DetectRemote(targetHostFlag, cfg.ToolNames(), cfg.Context.RemoteTimeout)
+	if err != nil {
+		slog.Error("Failed to describe target host", "host", targetHostFlag, "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	slog.Debug("Generating for target host", "host", target.Name, "system", target.OS.String(), "tools", target.Installed)
+	return target
+}
+
+// stdinContext returns data piped to tell, e.g. cat error.log | tell prompt "...", to send along
+// with the prompt. Nothing is read when stdin is a terminal or --no-stdin is given. Piped data
+// is sent without asking for workspace trust since the user chose to send it.
+func stdinContext(cfg *config.Config) []model.ContextItem {
+	if noStdinFlag || progress.IsTerminal(os.Stdin) {
+		return nil
+	}
+
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		slog.Warn("Failed to read stdin", "error", err)
+		return nil
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return nil
+	}
+
+	slog.Debug("Attaching piped input as context", "bytes", len(data))
+	return []model.ContextItem{{
+		Name:    "piped input",
+		Content: probe.Truncate(string(data), cfg.Context.MaxStdinBytes),
+	}}
+}
+
+// clipboardContext returns the clipboard when --paste is given, for the "I copied an error
+// message" workflow. It is truncated like piped input. Exits if the clipboard can't be read.
+func clipboardContext(cfg *config.Config) []model.ContextItem {
+	if !pasteFlag {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Context.ProbeTimeout)
+	defer cancel()
+	content, err := clipboard.Read(ctx)
+	if err != nil {
+		slog.Error("Failed to read clipboard", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if strings.TrimSpace(content) == "" {
+		fmt.Fprintf(os.Stderr, "Warning: the clipboard is empty\n")
+		return nil
+	}
+
+	slog.Debug("Attaching clipboard as context", "bytes", len(content))
+	return []model.ContextItem{{
+		Name:    "clipboard",
+		Content: probe.Truncate(content, cfg.Context.MaxStdinBytes),
+	}}
+}
+
+// tmuxContext captures the tmux pane given with --tmux-pane, so a prompt like "fix the error
+// above" can see the error. Like piped input, it is sent without asking for workspace trust.
+// Exits if the pane can't be captured.
+func tmuxContext(cfg *config.Config) []model.ContextItem {
+	if tmuxPaneFlag == "" {
+		return nil
+	}
+
+	target := tmuxPaneFlag
+	if target == currentTmuxPane {
+		target = ""
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Context.ProbeTimeout)
+	defer cancel()
+	content, err := probe.CaptureTmuxPane(ctx, target, cfg.Context.TmuxLines)
+	if err != nil {
+		slog.Error("Failed to capture tmux pane", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil
+	}
+
+	slog.Debug("Attaching tmux pane as context", "pane", tmuxPaneFlag, "bytes", len(content))
+	return []model.ContextItem{{Name: "tmux pane", Content: content}}
+}
+
+// aliasContext describes the aliases and functions of the user's shell, which the shell
+// integration passes in the environment, when context.aliases is enabled. They belong to the
+// local shell, so nothing is sent for a command meant for another host or OS.
+func aliasContext(cfg *config.Config) []model.ContextItem {
+	if !cfg.Context.Aliases || targetHostFlag != "" || targetOSFlag != "" {
+		return nil
+	}
+
+	aliases := shellenv.ParseAliases(os.Getenv(shellenv.AliasesEnvVar))
+	functions := shellenv.ParseFunctions(os.Getenv(shellenv.FunctionsEnvVar))
+	content := shellenv.DescribeAliases(aliases, functions)
+	if content == "" {
+		slog.Debug("No shell aliases to attach, they are passed by the shell integration")
+		return nil
+	}
+
+	slog.Debug("Attaching shell aliases as context", "aliases", len(aliases), "functions", len(functions))
+	return []model.ContextItem{{Name: "shell aliases", Content: content}}
+}
+
+// addTmuxPaneFlag adds --tmux-pane to cmd. Without a value it captures the pane tell runs in.
+func addTmuxPaneFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&tmuxPaneFlag, "tmux-pane", "", "Attach the contents of a tmux pane as context (default: the current pane)")
+	cmd.Flags().Lookup("tmux-pane").NoOptDefVal = currentTmuxPane
+}
+
+// contextFiles reads the files given with --context-file so the generated command matches them.
+// Each file is truncated to the configured token budget, estimated at 4 bytes per token.
+// Exits if a file can't be read or isn't text.
+func contextFiles(cfg *config.Config) []model.ContextItem {
+	var items []model.ContextItem
+	for _, path := range contextFileFlag {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("Failed to read context file", "path", path, "error", err)
+			fmt.Fprintf(os.Stderr, "Error: could not read context file: %v\n", err)
+			os.Exit(1)
+		}
+
+		// A NUL byte near the start means a binary file, which would only waste tokens
+		if bytes.IndexByte(data[:min(len(data), 8000)], 0) != -1 {
+			fmt.Fprintf(os.Stderr, "Error: context file %s is not a text file\n", path)
+			os.Exit(1)
+		}
+
+		slog.Debug("Attaching file as context", "path", path, "bytes", len(data))
+		items = append(items, model.ContextItem{
+			Name:    "file " + path,
+			Content: probe.Truncate(string(data), cfg.Context.MaxFileTokens*4),
+		})
+	}
+
+	return items
+}
+
+// withProgress runs generate while the status line is shown, clearing it before returning
+func withProgress(ticker *progress.Ticker, generate func()) {
+	if ticker == nil {
+		generate()
+		return
+	}
+
+	ticker.Start()
+	generate()
+	ticker.Stop()
+}
+
+// saveHistory records a generation result in the history database if available, after warning
+// about the monthly budget, and returns the ID of the new entry, or 0 if it wasn't saved
+func saveHistory(
+	db *storage.DB,
+	prompt string,
+	response *model.CommandResponse,
+	usage *model.LLMUsage,
+	genErr error,
+	parentID sql.NullInt64,
+	entryType string,
+) int64 {
+	if db == nil {
+		return 0
+	}
+
+	// Warn before saving, so the warning isn't lost when the history can't be written
+	if budget != nil && usage != nil {
+		warnBudget(response, usage, entryType)
+	}
+
+	var errorMsg string
+	if genErr != nil {
+		errorMsg = genErr.Error()
+	}
+
+	id, err := db.AddHistoryEntry(
+		prompt,
+		response,
+		usage,
+		errorMsg,
+		parentID,
+		entryType,
+	)
+	if err != nil {
+		slog.Error("Failed to save to history", "error", err)
+		return 0
+	}
+
+	return id
+}
+
+// warnIfPreviouslyFailed adds a warning to the response when the generated command is
+// the same as one that already failed when the user ran it, or close to it
+func warnIfPreviouslyFailed(db *storage.DB, response *model.CommandResponse) {
+	if db == nil || response == nil {
+		return
+	}
+
+	entry, err := db.FindFailedExecution(response.Command)
+	if err != nil {
+		slog.Warn("Failed to check history for failed executions", "error", err)
+		return
+	}
+	if entry == nil {
+		return
+	}
+
+	failedAt := entry.Timestamp
+	if entry.ExecutedAt.Valid {
+		failedAt = entry.ExecutedAt.Time
+	}
+	if strings.Join(strings.Fields(entry.Command), " ") == strings.Join(strings.Fields(response.Command), " ") {
+		response.AddWarning(model.WarningPreviouslyFailed, fmt.Sprintf(
+			"This exact command failed for you on %s (exit code %d, history entry %d)",
+			failedAt.Format("Jan 2"), entry.ExitCode.Int64, entry.ID))
+		return
+	}
+	response.AddWarning(model.WarningPreviouslyFailed, fmt.Sprintf(
+		"A similar command failed for you on %s (exit code %d, history entry %d): %s",
+		failedAt.Format("Jan 2"), entry.ExitCode.Int64, entry.ID, entry.Command))
+}
+
+// blockingWarnings are the warning kinds that keep a command off the command line at the strict
+// safety level; notices about continuations and placeholders don't
+var blockingWarnings = map[string]bool{
+	model.WarningImpact:           true,
+	model.WarningPreviouslyFailed: true,
+	model.WarningSyntax:           true,
+	model.WarningRoot:             true,
+	model.WarningDestructive:      true,
+	model.WarningCoreutils:        true,
+}
+
+// machineFormat reports whether --format selects output read by a program, such as the shell
+// integration, rather than by a person
+func machineFormat() bool {
+	return formatFlag == "json" || formatFlag == "shell" || formatFlag == "fish"
+}
+
+// formatShellResponse formats a generated command as assignments to tell_command, tell_details,
+// tell_undo, tell_warnings, tell_blocked and tell_history_id for bash and zsh to eval, or as set
+// commands for fish with --format fish, so the shell integration needs no JSON parser. Values are
+// single quoted; details are empty unless they should be shown, warnings are one message per
+// line and tell_blocked is 1 or 0.
+func formatShellResponse(response *model.CommandResponse, fish bool) string {
+	quote := func(value string) string {
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	}
+	assignment := "%s=%s\n"
+	if fish {
+		// Backslashes are escapes in fish's single quotes
+		quote = func(value string) string {
+			return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+		}
+		assignment = "set %s %s\n"
+	}
+
+	var details string
+	if response.ShowDetails {
+		details = response.Details
+	}
+	messages := make([]string, len(response.Warnings))
+	for i, warning := range response.Warnings {
+		messages[i] = warning.Message
+	}
+	blocked := "0"
+	if response.Blocked {
+		blocked = "1"
+	}
+	var historyID string
+	if response.HistoryID != 0 {
+		historyID = strconv.FormatInt(response.HistoryID, 10)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, assignment, "tell_command", quote(response.Command))
+	fmt.Fprintf(&sb, assignment, "tell_details", quote(details))
+	fmt.Fprintf(&sb, assignment, "tell_undo", quote(response.Undo))
+	fmt.Fprintf(&sb, assignment, "tell_warnings", quote(strings.Join(messages, "\n")))
+	fmt.Fprintf(&sb, assignment, "tell_blocked", blocked)
+	fmt.Fprintf(&sb, assignment, "tell_history_id", historyID)
+	return sb.String()
+}
+
+// markBlocked blocks commands with warnings at the strict safety level, unless --force is
+// given: the shell integration shows them without putting them on the command line
+func markBlocked(cfg *config.Config, response *model.CommandResponse) {
+	if cfg.Safety() != config.SafetyStrict || forceFlag {
+		return
+	}
+	for _, warning := range response.Warnings {
+		if blockingWarnings[warning.Kind] {
+			response.Blocked = true
+		}
+	}
+}
+
+// printCommandResponse prints a generated command in the format selected by --format
+func printCommandResponse(cfg *config.Config, response *model.CommandResponse, usage *model.LLMUsage) {
+	markBlocked(cfg, response)
+
+	// Copy the command with --copy, unless it is kept off the command line
+	copied := false
+	if copyFlag && response.Command != "" && !response.Blocked {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Context.ProbeTimeout)
+		err := clipboard.Write(ctx, response.Command)
+		cancel()
+		if err != nil {
+			slog.Error("Failed to copy command", "error", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		copied = true
+	}
+
+	// Display debug info if requested
+	if verboseFlag && usage != nil {
+		fmt.Fprintf(os.Stderr, "Model: %s\n", usage.Model)
+		if usage.Route != "" {
+			fmt.Fprintf(os.Stderr, "Route: %s\n", usage.Route)
+		}
+		if usage.Retries > 0 {
+			fmt.Fprintf(os.Stderr, "Retried: %d times\n", usage.Retries)
+		}
+		fmt.Fprintf(os.Stderr, "Tokens used: input=%d, output=%d\n", usage.InputTokens, usage.OutputTokens)
+		if cost := requestCost(cfg, usage.Model, usage.InputTokens, usage.OutputTokens); cost != "" {
+			fmt.Fprintf(os.Stderr, "Cost: %s\n", cost)
+		}
+	}
+
+	// Handle output based on format
+	if formatFlag == "json" {
+		// Output JSON
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			slog.Error("Failed to marshal response to JSON", "error", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+		return
+	}
+	if formatFlag == "shell" || formatFlag == "fish" {
+		fmt.Print(formatShellResponse(response, formatFlag == "fish"))
+		return
+	}
+
+	// Output text format. Warnings go to stderr so the command can still be captured from stdout
+	for _, warning := range response.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning.Message)
+	}
+	if noExplainFlag {
+		// Just print the command
+		fmt.Println(response.Command)
+	} else {
+		// Print command and explanation
+		fmt.Println(response.Command)
+		fmt.Println()
+		if response.ShowDetails {
+			fmt.Println(response.Details)
+		}
+	}
+	if response.Undo != "" {
+		fmt.Fprintf(os.Stderr, "Undo: %s\n", response.Undo)
+	}
+	if copied {
+		fmt.Fprintf(os.Stderr, "Copied to the clipboard.\n")
+	}
+	if response.Analysis != nil {
+		// The command is already followed by a blank line unless details were printed after it
+		if noExplainFlag || response.ShowDetails {
+			fmt.Println()
+		}
+		fmt.Print(formatAnalysis(response.Analysis))
+	}
+}
+
+// continuationChain returns the commands a prompt made with --continue follows, oldest first:
+// the history entry with the given ID, or the most recent successful command for 0, and the
+// entries it continues. Failed entries are skipped, and the oldest are left out once the chain
+// is larger than context.max_conversation_tokens.
+func continuationChain(cfg *config.Config, db *storage.DB, id int64) ([]model.HistoryEntry, error) {
+	if id == 0 {
+		entry, err := db.GetMostRecentSuccessfulCommand()
+		if err != nil {
+			return nil, err
+		}
+		id = entry.ID
+	}
+
+	chain, err := db.GetEntryChain(id)
+	if err != nil {
+		return nil, err
+	}
+	last := chain[len(chain)-1]
+	if last.EntryType != model.EntryTypeCommand || last.Command == "" || last.ErrorMessage != "" {
+		return nil, fmt.Errorf("history entry %d has no command to continue from", id)
+	}
+
+	var previous []model.HistoryEntry
+	tokens := 0
+	for i := len(chain) - 1; i >= 0; i-- {
+		entry := chain[i]
+		if entry.EntryType != model.EntryTypeCommand || entry.Command == "" || entry.ErrorMessage != "" {
+			continue
+		}
+		// The entry continued from is always sent
+		tokens += probe.EstimateTokens(entry.Prompt + entry.Command + entry.Details)
+		if len(previous) > 0 && tokens > cfg.Context.MaxConversationTokens {
+			slog.Debug("Leaving older commands out of the conversation", "from", entry.ID)
+			break
+		}
+		previous = append([]model.HistoryEntry{entry}, previous...)
+	}
+
+	slog.Debug("Continuing from previous command", "id", id, "chain", len(previous))
+	return previous, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/jonfk/tell/internal/fault"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/storage/storagetest"
+)
+
+func TestFaultDBLockHistoryWritesFailSoft(t *testing.T) {
+	db := storagetest.Open(t)
+	response := &model.CommandResponse{Command: "ls -la", Details: "Lists all files"}
+	usage := &model.LLMUsage{Model: "mistral-small-latest", InputTokens: 100, OutputTokens: 20}
+
+	t.Setenv(fault.EnvVar, "")
+	saved := saveHistory(db, "list files", response, usage, nil, sql.NullInt64{}, model.EntryTypeCommand)
+	if saved == 0 {
+		t.Fatal("saveHistory = 0 without the fault, want the new entry's ID")
+	}
+
+	t.Setenv(fault.EnvVar, fault.DBLock)
+
+	// The storage layer reports the lock...
+	_, err := db.AddHistoryEntry("list files", response, usage, "", sql.NullInt64{}, model.EntryTypeCommand)
+	if err == nil || !strings.Contains(err.Error(), "database is locked") {
+		t.Fatalf("AddHistoryEntry error = %v, want database is locked", err)
+	}
+
+	// ...and the command still gets its response, just without a history entry
+	if id := saveHistory(db, "list files", response, usage, nil, sql.NullInt64{}, model.EntryTypeCommand); id != 0 {
+		t.Errorf("saveHistory = %d, want 0 when the history can't be written", id)
+	}
+
+	// Reading the history isn't affected by the lock
+	entry, err := db.GetHistoryEntry(saved)
+	if err != nil {
+		t.Fatalf("GetHistoryEntry: %v", err)
+	}
+	if entry.Command != "ls -la" {
+		t.Errorf("command = %q, want %q", entry.Command, "ls -la")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// newHistoryImportCmd creates the history import command, which merges a JSON export into the
+// history
+func newHistoryImportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import history exported as JSON",
+		Long: `Merge history exported with 'tell history export' into this machine's history, keeping the
+timestamps, tags, favorites and how commands ran. Entries already in the history, with the same time,
+prompt, command and details, are skipped, so importing the same file twice adds nothing. Use - to read
+from stdin.`,
+		Example: `  tell history export > tell-history.json   # on the old machine
+  tell history import tell-history.json     # on the new one`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			export, err := readHistoryExport(args[0])
+			if err != nil {
+				slog.Error("Failed to read history export", "path", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			entries := make([]model.HistoryEntry, 0, len(export.Entries))
+			for _, exported := range export.Entries {
+				entries = append(entries, importedEntry(exported))
+			}
+
+			imported, err := db.ImportHistory(entries)
+			if err != nil {
+				slog.Error("Failed to import history", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Imported %d entries, skipped %d already in history.\n", imported, len(entries)-imported)
+		},
+	}
+}
+
+// readHistoryExport reads a document written by 'tell history export --format json' from path,
+// or from stdin for -
+func readHistoryExport(path string) (*historyExport, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	var export historyExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("could not parse %s, expected JSON from 'tell history export': %w", path, err)
+	}
+	if export.Version == 0 || export.Version > historyExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d in %s, this tell reads version %d", export.Version, path, historyExportVersion)
+	}
+
+	return &export, nil
+}
+
+// importedEntry turns an entry of a JSON export back into a history entry. Entries exported
+// without a type are commands.
+func importedEntry(exported exportedEntry) model.HistoryEntry {
+	entry := model.HistoryEntry{
+		ID:           exported.ID,
+		UID:          exported.UID,
+		Timestamp:    exported.Timestamp,
+		EntryType:    exported.EntryType,
+		Prompt:       exported.Prompt,
+		Command:      exported.Command,
+		Details:      exported.Details,
+		ShowDetails:  exported.ShowDetails,
+		Undo:         exported.Undo,
+		ErrorMessage: exported.Error,
+		Model:        exported.Model,
+		InputTokens:  exported.InputTokens,
+		OutputTokens: exported.OutputTokens,
+		Favorite:     exported.Favorite,
+		Shortcut:     exported.Shortcut,
+		TimedOut:     exported.TimedOut,
+		Outcome:      exported.Outcome,
+		RanCommand:   exported.RanCommand,
+		Edited:       exported.Edited,
+		UseCount:     exported.UseCount,
+	}
+	if entry.EntryType == "" {
+		entry.EntryType = model.EntryTypeCommand
+	}
+
+	// Tags are checked like the ones given to 'tell history tag'
+	for _, tag := range exported.Tags {
+		if normalized, err := normalizeTag(tag); err == nil {
+			entry.Tags = append(entry.Tags, normalized)
+		}
+	}
+
+	if exported.ParentID != nil {
+		entry.ParentID = sql.NullInt64{Int64: *exported.ParentID, Valid: true}
+	}
+	if exported.ExitCode != nil {
+		entry.ExitCode = sql.NullInt64{Int64: *exported.ExitCode, Valid: true}
+	}
+	if exported.ExecutedAt != nil {
+		entry.ExecutedAt = sql.NullTime{Time: *exported.ExecutedAt, Valid: true}
+	}
+	if exported.LastUsedAt != nil {
+		entry.LastUsedAt = sql.NullTime{Time: *exported.LastUsedAt, Valid: true}
+	}
+	if exported.DurationMS != nil {
+		entry.DurationMS = sql.NullInt64{Int64: *exported.DurationMS, Valid: true}
+	}
+	if exported.Output != nil {
+		entry.Output = sql.NullString{String: *exported.Output, Valid: true}
+	}
+
+	return entry
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jonfk/tell/internal/clipboard"
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/progress"
+	"github.com/jonfk/tell/internal/storage"
+)
+
+// interactiveMenu lists the choices offered after each generated command
+const interactiveMenu = "[r]un, [t]ry in sandbox, [e]dit and run, [c]opy, [g]enerate again, [q]uit:"
+
+// interactiveLoop shows a generated command on the terminal and lets the user run it, try it
+// in a sandbox, edit it and run it, copy it, or generate it again with feedback, until they
+// pick anything but try or generate. Regenerated and edited commands are saved to history as children of the command
+// they replace, and executions are recorded like with --run.
+func interactiveLoop(
+	cfg *config.Config,
+	db *storage.DB,
+	client *llm.Client,
+	ticker *progress.Ticker,
+	prompt string,
+	previous []model.HistoryEntry,
+	response *model.CommandResponse,
+	entryID int64,
+) {
+	tty, err := openTTY()
+	if err != nil {
+		slog.Error("No terminal for interactive mode", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: --interactive needs a terminal: %v\n", err)
+		os.Exit(1)
+	}
+	defer tty.Close()
+
+	var attempts []model.RejectedAttempt
+	for {
+		showCommand(tty, response)
+
+		choice, err := askLine(tty, interactiveMenu)
+		if err != nil {
+			return
+		}
+
+		switch strings.ToLower(choice) {
+		case "r", "run":
+			runAndRecord(cfg, db, tty, response.Command, entryID)
+			return
+
+		case "t", "try":
+			trialRun(cfg, tty, response.Command)
+
+		case "e", "edit":
+			edited, err := editCommand(tty, response.Command)
+			if err != nil {
+				slog.Error("Failed to edit command", "error", err)
+				fmt.Fprintf(tty, "Error: %v\n", err)
+				continue
+			}
+			if edited == "" {
+				fmt.Fprintf(tty, "The command is empty, not running it.\n")
+				continue
+			}
+
+			// Keep the edited command in history, since it's the one that was run
+			editedID := entryID
+			if edited != response.Command {
+				editedID = saveHistory(db, prompt, &model.CommandResponse{Command: edited}, nil, nil,
+					sql.NullInt64{Int64: entryID, Valid: entryID != 0}, model.EntryTypeCommand)
+			}
+			runAndRecord(cfg, db, tty, edited, editedID)
+			return
+
+		case "c", "copy":
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Context.ProbeTimeout)
+			err := clipboard.Write(ctx, response.Command)
+			cancel()
+			if err != nil {
+				slog.Error("Failed to copy command", "error", err)
+				fmt.Fprintf(tty, "Error: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(tty, "Copied to the clipboard.\n")
+			return
+
+		case "g", "generate":
+			feedback, err := askLine(tty, "What should change? (empty to just try again)")
+			if err != nil {
+				return
+			}
+			attempts = append(attempts, model.RejectedAttempt{Response: response, Feedback: feedback})
+
+			var regenerated *model.CommandResponse
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				regenerated, usage, genErr = client.RefineCommand(prompt, previous, attempts)
+			})
+
+			// The feedback is the prompt of the new attempt, which continues the rejected one
+			attemptPrompt := prompt
+			if feedback != "" {
+				attemptPrompt = feedback
+			}
+			warnIfPreviouslyFailed(db, regenerated)
+			newID := saveHistory(db, attemptPrompt, regenerated, usage, genErr,
+				sql.NullInt64{Int64: entryID, Valid: entryID != 0}, model.EntryTypeCommand)
+
+			if genErr != nil {
+				slog.Error("Failed to regenerate command", "error", genErr)
+				fmt.Fprintf(tty, "Error: %v\n", genErr)
+				attempts = attempts[:len(attempts)-1]
+				continue
+			}
+			fillPlaceholders(regenerated)
+			response, entryID = regenerated, newID
+
+		case "q", "quit", "":
+			return
+
+		default:
+			fmt.Fprintf(tty, "Unknown choice %q.\n", choice)
+		}
+	}
+}
+
+// showCommand prints a generated command, its warnings and explanation on the terminal
+func showCommand(tty *terminal, response *model.CommandResponse) {
+	fmt.Fprintf(tty, "\n%s\n\n", response.Command)
+	for _, warning := range response.Warnings {
+		fmt.Fprintf(tty, "Warning: %s\n", warning.Message)
+	}
+	if response.ShowDetails && !noExplainFlag {
+		fmt.Fprintf(tty, "%s\n\n", response.Details)
+	}
+	if response.Undo != "" {
+		fmt.Fprintf(tty, "Undo: %s\n\n", response.Undo)
+	}
+	if response.Analysis != nil {
+		fmt.Fprintf(tty, "%s\n", formatAnalysis(response.Analysis))
+	}
+}
+
+// editCommand opens command in the user's editor ($VISUAL, $EDITOR, or vi) on the terminal
+// and returns the edited command
+func editCommand(tty *terminal, command string) (string, error) {
+	return editText(tty, command, "tell-*.sh")
+}
+
+// editText opens text in the user's editor on the terminal, in a temporary file named after
+// pattern so the editor can tell its syntax, and returns the edited text
+func editText(tty *terminal, text string, pattern string) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("could not create file to edit: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(text + "\n"); err != nil {
+		file.Close()
+		return "", fmt.Errorf("could not write file to edit: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("could not write file to edit: %w", err)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// Run the editor through sh so editors configured with arguments (code --wait) work
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", file.Name())
+	cmd.Stdin = tty.in
+	cmd.Stdout = tty.out
+	cmd.Stderr = tty.out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("could not run editor %s: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("could not read edited file: %w", err)
+	}
+
+	return strings.TrimSpace(string(edited)), nil
+}
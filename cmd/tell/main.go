@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -14,26 +16,67 @@ import (
 	"github.com/jonfk/tell/internal/config"
 	"github.com/jonfk/tell/internal/llm"
 	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/placeholder"
 	"github.com/jonfk/tell/internal/shellenv"
 	"github.com/jonfk/tell/internal/storage"
+	"github.com/jonfk/tell/internal/xdg"
 	"github.com/spf13/cobra"
 )
 
 var (
 	// Flags
-	verboseFlag   bool
-	formatFlag    string
-	shellFlag     string
-	noExplainFlag bool
-	initFlag      bool
-	versionFlag   bool
-	limitFlag     int
-	favoriteFlag  bool
-	continueFlag  bool
+	verboseFlag     bool
+	formatFlag      string
+	shellFlag       string
+	noExplainFlag   bool
+	noStdinFlag     bool
+	contextFileFlag []string
+	targetHostFlag  string
+	targetOSFlag    string
+	tmuxPaneFlag    string
+	pasteFlag       bool
+	copyFlag        bool
+	runFlag         bool
+	interactiveFlag bool
+	analyzeFlag     bool
+	sandboxFlag     bool
+	varFlag         []string
+	withUndoFlag    bool
+	autoFixFlag     int
+	timeoutFlag     time.Duration
+	forceFlag       bool
+	posixFlag       bool
+	busyboxFlag     bool
+	initFlag        bool
+	versionFlag     bool
+	limitFlag       int
+	offsetFlag      int
+	pageFlag        int
+	sortFlag        string
+	uniqueFlag      bool
+	favoriteFlag    bool
+	shortcutFlag    string
+	continueFlag    int64
+	entryTypeFlag   string
+	modelFlag       string
+	providerFlag    string
+	printPathFlag   bool
+	envJSONFlag     bool
+	installFlag     bool
+	uninstallFlag   bool
+	traceFileFlag   string
+	recordFlag      string
+	replayFlag      string
+	overBudgetFlag  bool
+	semanticFlag    bool
+	tagFlag         string
 )
 
 const version = "0.1.0"
 
+// currentTmuxPane is the --tmux-pane value given without a target, meaning the pane tell runs in
+const currentTmuxPane = "current"
+
 func main() {
 	// Initially disable logging completely by using a no-op handler
 	// Logging is only enabled if debugFlag is set
@@ -65,6 +108,12 @@ func main() {
 
 	// Add global flags
 	rootCmd.PersistentFlags().BoolVarP(&verboseFlag, "verbose", "v", false, "Enable verbose logging to stderr")
+	rootCmd.PersistentFlags().StringVar(&traceFileFlag, "trace-file", "", "Write full LLM requests and raw responses to this file (or set TELL_TRACE=1)")
+	rootCmd.PersistentFlags().StringVar(&recordFlag, "record", "", "Record LLM responses as fixtures into this directory")
+	rootCmd.PersistentFlags().StringVar(&replayFlag, "replay", "", "Replay LLM responses from fixtures in this directory instead of calling the API")
+	rootCmd.PersistentFlags().BoolVar(&overBudgetFlag, "over-budget", false, "Send requests even though the monthly budget is spent and budget_hard_cap is set")
+	rootCmd.PersistentFlags().MarkHidden("record")
+	rootCmd.PersistentFlags().MarkHidden("replay")
 	rootCmd.Flags().BoolVarP(&initFlag, "init", "i", false, "Create default configuration file")
 	rootCmd.Flags().BoolVarP(&versionFlag, "version", "", false, "Show version information")
 
@@ -74,24 +123,51 @@ func main() {
 		Long:  "Convert a natural language description into appropriate shell commands",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			// --continue takes an optional history ID, given as --continue=42: the word after a bare
+			// --continue is the prompt, even a number, as in --continue 10 largest files
+			continuing := cmd.Flags().Changed("continue")
+			if continueFlag < 0 {
+				fmt.Fprintf(os.Stderr, "Error: invalid history ID for --continue: %d\n", continueFlag)
+				os.Exit(1)
+			}
+
 			// Join all args to form the prompt
 			prompt := strings.Join(args, " ")
 
-			// Load configuration
-			cfg, err := config.Load()
-			if err != nil {
-				slog.Error("Failed to load configuration", "error", err)
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if autoFixFlag < 0 {
+				fmt.Fprintf(os.Stderr, "Error: --auto-fix must be a positive number of attempts\n")
+				os.Exit(1)
+			}
+			// --auto-fix runs the command like --run
+			running := runFlag || sandboxFlag || autoFixFlag > 0
+			if (running || interactiveFlag) && machineFormat() {
+				fmt.Fprintf(os.Stderr, "Error: --run, --sandbox, --auto-fix and --interactive can't be combined with --format json or shell\n")
+				os.Exit(1)
+			}
+			if (running || interactiveFlag) && targetOSFlag != "" {
+				fmt.Fprintf(os.Stderr, "Error: --run, --sandbox, --auto-fix and --interactive can't be combined with --target-os, the command is meant for another system\n")
+				os.Exit(1)
+			}
+			if copyFlag && (running || interactiveFlag) {
+				fmt.Fprintf(os.Stderr, "Error: --copy can't be combined with --run, --sandbox, --auto-fix or --interactive, which offers to copy the command\n")
+				os.Exit(1)
+			}
+			if running && interactiveFlag {
+				fmt.Fprintf(os.Stderr, "Error: --run, --sandbox and --auto-fix can't be combined with --interactive, which offers to run or try the command\n")
 				os.Exit(1)
 			}
 
-			// Check if API key is set
-			if cfg.AnthropicAPIKey == "" {
-				slog.Error("Anthropic API key not set")
-				fmt.Fprintf(os.Stderr, "Error: Anthropic API key not set. Run 'tell config edit' to set it.\n")
+			if _, err := placeholder.ParseVars(varFlag); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 				os.Exit(1)
 			}
 
+			// Load configuration
+			cfg := loadConfig()
+			if cmd.Flags().Changed("timeout") {
+				cfg.Run.Timeout = timeoutFlag
+			}
+
 			// Initialize database
 			db, err := initializeDatabase()
 			if err != nil {
@@ -99,63 +175,91 @@ func main() {
 				// Don't exit if just the database fails; we can still generate the command
 			}
 
-			// Create LLM client
-			client := llm.NewClient(cfg)
+			// The same prompt as last time means the user wants another attempt
+			regenerating := isRegenerate(db, prompt)
+
+			// Create LLM client, sending the prompt to the --model override or the routed model
+			contextItems := collectContext(cfg, db, prompt)
+			clientOpts := []llm.Option{llm.WithContext(contextItems)}
+			if target := targetHost(cfg); target != nil {
+				clientOpts = append(clientOpts, llm.WithTargetHost(target))
+			}
+			route := routeModel(cfg, db, prompt)
+			if route != nil {
+				clientOpts = append(clientOpts, llm.WithModel(route.Model))
+			}
+			if withUndoFlag {
+				clientOpts = append(clientOpts, llm.WithUndo())
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
 
 			// Variables for parent tracking
 			var parentID sql.NullInt64
 			parentID.Valid = false
 
-			// Generate command
-			var response *model.CommandResponse
-			var usage *model.LLMUsage
-			var genErr error
-
-			// Handle continue flag
-			if continueFlag && db != nil {
-				// Get most recent successful command
-				previousEntry, prevErr := db.GetMostRecentSuccessfulCommand()
+			// Handle continue flag, or continue the conversation of the session prompts are made in
+			var previous []model.HistoryEntry
+			var session *model.Session
+			if continuing && db != nil {
+				var prevErr error
+				previous, prevErr = continuationChain(cfg, db, continueFlag)
 				if prevErr != nil {
-					slog.Error("Failed to get previous command", "error", prevErr)
+					slog.Error("Failed to get previous command", "id", continueFlag, "error", prevErr)
 					fmt.Fprintf(os.Stderr, "Error: Failed to get previous command: %v\n", prevErr)
 					os.Exit(1)
 				}
+			} else if db != nil {
+				session, previous = sessionConversation(db)
+			}
 
-				slog.Debug("Continuing from previous command", "id", previousEntry.ID)
-				fmt.Fprintf(os.Stderr, "Continuing from previous command: %s\n", previousEntry.Command)
-
-				// Generate command as continuation
-				response, usage, genErr = client.GenerateCommandContinuation(prompt, previousEntry)
-
-				// Set parent ID
+			// Set parent ID
+			if len(previous) > 0 {
 				parentID.Valid = true
-				parentID.Int64 = previousEntry.ID
-			} else {
-				// Normal command generation
-				response, usage, genErr = client.GenerateCommand(prompt)
+				parentID.Int64 = previous[len(previous)-1].ID
 			}
 
-			// Log to database if available
-			if db != nil {
-				var errorMsg string
-				if genErr != nil {
-					errorMsg = genErr.Error()
+			// Generate command, as a continuation of the previous ones if requested
+			generate := func(client *llm.Client) (*model.CommandResponse, *model.LLMUsage, error) {
+				if len(previous) == 0 {
+					return client.GenerateCommand(prompt)
 				}
 
-				_, dbErr := db.AddHistoryEntry(
-					prompt,
-					response,
-					usage,
-					errorMsg,
-					parentID, // Include parent ID
-				)
-
-				if dbErr != nil {
-					slog.Error("Failed to save to history", "error", dbErr)
+				response, usage, err := client.GenerateCommandContinuation(prompt, previous)
+				if response != nil && session != nil {
+					response.AddWarning(model.WarningContinuation,
+						fmt.Sprintf("Continuing session %q after: %s", session.Name, previous[len(previous)-1].Command))
+				} else if response != nil {
+					response.AddWarning(model.WarningContinuation,
+						fmt.Sprintf("Continuing from previous command: %s", previous[len(previous)-1].Command))
 				}
+				return response, usage, err
+			}
 
-				// Close database connection after use
-				db.Close()
+			var response *model.CommandResponse
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				response, usage, genErr = generate(client)
+			})
+
+			// Record how the model was picked
+			if route != nil && usage != nil {
+				usage.Route = route.Tier
+			}
+
+			// Log to database if available
+			var entryID int64
+			if db != nil {
+				defer db.Close()
+				warnIfPreviouslyFailed(db, response)
+				entryID = saveHistory(db, prompt, response, usage, genErr, parentID, model.EntryTypeCommand)
+				// The first entry of a session has no parent it would join it through
+				if session != nil && entryID != 0 {
+					if err := db.AddToSession(entryID, session.ID); err != nil {
+						slog.Warn("Failed to add entry to session", "id", entryID, "session", session.ID, "error", err)
+					}
+				}
 			}
 
 			// Handle command generation error after attempting to log it
@@ -165,44 +269,68 @@ func main() {
 				os.Exit(1)
 			}
 
-			// Display debug info if requested
-			if verboseFlag && usage != nil {
-				fmt.Fprintf(os.Stderr, "Model: %s\n", usage.Model)
-				fmt.Fprintf(os.Stderr, "Tokens used: input=%d, output=%d\n", usage.InputTokens, usage.OutputTokens)
+			// Offer a stronger model when the user keeps regenerating the same prompt
+			if regenerating && canOfferEscalation() {
+				response, usage, entryID = offerEscalation(cfg, db, contextItems, generate, prompt,
+					client.Model(), response, usage, entryID)
 			}
 
-			// Handle output based on format
-			if formatFlag == "json" {
-				// Output JSON
-				jsonData, err := json.Marshal(response)
+			// Ask for the values of placeholders such as {{filename}}; history keeps the template
+			fillPlaceholders(response)
+
+			// List the command's side effects before the user decides to run it
+			if analyzeFlag {
+				analysis, _, err := analyzeCommand(db, client, ticker, response.Command, entryID)
 				if err != nil {
-					slog.Error("Failed to marshal response to JSON", "error", err)
-					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-					os.Exit(1)
-				}
-				fmt.Println(string(jsonData))
-			} else {
-				// Output text format
-				if noExplainFlag {
-					// Just print the command
-					fmt.Println(response.Command)
-				} else {
-					// Print command and explanation
-					fmt.Println(response.Command)
-					fmt.Println()
-					if response.ShowDetails {
-						fmt.Println(response.Details)
-					}
+					slog.Warn("Failed to analyze command", "error", err)
+					fmt.Fprintf(os.Stderr, "Warning: could not analyze the command: %v\n", err)
 				}
+				response.Analysis = analysis
+			}
+
+			// Let the user run, edit, copy or regenerate the command from a menu
+			if interactiveFlag {
+				interactiveLoop(cfg, db, client, ticker, prompt, previous, response, entryID)
+				return
 			}
+
+			// Run the command right away when asked to, instead of handing it to the shell
+			if running {
+				runGenerated(cfg, db, client, ticker, response, usage, entryID)
+				return
+			}
+
+			response.HistoryID = entryID
+			printCommandResponse(cfg, response, usage)
 		},
 	}
 
 	// Add flags to prompt command
-	promptCmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json")
-	promptCmd.Flags().StringVarP(&shellFlag, "shell", "s", "auto", "Target shell: zsh|bash|fish")
+	promptCmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json|shell|fish")
+	promptCmd.Flags().StringVarP(&shellFlag, "shell", "s", "auto", "Target shell: zsh|bash|fish|pwsh|cmd")
 	promptCmd.Flags().BoolVarP(&noExplainFlag, "no-explain", "n", false, "Skip command explanation")
-	promptCmd.Flags().BoolVarP(&continueFlag, "continue", "c", false, "Continue from the most recent successful command")
+	promptCmd.Flags().StringArrayVarP(&contextFileFlag, "context-file", "F", nil, "Attach a file as context (repeatable)")
+	promptCmd.Flags().BoolVar(&noStdinFlag, "no-stdin", false, "Don't send data piped to stdin as context")
+	promptCmd.Flags().BoolVar(&pasteFlag, "paste", false, "Attach the clipboard as context")
+	addTmuxPaneFlag(promptCmd)
+	promptCmd.Flags().StringVar(&targetHostFlag, "target-host", "", "Generate the command for this SSH host instead of the local system")
+	promptCmd.Flags().StringVar(&targetOSFlag, "target-os", "", "Generate the command for this OS or distribution (linux, macos, ubuntu:22.04, ...) instead of the local system")
+	promptCmd.Flags().BoolVar(&runFlag, "run", false, "Ask for confirmation, then run the command")
+	promptCmd.Flags().BoolVar(&copyFlag, "copy", false, "Also copy the command to the clipboard")
+	promptCmd.Flags().BoolVar(&posixFlag, "posix", false, "Only use POSIX sh syntax and POSIX utility flags (default: posix in config)")
+	promptCmd.Flags().BoolVar(&busyboxFlag, "busybox", false, "Only use BusyBox applets and the options they support (default: busybox in config)")
+	promptCmd.Flags().BoolVar(&forceFlag, "force", false, "Allow destructive commands and commands with warnings when safety_level is strict")
+	promptCmd.Flags().StringArrayVar(&varFlag, "var", nil, "Value of a placeholder in the command, as name=value (repeatable)")
+	promptCmd.Flags().BoolVar(&sandboxFlag, "sandbox", false, "Try the command in a sandbox without network or write access, then ask to run it for real")
+	promptCmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Stop the command if it runs longer than this, e.g. 30s (default: run.timeout)")
+	promptCmd.Flags().IntVar(&autoFixFlag, "auto-fix", 0, "Run the command, and when it fails ask for a fix and offer to run it, up to this many times")
+	promptCmd.Flags().BoolVar(&withUndoFlag, "with-undo", false, "Also generate a command that reverses the command's changes")
+	promptCmd.Flags().BoolVar(&analyzeFlag, "analyze", false, "List the command's side effects: files written or deleted, network access, privileges")
+	promptCmd.Flags().BoolVar(&interactiveFlag, "interactive", false, "Choose to run, edit, copy or regenerate the command from a menu")
+	promptCmd.Flags().Int64VarP(&continueFlag, "continue", "c", 0, "Continue from the most recent successful command, or with --continue=ID from this history entry and the commands it continues")
+	promptCmd.Flags().Lookup("continue").NoOptDefVal = "0"
+	promptCmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	promptCmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
 
 	// History command
 	historyCmd := &cobra.Command{
@@ -223,14 +351,97 @@ func main() {
 			}
 			defer db.Close()
 
-			var entries []model.HistoryEntry
+			// Only commands are listed unless asked otherwise; "all" lists every entry type
+			entryType := entryTypeFlag
+			switch entryType {
+			case "all":
+				entryType = ""
+			case model.EntryTypeCommand, model.EntryTypeAnswer, model.EntryTypeSummary, model.EntryTypeExplanation, model.EntryTypeAnalysis, model.EntryTypeScript:
+			default:
+				fmt.Fprintf(os.Stderr, "Error: invalid entry type %q (expected command, answer, summary, explanation, analysis, script or all)\n", entryTypeFlag)
+				os.Exit(1)
+			}
+			if formatFlag != "text" && formatFlag != "picker" {
+				fmt.Fprintf(os.Stderr, "Error: invalid format %q (expected text or picker)\n", formatFlag)
+				os.Exit(1)
+			}
+
+			if sortFlag != model.HistorySortRecent && sortFlag != model.HistorySortUsed {
+				fmt.Fprintf(os.Stderr, "Error: invalid sort %q (expected recent or used)\n", sortFlag)
+				os.Exit(1)
+			}
+			if sortFlag != model.HistorySortRecent && query != "" {
+				fmt.Fprintf(os.Stderr, "Error: --sort only applies to listing history, searches show the best matches first\n")
+				os.Exit(1)
+			}
+
+			if uniqueFlag && query != "" {
+				fmt.Fprintf(os.Stderr, "Error: --unique only applies to listing history, not to searches\n")
+				os.Exit(1)
+			}
+
+			if semanticFlag && query == "" {
+				fmt.Fprintf(os.Stderr, "Error: --semantic needs a query\n")
+				os.Exit(1)
+			}
+
+			// Searches show the best matches, so only listing goes past the first page
+			offset := offsetFlag
+			if cmd.Flags().Changed("offset") || cmd.Flags().Changed("page") {
+				if query != "" {
+					fmt.Fprintf(os.Stderr, "Error: --offset and --page only apply to listing history, not to searches\n")
+					os.Exit(1)
+				}
+				if cmd.Flags().Changed("offset") && cmd.Flags().Changed("page") {
+					fmt.Fprintf(os.Stderr, "Error: use either --offset or --page, not both\n")
+					os.Exit(1)
+				}
+				if offsetFlag < 0 {
+					fmt.Fprintf(os.Stderr, "Error: --offset must not be negative\n")
+					os.Exit(1)
+				}
+				if cmd.Flags().Changed("page") {
+					if pageFlag < 1 || limitFlag < 1 {
+						fmt.Fprintf(os.Stderr, "Error: --page must be 1 or more, with a --limit of 1 or more\n")
+						os.Exit(1)
+					}
+					offset = (pageFlag - 1) * limitFlag
+				}
+			}
+
+			tag := ""
+			if tagFlag != "" {
+				if tag, err = normalizeTag(tagFlag); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
 
-			if query != "" {
+			var entries []model.HistoryEntry
+			// With --unique, how many entries each listed entry stands for, and how many are listed in all
+			counts := make(map[int64]int)
+			total := -1
+
+			if semanticFlag {
+				// Search by meaning
+				entries, err = searchSemantic(db, query, limitFlag, entryType, tag)
+			} else if query != "" {
 				// Search by query
-				entries, err = db.SearchHistory(query, limitFlag)
+				entries, err = db.SearchHistory(query, limitFlag, entryType, tag)
+			} else if uniqueFlag {
+				// List the newest entry of each command (or favorites)
+				var groups []model.HistoryGroup
+				groups, total, err = db.GetUniqueHistoryEntries(limitFlag, offset, favoriteFlag, entryType, tag, sortFlag)
+				for _, group := range groups {
+					// The uses of every entry in the group count, as they do for --sort used
+					entry := group.Latest
+					entry.UseCount = group.UseCount
+					entries = append(entries, entry)
+					counts[entry.ID] = group.Count
+				}
 			} else {
 				// List all entries (or favorites)
-				entries, err = db.GetHistoryEntries(limitFlag, 0, favoriteFlag, "")
+				entries, err = db.GetHistoryEntries(limitFlag, offset, favoriteFlag, "", entryType, tag, sortFlag)
 			}
 
 			if err != nil {
@@ -239,7 +450,13 @@ func main() {
 				os.Exit(1)
 			}
 
-			if len(entries) == 0 {
+			// The shell integration's history widget pipes the picker format into fzf
+			if formatFlag == "picker" {
+				writePickerEntries(os.Stdout, entries)
+				return
+			}
+
+			if len(entries) == 0 && offset == 0 {
 				fmt.Println("No history entries found.")
 				return
 			}
@@ -252,31 +469,84 @@ func main() {
 				// Print entry ID and timestamp
 				fmt.Printf("[%d] %s", entry.ID, timestamp)
 
-				// Add favorite indicator
+				// Add favorite indicator, with the name of its shortcut
 				if entry.Favorite {
 					fmt.Print(" ⭐")
+					if entry.Shortcut != "" {
+						fmt.Printf(" %s", entry.Shortcut)
+					}
 				}
-				// Add continuation indicator
+				// Add continuation indicators, 'tell history tree' shows the whole chain
 				if entry.ParentID.Valid {
 					fmt.Printf(" (continues from %d)", entry.ParentID.Int64)
 				}
+				if entry.Continuations > 0 {
+					fmt.Printf(" (continuations: %d)", entry.Continuations)
+				}
+				if entry.Edited {
+					fmt.Print(" (edited)")
+				}
+				if entry.UseCount > 0 {
+					fmt.Printf(" (uses: %d)", entry.UseCount)
+				}
+				if counts[entry.ID] > 1 {
+					fmt.Printf(" (%d entries, latest shown)", counts[entry.ID])
+				}
+				// Add tags
+				for _, tag := range entry.Tags {
+					fmt.Printf(" #%s", tag)
+				}
 				fmt.Println()
 
 				// Print prompt
 				fmt.Printf("Prompt: %s\n", entry.Prompt)
 
-				// Print command
-				fmt.Printf("Command: %s\n", entry.Command)
+				// Print command, or the first line of the answer, summary or script description
+				switch entry.EntryType {
+				case model.EntryTypeAnswer:
+					answer, _, _ := strings.Cut(entry.Details, "\n")
+					fmt.Printf("Answer: %s\n", answer)
+				case model.EntryTypeSummary:
+					summary, _, _ := strings.Cut(entry.Details, "\n")
+					fmt.Printf("Summary: %s\n", summary)
+				case model.EntryTypeScript:
+					description, _, _ := strings.Cut(entry.Details, "\n")
+					fmt.Printf("Script: %s\n", description)
+				default:
+					fmt.Printf("Command: %s\n", entry.Command)
+				}
 
 				// Print separator
 				fmt.Println(strings.Repeat("-", 80))
 			}
+
+			// Say where the listing is in the history, and how to see more
+			if query == "" {
+				if total < 0 {
+					total, err = db.CountHistoryEntries(favoriteFlag, entryType, tag)
+					if err != nil {
+						slog.Error("Failed to count history", "error", err)
+						fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+						os.Exit(1)
+					}
+				}
+				printHistoryFooter(offset, limitFlag, len(entries), total)
+			}
 		},
 	}
 
 	// Add flags to history command
 	historyCmd.Flags().IntVarP(&limitFlag, "limit", "l", 10, "Maximum number of entries to show")
+	historyCmd.Flags().IntVar(&offsetFlag, "offset", 0, "Skip this many of the most recent entries")
+	historyCmd.Flags().IntVar(&pageFlag, "page", 1, "Show this page of entries, --limit entries per page")
+	historyCmd.Flags().StringVar(&sortFlag, "sort", model.HistorySortRecent, "Order of the entries listed: recent|used (most used first)")
+	historyCmd.Flags().BoolVar(&uniqueFlag, "unique", false, "Show repeated commands once, as their newest entry with how many there are")
 	historyCmd.Flags().BoolVarP(&favoriteFlag, "favorites", "f", false, "Show only favorite entries")
+	historyCmd.Flags().StringVarP(&entryTypeFlag, "type", "t", model.EntryTypeCommand, "Entry type to show: command|answer|summary|explanation|analysis|script|all")
+	historyCmd.Flags().StringVar(&formatFlag, "format", "text", "Output format: text|picker (NUL-separated id, prompt and command for fzf --read0)")
+	historyCmd.Flags().BoolVar(&semanticFlag, "semantic", false, "Search by meaning with embeddings rather than by keywords")
+	historyCmd.Flags().StringVar(&tagFlag, "tag", "", "Show only entries with this tag")
+	historyCmd.RegisterFlagCompletionFunc("tag", completeTags)
 
 	// History show command
 	historyShowCmd := &cobra.Command{
@@ -284,6 +554,8 @@ func main() {
 		Short: "Show details of a specific history entry",
 		Long:  "Show complete details of a specific history entry by ID",
 		Args:  cobra.ExactArgs(1),
+		// Complete recent history IDs
+		ValidArgsFunction: completeHistoryIDs,
 		Run: func(cmd *cobra.Command, args []string) {
 			// Parse ID
 			id, err := strconv.ParseInt(args[0], 10, 64)
@@ -313,25 +585,104 @@ func main() {
 			fmt.Printf("ID: %d\n", entry.ID)
 			fmt.Printf("Time: %s\n", entry.Timestamp.Format(time.RFC1123))
 			fmt.Printf("Favorite: %v\n", entry.Favorite)
+			if entry.Shortcut != "" {
+				fmt.Printf("Shortcut: %s\n", entry.Shortcut)
+			}
+			if len(entry.Tags) > 0 {
+				fmt.Printf("Tags: %s\n", strings.Join(entry.Tags, ", "))
+			}
 
 			// Display parent ID if present
 			if entry.ParentID.Valid {
 				fmt.Printf("Continues from: %d\n", entry.ParentID.Int64)
 			}
+			if entry.Continuations > 0 {
+				fmt.Printf("Continuations: %d\n", entry.Continuations)
+			}
+			if entry.SessionID.Valid {
+				if session, err := db.GetSession(strconv.FormatInt(entry.SessionID.Int64, 10)); err == nil && session != nil {
+					fmt.Printf("Session: %s\n", session.Name)
+				}
+			}
+			if entry.Edited {
+				fmt.Println("Edited: true")
+			}
+			if entry.UseCount > 0 {
+				fmt.Printf("Uses: %d, last %s\n", entry.UseCount, entry.LastUsedAt.Time.Format(time.RFC1123))
+			}
 
 			fmt.Printf("Model: %s\n", entry.Model)
+			if entry.Route != "" {
+				fmt.Printf("Route: %s\n", entry.Route)
+			}
+			if entry.Retries > 0 {
+				fmt.Printf("Retries: %d\n", entry.Retries)
+			}
 			fmt.Printf("Input Tokens: %d\n", entry.InputTokens)
 			fmt.Printf("Output Tokens: %d\n", entry.OutputTokens)
+			// Showing an entry needs no API key, and the cost is left out when the config can't be read
+			if cfg, err := config.Load(); err != nil {
+				slog.Warn("Failed to load configuration, not showing the cost", "error", err)
+			} else if cost := requestCost(cfg, entry.Model, entry.InputTokens, entry.OutputTokens); cost != "" {
+				fmt.Printf("Cost: %s\n", cost)
+			}
 			fmt.Println()
 			fmt.Printf("Prompt: %s\n", entry.Prompt)
 			fmt.Println()
-			fmt.Printf("Command: %s\n", entry.Command)
-			fmt.Println()
 
-			if entry.Details != "" {
+			// Answers from 'tell ask' and summaries have no command, only text
+			switch entry.EntryType {
+			case model.EntryTypeAnswer:
+				fmt.Printf("Answer: %s\n", entry.Details)
+				fmt.Println()
+			case model.EntryTypeSummary:
+				fmt.Printf("Summary: %s\n", entry.Details)
+				fmt.Println()
+			case model.EntryTypeScript:
+				fmt.Printf("Script:\n%s\n", entry.Command)
+				fmt.Println()
+			default:
+				fmt.Printf("Command: %s\n", entry.Command)
+				fmt.Println()
+			}
+
+			if entry.Details != "" && (entry.EntryType == model.EntryTypeCommand || entry.EntryType == model.EntryTypeScript) {
 				fmt.Printf("Details: %s\n", entry.Details)
 				fmt.Println()
 			}
+			if entry.Undo != "" {
+				fmt.Printf("Undo: %s\n", entry.Undo)
+				fmt.Println()
+			}
+			if entry.ExecutedAt.Valid {
+				fmt.Printf("Executed: %s (exit code %d", entry.ExecutedAt.Time.Format(time.RFC1123), entry.ExitCode.Int64)
+				if entry.DurationMS.Valid {
+					fmt.Printf(", took %s", time.Duration(entry.DurationMS.Int64)*time.Millisecond)
+				}
+				if entry.TimedOut {
+					fmt.Print(", stopped by the run timeout")
+				}
+				fmt.Println(")")
+				fmt.Println()
+			}
+			switch entry.Outcome {
+			case model.OutcomeAsIs:
+				fmt.Printf("Outcome: run as generated\n\n")
+			case model.OutcomeEdited:
+				fmt.Printf("Outcome: edited, ran: %s\n\n", entry.RanCommand)
+			case model.OutcomeDiscarded:
+				fmt.Printf("Outcome: discarded\n\n")
+			}
+			if entry.Output.Valid {
+				fmt.Printf("Output:\n%s\n", strings.TrimRight(entry.Output.String, "\n"))
+				fmt.Println()
+			}
+			if entry.Details != "" && entry.EntryType == model.EntryTypeExplanation {
+				fmt.Printf("Explanation: %s\n", entry.Details)
+			}
+			if entry.Details != "" && entry.EntryType == model.EntryTypeAnalysis {
+				fmt.Printf("Analysis: %s\n", entry.Details)
+			}
 
 			if entry.ErrorMessage != "" {
 				fmt.Printf("Error: %s\n", entry.ErrorMessage)
@@ -343,8 +694,13 @@ func main() {
 	historyFavoriteCmd := &cobra.Command{
 		Use:   "favorite [id]",
 		Short: "Toggle favorite status of a history entry",
-		Long:  "Mark or unmark a history entry as favorite by ID",
-		Args:  cobra.ExactArgs(1),
+		Long: `Mark or unmark a history entry as favorite by ID. With --name, mark it as favorite and name the
+shell abbreviation or alias 'tell favorites export-abbr' defines for its command; an empty name removes it.`,
+		Example: `  tell history favorite 42
+  tell history favorite 42 --name gst`,
+		Args: cobra.ExactArgs(1),
+		// Complete recent history IDs
+		ValidArgsFunction: completeHistoryIDs,
 		Run: func(cmd *cobra.Command, args []string) {
 			// Parse ID
 			id, err := strconv.ParseInt(args[0], 10, 64)
@@ -362,6 +718,25 @@ func main() {
 			}
 			defer db.Close()
 
+			// Name the favorite's shortcut
+			if cmd.Flags().Changed("name") {
+				if shortcutFlag != "" && !shortcutNamePattern.MatchString(shortcutFlag) {
+					fmt.Fprintf(os.Stderr, "Error: invalid shortcut name %q: use letters, digits, ., - and _\n", shortcutFlag)
+					os.Exit(1)
+				}
+				if err := db.SetShortcut(id, shortcutFlag); err != nil {
+					slog.Error("Failed to set shortcut", "id", id, "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				if shortcutFlag == "" {
+					fmt.Printf("Entry %d has no shortcut anymore.\n", id)
+				} else {
+					fmt.Printf("Entry %d marked as favorite with the shortcut %s.\n", id, shortcutFlag)
+				}
+				return
+			}
+
 			// Get current favorite status
 			entry, err := db.GetHistoryEntry(id)
 			if err != nil {
@@ -392,6 +767,8 @@ func main() {
 		Short: "Delete a history entry",
 		Long:  "Delete a specific history entry by ID",
 		Args:  cobra.ExactArgs(1),
+		// Complete recent history IDs
+		ValidArgsFunction: completeHistoryIDs,
 		Run: func(cmd *cobra.Command, args []string) {
 			// Parse ID
 			id, err := strconv.ParseInt(args[0], 10, 64)
@@ -420,21 +797,91 @@ func main() {
 		},
 	}
 
+	historyFavoriteCmd.Flags().StringVar(&shortcutFlag, "name", "", "Mark as favorite and name its shell abbreviation or alias")
+
 	// Add subcommands to historyCmd
-	historyCmd.AddCommand(historyShowCmd, historyFavoriteCmd, historyDeleteCmd)
+	historyCmd.AddCommand(historyShowCmd, historyFavoriteCmd, historyDeleteCmd, newHistoryRecordCmd(), newHistoryTagCmd(), newHistoryTagsCmd(), newHistoryExportCmd(), newHistoryImportCmd(), newHistoryPruneCmd(), newHistoryEditCmd(), newHistoryCopyCmd(), newHistoryTreeCmd())
 
 	// Add subcommands
 	envCmd := &cobra.Command{
 		Use:   "env [shell]",
 		Short: "Print shell integration script",
-		Long:  "Print shell integration script for specified shell",
+		Long: `Print shell integration script for specified shell (zsh, bash, fish or pwsh), or with tmux a tmux.conf snippet opening tell in a popup.
+The name of the function generating a command, whether it prints the explanation and whether it
+inserts, copies or runs the command come from the integration section of the configuration.`,
 		Run: func(cmd *cobra.Command, args []string) {
 			shell := "auto"
 			if len(args) > 0 {
 				shell = args[0]
 			}
 
-			script, err := shellenv.GenerateIntegrationScript(shell)
+			if installFlag && uninstallFlag {
+				fmt.Fprintf(os.Stderr, "Error: --install and --uninstall can't be combined\n")
+				os.Exit(1)
+			}
+			if (installFlag || uninstallFlag) && (envJSONFlag || printPathFlag) {
+				fmt.Fprintf(os.Stderr, "Error: --install and --uninstall can't be combined with --json or --print-path\n")
+				os.Exit(1)
+			}
+
+			// Source the integration from the shell's startup file
+			if installFlag {
+				startupFile, err := shellenv.InstallIntegration(shell, integrationOptions())
+				if err != nil {
+					slog.Error("Failed to install shell integration", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Installed the %s integration in %s, it takes effect in new sessions.\n", shellenv.ResolveShell(shell), startupFile)
+				return
+			}
+			if uninstallFlag {
+				startupFile, found, err := shellenv.UninstallIntegration(shell)
+				if err != nil {
+					slog.Error("Failed to uninstall shell integration", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				if !found {
+					fmt.Printf("The %s integration isn't installed in %s.\n", shellenv.ResolveShell(shell), startupFile)
+					return
+				}
+				fmt.Printf("Removed the %s integration from %s, it is gone from new sessions.\n", shellenv.ResolveShell(shell), startupFile)
+				return
+			}
+
+			// Describe the integration for installers and dotfile managers
+			if envJSONFlag {
+				metadata, err := shellenv.IntegrationMetadata(shell, version, integrationOptions())
+				if err != nil {
+					slog.Error("Failed to describe shell integration", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+
+				jsonData, err := json.MarshalIndent(metadata, "", "  ")
+				if err != nil {
+					slog.Error("Failed to marshal integration metadata to JSON", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(jsonData))
+				return
+			}
+
+			// Write the script to a file that rc files can source
+			if printPathFlag {
+				path, err := shellenv.WriteIntegrationScript(shell, integrationOptions())
+				if err != nil {
+					slog.Error("Failed to write shell integration", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(path)
+				return
+			}
+
+			script, err := shellenv.GenerateIntegrationScript(shell, integrationOptions())
 			if err != nil {
 				slog.Error("Failed to generate shell integration", "error", err)
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -444,6 +891,10 @@ func main() {
 			fmt.Println(script)
 		},
 	}
+	envCmd.Flags().BoolVar(&printPathFlag, "print-path", false, "Write the integration script to a file and print its path")
+	envCmd.Flags().BoolVar(&envJSONFlag, "json", false, "Print JSON metadata describing the integration")
+	envCmd.Flags().BoolVar(&installFlag, "install", false, "Write the integration script to a file and source it from the shell's startup file")
+	envCmd.Flags().BoolVar(&uninstallFlag, "uninstall", false, "Remove the integration from the shell's startup file and delete the script")
 
 	configCmd := &cobra.Command{
 		Use:   "config",
@@ -486,7 +937,10 @@ func main() {
 	}
 
 	configCmd.AddCommand(configEditCmd, configShowCmd, configInitCmd)
-	rootCmd.AddCommand(promptCmd, envCmd, configCmd, historyCmd)
+	rootCmd.AddCommand(promptCmd, newCompletionPromptCmd(), newAskCmd(), newSummarizeCmd(), newExplainCmd(), newAnalyzeCmd(), newFixCmd(), newRunCmd(), newScriptCmd(), envCmd, configCmd, historyCmd, newFavoritesCmd(), newSessionCmd(), newSyncCmd(), newStatsCmd(), newCostCmd(), newWorkspaceCmd(), newPopupCmd(), newInternalReportCmd(), newInternalUseCmd())
+
+	// Complete model names, target systems and history IDs in the scripts from tell completion
+	registerCompletions(rootCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -494,6 +948,67 @@ func main() {
 	}
 }
 
+// writePickerEntries writes the history entries with a command for a fuzzy finder: one record
+// per entry ending with a NUL byte, since commands can span lines, made of the ID, the prompt on
+// one line and the command separated by tabs. Favorites have a star before their prompt.
+func writePickerEntries(w io.Writer, entries []model.HistoryEntry) {
+	for _, entry := range entries {
+		if entry.Command == "" {
+			continue
+		}
+		prompt := strings.Join(strings.Fields(entry.Prompt), " ")
+		if entry.Favorite {
+			prompt = "⭐ " + prompt
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\x00", entry.ID, prompt, entry.Command)
+	}
+}
+
+// printHistoryFooter prints which of the total entries a listing showed, after skipping offset,
+// and the flag that shows the next ones
+func printHistoryFooter(offset int, limit int, shown int, total int) {
+	if shown == 0 {
+		fmt.Printf("No entries past the first %d, the history has %d.\n", offset, total)
+		return
+	}
+
+	fmt.Printf("Showing %d-%d of %d entries", offset+1, offset+shown, total)
+	if limit > 0 && offset%limit == 0 {
+		fmt.Printf(" (page %d of %d)", offset/limit+1, (total+limit-1)/limit)
+	}
+	if offset+shown < total {
+		if limit > 0 && offset%limit == 0 {
+			fmt.Printf(", next: --page %d", offset/limit+2)
+		} else {
+			fmt.Printf(", next: --offset %d", offset+shown)
+		}
+	}
+	fmt.Println()
+}
+
+// integrationOptions returns the shape of the shell integration from the integration section of
+// the configuration, exiting if the configuration can't be loaded or the options are invalid
+func integrationOptions() shellenv.Options {
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	opts := shellenv.Options{
+		FunctionName: cfg.Integration.FunctionName,
+		ShowDetails:  cfg.Integration.ShowDetails,
+		Action:       cfg.Integration.Action,
+		BashPreexec:  cfg.Integration.BashPreexec,
+	}
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return opts
+}
+
 // initializeDatabase creates and initializes the SQLite database
 func initializeDatabase() (*storage.DB, error) {
 	db, err := storage.NewDB()
@@ -501,14 +1016,74 @@ func initializeDatabase() (*storage.DB, error) {
 		return nil, fmt.Errorf("could not create database connection: %w", err)
 	}
 
+	cfg, err := config.Load()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not load configuration: %w", err)
+	}
+	db.SetEncryption(cfg.History.Encrypt, historyKey)
+
 	if err := db.InitSchema(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("could not initialize database schema: %w", err)
 	}
 
+	if err := applyRetention(cfg.History, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not apply history retention: %w", err)
+	}
+
 	return db, nil
 }
 
+// openTraceFile opens the trace file for appending. If path is empty and TELL_TRACE=1 is set,
+// the trace is written to trace.log in the state directory. Returns nil if tracing is disabled.
+func openTraceFile(path string) (*os.File, error) {
+	if path == "" {
+		if os.Getenv("TELL_TRACE") != "1" {
+			return nil, nil
+		}
+
+		stateDir, err := xdg.StateDir()
+		if err != nil {
+			return nil, fmt.Errorf("could not get state directory: %w", err)
+		}
+		path = filepath.Join(stateDir, "trace.log")
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open trace file: %w", err)
+	}
+
+	slog.Debug("Tracing LLM requests", "path", path)
+	return f, nil
+}
+
+// fixtureHTTPClient returns an HTTP client that records responses to recordDir or
+// replays them from replayDir. Returns nil if neither is set.
+func fixtureHTTPClient(recordDir, replayDir string) (*http.Client, error) {
+	if recordDir != "" && replayDir != "" {
+		return nil, fmt.Errorf("--record and --replay cannot be used together")
+	}
+
+	var transport http.RoundTripper
+	var err error
+	switch {
+	case replayDir != "":
+		transport, err = llm.NewReplayTransport(replayDir)
+	case recordDir != "":
+		transport, err = llm.NewRecordTransport(recordDir, http.DefaultTransport)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
 // setupLogging configures the application logging based on verbose flag
 // IMPORTANT: All commands with custom PersistentPreRun MUST call this function
 // to maintain consistent logging behavior
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/placeholder"
+)
+
+// fillPlaceholders replaces the placeholders in a command ({{filename}}) with the values given
+// with --var and asks on the terminal for the others. Placeholders that aren't filled in stay
+// in the command, with a warning.
+func fillPlaceholders(response *model.CommandResponse) {
+	names := placeholder.Names(response.Command)
+	if len(names) == 0 {
+		return
+	}
+
+	// --var was checked when the command started
+	values, _ := placeholder.ParseVars(varFlag)
+
+	var missing []string
+	for _, name := range names {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		if tty, err := openTTY(); err != nil {
+			slog.Debug("No terminal to ask for placeholder values", "error", err)
+		} else {
+			fmt.Fprintf(tty, "%s\n\n", placeholder.Fill(response.Command, values))
+			for _, name := range missing {
+				value, err := askLine(tty, "Value for "+placeholder.Format(name)+":")
+				if err != nil {
+					break
+				}
+				// An empty answer leaves the placeholder for the user to fill in later
+				if value != "" {
+					values[name] = value
+				}
+			}
+			tty.Close()
+		}
+	}
+
+	response.Command = placeholder.Fill(response.Command, values)
+
+	if left := placeholder.Names(response.Command); len(left) > 0 {
+		formatted := make([]string, len(left))
+		for i, name := range left {
+			formatted[i] = placeholder.Format(name)
+		}
+		response.AddWarning(model.WarningPlaceholders,
+			"Replace "+strings.Join(formatted, ", ")+" before running the command")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// newPopupCmd creates the popup command, which the tmux integration runs in a display-popup:
+// it asks for a prompt on the terminal and types the generated command into another pane
+func newPopupCmd() *cobra.Command {
+	var pane string
+	var capture bool
+
+	cmd := &cobra.Command{
+		Use:   "popup",
+		Short: "Ask for a prompt and type the command into a tmux pane",
+		Long: `Ask for a prompt on the terminal, generate a command and type it into a tmux pane without
+running it. Meant for a tmux display-popup opened by the binding from 'tell env tmux', which passes
+the pane the popup was opened from.`,
+		Example: `  tmux display-popup -E -d '#{pane_current_path}' "tell popup --pane '#{pane_id}'"`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			tty, err := openTTY()
+			if err != nil {
+				slog.Error("Failed to open terminal", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer tty.Close()
+
+			prompt, err := askLine(tty, "tell>")
+			if err != nil || prompt == "" {
+				return
+			}
+
+			// The pane the popup was opened from shows what the prompt may refer to, e.g. an error
+			if capture {
+				tmuxPaneFlag = pane
+			}
+
+			cfg := loadConfig()
+
+			// Initialize database
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				// Don't exit if just the database fails; we can still generate the command
+			}
+
+			clientOpts := []llm.Option{llm.WithContext(collectContext(cfg, db, prompt))}
+			route := routeModel(cfg, db, prompt)
+			if route != nil {
+				clientOpts = append(clientOpts, llm.WithModel(route.Model))
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
+
+			var response *model.CommandResponse
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				response, usage, genErr = client.GenerateCommand(prompt)
+			})
+
+			// Record how the model was picked
+			if route != nil && usage != nil {
+				usage.Route = route.Tier
+			}
+
+			if db != nil {
+				warnIfPreviouslyFailed(db, response)
+				saveHistory(db, prompt, response, usage, genErr, sql.NullInt64{}, model.EntryTypeCommand)
+				db.Close()
+			}
+
+			// The popup closes when tell exits, so errors wait for a key press
+			if genErr != nil {
+				slog.Error("Failed to generate command", "error", genErr)
+				fmt.Fprintf(tty, "Error: %v\n", genErr)
+				askLine(tty, "Press Enter to close.")
+				os.Exit(1)
+			}
+
+			fillPlaceholders(response)
+			markBlocked(cfg, response)
+
+			// Commands are typed straight away unless there is something to read first
+			if len(response.Warnings) > 0 || (response.ShowDetails && !noExplainFlag) || response.Undo != "" {
+				showCommand(tty, response)
+				if response.Blocked {
+					fmt.Fprintf(tty, "Not typed into the pane because of the warnings (safety_level: strict, --force allows it).\n")
+					askLine(tty, "Press Enter to close.")
+					os.Exit(1)
+				}
+				if _, err := askLine(tty, "Press Enter to type the command into the pane, Ctrl-C to cancel."); err != nil {
+					return
+				}
+			}
+
+			if err := sendToPane(pane, response.Command); err != nil {
+				slog.Error("Failed to send command to tmux pane", "pane", pane, "error", err)
+				fmt.Fprintf(tty, "Error: %v\n", err)
+				askLine(tty, "Press Enter to close.")
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&pane, "pane", "", "tmux pane to type the command into, e.g. %3")
+	cmd.Flags().BoolVar(&capture, "capture", false, "Attach the contents of the pane as context")
+	cmd.Flags().StringVarP(&shellFlag, "shell", "s", "auto", "Target shell: zsh|bash|fish|pwsh|cmd")
+	cmd.Flags().BoolVarP(&noExplainFlag, "no-explain", "n", false, "Skip command explanation")
+	cmd.Flags().BoolVar(&forceFlag, "force", false, "Allow commands with warnings when safety_level is strict")
+	cmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	cmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
+	cmd.MarkFlagRequired("pane")
+
+	return cmd
+}
+
+// sendToPane types command into a tmux pane without running it. A command spanning lines is
+// pasted instead, since a typed newline would run the first line; with bracketed paste, which
+// bash and zsh turn on, the shell keeps the lines on its command line.
+func sendToPane(pane string, command string) error {
+	var commands [][]string
+	if strings.Contains(command, "\n") {
+		commands = [][]string{
+			{"set-buffer", "-b", "tell", "--", command},
+			{"paste-buffer", "-p", "-d", "-b", "tell", "-t", pane},
+		}
+	} else {
+		commands = [][]string{{"send-keys", "-t", pane, "-l", "--", command}}
+	}
+
+	for _, args := range commands {
+		output, err := exec.Command("tmux", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("could not %s to pane %s: %w: %s", args[0], pane, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// startInOwnGroup makes cmd start in its own process group, so the whole pipeline can be
+// stopped at once. With a terminal the group becomes the terminal's foreground group, so the
+// command can still read it and gets Ctrl-C.
+func startInOwnGroup(cmd *exec.Cmd, tty *os.File) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if tty != nil {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = int(tty.Fd())
+	}
+}
+
+// terminateGroup asks the process group started by cmd to exit
+func terminateGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// killGroup kills the process group started by cmd
+func killGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// takeTerminal makes tell's process group the foreground group of tty again after a command
+// ran in its own group. tell is in the background until then, so SIGTTOU is ignored.
+func takeTerminal(tty *os.File) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+
+	pgid := int32(syscall.Getpgrp())
+	syscall.Syscall(syscall.SYS_IOCTL, tty.Fd(), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&pgid)))
+}
+
+// cmdExecCommand runs command with cmd, which is only found under Wine or a compatibility layer
+func cmdExecCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/c", command)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startInOwnGroup does nothing on Windows, where only the shell itself is stopped
+func startInOwnGroup(cmd *exec.Cmd, tty *os.File) {}
+
+// terminateGroup kills the shell, since Windows has no SIGTERM
+func terminateGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// killGroup kills the shell
+func killGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+// takeTerminal does nothing on Windows, where the terminal is never handed over
+func takeTerminal(tty *os.File) {}
+
+// cmdExecCommand runs command with cmd.exe. The command line is passed as is, since cmd doesn't
+// split its arguments the way Go quotes them.
+func cmdExecCommand(command string) *exec.Cmd {
+	cmd := exec.Command("cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /d /s /c "` + command + `"`}
+	return cmd
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// newHistoryPruneCmd creates the history prune command, which deletes old history entries
+func newHistoryPruneCmd() *cobra.Command {
+	var olderThan string
+	var keepFavorites bool
+	var dryRun bool
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete old history entries",
+		Long: `Delete the history entries older than --older-than, or than history.retention in the config
+when it isn't given. Asks before deleting, unless --yes is given.
+
+Set history.retention to prune history every time tell starts instead.`,
+		Example: `  tell history prune --older-than 90d --keep-favorites
+  tell history prune --older-than 2w --dry-run`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load()
+			if err != nil {
+				slog.Error("Failed to load configuration", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if olderThan == "" {
+				olderThan = cfg.History.Retention
+			}
+			if olderThan == "" {
+				fmt.Fprintf(os.Stderr, "Error: --older-than is required when history.retention isn't set\n")
+				os.Exit(1)
+			}
+			age, err := parseAge(olderThan)
+			if err != nil {
+				slog.Error("Invalid age", "older_than", olderThan, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if !cmd.Flags().Changed("keep-favorites") {
+				keepFavorites = cfg.History.RetentionKeepFavorites
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			cutoff := time.Now().Add(-age)
+			count, err := db.PruneHistory(cutoff, keepFavorites, true)
+			if err != nil {
+				slog.Error("Failed to count old history entries", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if count == 0 {
+				fmt.Printf("No history entries older than %s.\n", olderThan)
+				return
+			}
+			if dryRun {
+				fmt.Printf("Would delete %d entries older than %s.\n", count, olderThan)
+				return
+			}
+
+			if !yes {
+				tty, err := openTTY()
+				if err != nil {
+					slog.Error("Failed to open terminal", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v, use --yes to prune without asking\n", err)
+					os.Exit(1)
+				}
+				defer tty.Close()
+
+				if ok, err := askYesNo(tty, fmt.Sprintf("Delete %d entries older than %s?", count, olderThan)); err != nil || !ok {
+					return
+				}
+			}
+
+			deleted, err := db.PruneHistory(cutoff, keepFavorites, false)
+			if err != nil {
+				slog.Error("Failed to prune history", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Deleted %d entries older than %s.\n", deleted, olderThan)
+		},
+	}
+
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "Delete entries older than this, such as 90d, 2w or 36h (default history.retention)")
+	cmd.Flags().BoolVar(&keepFavorites, "keep-favorites", false, "Keep favorites however old they are (default history.retention_keep_favorites)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show how many entries would be deleted")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Delete without asking")
+
+	return cmd
+}
+
+// applyRetention deletes the history entries older than history.retention, when it is set
+func applyRetention(cfg config.HistoryConfig, db *storage.DB) error {
+	if cfg.Retention == "" {
+		return nil
+	}
+
+	age, err := parseAge(cfg.Retention)
+	if err != nil {
+		return fmt.Errorf("invalid history.retention: %w", err)
+	}
+
+	deleted, err := db.PruneHistory(time.Now().Add(-age), cfg.RetentionKeepFavorites, false)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		slog.Debug("Pruned history", "retention", cfg.Retention, "deleted", deleted)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// newHistoryRecordCmd creates the history record command, which records how running the
+// command of a history entry went
+func newHistoryRecordCmd() *cobra.Command {
+	var exitCode int
+	var durationMS int64
+	var startedAt int64
+	var outputFile string
+
+	cmd := &cobra.Command{
+		Use:   "record [id]",
+		Short: "Record that the command of a history entry was run",
+		Long: `Record the exit code, and when known how long it ran and its output, of the command of a
+history entry you ran yourself, so 'tell fix' and 'tell prompt --continue' know how it went. The
+shell integration records commands it put on your command line on its own.`,
+		Example: `  tell history record 42 --exit-code 1 --duration-ms 350
+  make 2>&1 | tee /tmp/make.log; tell history record 42 --exit-code $? --output-file /tmp/make.log`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeHistoryIDs,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			// Recording calls no model, so no API key is needed
+			cfg, err := config.Load()
+			if err != nil {
+				slog.Error("Failed to load configuration", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			execution := model.Execution{
+				ExitCode: exitCode,
+				Duration: time.Duration(durationMS) * time.Millisecond,
+			}
+			if durationMS < 0 {
+				execution.Duration = -1
+			}
+
+			// Without a start time, the command is taken to have just finished
+			execution.StartedAt = time.Now().Add(-max(execution.Duration, 0))
+			if startedAt > 0 {
+				execution.StartedAt = time.Unix(startedAt, 0)
+			}
+
+			if outputFile != "" {
+				output, err := readOutput(outputFile, cfg.History.MaxOutputBytes)
+				if err != nil {
+					slog.Error("Failed to read output", "path", outputFile, "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				execution.Output = output
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			if err := db.RecordExecution(id, execution); err != nil {
+				slog.Error("Failed to record execution", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&exitCode, "exit-code", 0, "Exit code of the command")
+	cmd.Flags().Int64Var(&durationMS, "duration-ms", -1, "How long the command ran, in milliseconds")
+	cmd.Flags().Int64Var(&startedAt, "started-at", 0, "When the command started, in seconds since the Unix epoch")
+	cmd.Flags().StringVar(&outputFile, "output-file", "", "File with the command's output, - for stdin; only the end is kept")
+	cmd.MarkFlagRequired("exit-code")
+
+	return cmd
+}
+
+// readOutput reads the last maxBytes of the output saved in path, or stdin for "-"
+func readOutput(path string, maxBytes int) (string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("could not read output: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	output := &tailBuffer{max: maxBytes}
+	if _, err := io.Copy(output, r); err != nil {
+		return "", fmt.Errorf("could not read output: %w", err)
+	}
+	return output.String(), nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// newInternalReportCmd creates the internal-report command, which the shell integration calls
+// with what the user did with a command tell put on their command line
+func newInternalReportCmd() *cobra.Command {
+	var ran string
+	var exitCode int
+	var durationMS int64
+	var startedAt int64
+
+	cmd := &cobra.Command{
+		Use:   "internal-report [id]",
+		Short: "Report what happened to a command put on the command line (used by the shell integration)",
+		Long: `Record on a history entry whether its command was run as tell gave it, edited first, or
+discarded, and how the command that ran went. --command is the command line the user ran next;
+without it nothing was run. A command line starting with a different program than the generated
+command counts as discarded.`,
+		Args:   cobra.ExactArgs(1),
+		Hidden: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			entry, err := db.GetHistoryEntry(id)
+			if err != nil {
+				slog.Error("Failed to retrieve history entry", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			outcome := classifyOutcome(entry.Command, ran)
+			ranCommand := ""
+			if outcome == model.OutcomeEdited {
+				ranCommand = strings.TrimSpace(ran)
+			}
+			slog.Debug("Recording outcome", "id", id, "outcome", outcome)
+
+			if err := db.RecordOutcome(id, outcome, ranCommand); err != nil {
+				slog.Error("Failed to record outcome", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if outcome == model.OutcomeDiscarded {
+				return
+			}
+
+			execution := model.Execution{
+				ExitCode: exitCode,
+				Duration: time.Duration(durationMS) * time.Millisecond,
+			}
+			if durationMS < 0 {
+				execution.Duration = -1
+			}
+
+			// Without a start time, the command is taken to have just finished
+			execution.StartedAt = time.Now().Add(-max(execution.Duration, 0))
+			if startedAt > 0 {
+				execution.StartedAt = time.Unix(startedAt, 0)
+			}
+
+			if err := db.RecordExecution(id, execution); err != nil {
+				slog.Error("Failed to record execution", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&ran, "command", "", "The command line the user ran, none if they ran nothing")
+	cmd.Flags().IntVar(&exitCode, "exit-code", 0, "Exit code of the command line")
+	cmd.Flags().Int64Var(&durationMS, "duration-ms", -1, "How long the command line ran, in milliseconds")
+	cmd.Flags().Int64Var(&startedAt, "started-at", 0, "When the command line started, in seconds since the Unix epoch")
+
+	return cmd
+}
+
+// newInternalUseCmd creates the internal-use command, which the shell integration's history widget
+// calls with the entry picked from history
+func newInternalUseCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:    "internal-use [id]",
+		Short:  "Count a use of a history entry picked from history (used by the shell integration)",
+		Args:   cobra.ExactArgs(1),
+		Hidden: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			if err := db.RecordUse(id); err != nil {
+				slog.Error("Failed to record use", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// classifyOutcome compares the generated command with the command line the user ran after it was
+// put on their command line. A command line running another program is taken to be a new
+// command typed after clearing the line.
+func classifyOutcome(generated string, ran string) string {
+	generated, ran = strings.TrimSpace(generated), strings.TrimSpace(ran)
+	switch {
+	case ran == "":
+		return model.OutcomeDiscarded
+	case ran == generated:
+		return model.OutcomeAsIs
+	case firstWord(ran) == firstWord(generated):
+		return model.OutcomeEdited
+	default:
+		return model.OutcomeDiscarded
+	}
+}
+
+// firstWord returns the first whitespace separated word of s, the program a command line runs
+func firstWord(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
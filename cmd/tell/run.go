@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jonfk/tell/internal/atuin"
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/placeholder"
+	"github.com/jonfk/tell/internal/policy"
+	"github.com/jonfk/tell/internal/progress"
+	"github.com/jonfk/tell/internal/shellenv"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// newRunCmd creates the run command, which runs the command of a history entry again
+func newRunCmd() *cobra.Command {
+	var edit bool
+
+	cmd := &cobra.Command{
+		Use:   "run [id]",
+		Short: "Run the command of a history entry",
+		Long: `Show the command of a history entry, ask for confirmation and run it in your shell. With --edit
+the command is opened in $VISUAL or $EDITOR first, and the edited command is saved to history as a
+continuation of the entry. Placeholders such as {{filename}} are filled in from --var or asked
+for. The exit code and duration are recorded like with 'tell prompt --run'.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			// Running a command from history calls no model, so no API key is needed
+			cfg, err := config.Load()
+			if err != nil {
+				slog.Error("Failed to load configuration", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if cmd.Flags().Changed("timeout") {
+				cfg.Run.Timeout = timeoutFlag
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			entry, err := db.GetHistoryEntry(id)
+			if err != nil {
+				slog.Error("Failed to retrieve history entry", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if entry.EntryType != model.EntryTypeCommand || entry.Command == "" {
+				fmt.Fprintf(os.Stderr, "Error: history entry %d has no command to run\n", id)
+				os.Exit(1)
+			}
+
+			tty, err := openTTY()
+			if err != nil {
+				slog.Error("No terminal to confirm the command", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: tell run needs a terminal to confirm the command: %v\n", err)
+				os.Exit(1)
+			}
+			defer tty.Close()
+
+			if _, err := placeholder.ParseVars(varFlag); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			// Commands with placeholders are templates, filled in on each run
+			response := &model.CommandResponse{Command: entry.Command}
+			fillPlaceholders(response)
+
+			command, entryID := response.Command, entry.ID
+			if edit {
+				command, err = editCommand(tty, command)
+				if err != nil {
+					slog.Error("Failed to edit command", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				if command == "" {
+					fmt.Fprintf(os.Stderr, "Error: the command is empty, not running it\n")
+					os.Exit(1)
+				}
+			}
+
+			// Refuse before asking, rather than after
+			if err := policy.Check(command, cfg.Policy); err != nil {
+				slog.Error("Command refused", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Fprintf(tty, "%s\n\n", command)
+			for _, warning := range response.Warnings {
+				fmt.Fprintf(tty, "Warning: %s\n", warning.Message)
+			}
+			if yes, err := askYesNo(tty, "Run this command?"); err != nil || !yes {
+				return
+			}
+			if err := db.RecordUse(entry.ID); err != nil {
+				slog.Error("Failed to record use", "id", entry.ID, "error", err)
+			}
+
+			// Keep the edited command in history, since it's the one that was run. Filling in
+			// placeholders isn't an edit, the run is recorded on the template.
+			if command != response.Command {
+				entryID = saveHistory(db, entry.Prompt, &model.CommandResponse{Command: command}, nil, nil,
+					sql.NullInt64{Int64: entry.ID, Valid: true}, model.EntryTypeCommand)
+			}
+			runAndRecord(cfg, db, tty, command, entryID)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&edit, "edit", "e", false, "Edit the command in $VISUAL or $EDITOR before running it")
+	cmd.Flags().StringArrayVar(&varFlag, "var", nil, "Value of a placeholder in the command, as name=value (repeatable)")
+	cmd.Flags().StringVarP(&shellFlag, "shell", "s", "auto", "Shell to run the command in: zsh|bash|fish|pwsh|cmd")
+	cmd.Flags().DurationVar(&timeoutFlag, "timeout", 0, "Stop the command if it runs longer than this, e.g. 30s (default: run.timeout)")
+	cmd.Flags().BoolVar(&forceFlag, "force", false, "Allow destructive commands when safety_level is strict")
+
+	return cmd
+}
+
+// runGenerated prints a generated command, asks on the terminal whether to run it and runs it
+// in the user's shell. With --sandbox it is tried in a sandbox before asking, and with --auto-fix
+// failures are fixed by the model. The exit code and duration are recorded in history entry
+// entryID, and tell exits with the command's exit code.
+func runGenerated(
+	cfg *config.Config,
+	db *storage.DB,
+	client *llm.Client,
+	ticker *progress.Ticker,
+	response *model.CommandResponse,
+	usage *model.LLMUsage,
+	entryID int64,
+) {
+	printCommandResponse(cfg, response, usage)
+
+	tty, err := openTTY()
+	if err != nil {
+		slog.Error("No terminal to confirm the command", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: --run needs a terminal to confirm the command: %v\n", err)
+		os.Exit(1)
+	}
+	defer tty.Close()
+
+	// Show what the command does in a sandbox first when asked to
+	question := "Run this command?"
+	if sandboxFlag {
+		trialRun(cfg, tty, response.Command)
+		question = "Run this command for real?"
+	}
+
+	if yes, err := askYesNo(tty, question); err != nil || !yes {
+		return
+	}
+
+	if autoFixFlag > 0 {
+		autoFix(cfg, db, client, ticker, tty, response.Command, entryID)
+		return
+	}
+	runAndRecord(cfg, db, tty, response.Command, entryID)
+}
+
+// runAndRecord runs command in the user's shell and records how it went in history entry
+// entryID, like runRecorded. Exits with the command's exit code when it failed.
+func runAndRecord(cfg *config.Config, db *storage.DB, tty *terminal, command string, entryID int64) {
+	execution := runRecorded(cfg, db, tty, command, entryID, false)
+	if execution.ExitCode != 0 {
+		exitWithCode(db, execution.ExitCode)
+	}
+}
+
+// runRecorded runs command in the user's shell and records its exit code and duration, and
+// the end of its output with history.record_output, in history entry entryID. With capture the
+// end of the output is returned even when it isn't recorded. Refuses commands the policy blocks.
+func runRecorded(cfg *config.Config, db *storage.DB, tty *terminal, command string, entryID int64, capture bool) model.Execution {
+	// Edited commands and commands from history are held to the policy and safety level too
+	err := policy.Check(command, cfg.Policy)
+	if err == nil {
+		err = policy.CheckSafety(command, cfg.Safety(), forceFlag)
+	}
+	if err != nil {
+		slog.Error("Command refused", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exitWithCode(db, 1)
+	}
+
+	// Data piped to tell was already read as context, so interactive commands read the terminal
+	stdin := os.Stdin
+	if !progress.IsTerminal(os.Stdin) {
+		stdin = tty.in
+	}
+
+	var output *tailBuffer
+	if cfg.History.RecordOutput || capture {
+		output = &tailBuffer{max: cfg.History.MaxOutputBytes}
+	}
+
+	// Atuin records commands run from the shell itself, with history.atuin it gets these too
+	var atuinID string
+	if cfg.History.Atuin {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Context.ProbeTimeout)
+		atuinID, err = atuin.Start(ctx, command)
+		cancel()
+		if err != nil {
+			slog.Warn("Failed to record command in atuin", "error", err)
+		}
+	}
+
+	execution := execute(runShell(), command, stdin, output, cfg.Run)
+	slog.Debug("Command finished", "exit_code", execution.ExitCode, "duration", execution.Duration)
+
+	if atuinID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Context.ProbeTimeout)
+		if err := atuin.End(ctx, atuinID, execution.ExitCode); err != nil {
+			slog.Warn("Failed to record command in atuin", "error", err)
+		}
+		cancel()
+	}
+
+	if db != nil && entryID != 0 {
+		recorded := execution
+		if !cfg.History.RecordOutput {
+			recorded.Output = ""
+		}
+		if err := db.RecordExecution(entryID, recorded); err != nil {
+			slog.Error("Failed to record execution", "id", entryID, "error", err)
+		}
+	}
+
+	return execution
+}
+
+// exitWithCode closes the database, which deferred calls won't do, and exits with code
+func exitWithCode(db *storage.DB, code int) {
+	if db != nil {
+		db.Close()
+	}
+	os.Exit(code)
+}
+
+// runShell returns the shell generated commands are run in: the one given with --shell,
+// or the detected one
+func runShell() string {
+	if shellFlag != "" && shellFlag != "auto" {
+		return shellenv.NormalizeShell(shellFlag)
+	}
+	return shellenv.DetectShell()
+}
+
+// execute runs command with shell -c (cmd /c for cmd.exe), attached to the terminal, and returns how it went, like
+// executeCmd. When output isn't nil, the command's output is also written to it, which means
+// the command writes to a pipe instead of the terminal.
+func execute(shell string, command string, stdin *os.File, output *tailBuffer, run config.RunConfig) model.Execution {
+	cmd := exec.Command(shell, "-c", command)
+	if shellenv.NormalizeShell(shell) == shellenv.Cmd {
+		cmd = cmdExecCommand(command)
+	}
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if output != nil {
+		cmd.Stdout = io.MultiWriter(os.Stdout, output)
+		cmd.Stderr = io.MultiWriter(os.Stderr, output)
+	}
+
+	execution := executeCmd(cmd, run)
+	if output != nil {
+		execution.Output = output.String()
+	}
+	return execution
+}
+
+// executeCmd runs cmd and returns its exit code (128 plus the signal number when it was killed
+// by a signal, 127 when it couldn't be started), when it started and how long it ran. With a
+// run timeout, a command still running after it gets SIGTERM, then SIGKILL after kill_after.
+func executeCmd(cmd *exec.Cmd, run config.RunConfig) model.Execution {
+	// Ctrl-C is for the command; tell keeps running to record how it ended
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+
+	// A timed out command is stopped with everything it started
+	var tty *os.File
+	if run.Timeout > 0 {
+		if stdin, ok := cmd.Stdin.(*os.File); ok && progress.IsTerminal(stdin) {
+			tty = stdin
+		}
+		startInOwnGroup(cmd, tty)
+	}
+
+	startedAt := time.Now()
+	if err := cmd.Start(); err != nil {
+		slog.Error("Failed to start shell", "path", cmd.Path, "error", err)
+		fmt.Fprintf(os.Stderr, "Error: could not run command: %v\n", err)
+		return model.Execution{ExitCode: 127, StartedAt: startedAt, Duration: time.Since(startedAt)}
+	}
+
+	// Stop the command once it runs past the timeout, and kill it if it ignores SIGTERM
+	done := make(chan struct{})
+	var timedOut atomic.Bool
+	if run.Timeout > 0 {
+		go func() {
+			select {
+			case <-done:
+				return
+			case <-time.After(run.Timeout):
+			}
+			timedOut.Store(true)
+			fmt.Fprintf(os.Stderr, "\ntell: the command ran longer than %s, stopping it\n", run.Timeout)
+			terminateGroup(cmd)
+
+			select {
+			case <-done:
+			case <-time.After(run.KillAfter):
+				killGroup(cmd)
+			}
+		}()
+	}
+
+	err := cmd.Wait()
+	close(done)
+	execution := model.Execution{StartedAt: startedAt, Duration: time.Since(startedAt), TimedOut: timedOut.Load()}
+	if tty != nil {
+		takeTerminal(tty)
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		execution.ExitCode = 0
+	case errors.As(err, &exitErr):
+		execution.ExitCode = exitErr.ExitCode()
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			execution.ExitCode = 128 + int(status.Signal())
+		}
+	default:
+		slog.Error("Failed to run shell", "path", cmd.Path, "error", err)
+		fmt.Fprintf(os.Stderr, "Error: could not run command: %v\n", err)
+		execution.ExitCode = 127
+	}
+	return execution
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+// Write appends p, dropping the start of the buffer when it grows past max
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the kept output, without a multi-byte character cut in half at its start
+func (t *tailBuffer) String() string {
+	return strings.ToValidUTF8(string(t.buf), "")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/policy"
+	"github.com/jonfk/tell/internal/sandbox"
+)
+
+// trialRun runs command in a sandbox with its output on the terminal, then reports how it
+// ended and which files it left in its temporary directory. Nothing the command does in the
+// sandbox is kept. The run timeout applies like to real runs. Commands the policy or the safety
+// level refuse aren't tried either.
+func trialRun(cfg *config.Config, tty *terminal, command string) {
+	err := policy.Check(command, cfg.Policy)
+	if err == nil {
+		err = policy.CheckSafety(command, cfg.Safety(), forceFlag)
+	}
+	if err != nil {
+		slog.Error("Command refused", "error", err)
+		fmt.Fprintf(tty, "Error: %v\n", err)
+		return
+	}
+
+	box, err := sandbox.Find()
+	if err != nil {
+		slog.Error("No sandbox available", "error", err)
+		fmt.Fprintf(tty, "Error: could not try the command: %v\n", err)
+		return
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		slog.Error("Failed to get working directory", "error", err)
+		fmt.Fprintf(tty, "Error: could not try the command: %v\n", err)
+		return
+	}
+
+	scratch, err := os.MkdirTemp("", "tell-sandbox-*")
+	if err != nil {
+		slog.Error("Failed to create sandbox directory", "error", err)
+		fmt.Fprintf(tty, "Error: could not try the command: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(scratch)
+
+	fmt.Fprintf(tty, "Trying the command in a sandbox: files are read-only and there is no network.\n")
+	fmt.Fprintf(tty, "--- sandbox ---\n")
+
+	// The command gets no input, so it can't wait on the terminal
+	cmd := box.Command(runShell(), command, dir, scratch)
+	cmd.Stdout = tty.out
+	cmd.Stderr = tty.out
+	execution := executeCmd(cmd, cfg.Run)
+	slog.Debug("Sandboxed command finished", "exit_code", execution.ExitCode, "duration", execution.Duration)
+
+	fmt.Fprintf(tty, "--- exit code %d, took %s ---\n", execution.ExitCode, execution.Duration.Round(time.Millisecond))
+	for _, file := range scratchFiles(scratch) {
+		fmt.Fprintf(tty, "Wrote temporary file %s\n", file)
+	}
+}
+
+// scratchFiles lists the files under the sandbox's temporary directory, relative to it
+func scratchFiles(scratch string) []string {
+	var files []string
+	filepath.WalkDir(scratch, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(scratch, path); err == nil {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/conventions"
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/policy"
+	"github.com/spf13/cobra"
+)
+
+// scriptResponse is the JSON output of the script command
+type scriptResponse struct {
+	*model.Script
+	// Path is the file the script was written to, empty when it was only printed
+	Path      string `json:"path,omitempty"`
+	HistoryID int64  `json:"history_id,omitempty"`
+}
+
+// newScriptCmd creates the script command, which writes a complete shell script instead of a
+// one-liner
+func newScriptCmd() *cobra.Command {
+	var output string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "script [description]",
+		Short: "Generate a complete shell script",
+		Long: `Generate a complete, commented shell script with a shebang, set -euo pipefail and argument
+parsing, for tasks too big for a one-liner. With --output the script is written to a file with
+execute permissions, otherwise it is printed:
+
+  tell script "back up a directory to S3, keeping 7 daily copies" --output backup.sh`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			prompt := strings.Join(args, " ")
+
+			// Check before asking for a script that can't be written
+			if output != "" && !force {
+				if _, err := os.Stat(output); err == nil {
+					fmt.Fprintf(os.Stderr, "Error: %s already exists, use --force to overwrite it\n", output)
+					os.Exit(1)
+				}
+			}
+
+			cfg := loadConfig()
+			if cfg.Cmd {
+				fmt.Fprintf(os.Stderr, "Error: tell script doesn't write batch files, use --shell pwsh for a PowerShell script\n")
+				os.Exit(1)
+			}
+
+			// Initialize database
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				// Don't exit if just the database fails; we can still write the script
+			}
+
+			clientOpts := []llm.Option{llm.WithContext(collectContext(cfg, db, prompt))}
+			if target := targetHost(cfg); target != nil {
+				clientOpts = append(clientOpts, llm.WithTargetHost(target))
+			}
+			override := overrideModel()
+			if override != nil {
+				clientOpts = append(clientOpts, llm.WithModel(override.Model))
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
+
+			var script *model.Script
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				script, usage, genErr = client.GenerateScript(prompt)
+			})
+			if genErr == nil {
+				genErr = finishScript(cfg, script, output)
+			}
+
+			// Record that the model was overridden
+			if override != nil && usage != nil {
+				usage.Route = override.Tier
+			}
+
+			// The script is stored as the command, with its description and usage as the details
+			var historyID int64
+			if db != nil {
+				response := &model.CommandResponse{}
+				if script != nil {
+					response.Command = script.Script
+					response.Details = formatScriptDetails(script, output)
+				}
+				historyID = saveHistory(db, prompt, response, usage, genErr, sql.NullInt64{}, model.EntryTypeScript)
+				db.Close()
+			}
+
+			if genErr != nil {
+				slog.Error("Failed to generate script", "error", genErr)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", genErr)
+				os.Exit(1)
+			}
+
+			if output != "" {
+				if err := writeScript(output, script.Script); err != nil {
+					slog.Error("Failed to write script", "path", output, "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			// Display debug info if requested
+			if verboseFlag && usage != nil {
+				fmt.Fprintf(os.Stderr, "Model: %s\n", usage.Model)
+				if usage.Retries > 0 {
+					fmt.Fprintf(os.Stderr, "Retried: %d times\n", usage.Retries)
+				}
+				fmt.Fprintf(os.Stderr, "Tokens used: input=%d, output=%d\n", usage.InputTokens, usage.OutputTokens)
+				if cost := requestCost(cfg, usage.Model, usage.InputTokens, usage.OutputTokens); cost != "" {
+					fmt.Fprintf(os.Stderr, "Cost: %s\n", cost)
+				}
+			}
+
+			if formatFlag == "json" {
+				jsonData, err := json.Marshal(scriptResponse{Script: script, Path: output, HistoryID: historyID})
+				if err != nil {
+					slog.Error("Failed to marshal script to JSON", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(jsonData))
+				return
+			}
+
+			// Without a file the script goes to stdout so it can be redirected, and the rest to stderr
+			if output == "" {
+				fmt.Println(script.Script)
+				fmt.Fprintf(os.Stderr, "\n%s", formatScriptDetails(script, ""))
+				return
+			}
+			fmt.Print(formatScriptDetails(script, output))
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the script to this file, with execute permissions")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite the --output file if it exists")
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json")
+	cmd.Flags().StringArrayVarP(&contextFileFlag, "context-file", "F", nil, "Attach a file as context (repeatable)")
+	cmd.Flags().BoolVar(&noStdinFlag, "no-stdin", false, "Don't send data piped to stdin as context")
+	cmd.Flags().BoolVar(&posixFlag, "posix", false, "Only use POSIX sh syntax and POSIX utility flags (default: posix in config)")
+	cmd.Flags().BoolVar(&busyboxFlag, "busybox", false, "Only use BusyBox applets and the options they support (default: busybox in config)")
+	cmd.Flags().StringVar(&targetHostFlag, "target-host", "", "Write the script for this SSH host instead of the local system")
+	cmd.Flags().StringVar(&targetOSFlag, "target-os", "", "Write the script for this OS or distribution (linux, macos, ubuntu:22.04, ...) instead of the local system")
+	cmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	cmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
+
+	return cmd
+}
+
+// finishScript applies the file conventions to a generated script and checks it against the
+// blocked patterns of the policy. The allowlist isn't applied, since tell doesn't run the script.
+func finishScript(cfg *config.Config, script *model.Script, output string) error {
+	path := output
+	if path == "" {
+		path = "script.sh"
+	}
+	script.Script = conventions.ApplyToScript(script.Script, path, cfg.FileConventions)
+
+	return policy.Check(script.Script, config.PolicyConfig{Blocked: cfg.Policy.Blocked})
+}
+
+// writeScript writes script to path and makes it executable, also when the file already existed
+func writeScript(path string, script string) error {
+	if err := os.WriteFile(path, []byte(script+"\n"), 0o755); err != nil {
+		return fmt.Errorf("could not write script: %w", err)
+	}
+	if err := os.Chmod(path, 0o755); err != nil {
+		return fmt.Errorf("could not make script executable: %w", err)
+	}
+	return nil
+}
+
+// formatScriptDetails renders what a script does, how to call it and where it was written
+func formatScriptDetails(script *model.Script, path string) string {
+	var sb strings.Builder
+
+	if script.Description != "" {
+		fmt.Fprintf(&sb, "%s\n", script.Description)
+	}
+	if script.Usage != "" {
+		fmt.Fprintf(&sb, "Usage: %s\n", script.Usage)
+	}
+	if path != "" {
+		fmt.Fprintf(&sb, "Wrote %s\n", path)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/storage"
+)
+
+// embeddingBatchSize is the number of history entries embedded in a single request
+const embeddingBatchSize = 64
+
+// searchSemantic returns up to limit history entries closest in meaning to query. Entries
+// without an embedding for the configured model are embedded first, so the first search
+// indexes the whole history and later ones only what was added since.
+func searchSemantic(db *storage.DB, query string, limit int, entryType string, tag string) ([]model.HistoryEntry, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load configuration: %w", err)
+	}
+
+	provider, settings, err := cfg.EmbeddingSettings()
+	if err != nil {
+		return nil, err
+	}
+	// Replayed responses don't need a key
+	if config.RequiresAPIKey(provider) && settings.APIKey == "" && replayFlag == "" {
+		return nil, fmt.Errorf("API key for embedding provider %s not set, run 'tell config edit' to set it", provider)
+	}
+
+	httpClient, err := fixtureHTTPClient(recordFlag, replayFlag)
+	if err != nil {
+		return nil, err
+	}
+	embedder, err := llm.NewEmbedder(cfg, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	indexed := 0
+	for {
+		entries, err := db.GetUnembeddedEntries(embedder.Name(), embeddingBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		if indexed == 0 {
+			fmt.Fprintf(os.Stderr, "Indexing history for semantic search with %s...\n", embedder.Name())
+		}
+
+		texts := make([]string, len(entries))
+		for i, entry := range entries {
+			texts[i] = embeddingText(entry)
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("could not embed history: %w", err)
+		}
+		for i, entry := range entries {
+			if err := db.SaveEmbedding(entry.ID, embedder.Name(), vectors[i]); err != nil {
+				return nil, err
+			}
+		}
+		indexed += len(entries)
+	}
+	if indexed > 0 {
+		slog.Debug("Embedded history entries", "count", indexed, "model", embedder.Name())
+	}
+
+	vectors, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("could not embed query: %w", err)
+	}
+
+	return db.SemanticSearch(vectors[0], embedder.Name(), limit, entryType, tag)
+}
+
+// embeddingText is the text of a history entry that is embedded: the prompt with the command,
+// or with the first line of an answer, summary or script description
+func embeddingText(entry model.HistoryEntry) string {
+	switch entry.EntryType {
+	case model.EntryTypeAnswer, model.EntryTypeSummary, model.EntryTypeScript:
+		firstLine, _, _ := strings.Cut(entry.Details, "\n")
+		return entry.Prompt + "\n" + firstLine
+	default:
+		return entry.Prompt + "\n" + entry.Command
+	}
+}
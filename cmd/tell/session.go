@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+// sessionEnvVar names a session for prompts made from one shell, instead of the active one
+const sessionEnvVar = "TELL_SESSION"
+
+// newSessionCmd creates the session command, which manages named conversations
+func newSessionCmd() *cobra.Command {
+	sessionCmd := &cobra.Command{
+		Use:   "session",
+		Short: "Manage named conversations",
+		Long: `Sessions are named conversations: while a session is active, each prompt is sent with the
+commands generated before in the session, in order, like --continue does with the last one. Start a
+session for a task, such as a migration, and resume it later. Setting TELL_SESSION to the name of a
+session uses it from that shell instead of the active one.`,
+	}
+
+	startCmd := &cobra.Command{
+		Use:     "start [name]",
+		Short:   "Start a session and make it the active one",
+		Example: `  tell session start "migrating postgres"`,
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := strings.TrimSpace(args[0])
+			// Sessions are looked up by name or ID
+			if _, err := strconv.ParseInt(name, 10, 64); err == nil || name == "" {
+				fmt.Fprintf(os.Stderr, "Error: invalid session name %q: it can't be empty or a number\n", args[0])
+				os.Exit(1)
+			}
+
+			db := openSessionDB()
+			defer db.Close()
+
+			if existing, err := db.GetSession(name); err == nil && existing != nil {
+				fmt.Fprintf(os.Stderr, "Error: a session named %q already exists, resume it with 'tell session resume %q'\n", name, name)
+				os.Exit(1)
+			}
+
+			session, err := db.CreateSession(name)
+			if err != nil {
+				slog.Error("Failed to create session", "name", name, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			activateSession(db, session)
+		},
+	}
+
+	resumeCmd := &cobra.Command{
+		Use:               "resume [name or id]",
+		Short:             "Make a session the active one again",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeSessions,
+		Run: func(cmd *cobra.Command, args []string) {
+			db := openSessionDB()
+			defer db.Close()
+
+			activateSession(db, findSession(db, args[0]))
+		},
+	}
+
+	endCmd := &cobra.Command{
+		Use:   "end",
+		Short: "Stop making prompts in the active session",
+		Long:  "Stop making prompts in the active session. Its commands are kept, and it can be resumed later.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			db := openSessionDB()
+			defer db.Close()
+
+			session, err := db.GetActiveSession()
+			if err != nil {
+				slog.Error("Failed to get active session", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if session == nil {
+				fmt.Println("No session is active.")
+				return
+			}
+
+			if err := db.SetActiveSession(0); err != nil {
+				slog.Error("Failed to end session", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Ended session %q.\n", session.Name)
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List sessions, most recently used first",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			db := openSessionDB()
+			defer db.Close()
+
+			sessions, err := db.GetSessions()
+			if err != nil {
+				slog.Error("Failed to retrieve sessions", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if len(sessions) == 0 {
+				fmt.Println("No sessions yet. Start one with 'tell session start <name>'.")
+				return
+			}
+
+			for _, session := range sessions {
+				marker := " "
+				if session.Active {
+					marker = "*"
+				}
+				fmt.Printf("%s [%d] %s (%d entries, last used %s)\n", marker, session.ID, session.Name,
+					session.Entries, session.LastUsed.Format("2006-01-02 15:04:05"))
+			}
+		},
+	}
+
+	showCmd := &cobra.Command{
+		Use:               "show [name or id]",
+		Short:             "Show the conversation of a session, the active one by default",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeSessions,
+		Run: func(cmd *cobra.Command, args []string) {
+			db := openSessionDB()
+			defer db.Close()
+
+			var session *model.Session
+			if len(args) > 0 {
+				session = findSession(db, args[0])
+			} else {
+				var err error
+				session, err = db.GetActiveSession()
+				if err != nil {
+					slog.Error("Failed to get active session", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				if session == nil {
+					fmt.Fprintf(os.Stderr, "Error: no session is active, name the session to show\n")
+					os.Exit(1)
+				}
+			}
+
+			entries, err := db.GetSessionEntries(session.ID)
+			if err != nil {
+				slog.Error("Failed to retrieve session entries", "session", session.ID, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Session: %s", session.Name)
+			if session.Active {
+				fmt.Print(" (active)")
+			}
+			fmt.Println()
+			fmt.Printf("Started: %s\n", session.CreatedAt.Format(time.RFC1123))
+			fmt.Println(strings.Repeat("-", 80))
+
+			for _, entry := range entries {
+				fmt.Printf("[%d] %s\n", entry.ID, entry.Timestamp.Format("2006-01-02 15:04:05"))
+				fmt.Printf("Prompt: %s\n", entry.Prompt)
+				if entry.ErrorMessage != "" {
+					fmt.Printf("Error: %s\n", entry.ErrorMessage)
+				} else {
+					fmt.Printf("Command: %s\n", entry.Command)
+				}
+				if entry.ExitCode.Valid {
+					fmt.Printf("Exit code: %d\n", entry.ExitCode.Int64)
+				}
+				fmt.Println(strings.Repeat("-", 80))
+			}
+		},
+	}
+
+	sessionCmd.AddCommand(startCmd, resumeCmd, endCmd, listCmd, showCmd)
+	return sessionCmd
+}
+
+// openSessionDB opens the database for the session commands, which can't work without it
+func openSessionDB() *storage.DB {
+	db, err := initializeDatabase()
+	if err != nil {
+		slog.Error("Failed to initialize database", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return db
+}
+
+// findSession returns the session with the given name or ID, exiting when there is none
+func findSession(db *storage.DB, nameOrID string) *model.Session {
+	session, err := db.GetSession(nameOrID)
+	if err != nil {
+		slog.Error("Failed to get session", "session", nameOrID, "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if session == nil {
+		fmt.Fprintf(os.Stderr, "Error: no session named %q, list them with 'tell session list'\n", nameOrID)
+		os.Exit(1)
+	}
+	return session
+}
+
+// activateSession makes session the active one and says so
+func activateSession(db *storage.DB, session *model.Session) {
+	if err := db.SetActiveSession(session.ID); err != nil {
+		slog.Error("Failed to activate session", "session", session.ID, "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Session %q is active, prompts continue its conversation until 'tell session end'.\n", session.Name)
+}
+
+// sessionConversation returns the session prompts are made in, named by TELL_SESSION or the
+// active one, and its commands to send as the earlier turns of the conversation. Failed
+// generations are left out. Returns nil when there is no session.
+func sessionConversation(db *storage.DB) (*model.Session, []model.HistoryEntry) {
+	var session *model.Session
+	if name := os.Getenv(sessionEnvVar); name != "" {
+		session = findSession(db, name)
+	} else {
+		var err error
+		session, err = db.GetActiveSession()
+		if err != nil {
+			slog.Error("Failed to get active session", "error", err)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if session == nil {
+			return nil, nil
+		}
+	}
+
+	entries, err := db.GetSessionEntries(session.ID)
+	if err != nil {
+		slog.Error("Failed to retrieve session entries", "session", session.ID, "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	var previous []model.HistoryEntry
+	for _, entry := range entries {
+		if entry.ErrorMessage == "" && entry.Command != "" && entry.EntryType == model.EntryTypeCommand {
+			previous = append(previous, entry)
+		}
+	}
+	return session, previous
+}
+
+// completeSessions offers the names of the sessions, most recently used first
+func completeSessions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	db, err := initializeDatabase()
+	if err != nil {
+		slog.Debug("Could not open the database to complete sessions", "error", err)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	defer db.Close()
+
+	sessions, err := db.GetSessions()
+	if err != nil {
+		slog.Debug("Could not read sessions to complete them", "error", err)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, session := range sessions {
+		if strings.HasPrefix(session.Name, toComplete) {
+			names = append(names, fmt.Sprintf("%s\t%d entries", session.Name, session.Entries))
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// How much of the usage 'tell stats' shows as text. The JSON output has every day and week.
+const (
+	statsRecentDays  = 14
+	statsRecentWeeks = 8
+	statsTopCommands = 10
+)
+
+// stats is the JSON output of 'tell stats'
+type stats struct {
+	Since *time.Time `json:"since,omitempty"`
+	*model.UsageStats
+	Parsing []model.ParseStats `json:"parsing"`
+}
+
+// newStatsCmd creates the stats command, which summarizes usage recorded in the history
+func newStatsCmd() *cobra.Command {
+	var formatFlag string
+	var sinceFlag string
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show usage statistics",
+		Long: `Show statistics from the command history: entries per day and week, requests and tokens by model,
+how often requests failed and commands run failed, the commands generated most often, the average size of
+responses, and how often responses parse for each system prompt style.`,
+		Example: `  tell stats
+  tell stats --since 30d
+  tell stats --format json`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if formatFlag != "text" && formatFlag != "json" {
+				fmt.Fprintf(os.Stderr, "Error: unknown format %q, use text or json\n", formatFlag)
+				os.Exit(1)
+			}
+
+			var since time.Time
+			if sinceFlag != "" {
+				var err error
+				if since, err = parseSince(sinceFlag, time.Now()); err != nil {
+					slog.Error("Invalid --since", "since", sinceFlag, "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			usage, err := db.GetUsageStats(since, statsTopCommands)
+			if err != nil {
+				slog.Error("Failed to retrieve usage stats", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			parseStats, err := db.GetParseStats(since)
+			if err != nil {
+				slog.Error("Failed to retrieve parse stats", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if formatFlag == "json" {
+				out := stats{UsageStats: usage, Parsing: parseStats}
+				if !since.IsZero() {
+					out.Since = &since
+				}
+				if out.Parsing == nil {
+					out.Parsing = []model.ParseStats{}
+				}
+				jsonData, err := json.MarshalIndent(out, "", "  ")
+				if err != nil {
+					slog.Error("Failed to marshal stats to JSON", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(jsonData))
+				return
+			}
+
+			if usage.Entries == 0 {
+				fmt.Println("No statistics recorded yet.")
+				return
+			}
+
+			printUsageStats(usage)
+			if len(parseStats) > 0 {
+				fmt.Println()
+				printParseStats(parseStats)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json")
+	cmd.Flags().StringVar(&sinceFlag, "since", "", "Only count entries since a date (2024-05-01) or for a duration (24h, 7d, 2w)")
+
+	return cmd
+}
+
+// printUsageStats prints the summary of the history as tables
+func printUsageStats(usage *model.UsageStats) {
+	fmt.Printf("Entries: %d\n", usage.Entries)
+	fmt.Printf("Requests: %d, %d failed (%.0f%%)\n", usage.Requests, usage.Errors, percent(usage.Errors, usage.Requests))
+	fmt.Printf("Commands run: %d, %d failed (%.0f%%)\n", usage.Runs, usage.FailedRuns, percent(usage.FailedRuns, usage.Runs))
+	fmt.Printf("Average response: %.0f output tokens, %.0f characters\n", usage.AvgOutputTokens, usage.AvgResponseChars)
+
+	fmt.Println()
+	fmt.Println("Entries per day:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tENTRIES")
+	for _, day := range usage.Days[:min(len(usage.Days), statsRecentDays)] {
+		fmt.Fprintf(w, "%s\t%d\n", day.Start, day.Entries)
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Entries per week:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WEEK OF\tENTRIES")
+	for _, week := range usage.Weeks[:min(len(usage.Weeks), statsRecentWeeks)] {
+		fmt.Fprintf(w, "%s\t%d\n", week.Start, week.Entries)
+	}
+	w.Flush()
+
+	if len(usage.Models) > 0 {
+		fmt.Println()
+		fmt.Println("Requests by model:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MODEL\tREQUESTS\tFAILED\tINPUT TOKENS\tOUTPUT TOKENS")
+		for _, m := range usage.Models {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", m.Model, m.Requests, m.Errors, m.InputTokens, m.OutputTokens)
+		}
+		w.Flush()
+	}
+
+	if len(usage.TopCommands) > 0 {
+		fmt.Println()
+		fmt.Println("Most reused commands:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "GENERATED\tRUN\tCOMMAND")
+		for _, c := range usage.TopCommands {
+			fmt.Fprintf(w, "%d\t%d\t%s\n", c.Generated, c.Runs, c.Command)
+		}
+		w.Flush()
+	}
+}
+
+// printParseStats prints parse success per system prompt variant, to compare prompt_style settings
+func printParseStats(parseStats []model.ParseStats) {
+	fmt.Println("Response parsing by system prompt style:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STYLE\tREQUESTS\tFIRST TRY\tREPAIRED\tFAILED\tAVG INPUT TOKENS\tAVG OUTPUT TOKENS")
+	for _, s := range parseStats {
+		variant := s.PromptVariant
+		if variant == "" {
+			variant = "unknown"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d (%.0f%%)\t%d\t%d\t%.0f\t%.0f\n",
+			variant, s.Requests, s.FirstTry, percent(s.FirstTry, s.Requests),
+			s.Repaired, s.Failed, s.AvgInputTokens, s.AvgOutputTokens)
+	}
+	w.Flush()
+}
+
+// percent returns n as a percentage of total
+func percent(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
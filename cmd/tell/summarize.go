@@ -0,0 +1,134 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jonfk/tell/internal/llm"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/progress"
+	"github.com/spf13/cobra"
+)
+
+// summarizeResponse is the JSON output of the summarize command
+type summarizeResponse struct {
+	Summary string `json:"summary"`
+}
+
+// newSummarizeCmd creates the summarize command, which sits at the end of a pipe and
+// summarizes the output of other commands
+func newSummarizeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "summarize [focus]",
+		Short: "Summarize command output piped to tell",
+		Long: `Summarize logs, diffs, process lists and other command output read from stdin, pointing out
+notable anomalies. An optional focus tells tell what you care about, e.g.
+
+  journalctl -u nginx --since today | tell summarize
+  git diff main | tell summarize "anything that changes the public API"`,
+		Run: func(cmd *cobra.Command, args []string) {
+			focus := strings.Join(args, " ")
+
+			// Summarize only reads piped input, it would otherwise wait for the user to type
+			if progress.IsTerminal(os.Stdin) {
+				fmt.Fprintf(os.Stderr, "Error: summarize reads command output from stdin, e.g. 'dmesg | tell summarize'\n")
+				os.Exit(1)
+			}
+
+			input, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				slog.Error("Failed to read stdin", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: could not read stdin: %v\n", err)
+				os.Exit(1)
+			}
+
+			if strings.TrimSpace(string(input)) == "" {
+				fmt.Fprintf(os.Stderr, "Error: nothing to summarize: input is empty\n")
+				os.Exit(1)
+			}
+
+			cfg := loadConfig()
+
+			// Initialize database
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				// Don't exit if just the database fails; we can still summarize
+			}
+
+			// The piped input is the context, so no context probes are run
+			var clientOpts []llm.Option
+			override := overrideModel()
+			if override != nil {
+				clientOpts = append(clientOpts, llm.WithModel(override.Model))
+			}
+			client, ticker, cleanup := newLLMClient(cfg, db, clientOpts...)
+			defer cleanup()
+
+			var summary string
+			var usage *model.LLMUsage
+			var genErr error
+			withProgress(ticker, func() {
+				summary, usage, genErr = client.Summarize(string(input), focus)
+			})
+
+			// Record that the model was overridden
+			if override != nil && usage != nil {
+				usage.Route = override.Tier
+			}
+
+			// Summaries are stored in the details column, the input itself isn't kept
+			if db != nil {
+				prompt := fmt.Sprintf("summarize %d lines of input", strings.Count(string(input), "\n"))
+				if focus != "" {
+					prompt += ": " + focus
+				}
+				response := &model.CommandResponse{Details: summary, ShowDetails: true}
+				saveHistory(db, prompt, response, usage, genErr, sql.NullInt64{}, model.EntryTypeSummary)
+				db.Close()
+			}
+
+			if genErr != nil {
+				slog.Error("Failed to summarize input", "error", genErr)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", genErr)
+				os.Exit(1)
+			}
+
+			// Display debug info if requested
+			if verboseFlag && usage != nil {
+				fmt.Fprintf(os.Stderr, "Model: %s\n", usage.Model)
+				if usage.Retries > 0 {
+					fmt.Fprintf(os.Stderr, "Retried: %d times\n", usage.Retries)
+				}
+				fmt.Fprintf(os.Stderr, "Tokens used: input=%d, output=%d\n", usage.InputTokens, usage.OutputTokens)
+				if cost := requestCost(cfg, usage.Model, usage.InputTokens, usage.OutputTokens); cost != "" {
+					fmt.Fprintf(os.Stderr, "Cost: %s\n", cost)
+				}
+			}
+
+			if formatFlag == "json" {
+				jsonData, err := json.Marshal(summarizeResponse{Summary: summary})
+				if err != nil {
+					slog.Error("Failed to marshal summary to JSON", "error", err)
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(jsonData))
+				return
+			}
+
+			fmt.Println(summary)
+		},
+	}
+
+	cmd.Flags().StringVarP(&formatFlag, "format", "f", "text", "Output format: text|json")
+	cmd.Flags().StringVarP(&modelFlag, "model", "m", "", "Use this model for this request instead of the configured one")
+	cmd.Flags().StringVar(&providerFlag, "provider", "", "Use this provider for this request instead of the configured one")
+
+	return cmd
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/histsync"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/jonfk/tell/internal/xdg"
+	"github.com/spf13/cobra"
+)
+
+// syncFileVersion is the version of the history files 'tell sync' writes, increased on
+// incompatible changes
+const syncFileVersion = 1
+
+// syncFile is the history of one machine in the sync target, history-<machine>.json. It only
+// changes when the history does, so backends like git don't record syncs that changed nothing.
+type syncFile struct {
+	Version   int              `json:"version"`
+	Machine   string           `json:"machine"`
+	Entries   []syncedEntry    `json:"entries"`
+	Deletions []syncedDeletion `json:"deletions,omitempty"`
+}
+
+// syncedEntry is an entry of the JSON export with what merging it needs: the UID of its parent,
+// since IDs differ between machines, and when it last changed
+type syncedEntry struct {
+	exportedEntry
+	ParentUID string     `json:"parent_uid,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// syncedDeletion is an entry deleted on one of the machines
+type syncedDeletion struct {
+	UID       string    `json:"uid"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// unsafeFileChars matches what can't be in the name of the history file of a machine
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// newSyncCmd creates the sync command, which merges the history of every machine in the sync
+// target
+func newSyncCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync",
+		Short: "Share history with your other machines",
+		Long: `Merge the history of your other machines into this one, and share this one's with them.
+
+Each machine keeps its history in its own file in the sync target, set with sync.backend and
+sync.target in the config: a directory another tool syncs, such as Dropbox or Syncthing (dir), an
+rclone remote (rclone) or a git repository (git). Entries are the same on every machine, so new
+entries are added once, entries deleted on one machine are deleted on the others, and favorites,
+tags, edits and how commands ran are taken from the machine that changed them last. With
+history.encrypt, the text of the entries is encrypted in the files, and every machine needs the
+same key.`,
+		Example: `  tell sync`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load()
+			if err != nil {
+				slog.Error("Failed to load configuration", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			machine, result, err := syncHistory(context.Background(), cfg.Sync, db)
+			if err != nil {
+				slog.Error("Failed to sync history", "backend", cfg.Sync.Backend, "target", cfg.Sync.Target, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Synced history with %s as %s: %d added, %d updated, %d deleted.\n",
+				cfg.Sync.Target, machine, result.Added, result.Updated, result.Deleted)
+		},
+	}
+}
+
+// syncHistory merges the history files in the sync target into the history, then writes the
+// history of this machine to the target. Returns the name of this machine and what changed.
+func syncHistory(ctx context.Context, cfg config.SyncConfig, db *storage.DB) (string, storage.SyncResult, error) {
+	var total storage.SyncResult
+
+	machine, err := syncMachineName(cfg)
+	if err != nil {
+		return "", total, err
+	}
+
+	cacheDir, err := xdg.CacheDir()
+	if err != nil {
+		return "", total, fmt.Errorf("could not get cache directory: %w", err)
+	}
+	backend, err := histsync.New(cfg, cacheDir)
+	if err != nil {
+		return "", total, err
+	}
+
+	if err := backend.Pull(ctx); err != nil {
+		return "", total, fmt.Errorf("could not get history from %s: %w", cfg.Target, err)
+	}
+
+	// This machine's own file too, for a history that was lost since it was written
+	paths, err := filepath.Glob(filepath.Join(backend.Dir(), "history-*.json"))
+	if err != nil {
+		return "", total, fmt.Errorf("could not list history files: %w", err)
+	}
+	for _, path := range paths {
+		entries, deletions, err := readSyncFile(path, db)
+		if err != nil {
+			return "", total, err
+		}
+		result, err := db.ApplySync(entries, deletions)
+		if err != nil {
+			return "", total, fmt.Errorf("could not merge %s: %w", filepath.Base(path), err)
+		}
+		slog.Debug("Merged history", "file", filepath.Base(path), "added", result.Added, "updated", result.Updated, "deleted", result.Deleted)
+		total.Added += result.Added
+		total.Updated += result.Updated
+		total.Deleted += result.Deleted
+	}
+
+	name := "history-" + machine + ".json"
+	if err := writeSyncFile(filepath.Join(backend.Dir(), name), machine, db); err != nil {
+		return "", total, err
+	}
+	if err := backend.Push(ctx, name); err != nil {
+		return "", total, fmt.Errorf("could not send history to %s: %w", cfg.Target, err)
+	}
+
+	return machine, total, nil
+}
+
+// syncMachineName returns the name of this machine's history file, sync.machine or the host name
+func syncMachineName(cfg config.SyncConfig) (string, error) {
+	machine := cfg.Machine
+	if machine == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("could not get host name, set sync.machine in the config: %w", err)
+		}
+		machine = hostname
+	}
+	return unsafeFileChars.ReplaceAllString(machine, "-"), nil
+}
+
+// readSyncFile reads the history of a machine written by writeSyncFile, decrypting the entries a
+// machine with encrypted history wrote
+func readSyncFile(path string, db *storage.DB) ([]storage.SyncedEntry, []storage.Deletion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	var file syncFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	if file.Version > syncFileVersion {
+		return nil, nil, fmt.Errorf("%s was written by a newer version of tell, upgrade tell to sync", filepath.Base(path))
+	}
+
+	entries := make([]storage.SyncedEntry, 0, len(file.Entries))
+	for _, synced := range file.Entries {
+		entry := storage.SyncedEntry{HistoryEntry: importedEntry(synced.exportedEntry), ParentUID: synced.ParentUID}
+		// IDs are those of the other machine, and uses are counted on each machine
+		entry.ParentID = sql.NullInt64{}
+		entry.UseCount, entry.LastUsedAt = 0, sql.NullTime{}
+		if synced.UpdatedAt != nil {
+			entry.UpdatedAt = sql.NullTime{Time: *synced.UpdatedAt, Valid: true}
+		}
+		if err := db.OpenSynced(&entry.HistoryEntry); err != nil {
+			return nil, nil, fmt.Errorf("could not read %s: %w; machines syncing encrypted history need encrypt: true and the same key, in the keyring or %s",
+				filepath.Base(path), err, historyKeyEnvVar)
+		}
+		entries = append(entries, entry)
+	}
+
+	deletions := make([]storage.Deletion, 0, len(file.Deletions))
+	for _, deletion := range file.Deletions {
+		deletions = append(deletions, storage.Deletion{UID: deletion.UID, DeletedAt: deletion.DeletedAt})
+	}
+
+	return entries, deletions, nil
+}
+
+// writeSyncFile writes the history of this machine to path, replacing the previous one at once so
+// tools syncing the directory never see half a file. With encrypted history, the text of the
+// entries is encrypted in the file too.
+func writeSyncFile(path string, machine string, db *storage.DB) error {
+	entries, err := db.GetSyncedEntries()
+	if err != nil {
+		return err
+	}
+	deletions, err := db.GetDeletions()
+	if err != nil {
+		return err
+	}
+
+	file := syncFile{
+		Version:   syncFileVersion,
+		Machine:   machine,
+		Entries:   make([]syncedEntry, 0, len(entries)),
+		Deletions: make([]syncedDeletion, 0, len(deletions)),
+	}
+	for _, entry := range entries {
+		if err := db.SealSynced(&entry.HistoryEntry); err != nil {
+			return fmt.Errorf("could not encrypt history entry %d: %w", entry.ID, err)
+		}
+		synced := syncedEntry{exportedEntry: exportEntry(entry.HistoryEntry), ParentUID: entry.ParentUID}
+		synced.ParentID = nil
+		synced.UseCount, synced.LastUsedAt = 0, nil
+		if entry.UpdatedAt.Valid {
+			synced.UpdatedAt = &entry.UpdatedAt.Time
+		}
+		file.Entries = append(file.Entries, synced)
+	}
+	for _, deletion := range deletions {
+		file.Deletions = append(file.Deletions, syncedDeletion{UID: deletion.UID, DeletedAt: deletion.DeletedAt})
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode history: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("could not write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	return nil
+}
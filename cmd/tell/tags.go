@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// tagPattern matches tags once lower-cased: a single word, so tags print separated by spaces
+var tagPattern = regexp.MustCompile(`^[\p{Ll}\p{N}_][\p{Ll}\p{N}_.:/-]*$`)
+
+// normalizeTag lower-cases a tag and drops a leading #, so #Docker and docker are the same tag
+func normalizeTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.TrimPrefix(tag, "#"))
+	if !tagPattern.MatchString(normalized) {
+		return "", fmt.Errorf("invalid tag %q: use letters, digits, _, ., :, / and -", tag)
+	}
+	return normalized, nil
+}
+
+// newHistoryTagCmd creates the history tag command, which adds tags to a history entry or
+// removes them
+func newHistoryTagCmd() *cobra.Command {
+	var remove bool
+
+	cmd := &cobra.Command{
+		Use:   "tag [id] [tag...]",
+		Short: "Tag a history entry",
+		Long: `Add tags to a history entry, to organize entries by topic and list them with
+'tell history --tag'. Tags are single words, case doesn't matter. With --remove, remove them instead.`,
+		Example: `  tell history tag 42 docker backup
+  tell history tag 42 --remove backup
+  tell history --tag docker`,
+		Args:              cobra.MinimumNArgs(2),
+		ValidArgsFunction: completeHistoryIDs,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			var tags []string
+			for _, arg := range args[1:] {
+				tag, err := normalizeTag(arg)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(1)
+				}
+				tags = append(tags, tag)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			if remove {
+				err = db.RemoveTags(id, tags)
+			} else {
+				err = db.AddTags(id, tags)
+			}
+			if err != nil {
+				slog.Error("Failed to update tags", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			entry, err := db.GetHistoryEntry(id)
+			if err != nil {
+				slog.Error("Failed to retrieve history entry", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			if len(entry.Tags) == 0 {
+				fmt.Printf("Entry %d has no tags.\n", id)
+			} else {
+				fmt.Printf("Entry %d is tagged %s.\n", id, strings.Join(entry.Tags, ", "))
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&remove, "remove", false, "Remove the tags instead of adding them")
+
+	return cmd
+}
+
+// newHistoryTagsCmd creates the history tags command, which lists the tags in use
+func newHistoryTagsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tags",
+		Short: "List the tags of history entries",
+		Long:  "List the tags given to history entries with 'tell history tag', with the number of entries that have each",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			tags, err := db.GetTags()
+			if err != nil {
+				slog.Error("Failed to retrieve tags", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if len(tags) == 0 {
+				fmt.Println("No tags yet. Tag entries with 'tell history tag <id> <tag>...'.")
+				return
+			}
+			for _, tag := range tags {
+				fmt.Printf("%-20s %d\n", tag.Tag, tag.Count)
+			}
+		},
+	}
+}
+
+// completeTags offers the tags in use, most used first
+func completeTags(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	db, err := initializeDatabase()
+	if err != nil {
+		slog.Debug("Could not open the database to complete tags", "error", err)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	defer db.Close()
+
+	tags, err := db.GetTags()
+	if err != nil {
+		slog.Debug("Could not read tags to complete them", "error", err)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var names []string
+	for _, tag := range tags {
+		if strings.HasPrefix(tag.Tag, toComplete) {
+			names = append(names, fmt.Sprintf("%s\t%d entries", tag.Tag, tag.Count))
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
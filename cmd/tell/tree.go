@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/spf13/cobra"
+)
+
+// newHistoryTreeCmd creates the history tree command, which shows the continuations of a history
+// entry as a tree
+func newHistoryTreeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "tree [id]",
+		Short: "Show the continuation tree of a history entry",
+		Long: `Show every entry of the continuation tree a history entry is in, as a tree: the entry the chain
+started from, and the entries continuing each entry below it, from 'tell prompt --continue',
+regenerated and fixed commands, and commands edited before running them. Each line has the ID,
+prompt and command of an entry, and the exit code of commands that failed.`,
+		Example:           `  tell history tree 42`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeHistoryIDs,
+		Run: func(cmd *cobra.Command, args []string) {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				slog.Error("Invalid history ID", "input", args[0], "error", err)
+				fmt.Fprintf(os.Stderr, "Error: Invalid history ID: %s\n", args[0])
+				os.Exit(1)
+			}
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			entries, err := db.GetEntryTree(id)
+			if err != nil {
+				slog.Error("Failed to retrieve history tree", "id", id, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			writeEntryTree(os.Stdout, entries, id)
+		},
+	}
+}
+
+// writeEntryTree draws entries as a tree, from the first entry down, with the entries continuing
+// each entry below it, oldest first. The entry with ID selected is marked.
+func writeEntryTree(w io.Writer, entries []model.HistoryEntry, selected int64) {
+	if len(entries) == 0 {
+		return
+	}
+
+	// Entries are oldest first, so children are too
+	children := make(map[int64][]model.HistoryEntry)
+	for _, entry := range entries[1:] {
+		children[entry.ParentID.Int64] = append(children[entry.ParentID.Int64], entry)
+	}
+
+	var write func(entry model.HistoryEntry, prefix string, branch string, last bool)
+	write = func(entry model.HistoryEntry, prefix string, branch string, last bool) {
+		fmt.Fprintf(w, "%s%s%s\n", prefix, branch, treeLine(entry, entry.ID == selected && len(entries) > 1))
+
+		// Below the root, children hang from the branch of their parent
+		if branch != "" {
+			if last {
+				prefix += "    "
+			} else {
+				prefix += "│   "
+			}
+		}
+		kids := children[entry.ID]
+		for i, child := range kids {
+			if i == len(kids)-1 {
+				write(child, prefix, "└── ", true)
+			} else {
+				write(child, prefix, "├── ", false)
+			}
+		}
+	}
+	write(entries[0], "", "", true)
+}
+
+// treeLine describes a history entry on one line of a tree: its ID, prompt and the first line
+// of its command, or of its details for entries without a command
+func treeLine(entry model.HistoryEntry, selected bool) string {
+	var line strings.Builder
+	fmt.Fprintf(&line, "[%d] %s", entry.ID, strings.Join(strings.Fields(entry.Prompt), " "))
+
+	text := entry.Command
+	if text == "" {
+		text = entry.Details
+	}
+	if first, _, _ := strings.Cut(strings.TrimSpace(text), "\n"); first != "" {
+		fmt.Fprintf(&line, " → %s", first)
+	}
+
+	if entry.ErrorMessage != "" {
+		line.WriteString(" (request failed)")
+	} else if entry.ExitCode.Valid && entry.ExitCode.Int64 != 0 {
+		fmt.Fprintf(&line, " (exit code %d)", entry.ExitCode.Int64)
+	}
+	if entry.Favorite {
+		line.WriteString(" ⭐")
+	}
+	if selected {
+		line.WriteString(" ◀")
+	}
+	return line.String()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// terminal is the terminal tell asks questions on, opened directly with openTTY since stdout is
+// usually captured by the shell integration. On Unix in and out are the same /dev/tty file, on
+// Windows the console's input and output are opened separately.
+type terminal struct {
+	in  *os.File
+	out *os.File
+}
+
+// Read reads an answer typed on the terminal
+func (t *terminal) Read(p []byte) (int, error) {
+	return t.in.Read(p)
+}
+
+// Write writes to the terminal
+func (t *terminal) Write(p []byte) (int, error) {
+	return t.out.Write(p)
+}
+
+// Close closes the terminal's files
+func (t *terminal) Close() error {
+	err := t.in.Close()
+	if t.out != t.in {
+		if outErr := t.out.Close(); err == nil {
+			err = outErr
+		}
+	}
+	return err
+}
+
+// askYesNo asks a question on the terminal and reports whether the user answered yes.
+// Anything else, including a failed read, is a no.
+func askYesNo(tty *terminal, question string) (bool, error) {
+	answer, err := askLine(tty, question+" [y/N]")
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// askLine asks a question on the terminal and returns the answer without surrounding whitespace
+func askLine(tty *terminal, question string) (string, error) {
+	fmt.Fprintf(tty, "%s ", question)
+
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		slog.Debug("Failed to read answer from terminal", "error", err)
+		return "", fmt.Errorf("could not read answer: %w", err)
+	}
+
+	return strings.TrimSpace(line), nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// openTTY opens the controlling terminal, /dev/tty, for reading and writing
+func openTTY() (*terminal, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open terminal: %w", err)
+	}
+	return &terminal{in: tty, out: tty}, nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// openTTY opens the console, which Windows has no /dev/tty for: CONIN$ is its input and
+// CONOUT$ its output, whatever stdin and stdout are redirected to
+func openTTY() (*terminal, error) {
+	in, err := os.OpenFile("CONIN$", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not open console: %w", err)
+	}
+	out, err := os.OpenFile("CONOUT$", os.O_RDWR, 0)
+	if err != nil {
+		in.Close()
+		return nil, fmt.Errorf("could not open console: %w", err)
+	}
+	return &terminal{in: in, out: out}, nil
+}
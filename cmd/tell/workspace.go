@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/jonfk/tell/internal/workspace"
+	"github.com/spf13/cobra"
+)
+
+// workspaceTrusted reports whether context may be collected from the current workspace.
+// The first time a workspace is seen the user is asked on the terminal and the answer is
+// saved. Without a database or a terminal to ask on, the workspace is not trusted.
+func workspaceTrusted(db *storage.DB) bool {
+	if db == nil {
+		return false
+	}
+
+	root, err := workspace.Current()
+	if err != nil {
+		slog.Warn("Failed to find current workspace", "error", err)
+		return false
+	}
+
+	trust, err := db.GetWorkspaceTrust(root)
+	if err != nil {
+		slog.Warn("Failed to check workspace trust", "path", root, "error", err)
+		return false
+	}
+	if trust != nil {
+		slog.Debug("Workspace trust", "path", trust.Path, "trusted", trust.Trusted)
+		return trust.Trusted
+	}
+
+	trusted, answered := askWorkspaceTrust(root)
+	if !answered {
+		return false
+	}
+
+	if err := db.SetWorkspaceTrust(root, trusted); err != nil {
+		slog.Warn("Failed to save workspace trust", "path", root, "error", err)
+	}
+	return trusted
+}
+
+// askWorkspaceTrust asks the user on the terminal whether to trust a workspace.
+// answered is false when there is no terminal to ask on.
+func askWorkspaceTrust(root string) (trusted bool, answered bool) {
+	tty, err := openTTY()
+	if err != nil {
+		slog.Debug("No terminal to ask for workspace trust", "error", err)
+		return false, false
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "tell can send context from this workspace (such as git status) to your LLM provider.\n")
+	trusted, err = askYesNo(tty, fmt.Sprintf("Trust %s?", root))
+	if err != nil {
+		return false, false
+	}
+	return trusted, true
+}
+
+// newWorkspaceCmd creates the workspace command, which manages which workspaces
+// context may be collected from
+func newWorkspaceCmd() *cobra.Command {
+	workspaceCmd := &cobra.Command{
+		Use:   "workspace",
+		Short: "Manage workspace trust",
+		Long:  "Manage which workspaces tell may collect context (git status, files, ...) from",
+	}
+
+	trustCmd := &cobra.Command{
+		Use:   "trust [path]",
+		Short: "Trust a workspace",
+		Long:  "Allow context to be collected from a workspace (the current one by default) and everything below it",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			setWorkspaceTrust(args, true)
+		},
+	}
+
+	untrustCmd := &cobra.Command{
+		Use:   "untrust [path]",
+		Short: "Stop trusting a workspace",
+		Long:  "Never collect context from a workspace (the current one by default) and everything below it",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			setWorkspaceTrust(args, false)
+		},
+	}
+
+	forgetCmd := &cobra.Command{
+		Use:   "forget [path]",
+		Short: "Forget a workspace trust decision",
+		Long:  "Remove the trust decision for a workspace (the current one by default) so you are asked again",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			root := workspaceArg(args)
+
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			if err := db.DeleteWorkspaceTrust(root); err != nil {
+				slog.Error("Failed to forget workspace trust", "path", root, "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Forgot trust decision for %s\n", root)
+		},
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List workspace trust decisions",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := initializeDatabase()
+			if err != nil {
+				slog.Error("Failed to initialize database", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer db.Close()
+
+			trusts, err := db.GetWorkspaceTrusts()
+			if err != nil {
+				slog.Error("Failed to list workspace trust", "error", err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			if len(trusts) == 0 {
+				fmt.Println("No workspace trust decisions recorded.")
+				return
+			}
+
+			for _, trust := range trusts {
+				status := "untrusted"
+				if trust.Trusted {
+					status = "trusted"
+				}
+				fmt.Printf("%-9s  %s  %s\n", status, trust.DecidedAt.Format("2006-01-02"), trust.Path)
+			}
+		},
+	}
+
+	workspaceCmd.AddCommand(trustCmd, untrustCmd, forgetCmd, listCmd)
+	return workspaceCmd
+}
+
+// workspaceArg returns the workspace root for the optional path argument, exiting on failure
+func workspaceArg(args []string) string {
+	var root string
+	var err error
+	if len(args) > 0 {
+		root, err = workspace.Root(args[0])
+	} else {
+		root, err = workspace.Current()
+	}
+	if err != nil {
+		slog.Error("Failed to find workspace", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return root
+}
+
+// setWorkspaceTrust records a trust decision for the workspace given in args
+func setWorkspaceTrust(args []string, trusted bool) {
+	root := workspaceArg(args)
+
+	db, err := initializeDatabase()
+	if err != nil {
+		slog.Error("Failed to initialize database", "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if err := db.SetWorkspaceTrust(root, trusted); err != nil {
+		slog.Error("Failed to set workspace trust", "path", root, "error", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if trusted {
+		fmt.Printf("Trusted %s\n", root)
+	} else {
+		fmt.Printf("Untrusted %s\n", root)
+	}
+}
@@ -0,0 +1,45 @@
+package atuin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SessionEnvVar is set by Atuin's shell hooks, which 'atuin history start' needs to know the
+// session a command belongs to
+const SessionEnvVar = "ATUIN_SESSION"
+
+// Start records in Atuin's history that command is starting in the current directory, the way
+// Atuin's shell hooks do, and returns the ID End takes. Needs Atuin's shell hooks in the shell
+// tell runs from, for the session.
+func Start(ctx context.Context, command string) (string, error) {
+	if os.Getenv(SessionEnvVar) == "" {
+		return "", errors.New("atuin isn't set up in this shell, " + SessionEnvVar + " is not set")
+	}
+
+	out, err := exec.CommandContext(ctx, "atuin", "history", "start", "--", command).Output()
+	if err != nil {
+		return "", fmt.Errorf("could not start atuin history entry: %w", err)
+	}
+
+	id := strings.TrimSpace(string(out))
+	if id == "" {
+		return "", errors.New("could not start atuin history entry: atuin printed no ID")
+	}
+	return id, nil
+}
+
+// End records in Atuin's history that the command of the entry Start returned finished with
+// exitCode. Atuin takes the duration from the time between Start and End.
+func End(ctx context.Context, id string, exitCode int) error {
+	cmd := exec.CommandContext(ctx, "atuin", "history", "end", "--exit", strconv.Itoa(exitCode), "--", id)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not end atuin history entry: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package clipboard
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jonfk/tell/internal/sysinfo"
+)
+
+// tool is a clipboard command line tool, with the arguments to read and to write the clipboard
+type tool struct {
+	read  []string
+	write []string
+}
+
+// PowerShell scripts reading and writing the Windows clipboard as UTF-8 through stdout and stdin
+const (
+	windowsReadScript  = "[Console]::OutputEncoding = [Text.Encoding]::UTF8; Get-Clipboard -Raw"
+	windowsWriteScript = "[Console]::InputEncoding = [Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())"
+)
+
+// tools returns the clipboard tools for the current platform, in order of preference
+func tools() []tool {
+	switch sysinfo.DetectPlatform() {
+	case sysinfo.PlatformMacOS:
+		return []tool{{read: []string{"pbpaste"}, write: []string{"pbcopy"}}}
+	case sysinfo.PlatformWindows, sysinfo.PlatformWSL:
+		// Text passes through PowerShell as UTF-8; clip.exe, which reads the console code
+		// page, is only used when PowerShell can't be found
+		return []tool{
+			{
+				read:  []string{"pwsh.exe", "-NoProfile", "-Command", windowsReadScript},
+				write: []string{"pwsh.exe", "-NoProfile", "-Command", windowsWriteScript},
+			},
+			{
+				read:  []string{"powershell.exe", "-NoProfile", "-Command", windowsReadScript},
+				write: []string{"powershell.exe", "-NoProfile", "-Command", windowsWriteScript},
+			},
+			{read: []string{"powershell.exe", "-NoProfile", "-Command", "Get-Clipboard"}, write: []string{"clip.exe"}},
+		}
+	default:
+		var found []tool
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			found = append(found, tool{read: []string{"wl-paste", "--no-newline"}, write: []string{"wl-copy"}})
+		}
+		return append(found,
+			tool{read: []string{"xclip", "-selection", "clipboard", "-out"}, write: []string{"xclip", "-selection", "clipboard", "-in"}},
+			tool{read: []string{"xsel", "--clipboard", "--output"}, write: []string{"xsel", "--clipboard", "--input"}},
+		)
+	}
+}
+
+// find returns the read or write command of the first clipboard tool that is installed
+func find(command func(t tool) []string) ([]string, error) {
+	var tried []string
+	for _, t := range tools() {
+		args := command(t)
+		if _, err := exec.LookPath(args[0]); err == nil {
+			return args, nil
+		}
+		tried = append(tried, args[0])
+	}
+	return nil, errors.New("none of " + strings.Join(tried, ", ") + " is installed")
+}
+
+// Read returns the text in the system clipboard, using the first clipboard
+// tool installed: pbpaste, wl-paste, xclip, xsel or PowerShell on Windows and WSL
+func Read(ctx context.Context) (string, error) {
+	args, err := find(func(t tool) []string { return t.read })
+	if err != nil {
+		return "", fmt.Errorf("could not read clipboard: %w", err)
+	}
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("could not read clipboard: %w", err)
+	}
+	// PowerShell ends lines with CRLF
+	return strings.ReplaceAll(string(out), "\r\n", "\n"), nil
+}
+
+// Write puts text in the system clipboard, using the first clipboard tool installed:
+// pbcopy, wl-copy, xclip, xsel or PowerShell on Windows and WSL. Without one that works, as
+// over SSH, the terminal is asked to set its clipboard with OSC 52.
+func Write(ctx context.Context, text string) error {
+	args, err := find(func(t tool) []string { return t.write })
+	if err == nil {
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		err = cmd.Run()
+	}
+	if err == nil {
+		return nil
+	}
+
+	if oscErr := writeOSC52(text); oscErr != nil {
+		return fmt.Errorf("could not write clipboard: %w", err)
+	}
+	return nil
+}
+
+// writeOSC52 sends text to the terminal in an OSC 52 escape sequence, which terminals such as
+// iTerm2, kitty, WezTerm and Windows Terminal, and tmux, put in the system clipboard. Terminals
+// without it ignore the sequence, which can't be told apart from success.
+func writeOSC52(text string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	_, err = fmt.Fprintf(tty, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
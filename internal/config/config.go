@@ -6,22 +6,461 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/jonfk/tell/internal/sysinfo"
+	"github.com/jonfk/tell/internal/xdg"
 	"gopkg.in/yaml.v3"
 )
 
+// Supported LLM providers
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderMistral   = "mistral"
+	ProviderGroq      = "groq"
+	ProviderDeepSeek  = "deepseek"
+	ProviderVertex    = "vertex"
+	ProviderXAI       = "xai"
+	ProviderOpenAI    = "openai"
+	ProviderOllama    = "ollama"
+)
+
+// System prompt styles
+const (
+	// PromptStyleFull uses the system prompt with guidelines and examples
+	PromptStyleFull = "full"
+	// PromptStyleCompact uses a short system prompt without examples
+	PromptStyleCompact = "compact"
+	// PromptStyleAB picks the full or compact prompt at random for each request, to compare them with 'tell stats'
+	PromptStyleAB = "ab"
+)
+
+// Safety levels
+const (
+	// SafetyStrict asks the model for the most conservative commands, refuses destructive
+	// commands without --force and keeps commands with warnings off the command line
+	SafetyStrict = "strict"
+	// SafetyNormal asks the model to prefer safe commands and flags destructive ones with a warning
+	SafetyNormal = "normal"
+	// SafetyOff leaves safety out of the system prompt and doesn't look for destructive commands
+	SafetyOff = "off"
+)
+
+// Integration actions, what the function of the shell integration does with a generated command
+const (
+	// IntegrationInsert puts the command on the command line, or in the history where the
+	// shell can't, to be edited or run
+	IntegrationInsert = "insert"
+	// IntegrationCopy copies the command to the clipboard
+	IntegrationCopy = "copy"
+	// IntegrationRun runs the command right away, as if it was typed
+	IntegrationRun = "run"
+)
+
+// Sync backends, how 'tell sync' shares history with other machines
+const (
+	// SyncDir keeps history in a directory another tool syncs, such as Dropbox or Syncthing
+	SyncDir = "dir"
+	// SyncRclone keeps history on an rclone remote
+	SyncRclone = "rclone"
+	// SyncGit keeps history in a git repository
+	SyncGit = "git"
+)
+
+// ProviderConfig holds the settings for a non-Anthropic LLM provider
+type ProviderConfig struct {
+	APIKey  string `yaml:"api_key,omitempty"`
+	Model   string `yaml:"model,omitempty"`
+	BaseURL string `yaml:"base_url,omitempty"`
+	// Region and ProjectID are used by cloud platform providers such as Vertex AI
+	Region    string `yaml:"region,omitempty"`
+	ProjectID string `yaml:"project_id,omitempty"`
+}
+
+// providerDefault holds the built-in settings used for any provider value not set in the configuration
+type providerDefault struct {
+	// apiKeyEnv is the environment variable the API key is read from, empty if the provider doesn't use one
+	apiKeyEnv string
+	model     string
+	baseURL   string
+	region    string
+	// embeddingModel is the model history is embedded with for semantic search, empty if the
+	// provider has no embeddings API
+	embeddingModel string
+}
+
+// providerDefaults holds the built-in settings for each provider
+var providerDefaults = map[string]providerDefault{
+	ProviderMistral: {
+		apiKeyEnv:      "MISTRAL_API_KEY",
+		model:          "codestral-latest",
+		baseURL:        "https://api.mistral.ai/v1",
+		embeddingModel: "mistral-embed",
+	},
+	ProviderGroq: {
+		apiKeyEnv: "GROQ_API_KEY",
+		model:     "llama-3.3-70b-versatile",
+		baseURL:   "https://api.groq.com/openai/v1",
+	},
+	ProviderDeepSeek: {
+		apiKeyEnv: "DEEPSEEK_API_KEY",
+		model:     "deepseek-chat",
+		baseURL:   "https://api.deepseek.com/v1",
+	},
+	ProviderVertex: {
+		model:  "claude-3-5-haiku@20241022",
+		region: "us-east5",
+	},
+	ProviderXAI: {
+		apiKeyEnv: "XAI_API_KEY",
+		model:     "grok-3-mini",
+		baseURL:   "https://api.x.ai/v1",
+	},
+	ProviderOpenAI: {
+		apiKeyEnv:      "OPENAI_API_KEY",
+		model:          "gpt-4o-mini",
+		baseURL:        "https://api.openai.com/v1",
+		embeddingModel: "text-embedding-3-small",
+	},
+	// Ollama runs models locally and exposes an OpenAI-compatible API without authentication
+	ProviderOllama: {
+		model:          "llama3.2",
+		baseURL:        "http://localhost:11434/v1",
+		embeddingModel: "nomic-embed-text",
+	},
+}
+
+// knownModels lists well known models for each provider. Other model names can
+// still be configured; the list is used for documentation and suggestions.
+var knownModels = map[string][]string{
+	ProviderAnthropic: {
+		"claude-3-haiku-20240307",
+		"claude-3-5-haiku-latest",
+		"claude-3-5-sonnet-latest",
+		"claude-3-7-sonnet-latest",
+	},
+	ProviderMistral: {
+		"codestral-latest",
+		"mistral-small-latest",
+		"mistral-large-latest",
+	},
+	ProviderGroq: {
+		"llama-3.3-70b-versatile",
+		"llama-3.1-8b-instant",
+	},
+	ProviderDeepSeek: {
+		"deepseek-chat",
+		"deepseek-reasoner",
+	},
+	ProviderVertex: {
+		"claude-3-5-haiku@20241022",
+		"claude-3-5-sonnet-v2@20241022",
+		"claude-3-7-sonnet@20250219",
+	},
+	ProviderXAI: {
+		"grok-3-mini",
+		"grok-3",
+	},
+	ProviderOpenAI: {
+		"gpt-4o-mini",
+		"gpt-4o",
+		"gpt-4.1",
+	},
+	ProviderOllama: {
+		"llama3.2",
+		"qwen2.5-coder",
+	},
+}
+
+// defaultPricing holds the list prices of well known models, in US dollars per million tokens.
+// Models are matched by the longest name they start with, so dated versions and Vertex AI
+// names (claude-3-5-haiku@20241022) get the price of their model. Models run locally are free.
+var defaultPricing = map[string]ModelPrice{
+	"claude-3-haiku":          {Input: 0.25, Output: 1.25},
+	"claude-3-5-haiku":        {Input: 0.80, Output: 4},
+	"claude-3-5-sonnet":       {Input: 3, Output: 15},
+	"claude-3-7-sonnet":       {Input: 3, Output: 15},
+	"claude-3-opus":           {Input: 15, Output: 75},
+	"claude-sonnet-4":         {Input: 3, Output: 15},
+	"claude-opus-4":           {Input: 15, Output: 75},
+	"codestral":               {Input: 0.30, Output: 0.90},
+	"mistral-small":           {Input: 0.10, Output: 0.30},
+	"mistral-large":           {Input: 2, Output: 6},
+	"llama-3.3-70b-versatile": {Input: 0.59, Output: 0.79},
+	"llama-3.1-8b-instant":    {Input: 0.05, Output: 0.08},
+	"deepseek-chat":           {Input: 0.27, Output: 1.10},
+	"deepseek-reasoner":       {Input: 0.55, Output: 2.19},
+	"grok-3-mini":             {Input: 0.30, Output: 0.50},
+	"grok-3":                  {Input: 3, Output: 15},
+	"gpt-4o-mini":             {Input: 0.15, Output: 0.60},
+	"gpt-4o":                  {Input: 2.50, Output: 10},
+	"gpt-4.1-nano":            {Input: 0.10, Output: 0.40},
+	"gpt-4.1-mini":            {Input: 0.40, Output: 1.60},
+	"gpt-4.1":                 {Input: 2, Output: 8},
+	"llama3.2":                {},
+	"qwen2.5-coder":           {},
+}
+
 // Config holds the application configuration
 type Config struct {
-	AnthropicAPIKey   string   `yaml:"anthropic_api_key"`
-	LLMModel          string   `yaml:"llm_model"`
-	PreferredCommands []string `yaml:"preferred_commands"`
-	ExtraInstructions []string `yaml:"extra_instructions"`
+	// Provider selects the LLM backend, defaults to anthropic
+	Provider          string                    `yaml:"provider"`
+	AnthropicAPIKey   string                    `yaml:"anthropic_api_key"`
+	LLMModel          string                    `yaml:"llm_model"`
+	Providers         map[string]ProviderConfig `yaml:"providers,omitempty"`
+	PreferredCommands []string                  `yaml:"preferred_commands"`
+	ExtraInstructions []string                  `yaml:"extra_instructions"`
+	Context           ContextConfig             `yaml:"context"`
+	// ContextCommands are shell commands whose output is attached to prompts as context
+	ContextCommands []ContextCommand `yaml:"context_commands,omitempty"`
+	Routing         RoutingConfig    `yaml:"routing"`
+	// PromptStyle selects the system prompt: full, compact or ab
+	PromptStyle string `yaml:"prompt_style"`
+	// ValidateSyntax parses generated commands with the shell before printing them and asks
+	// the model once to correct a syntax error
+	ValidateSyntax bool `yaml:"validate_syntax"`
+	// Posix asks for commands that run in any POSIX sh, without bashisms or GNU-only flags
+	Posix bool `yaml:"posix"`
+	// BusyBox asks for commands that only use BusyBox applets and the options they support, for
+	// embedded devices and Alpine containers
+	BusyBox bool `yaml:"busybox"`
+	// PowerShell asks for PowerShell commands using cmdlets instead of Unix tools. It is turned
+	// on for a request when tell runs from PowerShell.
+	PowerShell bool `yaml:"powershell"`
+	// Cmd asks for commands for the Windows command prompt, cmd.exe. It is turned on for a
+	// request when tell runs from cmd.
+	Cmd bool `yaml:"cmd"`
+	// SafetyLevel controls how cautious generated commands are: strict, normal or off
+	SafetyLevel string      `yaml:"safety_level"`
+	Retry       RetryConfig `yaml:"retry"`
+	// FileConventions are applied to files that generated commands write
+	FileConventions FileConventions `yaml:"file_conventions"`
+	Summarize       SummarizeConfig `yaml:"summarize"`
+	History         HistoryConfig   `yaml:"history"`
+	Run             RunConfig       `yaml:"run"`
+	// Policy restricts which commands tell gives out, e.g. in locked-down environments
+	Policy PolicyConfig `yaml:"policy"`
+	// Integration shapes the shell integration printed by 'tell env'
+	Integration IntegrationConfig `yaml:"integration"`
+	// Sync shares history with other machines with 'tell sync'
+	Sync SyncConfig `yaml:"sync"`
+	// Pricing sets the price of models, replacing the built-in price of a model or adding
+	// models without one
+	Pricing map[string]ModelPrice `yaml:"pricing,omitempty"`
+	// MonthlyBudgetUSD is how much requests may cost each month, warned about at 80% and 100%.
+	// 0 means no budget.
+	MonthlyBudgetUSD float64 `yaml:"monthly_budget_usd,omitempty"`
+	// BudgetHardCap refuses requests once the monthly budget is spent, unless --over-budget is given
+	BudgetHardCap bool `yaml:"budget_hard_cap,omitempty"`
+}
+
+// ModelPrice is what a model costs, in US dollars per million tokens
+type ModelPrice struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// Cost returns what a request with the given token counts cost, in US dollars
+func (p ModelPrice) Cost(inputTokens int64, outputTokens int64) float64 {
+	return (float64(inputTokens)*p.Input + float64(outputTokens)*p.Output) / 1e6
+}
+
+// SyncConfig says where 'tell sync' keeps the history of every machine
+type SyncConfig struct {
+	// Backend is dir, rclone or git
+	Backend string `yaml:"backend"`
+	// Target is the directory, the rclone remote path (remote:path) or the URL of the git
+	// repository
+	Target string `yaml:"target"`
+	// Machine names the history of this machine in the target, the host name by default
+	Machine string `yaml:"machine,omitempty"`
+}
+
+// IntegrationConfig shapes the function of the shell integration generating a command, tellme
+// by default. Changes take effect once the integration is generated again.
+type IntegrationConfig struct {
+	// FunctionName names the function, for users with a tellme of their own
+	FunctionName string `yaml:"function_name"`
+	// ShowDetails prints the explanation before the command; without it only an explanation of
+	// why there is no command is printed
+	ShowDetails bool `yaml:"show_details"`
+	// Action is what the function does with the command: insert, copy or run
+	Action string `yaml:"action"`
+	// BashPreexec records what happened to commands in bash with the hooks of bash-preexec,
+	// which also time them, instead of PROMPT_COMMAND
+	BashPreexec bool `yaml:"bash_preexec"`
+}
+
+// RunConfig controls commands tell runs itself, with --run, --interactive, --auto-fix and 'tell run'
+type RunConfig struct {
+	// Timeout stops commands that run longer than this, 0 for no limit
+	Timeout time.Duration `yaml:"timeout"`
+	// KillAfter is how long a timed out command gets to exit after SIGTERM before it gets SIGKILL
+	KillAfter time.Duration `yaml:"kill_after"`
+}
+
+// PolicyConfig lists regular expressions generated commands are checked against. Refused
+// commands are never printed or run, and are saved to history with the reason.
+type PolicyConfig struct {
+	// Blocked refuses commands any of these patterns matches, e.g. \bmkfs or \bshutdown\b
+	Blocked []string `yaml:"blocked,omitempty"`
+	// Allowed turns on allowlist mode when not empty: each simple command of a command line
+	// (split at pipes, lists and command substitutions) must match one of these patterns
+	Allowed []string `yaml:"allowed,omitempty"`
+}
+
+// HistoryConfig controls what is recorded in history when a generated command is run
+type HistoryConfig struct {
+	// RecordOutput keeps the end of the output of commands run with --run or --interactive
+	RecordOutput bool `yaml:"record_output"`
+	// MaxOutputBytes is how much of the end of the output is kept
+	MaxOutputBytes int `yaml:"max_output_bytes"`
+	// Atuin also records commands tell runs itself in Atuin's history, where commands run from
+	// the shell already are
+	Atuin bool `yaml:"atuin"`
+	// EmbeddingProvider computes the embeddings 'tell history --semantic' searches with. It
+	// must have an OpenAI-compatible embeddings API, which Anthropic doesn't have.
+	EmbeddingProvider string `yaml:"embedding_provider"`
+	// EmbeddingModel overrides the provider's default embedding model
+	EmbeddingModel string `yaml:"embedding_model,omitempty"`
+	// Encrypt encrypts prompts, commands, explanations and output in the history database with
+	// a key kept in the OS keyring. Existing entries are encrypted, or decrypted once it is off.
+	Encrypt bool `yaml:"encrypt"`
+	// Retention deletes entries older than this, such as 90d or 2w, whenever tell opens the
+	// history. Empty keeps history forever.
+	Retention string `yaml:"retention,omitempty"`
+	// RetentionKeepFavorites keeps favorites however old they are
+	RetentionKeepFavorites bool `yaml:"retention_keep_favorites"`
+}
+
+// SummarizeConfig controls how 'tell summarize' splits large input into requests
+type SummarizeConfig struct {
+	// ChunkSize is the maximum number of bytes of input sent in a single request
+	ChunkSize int `yaml:"chunk_size"`
+	// MaxChunks bounds the number of requests; the middle of larger input is skipped
+	MaxChunks int `yaml:"max_chunks"`
+}
+
+// Indentation styles for FileConventions
+const (
+	IndentTabs   = "tabs"
+	IndentSpaces = "spaces"
+)
+
+// FileConventions describe the house style for files created by generated commands
+// (e.g. scripts written with a here-document), applied after generation
+type FileConventions struct {
+	// Shebangs maps an interpreter to the preferred shebang line,
+	// e.g. bash: "#!/usr/bin/env bash"
+	Shebangs map[string]string `yaml:"shebangs,omitempty"`
+	// LicenseHeader is added as a comment at the top of each file, after the shebang
+	LicenseHeader string `yaml:"license_header,omitempty"`
+	// Indent converts leading indentation to tabs or spaces, empty keeps it as generated
+	Indent      string `yaml:"indent,omitempty"`
+	IndentWidth int    `yaml:"indent_width,omitempty"`
+}
+
+// IsZero reports whether no conventions are configured
+func (f FileConventions) IsZero() bool {
+	return len(f.Shebangs) == 0 && f.LicenseHeader == "" && f.Indent == ""
+}
+
+// RetryConfig controls how failed LLM requests (rate limits, server errors,
+// timeouts) are retried with exponential backoff
+type RetryConfig struct {
+	MaxRetries     int           `yaml:"max_retries"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// ContextConfig controls which environment context is gathered and sent with prompts
+type ContextConfig struct {
+	// ProbeTimeout bounds how long each individual context probe may run
+	ProbeTimeout time.Duration `yaml:"probe_timeout"`
+	// System includes the operating system, distribution and architecture in the system prompt
+	System bool `yaml:"system"`
+	// Coreutils is the flavor of sed, date, stat and friends: gnu, bsd, busybox, or auto to detect it
+	Coreutils string `yaml:"coreutils"`
+	// PackageManager is the package manager commands install software with, auto to detect it
+	PackageManager string `yaml:"package_manager"`
+	// Tools tells the model which preferred commands and extended tools are installed
+	Tools bool `yaml:"tools"`
+	// ExtendedTools are looked up on PATH in addition to the preferred commands
+	ExtendedTools []string `yaml:"extended_tools"`
+	// ToolsCacheTTL is how long tool lookups are cached, 0 disables the cache
+	ToolsCacheTTL time.Duration `yaml:"tools_cache_ttl"`
+	// Git includes the branch and short status of the current git repository
+	Git bool `yaml:"git"`
+	// Cwd includes the working directory path and a listing of its entries
+	Cwd bool `yaml:"cwd"`
+	// MaxEntries truncates the working directory listing
+	MaxEntries int `yaml:"max_entries"`
+	// Help includes the man page synopsis or --help output of installed tools the prompt mentions
+	Help bool `yaml:"help"`
+	// MaxHelpTools bounds the number of tools help is included for
+	MaxHelpTools int `yaml:"max_help_tools"`
+	// MaxHelpTokens truncates the help of each tool
+	MaxHelpTokens int `yaml:"max_help_tokens"`
+	// Aliases includes the aliases and function names of the user's shell, passed by the shell integration
+	Aliases bool `yaml:"aliases"`
+	// TmuxLines is the number of scrollback lines captured with --tmux-pane, above the visible pane
+	TmuxLines int `yaml:"tmux_lines"`
+	// Atuin includes the commands recently run in the working directory from Atuin's history
+	Atuin bool `yaml:"atuin"`
+	// AtuinCommands is the number of commands included from Atuin's history
+	AtuinCommands int `yaml:"atuin_commands"`
+	// MaxStdinBytes truncates data piped to tell prompt and tell ask
+	MaxStdinBytes int `yaml:"max_stdin_bytes"`
+	// MaxFileTokens truncates each file attached with --context-file
+	MaxFileTokens int `yaml:"max_file_tokens"`
+	// MaxTokens is the budget for all context sent with a request; larger context is truncated
+	MaxTokens int `yaml:"max_tokens"`
+	// MaxConversationTokens bounds the earlier commands of a chain sent with --continue; the
+	// oldest are left out first
+	MaxConversationTokens int `yaml:"max_conversation_tokens"`
+	// RemoteTimeout bounds the ssh connection describing a host given with --target-host
+	RemoteTimeout time.Duration `yaml:"remote_timeout"`
+	// RequireTrust asks before collecting context from a workspace for the first time
+	RequireTrust bool `yaml:"require_trust"`
+}
+
+// ContextCommand is a user defined context source: a shell command whose output is sent
+// with prompts, e.g. git status --porcelain or docker ps
+type ContextCommand struct {
+	// Name labels the output in the prompt, defaults to the command itself
+	Name    string `yaml:"name,omitempty"`
+	Command string `yaml:"command"`
+	// MaxTokens truncates the output, defaults to DefaultContextCommandTokens
+	MaxTokens int `yaml:"max_tokens,omitempty"`
+}
+
+// DefaultContextCommandTokens truncates the output of context commands without max_tokens
+const DefaultContextCommandTokens = 500
+
+// RoutingConfig controls automatic selection between a cheap model for simple
+// prompts and a stronger model for long or multi-step ones
+type RoutingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// SimpleModel and ComplexModel default to the active model when empty
+	SimpleModel  string `yaml:"simple_model"`
+	ComplexModel string `yaml:"complex_model"`
+	// MaxSimpleTokens is the estimated prompt size above which a prompt is considered complex
+	MaxSimpleTokens int `yaml:"max_simple_tokens"`
+	// ComplexKeywords mark a prompt as complex when any of them appears in it
+	ComplexKeywords []string `yaml:"complex_keywords"`
+	// EscalateOnFailure routes a prompt to the complex model if it failed before
+	EscalateOnFailure bool `yaml:"escalate_on_failure"`
+	// FallbackModels are the stronger models offered, in order, when a prompt is
+	// regenerated. ComplexModel is offered when empty. Used even when routing is disabled.
+	FallbackModels []string `yaml:"fallback_models"`
 }
 
 // DefaultConfig returns a configuration with default values
 func DefaultConfig() *Config {
 	return &Config{
+		Provider:          ProviderAnthropic,
 		AnthropicAPIKey:   "",
 		LLMModel:          "claude-3-haiku-20240307",
 		PreferredCommands: []string{"rg", "fd", "find", "grep", "awk", "sed"},
@@ -29,29 +468,256 @@ func DefaultConfig() *Config {
 			"Prefer using modern alternatives like ripgrep (rg) instead of grep when available",
 			"For Python projects, recommend using uv for package management",
 		},
+		Context: ContextConfig{
+			ProbeTimeout:   2 * time.Second,
+			System:         true,
+			Coreutils:      "auto",
+			PackageManager: "auto",
+			Tools:          true,
+			ExtendedTools: []string{
+				"jq", "yq", "fzf", "bat", "eza", "tree", "curl", "wget", "git", "docker", "podman",
+				"kubectl", "ffmpeg", "magick", "zstd", "pigz", "parallel", "ncdu", "lsof", "ss",
+			},
+			ToolsCacheTTL:         24 * time.Hour,
+			Git:                   false,
+			Cwd:                   false,
+			MaxEntries:            50,
+			Help:                  false,
+			MaxHelpTools:          2,
+			MaxHelpTokens:         500,
+			Aliases:               false,
+			TmuxLines:             100,
+			Atuin:                 false,
+			AtuinCommands:         20,
+			MaxStdinBytes:         16384,
+			MaxFileTokens:         2000,
+			MaxTokens:             4000,
+			MaxConversationTokens: 4000,
+			RemoteTimeout:         10 * time.Second,
+			RequireTrust:          true,
+		},
+		PromptStyle:    PromptStyleFull,
+		ValidateSyntax: true,
+		SafetyLevel:    SafetyNormal,
+		Retry: RetryConfig{
+			MaxRetries:     2,
+			InitialBackoff: 500 * time.Millisecond,
+			MaxBackoff:     8 * time.Second,
+		},
+		Routing: RoutingConfig{
+			Enabled:         false,
+			MaxSimpleTokens: 20,
+			ComplexKeywords: []string{
+				"pipeline", "script", "loop", "for each", "recursively", "and then", "parallel",
+			},
+			EscalateOnFailure: true,
+		},
+		Summarize: SummarizeConfig{
+			ChunkSize: 32000,
+			MaxChunks: 8,
+		},
+		History: HistoryConfig{
+			RecordOutput:           false,
+			MaxOutputBytes:         4096,
+			Atuin:                  false,
+			EmbeddingProvider:      ProviderOpenAI,
+			RetentionKeepFavorites: true,
+		},
+		Run: RunConfig{
+			Timeout:   0,
+			KillAfter: 5 * time.Second,
+		},
+		Integration: IntegrationConfig{
+			FunctionName: "tellme",
+			ShowDetails:  true,
+			Action:       IntegrationInsert,
+		},
+		Sync: SyncConfig{
+			Backend: SyncDir,
+		},
 	}
 }
 
-// GetConfigPath returns the path to the config file
-func GetConfigPath() (string, error) {
-	// Try XDG_CONFIG_HOME first
-	configDir := os.Getenv("XDG_CONFIG_HOME")
-	if configDir == "" {
-		// Fall back to HOME/.config
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("could not determine home directory: %w", err)
+// ProviderNames returns the names of all supported providers
+func ProviderNames() []string {
+	names := []string{ProviderAnthropic}
+	for name := range providerDefaults {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// KnownModels returns the well known models for the named provider
+func KnownModels(provider string) []string {
+	return knownModels[provider]
+}
+
+// Price returns the price of model, from pricing in the config or the built-in prices. The
+// longest name model starts with is used, so claude-3-5-haiku matches claude-3-5-haiku-latest.
+// ok is false for models without a price.
+func (c *Config) Price(model string) (price ModelPrice, ok bool) {
+	match := ""
+	for _, prices := range []map[string]ModelPrice{defaultPricing, c.Pricing} {
+		for name, p := range prices {
+			if strings.HasPrefix(model, name) && len(name) >= len(match) {
+				match, price, ok = name, p, true
+			}
 		}
-		configDir = filepath.Join(home, ".config")
 	}
+	return price, ok
+}
 
-	// Ensure the directory exists
-	tellConfigDir := filepath.Join(configDir, "tell-llm")
-	if err := os.MkdirAll(tellConfigDir, 0755); err != nil {
-		return "", fmt.Errorf("could not create config directory: %w", err)
+// ActiveProvider returns the name of the configured provider
+func (c *Config) ActiveProvider() string {
+	if c.Provider == "" {
+		return ProviderAnthropic
 	}
+	return c.Provider
+}
 
-	return filepath.Join(tellConfigDir, "tell.yaml"), nil
+// Safety returns the configured safety level, SafetyNormal when it isn't strict or off
+func (c *Config) Safety() string {
+	switch c.SafetyLevel {
+	case SafetyStrict, SafetyOff:
+		return c.SafetyLevel
+	default:
+		return SafetyNormal
+	}
+}
+
+// ProviderSettings returns the settings for the named provider, filling in any
+// value not set in the configuration from the environment and built-in defaults
+func (c *Config) ProviderSettings(name string) (ProviderConfig, error) {
+	if name == ProviderAnthropic {
+		return ProviderConfig{
+			APIKey: c.AnthropicAPIKey,
+			Model:  c.LLMModel,
+		}, nil
+	}
+
+	defaults, ok := providerDefaults[name]
+	if !ok {
+		return ProviderConfig{}, fmt.Errorf("unknown provider %q (supported: %s)", name, strings.Join(ProviderNames(), ", "))
+	}
+
+	settings := c.Providers[name]
+	if settings.APIKey == "" && defaults.apiKeyEnv != "" {
+		settings.APIKey = os.Getenv(defaults.apiKeyEnv)
+	}
+	if settings.Model == "" {
+		settings.Model = defaults.model
+	}
+	if settings.BaseURL == "" {
+		settings.BaseURL = defaults.baseURL
+	}
+
+	if name == ProviderVertex {
+		// Use the same environment variables as other Anthropic-on-Vertex tooling
+		if settings.Region == "" {
+			settings.Region = os.Getenv("CLOUD_ML_REGION")
+		}
+		if settings.ProjectID == "" {
+			settings.ProjectID = os.Getenv("ANTHROPIC_VERTEX_PROJECT_ID")
+		}
+		if settings.ProjectID == "" {
+			settings.ProjectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+		}
+	}
+	if settings.Region == "" {
+		settings.Region = defaults.region
+	}
+
+	return settings, nil
+}
+
+// RequiresAPIKey reports whether the named provider authenticates with an API key.
+// Providers such as Vertex AI use platform credentials instead, and local ones like Ollama need none.
+func RequiresAPIKey(provider string) bool {
+	if provider == ProviderAnthropic {
+		return true
+	}
+	return providerDefaults[provider].apiKeyEnv != ""
+}
+
+// EmbeddingSettings returns the provider history is embedded with and its settings, with Model
+// set to the embedding model
+func (c *Config) EmbeddingSettings() (string, ProviderConfig, error) {
+	name := c.History.EmbeddingProvider
+	if name == ProviderAnthropic || name == ProviderVertex {
+		return "", ProviderConfig{}, fmt.Errorf("provider %s has no embeddings API, set history.embedding_provider to openai, ollama or mistral", name)
+	}
+
+	settings, err := c.ProviderSettings(name)
+	if err != nil {
+		return "", ProviderConfig{}, err
+	}
+	settings.Model = c.History.EmbeddingModel
+	if settings.Model == "" {
+		settings.Model = providerDefaults[name].embeddingModel
+	}
+	if settings.Model == "" {
+		return "", ProviderConfig{}, fmt.Errorf("provider %s has no default embedding model, set history.embedding_model", name)
+	}
+
+	return name, settings, nil
+}
+
+// ActiveModel returns the model used by the configured provider
+func (c *Config) ActiveModel() string {
+	settings, err := c.ProviderSettings(c.ActiveProvider())
+	if err != nil {
+		return c.LLMModel
+	}
+	return settings.Model
+}
+
+// ToolNames returns the tools looked up for the system prompt: the preferred commands,
+// then the extended tools
+func (c *Config) ToolNames() []string {
+	return append(append([]string{}, c.PreferredCommands...), c.Context.ExtendedTools...)
+}
+
+// DefaultConfigForPlatform returns the default configuration tailored to the given
+// platform (see sysinfo.DetectPlatform), so suggestions match the machine out of the box
+func DefaultConfigForPlatform(platform string) *Config {
+	config := DefaultConfig()
+
+	switch platform {
+	case sysinfo.PlatformMacOS:
+		config.PreferredCommands = []string{"rg", "fd", "find", "grep", "awk", "sed", "open", "pbcopy"}
+		config.ExtraInstructions = []string{
+			"The system is macOS with BSD userland tools; use BSD-compatible flags (e.g. sed -i '', stat -f, date -v)",
+			"Use Homebrew (brew) to install packages",
+			"Prefer using modern alternatives like ripgrep (rg) instead of grep when available",
+		}
+	case sysinfo.PlatformWSL:
+		config.PreferredCommands = []string{"rg", "fd", "find", "grep", "awk", "sed", "wslpath"}
+		config.ExtraInstructions = []string{
+			"The system is Linux running under WSL; Windows drives are mounted under /mnt (e.g. /mnt/c)",
+			"Use wslpath to convert between Windows and Linux paths, and explorer.exe or clip.exe to interact with Windows",
+			"Prefer using modern alternatives like ripgrep (rg) instead of grep when available",
+		}
+	case sysinfo.PlatformLinux:
+		config.PreferredCommands = []string{"rg", "fd", "find", "grep", "awk", "sed", "systemctl", "journalctl"}
+		config.ExtraInstructions = []string{
+			"The system is Linux with GNU userland tools",
+			"Prefer using modern alternatives like ripgrep (rg) instead of grep when available",
+			"For Python projects, recommend using uv for package management",
+		}
+	}
+
+	return config
+}
+
+// GetConfigPath returns the path to the config file
+func GetConfigPath() (string, error) {
+	configDir, err := xdg.ConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get config directory: %w", err)
+	}
+
+	return filepath.Join(configDir, "tell.yaml"), nil
 }
 
 func EditConfig() {
@@ -146,7 +812,8 @@ func Load() (*Config, error) {
 
 	slog.Debug("Loaded configuration",
 		"path", configPath,
-		"model", config.LLMModel,
+		"provider", config.ActiveProvider(),
+		"model", config.ActiveModel(),
 		"preferredCommandsCount", len(config.PreferredCommands))
 
 	return config, nil
@@ -183,22 +850,41 @@ func (c *Config) String() string {
 	sb.WriteString("Configuration:\n")
 
 	// Truncate API key for security
-	apiKey := c.AnthropicAPIKey
-	if apiKey != "" {
-		// Show only first 4 and last 4 characters
-		if len(apiKey) > 8 {
-			apiKey = apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
-		} else {
-			apiKey = "****"
-		}
-	} else {
-		apiKey = "<not set>"
-	}
+	apiKey := truncateKey(c.AnthropicAPIKey)
 
 	// Use fmt.Fprintf instead of multiple WriteString calls
-	fmt.Fprintf(&sb, `  Anthropic API Key: %s
+	fmt.Fprintf(&sb, `  Provider: %s
+  Anthropic API Key: %s
   LLM Model: %s
-`, apiKey, c.LLMModel)
+`, c.ActiveProvider(), apiKey, c.LLMModel)
+
+	if len(c.Providers) > 0 {
+		sb.WriteString("  Providers:\n")
+		names := make([]string, 0, len(c.Providers))
+		for name := range c.Providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			settings := c.Providers[name]
+			fmt.Fprintf(&sb, "    %s:\n", name)
+			if RequiresAPIKey(name) {
+				fmt.Fprintf(&sb, "      API Key: %s\n", truncateKey(settings.APIKey))
+			}
+			if settings.Model != "" {
+				fmt.Fprintf(&sb, "      Model: %s\n", settings.Model)
+			}
+			if settings.BaseURL != "" {
+				fmt.Fprintf(&sb, "      Base URL: %s\n", settings.BaseURL)
+			}
+			if settings.Region != "" {
+				fmt.Fprintf(&sb, "      Region: %s\n", settings.Region)
+			}
+			if settings.ProjectID != "" {
+				fmt.Fprintf(&sb, "      Project ID: %s\n", settings.ProjectID)
+			}
+		}
+	}
 
 	sb.WriteString("  Preferred Commands:\n")
 	for _, cmd := range c.PreferredCommands {
@@ -210,9 +896,155 @@ func (c *Config) String() string {
 		fmt.Fprintf(&sb, "    - %s\n", instr)
 	}
 
+	sb.WriteString("  Context:\n")
+	fmt.Fprintf(&sb, "    Probe Timeout: %s\n", c.Context.ProbeTimeout)
+	fmt.Fprintf(&sb, "    System: %t\n", c.Context.System)
+	fmt.Fprintf(&sb, "    Coreutils: %s\n", c.Context.Coreutils)
+	fmt.Fprintf(&sb, "    Package Manager: %s\n", c.Context.PackageManager)
+	fmt.Fprintf(&sb, "    Tools: %t (cached for %s)\n", c.Context.Tools, c.Context.ToolsCacheTTL)
+	if c.Context.Tools && len(c.Context.ExtendedTools) > 0 {
+		fmt.Fprintf(&sb, "    Extended Tools: %s\n", strings.Join(c.Context.ExtendedTools, ", "))
+	}
+	fmt.Fprintf(&sb, "    Git: %t\n", c.Context.Git)
+	fmt.Fprintf(&sb, "    Working Directory: %t (max %d entries)\n", c.Context.Cwd, c.Context.MaxEntries)
+	fmt.Fprintf(&sb, "    Tool Help: %t (max %d tools, %d tokens each)\n", c.Context.Help, c.Context.MaxHelpTools, c.Context.MaxHelpTokens)
+	fmt.Fprintf(&sb, "    Aliases: %t\n", c.Context.Aliases)
+	fmt.Fprintf(&sb, "    Tmux Lines: %d\n", c.Context.TmuxLines)
+	fmt.Fprintf(&sb, "    Atuin: %t (%d commands)\n", c.Context.Atuin, c.Context.AtuinCommands)
+	fmt.Fprintf(&sb, "    Max Stdin Bytes: %d\n", c.Context.MaxStdinBytes)
+	fmt.Fprintf(&sb, "    Max File Tokens: %d\n", c.Context.MaxFileTokens)
+	fmt.Fprintf(&sb, "    Max Tokens: %d\n", c.Context.MaxTokens)
+	fmt.Fprintf(&sb, "    Max Conversation Tokens: %d\n", c.Context.MaxConversationTokens)
+	fmt.Fprintf(&sb, "    Remote Timeout: %s\n", c.Context.RemoteTimeout)
+	fmt.Fprintf(&sb, "    Require Trust: %t\n", c.Context.RequireTrust)
+
+	if len(c.ContextCommands) > 0 {
+		sb.WriteString("  Context Commands:\n")
+		for _, command := range c.ContextCommands {
+			fmt.Fprintf(&sb, "    - %s\n", command.Command)
+		}
+	}
+
+	fmt.Fprintf(&sb, "  Prompt Style: %s\n", c.PromptStyle)
+	fmt.Fprintf(&sb, "  Validate Syntax: %t\n", c.ValidateSyntax)
+	fmt.Fprintf(&sb, "  POSIX: %t\n", c.Posix)
+	fmt.Fprintf(&sb, "  BusyBox: %t\n", c.BusyBox)
+	fmt.Fprintf(&sb, "  PowerShell: %t\n", c.PowerShell)
+	fmt.Fprintf(&sb, "  Cmd: %t\n", c.Cmd)
+	fmt.Fprintf(&sb, "  Safety Level: %s\n", c.SafetyLevel)
+	if c.MonthlyBudgetUSD > 0 {
+		fmt.Fprintf(&sb, "  Monthly Budget: $%.2f (hard cap: %t)\n", c.MonthlyBudgetUSD, c.BudgetHardCap)
+	}
+
+	if !c.FileConventions.IsZero() {
+		sb.WriteString("  File Conventions:\n")
+		for interpreter, shebang := range c.FileConventions.Shebangs {
+			fmt.Fprintf(&sb, "    Shebang (%s): %s\n", interpreter, shebang)
+		}
+		if c.FileConventions.LicenseHeader != "" {
+			fmt.Fprintf(&sb, "    License Header: %s\n", strings.ReplaceAll(c.FileConventions.LicenseHeader, "\n", " / "))
+		}
+		if c.FileConventions.Indent != "" {
+			fmt.Fprintf(&sb, "    Indent: %s (width %d)\n", c.FileConventions.Indent, c.FileConventions.IndentWidth)
+		}
+	}
+
+	sb.WriteString("  Retry:\n")
+	fmt.Fprintf(&sb, "    Max Retries: %d\n", c.Retry.MaxRetries)
+	fmt.Fprintf(&sb, "    Initial Backoff: %s\n", c.Retry.InitialBackoff)
+	fmt.Fprintf(&sb, "    Max Backoff: %s\n", c.Retry.MaxBackoff)
+
+	sb.WriteString("  Summarize:\n")
+	fmt.Fprintf(&sb, "    Chunk Size: %d bytes\n", c.Summarize.ChunkSize)
+	fmt.Fprintf(&sb, "    Max Chunks: %d\n", c.Summarize.MaxChunks)
+
+	sb.WriteString("  History:\n")
+	fmt.Fprintf(&sb, "    Record Output: %t (last %d bytes)\n", c.History.RecordOutput, c.History.MaxOutputBytes)
+	fmt.Fprintf(&sb, "    Atuin: %t\n", c.History.Atuin)
+	if c.History.EmbeddingModel != "" {
+		fmt.Fprintf(&sb, "    Embeddings: %s (%s)\n", c.History.EmbeddingProvider, c.History.EmbeddingModel)
+	} else {
+		fmt.Fprintf(&sb, "    Embeddings: %s\n", c.History.EmbeddingProvider)
+	}
+	fmt.Fprintf(&sb, "    Encrypt: %t\n", c.History.Encrypt)
+	if c.History.Retention != "" {
+		fmt.Fprintf(&sb, "    Retention: %s (keep favorites: %t)\n", c.History.Retention, c.History.RetentionKeepFavorites)
+	} else {
+		sb.WriteString("    Retention: forever\n")
+	}
+
+	sb.WriteString("  Run:\n")
+	if c.Run.Timeout > 0 {
+		fmt.Fprintf(&sb, "    Timeout: %s (SIGKILL %s after SIGTERM)\n", c.Run.Timeout, c.Run.KillAfter)
+	} else {
+		sb.WriteString("    Timeout: none\n")
+	}
+
+	sb.WriteString("  Integration:\n")
+	fmt.Fprintf(&sb, "    Function Name: %s\n", c.Integration.FunctionName)
+	fmt.Fprintf(&sb, "    Show Details: %t\n", c.Integration.ShowDetails)
+	fmt.Fprintf(&sb, "    Action: %s\n", c.Integration.Action)
+	fmt.Fprintf(&sb, "    Bash Preexec: %t\n", c.Integration.BashPreexec)
+
+	if c.Sync.Target != "" {
+		sb.WriteString("  Sync:\n")
+		fmt.Fprintf(&sb, "    Backend: %s\n", c.Sync.Backend)
+		fmt.Fprintf(&sb, "    Target: %s\n", c.Sync.Target)
+		if c.Sync.Machine != "" {
+			fmt.Fprintf(&sb, "    Machine: %s\n", c.Sync.Machine)
+		}
+	}
+
+	if len(c.Policy.Blocked) > 0 || len(c.Policy.Allowed) > 0 {
+		sb.WriteString("  Policy:\n")
+		if len(c.Policy.Blocked) > 0 {
+			fmt.Fprintf(&sb, "    Blocked: %s\n", strings.Join(c.Policy.Blocked, ", "))
+		}
+		if len(c.Policy.Allowed) > 0 {
+			fmt.Fprintf(&sb, "    Allowed: %s\n", strings.Join(c.Policy.Allowed, ", "))
+		}
+	}
+
+	if len(c.Pricing) > 0 {
+		sb.WriteString("  Pricing (USD per million tokens):\n")
+		models := make([]string, 0, len(c.Pricing))
+		for name := range c.Pricing {
+			models = append(models, name)
+		}
+		sort.Strings(models)
+		for _, name := range models {
+			fmt.Fprintf(&sb, "    %s: input %g, output %g\n", name, c.Pricing[name].Input, c.Pricing[name].Output)
+		}
+	}
+
+	sb.WriteString("  Routing:\n")
+	fmt.Fprintf(&sb, "    Enabled: %t\n", c.Routing.Enabled)
+	if c.Routing.Enabled {
+		fmt.Fprintf(&sb, "    Simple Model: %s\n", c.Routing.SimpleModel)
+		fmt.Fprintf(&sb, "    Complex Model: %s\n", c.Routing.ComplexModel)
+		fmt.Fprintf(&sb, "    Max Simple Tokens: %d\n", c.Routing.MaxSimpleTokens)
+		fmt.Fprintf(&sb, "    Complex Keywords: %s\n", strings.Join(c.Routing.ComplexKeywords, ", "))
+		fmt.Fprintf(&sb, "    Escalate On Failure: %t\n", c.Routing.EscalateOnFailure)
+	}
+	if len(c.Routing.FallbackModels) > 0 {
+		fmt.Fprintf(&sb, "    Fallback Models: %s\n", strings.Join(c.Routing.FallbackModels, ", "))
+	}
+
 	return sb.String()
 }
 
+// truncateKey hides most of an API key so it can be displayed
+func truncateKey(apiKey string) string {
+	if apiKey == "" {
+		return "<not set>"
+	}
+	// Show only first 4 and last 4 characters
+	if len(apiKey) > 8 {
+		return apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
+	}
+	return "****"
+}
+
 // loadEnvVars loads configuration values from environment variables if they're not set
 func loadEnvVars(config *Config) *Config {
 	// Check for Anthropic API key in environment if not set in config
@@ -225,9 +1057,10 @@ func loadEnvVars(config *Config) *Config {
 	return config
 }
 
-// CreateDefaultConfig creates a default configuration file
+// CreateDefaultConfig creates a default configuration file with defaults for the detected platform
 func CreateDefaultConfig() error {
-	config := DefaultConfig()
-	slog.Info("Creating default configuration")
+	platform := sysinfo.DetectPlatform()
+	config := DefaultConfigForPlatform(platform)
+	slog.Info("Creating default configuration", "platform", platform)
 	return config.Save()
 }
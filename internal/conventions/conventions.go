@@ -0,0 +1,194 @@
+package conventions
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+)
+
+// heredocPattern matches the start of a here-document. Groups: "-" for <<-, delimiter.
+var heredocPattern = regexp.MustCompile(`<<(-?)\s*['"]?(\w+)['"]?`)
+
+// targetPattern matches the file a line writes to, e.g. > run.sh or tee -a notes.md
+var targetPattern = regexp.MustCompile(`(?:>>?|\btee(?:\s+-a)?)\s*['"]?([^\s'"<>|;&]+)`)
+
+// commentPrefixes maps file extensions to their line comment marker
+var commentPrefixes = map[string]string{
+	".sh": "#", ".bash": "#", ".zsh": "#", ".py": "#", ".rb": "#", ".pl": "#",
+	".yaml": "#", ".yml": "#", ".toml": "#", ".r": "#", ".conf": "#", ".ps1": "#",
+	".go": "//", ".js": "//", ".ts": "//", ".jsx": "//", ".tsx": "//", ".c": "//", ".h": "//",
+	".cpp": "//", ".cc": "//", ".java": "//", ".rs": "//", ".swift": "//", ".kt": "//", ".scala": "//", ".cs": "//",
+	".sql": "--", ".lua": "--", ".hs": "--",
+}
+
+// keepIndentation holds the extensions of files whose indentation is never changed, because
+// changing it would change what they mean or make them invalid
+var keepIndentation = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+	".py":   true,
+}
+
+// Apply rewrites files created by a command with here-documents so they follow the
+// configured conventions: preferred shebang lines, a license header and indentation.
+// Commands without here-documents are returned unchanged.
+func Apply(command string, conv config.FileConventions) string {
+	if conv.IsZero() {
+		return command
+	}
+
+	lines := strings.Split(command, "\n")
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		out = append(out, lines[i])
+
+		// Only here-documents written to a file are rewritten
+		match := heredocPattern.FindStringSubmatch(lines[i])
+		if match == nil {
+			continue
+		}
+		stripTabs, delimiter := match[1] == "-", match[2]
+		targetMatch := targetPattern.FindStringSubmatch(heredocPattern.ReplaceAllString(lines[i], ""))
+		if targetMatch == nil {
+			continue
+		}
+		target := targetMatch[1]
+
+		// Collect the body up to the delimiter line
+		end := -1
+		for j := i + 1; j < len(lines); j++ {
+			line := lines[j]
+			if stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if strings.TrimRight(line, " ") == delimiter {
+				end = j
+				break
+			}
+		}
+		if end == -1 {
+			continue
+		}
+
+		body := applyToFile(lines[i+1:end], target, stripTabs, conv)
+		out = append(out, body...)
+		i = end - 1
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// ApplyToScript applies the conventions to a whole script written to path, like to a file
+// created with a here-document
+func ApplyToScript(script string, path string, conv config.FileConventions) string {
+	if conv.IsZero() {
+		return script
+	}
+	return strings.Join(applyToFile(strings.Split(script, "\n"), path, false, conv), "\n")
+}
+
+// applyToFile applies the conventions to the lines of a file body
+func applyToFile(body []string, target string, stripTabs bool, conv config.FileConventions) []string {
+	body = append([]string{}, body...)
+	base := filepath.Base(target)
+	ext := strings.ToLower(filepath.Ext(base))
+
+	// Replace the shebang with the preferred one for its interpreter
+	hasShebang := len(body) > 0 && strings.HasPrefix(body[0], "#!")
+	if hasShebang {
+		if preferred, ok := conv.Shebangs[interpreter(body[0])]; ok {
+			body[0] = preferred
+		}
+	}
+
+	// Add the license header after the shebang, unless it's already there
+	if conv.LicenseHeader != "" {
+		prefix, ok := commentPrefixes[ext]
+		if !ok && (hasShebang || base == "Dockerfile" || base == "Makefile") {
+			prefix, ok = "#", true
+		}
+		if ok && !strings.Contains(strings.Join(body, "\n"), firstLine(conv.LicenseHeader)) {
+			var header []string
+			for _, line := range strings.Split(strings.TrimRight(conv.LicenseHeader, "\n"), "\n") {
+				header = append(header, strings.TrimRight(prefix+" "+line, " "))
+			}
+
+			insertAt := 0
+			if hasShebang {
+				insertAt = 1
+			}
+			body = append(body[:insertAt], append(header, body[insertAt:]...)...)
+		}
+	}
+
+	// Makefiles require tabs, YAML forbids them, indentation is syntax in Python, and <<- strips
+	// leading tabs, so leave their indentation alone
+	python := hasShebang && strings.HasPrefix(interpreter(body[0]), "python")
+	if conv.Indent != "" && base != "Makefile" && !keepIndentation[ext] && !python && !stripTabs {
+		for i, line := range body {
+			body[i] = reindent(line, conv.Indent, conv.IndentWidth)
+		}
+	}
+
+	return body
+}
+
+// interpreter returns the interpreter named by a shebang line, e.g. bash for
+// #!/bin/bash and python3 for #!/usr/bin/env python3
+func interpreter(shebang string) string {
+	fields := strings.Fields(strings.TrimPrefix(shebang, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	name := filepath.Base(fields[0])
+	if name == "env" {
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "-") {
+				return filepath.Base(field)
+			}
+		}
+		return ""
+	}
+	return name
+}
+
+// reindent converts the leading indentation of a line to tabs or spaces
+func reindent(line string, indent string, width int) string {
+	if width <= 0 {
+		width = 4
+	}
+
+	trimmed := strings.TrimLeft(line, " \t")
+	leading := line[:len(line)-len(trimmed)]
+	if leading == "" {
+		return line
+	}
+
+	// Measure the indentation in columns, counting tabs as a full indent level
+	columns := 0
+	for _, r := range leading {
+		if r == '\t' {
+			columns += width
+		} else {
+			columns++
+		}
+	}
+
+	switch indent {
+	case config.IndentTabs:
+		return strings.Repeat("\t", columns/width) + strings.Repeat(" ", columns%width) + trimmed
+	case config.IndentSpaces:
+		return strings.Repeat(" ", columns) + trimmed
+	default:
+		return line
+	}
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,47 @@
+package diff
+
+import (
+	"strings"
+)
+
+// Lines returns a line diff from a to b. Unchanged lines are prefixed with two spaces,
+// removed lines with "- " and added lines with "+ ".
+func Lines(a string, b string) string {
+	before := strings.Split(a, "\n")
+	after := strings.Split(b, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of before[i:] and after[j:]
+	lcs := make([][]int, len(before)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table, preferring removals before additions
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			sb.WriteString("  " + before[i] + "\n")
+			i++
+			j++
+		case j == len(after) || (i < len(before) && lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("- " + before[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + after[j] + "\n")
+			j++
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,97 @@
+package fault
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// EnvVar is the environment variable listing the faults to inject, separated by commas,
+// e.g. TELL_FAULT=db_lock,api_500 tell prompt "list files". It lets the error paths of the
+// storage and LLM layers be exercised without a broken database or API.
+const EnvVar = "TELL_FAULT"
+
+// Supported faults
+const (
+	// DBLock makes history writes fail as if the database were locked by another process
+	DBLock = "db_lock"
+	// API500 makes every LLM API request return a 500 Internal Server Error
+	API500 = "api_500"
+	// MalformedJSON replaces the model's reply with text that isn't valid JSON
+	MalformedJSON = "malformed_json"
+	// Timeout makes every LLM API request fail with a timeout
+	Timeout = "timeout"
+)
+
+// Active reports whether the named fault is enabled
+func Active(name string) bool {
+	for _, f := range strings.Split(os.Getenv(EnvVar), ",") {
+		if strings.TrimSpace(f) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns an error describing the named fault if it is enabled, nil otherwise
+func Error(name string) error {
+	if !Active(name) {
+		return nil
+	}
+
+	slog.Debug("Injecting fault", "fault", name)
+	switch name {
+	case DBLock:
+		return fmt.Errorf("database is locked (injected fault)")
+	default:
+		return fmt.Errorf("%s (injected fault)", name)
+	}
+}
+
+// HTTPActive reports whether any fault handled by Transport is enabled
+func HTTPActive() bool {
+	return Active(API500) || Active(Timeout)
+}
+
+// transport fails requests according to the enabled faults
+type transport struct {
+	next http.RoundTripper
+}
+
+// Transport wraps next so requests fail with the enabled API500 or Timeout faults
+func Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Active(Timeout) {
+		slog.Debug("Injecting fault", "fault", Timeout, "url", req.URL.String())
+		return nil, fmt.Errorf("request to %s timed out (injected fault): %w", req.URL.Host, os.ErrDeadlineExceeded)
+	}
+
+	if Active(API500) {
+		slog.Debug("Injecting fault", "fault", API500, "url", req.URL.String())
+		body := `{"type":"error","error":{"type":"api_error","message":"Internal server error (injected fault)"}}`
+		return &http.Response{
+			Status:        "500 Internal Server Error",
+			StatusCode:    http.StatusInternalServerError,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          io.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,77 @@
+package histsync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitBackend keeps the files in a git repository, in a clone in a local directory. Every
+// machine commits its own file, so rebasing onto the commits of other machines never conflicts.
+type gitBackend struct {
+	url string
+	dir string
+}
+
+func (b *gitBackend) Dir() string {
+	return b.dir
+}
+
+func (b *gitBackend) Pull(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(b.dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(b.dir), 0700); err != nil {
+			return fmt.Errorf("could not create sync directory: %w", err)
+		}
+		_, err := runGit(ctx, "", "clone", "--quiet", b.url, b.dir)
+		return err
+	}
+
+	// A new repository has nothing to pull yet
+	heads, err := runGit(ctx, b.dir, "ls-remote", "--heads", "origin")
+	if err != nil || heads == "" {
+		return err
+	}
+	_, err = runGit(ctx, b.dir, "pull", "--quiet", "--rebase", "--autostash", "origin", "HEAD")
+	return err
+}
+
+func (b *gitBackend) Push(ctx context.Context, name string) error {
+	if _, err := runGit(ctx, b.dir, "add", "--", name); err != nil {
+		return err
+	}
+
+	// Nothing to commit when the history didn't change since the last sync, but a commit of an
+	// earlier sync may not have been pushed
+	if _, err := runGit(ctx, b.dir, "diff", "--cached", "--quiet"); err != nil {
+		if _, err := runGit(ctx, b.dir, "commit", "--quiet", "-m", "Sync "+strings.TrimSuffix(name, filepath.Ext(name))); err != nil {
+			return err
+		}
+	}
+
+	// Another machine pushed since the pull
+	if _, err := runGit(ctx, b.dir, "push", "--quiet", "origin", "HEAD"); err != nil {
+		if err := b.Pull(ctx); err != nil {
+			return err
+		}
+		_, err := runGit(ctx, b.dir, "push", "--quiet", "origin", "HEAD")
+		return err
+	}
+	return nil
+}
+
+// runGit runs git with args in dir, or the current directory when dir is empty, and returns its
+// output, with its error output in the error when it fails
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,87 @@
+package histsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+)
+
+// Backend moves the history files of every machine between the sync target and a local
+// directory. Each machine only writes its own file, so backends never have to merge files.
+type Backend interface {
+	// Dir returns the local directory holding the files
+	Dir() string
+	// Pull updates Dir with the files in the target
+	Pull(ctx context.Context) error
+	// Push copies the file named name in Dir to the target
+	Push(ctx context.Context, name string) error
+}
+
+// New returns the backend named by cfg. Backends that need a local copy of the target keep it
+// under cacheDir.
+func New(cfg config.SyncConfig, cacheDir string) (Backend, error) {
+	if cfg.Target == "" {
+		return nil, fmt.Errorf("no sync target, set sync.target in the config")
+	}
+
+	switch cfg.Backend {
+	case config.SyncDir, "":
+		dir, err := expandHome(cfg.Target)
+		if err != nil {
+			return nil, err
+		}
+		return &dirBackend{dir: dir}, nil
+	case config.SyncRclone:
+		return &rcloneBackend{remote: cfg.Target, dir: copyDir(cacheDir, "rclone", cfg.Target)}, nil
+	case config.SyncGit:
+		return &gitBackend{url: cfg.Target, dir: copyDir(cacheDir, "git", cfg.Target)}, nil
+	default:
+		return nil, fmt.Errorf("unknown sync backend %q, use %s, %s or %s", cfg.Backend, config.SyncDir, config.SyncRclone, config.SyncGit)
+	}
+}
+
+// copyDir returns the directory under cacheDir for the local copy of target, so that changing
+// the target starts from a fresh copy
+func copyDir(cacheDir string, backend string, target string) string {
+	sum := sha256.Sum256([]byte(target))
+	return filepath.Join(cacheDir, "sync", backend+"-"+hex.EncodeToString(sum[:])[:12])
+}
+
+// expandHome replaces a leading ~ in path with the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine home directory: %w", err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// dirBackend keeps the files in a directory, which another tool such as Dropbox, Syncthing or a
+// network share makes the same on every machine
+type dirBackend struct {
+	dir string
+}
+
+func (b *dirBackend) Dir() string {
+	return b.dir
+}
+
+func (b *dirBackend) Pull(ctx context.Context) error {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return fmt.Errorf("could not create sync directory %s: %w", b.dir, err)
+	}
+	return nil
+}
+
+func (b *dirBackend) Push(ctx context.Context, name string) error {
+	return nil
+}
@@ -0,0 +1,41 @@
+package histsync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// rcloneBackend keeps the files on an rclone remote, copied to and from a local directory
+type rcloneBackend struct {
+	// remote is the remote path, such as gdrive:tell
+	remote string
+	dir    string
+}
+
+func (b *rcloneBackend) Dir() string {
+	return b.dir
+}
+
+func (b *rcloneBackend) Pull(ctx context.Context) error {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return fmt.Errorf("could not create sync directory %s: %w", b.dir, err)
+	}
+	return runRclone(ctx, "copy", b.remote, b.dir)
+}
+
+func (b *rcloneBackend) Push(ctx context.Context, name string) error {
+	return runRclone(ctx, "copyto", filepath.Join(b.dir, name), strings.TrimSuffix(b.remote, "/")+"/"+name)
+}
+
+// runRclone runs rclone with args, with its output in the error when it fails
+func runRclone(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, "rclone", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("rclone %s failed: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package keyring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/jonfk/tell/internal/sysinfo"
+)
+
+// ErrNotFound is returned by Get when the keyring has no secret for the service and account
+var ErrNotFound = errors.New("secret not found in the keyring")
+
+// Get returns the secret stored for service and account in the OS keyring: the login keychain
+// through security on macOS, or the Secret Service (GNOME Keyring, KWallet) through secret-tool
+// elsewhere
+func Get(ctx context.Context, service string, account string) (string, error) {
+	switch sysinfo.DetectPlatform() {
+	case sysinfo.PlatformMacOS:
+		out, err := exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+		// security exits with 44 when there is no such item
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+			return "", ErrNotFound
+		}
+		if err != nil {
+			return "", fmt.Errorf("could not read keychain: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	case sysinfo.PlatformWindows:
+		return "", errors.New("the Windows credential manager isn't supported")
+	default:
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return "", errors.New("secret-tool isn't installed, it comes with libsecret (libsecret-tools on Debian and Ubuntu)")
+		}
+		// secret-tool exits with 1 and prints nothing when there is no such secret
+		out, err := exec.CommandContext(ctx, "secret-tool", "lookup", "service", service, "account", account).Output()
+		if err != nil || len(out) == 0 {
+			var exitErr *exec.ExitError
+			if err == nil || (errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && len(exitErr.Stderr) == 0) {
+				return "", ErrNotFound
+			}
+			return "", fmt.Errorf("could not read keyring: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+}
+
+// Set stores secret for service and account in the OS keyring, replacing any secret already
+// there. The secret is passed on stdin, so it never shows in the process list.
+func Set(ctx context.Context, service string, account string, label string, secret string) error {
+	var cmd *exec.Cmd
+	switch sysinfo.DetectPlatform() {
+	case sysinfo.PlatformMacOS:
+		// security reads the command from stdin with -i; the values are quoted for its parser
+		cmd = exec.CommandContext(ctx, "security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -l %q -w %q\n", service, account, label, secret))
+	case sysinfo.PlatformWindows:
+		return errors.New("the Windows credential manager isn't supported")
+	default:
+		cmd = exec.CommandContext(ctx, "secret-tool", "store", "--label="+label, "service", service, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("could not store secret in the keyring: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// Analyze lists the side effects of a shell command, such as files written or deleted,
+// network access and privileges needed, so the user can decide whether to run it
+func (c *Client) Analyze(command string) (*model.Analysis, *model.LLMUsage, error) {
+	responseText, usage, err := c.send(buildAnalyzeSystemPrompt(c.config, c.target), []Message{
+		userMessage("List the side effects of this command:\n" + command),
+	})
+	if err != nil {
+		return nil, usage, fmt.Errorf("error analyzing command: %w", err)
+	}
+
+	analysis, err := parseAnalysis(responseText)
+	if err != nil {
+		return nil, usage, fmt.Errorf("error parsing analysis: %w", err)
+	}
+
+	return analysis, usage, nil
+}
+
+// parseAnalysis parses and validates the JSON analysis returned by the model
+func parseAnalysis(responseText string) (*model.Analysis, error) {
+	jsonStr, err := extractJSON(responseText)
+	if err != nil {
+		return nil, err
+	}
+
+	var analysis model.Analysis
+	if err := json.Unmarshal([]byte(jsonStr), &analysis); err != nil {
+		return nil, fmt.Errorf("error unmarshaling JSON: %w, response: %s", err, jsonStr)
+	}
+
+	analysis.Risk = strings.ToLower(strings.TrimSpace(analysis.Risk))
+	switch analysis.Risk {
+	case model.RiskLow, model.RiskMedium, model.RiskHigh:
+	default:
+		return nil, fmt.Errorf("invalid risk %q in response: %s", analysis.Risk, jsonStr)
+	}
+
+	return &analysis, nil
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/jonfk/tell/internal/config"
+)
+
+// anthropicProvider talks to the Anthropic Messages API through the official SDK
+type anthropicProvider struct {
+	client *anthropic.Client
+}
+
+// newAnthropicProvider creates a provider for the Anthropic API. Extra request
+// options are applied last, e.g. to route requests through a cloud platform.
+func newAnthropicProvider(settings config.ProviderConfig, httpClient *http.Client, extraOpts ...option.RequestOption) *anthropicProvider {
+	// Create new client using the current SDK pattern
+	// Retries are handled by the Client so they follow the configured policy
+	requestOpts := []option.RequestOption{
+		option.WithAPIKey(settings.APIKey),
+		option.WithMaxRetries(0),
+	}
+	if httpClient != nil {
+		requestOpts = append(requestOpts, option.WithHTTPClient(httpClient))
+	}
+	requestOpts = append(requestOpts, extraOpts...)
+
+	return &anthropicProvider{
+		client: anthropic.NewClient(requestOpts...),
+	}
+}
+
+// Complete implements Provider
+func (p *anthropicProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	messages := make([]anthropic.MessageParam, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role == RoleAssistant {
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(msg.Content)))
+		} else {
+			messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(msg.Content)))
+		}
+	}
+
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(req.Model),
+		MaxTokens: anthropic.F(int64(req.MaxTokens)),
+		System: anthropic.F([]anthropic.TextBlockParam{
+			anthropic.NewTextBlock(req.System),
+		}),
+		Messages: anthropic.F(messages),
+	}
+
+	var message *anthropic.Message
+	var err error
+	if req.OnProgress != nil {
+		message, err = p.stream(ctx, params, req.OnProgress)
+	} else {
+		message, err = p.client.Messages.New(ctx, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract the text content from the assistant's response
+	var responseText string
+	for _, content := range message.Content {
+		if content.Type == anthropic.ContentBlockTypeText {
+			responseText += content.Text
+		}
+	}
+
+	return &Response{
+		Text:         responseText,
+		InputTokens:  int(message.Usage.InputTokens),
+		OutputTokens: int(message.Usage.OutputTokens),
+	}, nil
+}
+
+// stream sends the request as a streaming request, reporting progress as text arrives
+func (p *anthropicProvider) stream(ctx context.Context, params anthropic.MessageNewParams, onProgress func(int)) (*anthropic.Message, error) {
+	stream := p.client.Messages.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	message := anthropic.Message{}
+	var streamedChars int
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return nil, err
+		}
+
+		switch ev := event.AsUnion().(type) {
+		case anthropic.ContentBlockDeltaEvent:
+			// Token counts are only reported at the end of the stream, so estimate
+			// from the text received so far (roughly 4 characters per token)
+			streamedChars += len(ev.Delta.Text)
+			onProgress((streamedChars + 3) / 4)
+		case anthropic.MessageDeltaEvent:
+			onProgress(int(ev.Usage.OutputTokens))
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
@@ -4,97 +4,214 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
 	"strings"
+	"time"
 
-	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/anthropics/anthropic-sdk-go/option"
 	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/conventions"
+	"github.com/jonfk/tell/internal/fault"
 	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/policy"
+	"github.com/jonfk/tell/internal/portability"
+	"github.com/jonfk/tell/internal/privilege"
+	"github.com/jonfk/tell/internal/shellenv"
+	"github.com/jonfk/tell/internal/sysinfo"
 )
 
 // Client represents an LLM API client
 type Client struct {
-	config *config.Config
-	client *anthropic.Client
+	config   *config.Config
+	provider Provider
+	// model is the model used by the selected provider
+	model string
+
+	// onProgress is called with the estimated output token count while a response is streaming
+	onProgress func(outputTokens int)
+	// tracer records requests and raw responses when tracing is enabled
+	tracer *tracer
+	// httpClient overrides the HTTP client used by providers when set
+	httpClient *http.Client
+	// contextItems is extra environment context attached to the user's prompt
+	contextItems []model.ContextItem
+	// modelOverride replaces the provider's configured model when set
+	modelOverride string
+	// promptVariant is the system prompt style used for commands (full or compact)
+	promptVariant string
+	// target is the remote host commands are generated for, nil for the local system
+	target *sysinfo.RemoteHost
+	// undo asks for a command reversing each generated command
+	undo bool
+	// syntaxShell parses generated commands to catch syntax errors, empty to skip the check
+	syntaxShell string
+	// force allows destructive commands at the strict safety level
+	force bool
+	// beforeRequest is called before each request is sent, which is refused when it returns an error
+	beforeRequest func() error
 }
 
-// NewClient creates a new LLM client
-func NewClient(cfg *config.Config) *Client {
-	// Create new client using the current SDK pattern
-	client := anthropic.NewClient(
-		option.WithAPIKey(cfg.AnthropicAPIKey),
-	)
+// Option configures optional behaviour of the Client
+type Option func(*Client)
 
-	return &Client{
-		config: cfg,
-		client: client,
+// WithHTTPClient sends requests through the given HTTP client instead of the default one.
+// This allows tests and dev tooling to swap the transport, e.g. for recorded fixtures.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
 	}
 }
 
-// GenerateCommand generates a shell command from a natural language prompt
-func (c *Client) GenerateCommand(prompt string) (*model.CommandResponse, *model.LLMUsage, error) {
-	// Build the system prompt
-	systemPrompt := buildSystemPrompt(c.config)
+// WithContext attaches environment context (git status, directory listing, ...) to the prompt
+func WithContext(items []model.ContextItem) Option {
+	return func(c *Client) {
+		c.contextItems = items
+	}
+}
 
-	// Create context for the request
-	ctx := context.Background()
+// WithModel sends requests to the given model instead of the one configured for the provider
+func WithModel(model string) Option {
+	return func(c *Client) {
+		c.modelOverride = model
+	}
+}
 
-	// Create the message request
-	message, err := c.client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.F(c.config.LLMModel),
-		MaxTokens: anthropic.F(int64(1024)),
-		System: anthropic.F([]anthropic.TextBlockParam{
-			anthropic.NewTextBlock(systemPrompt),
-		}),
-		Messages: anthropic.F([]anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
-		}),
-	})
+// WithTargetHost generates commands for a remote host instead of the local system
+func WithTargetHost(target *sysinfo.RemoteHost) Option {
+	return func(c *Client) {
+		c.target = target
+	}
+}
+
+// WithUndo asks for a command that reverses each generated command, in CommandResponse.Undo
+func WithUndo() Option {
+	return func(c *Client) {
+		c.undo = true
+	}
+}
+
+// WithSyntaxCheck parses each generated command with shell before returning it, and asks the
+// model once to correct a command the shell rejects
+func WithSyntaxCheck(shell string) Option {
+	return func(c *Client) {
+		c.syntaxShell = shell
+	}
+}
+
+// WithForce allows destructive commands when the safety level is strict, instead of refusing them
+func WithForce() Option {
+	return func(c *Client) {
+		c.force = true
+	}
+}
+
+// WithRequestCheck has check called before each request is sent, including repair and
+// correction requests, and refuses the request when it returns an error, e.g. once the
+// monthly budget is spent
+func WithRequestCheck(check func() error) Option {
+	return func(c *Client) {
+		c.beforeRequest = check
+	}
+}
 
+// WithProgress streams responses and reports the estimated number of output tokens received so far
+func WithProgress(fn func(outputTokens int)) Option {
+	return func(c *Client) {
+		c.onProgress = fn
+	}
+}
+
+// NewClient creates a new LLM client for the provider selected in the configuration
+func NewClient(cfg *config.Config, opts ...Option) (*Client, error) {
+	c := &Client{
+		config: cfg,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	providerName := cfg.ActiveProvider()
+	settings, err := cfg.ProviderSettings(providerName)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error generating command: %w", err)
+		return nil, err
 	}
+	c.promptVariant = choosePromptVariant(cfg.PromptStyle)
 
-	// Create usage info
-	usage := &model.LLMUsage{
-		Model:        c.config.LLMModel,
-		InputTokens:  int(message.Usage.OutputTokens),
-		OutputTokens: int(message.Usage.InputTokens),
+	c.model = settings.Model
+	if c.modelOverride != "" {
+		settings.Model = c.modelOverride
+		c.model = c.modelOverride
+	}
+
+	if c.tracer != nil {
+		c.tracer.secrets = []string{settings.APIKey}
+	}
+
+	// Fail API requests on purpose when fault injection asks for it
+	if fault.HTTPActive() {
+		c.httpClient = withFaults(c.httpClient)
+	}
+
+	c.provider, err = newProvider(providerName, settings, c.httpClient)
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract the text content from the assistant's response
-	var responseText string
-	for _, content := range message.Content {
-		if content.Type == anthropic.ContentBlockTypeText {
-			responseText += content.Text
+	return c, nil
+}
+
+// choosePromptVariant resolves the configured prompt style to the variant used by this client
+func choosePromptVariant(style string) string {
+	switch style {
+	case config.PromptStyleCompact:
+		return config.PromptStyleCompact
+	case config.PromptStyleAB:
+		if rand.IntN(2) == 0 {
+			return config.PromptStyleCompact
 		}
+		return config.PromptStyleFull
+	default:
+		return config.PromptStyleFull
 	}
+}
 
-	// Parse the JSON output
-	cmdResponse, err := parseAndValidateResponse(responseText)
+// withFaults returns a copy of httpClient (or the default client) whose transport injects API faults
+func withFaults(httpClient *http.Client) *http.Client {
+	faulty := &http.Client{}
+	if httpClient != nil {
+		*faulty = *httpClient
+	}
+	faulty.Transport = fault.Transport(faulty.Transport)
+	return faulty
+}
+
+// Model returns the model requests are sent to
+func (c *Client) Model() string {
+	return c.model
+}
+
+// GenerateCommand generates a shell command from a natural language prompt
+func (c *Client) GenerateCommand(prompt string) (*model.CommandResponse, *model.LLMUsage, error) {
+	cmdResponse, usage, err := c.complete([]Message{
+		userMessage(buildUserMessage(prompt, c.contextItems)),
+	})
 	if err != nil {
-		return nil, usage, fmt.Errorf("error parsing response: %w", err)
+		return cmdResponse, usage, fmt.Errorf("error generating command: %w", err)
 	}
 
 	return cmdResponse, usage, nil
 }
 
 func parseAndValidateResponse(responseText string) (*model.CommandResponse, error) {
-	// Try to find JSON content in the response
-	// Look for the first '{' and the last '}'
-	startIdx := strings.Index(responseText, "{")
-	endIdx := strings.LastIndex(responseText, "}")
-
-	if startIdx == -1 || endIdx == -1 || endIdx <= startIdx {
-		return nil, fmt.Errorf("could not find valid JSON in response: %s", responseText)
+	jsonStr, err := extractJSON(responseText)
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract the JSON part of the response
-	jsonStr := responseText[startIdx : endIdx+1]
-
 	// Parse the JSON
 	var response model.CommandResponse
-	err := json.Unmarshal([]byte(jsonStr), &response)
+	err = json.Unmarshal([]byte(jsonStr), &response)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling JSON: %w, response: %s", err, jsonStr)
 	}
@@ -104,76 +221,338 @@ func parseAndValidateResponse(responseText string) (*model.CommandResponse, erro
 		return nil, fmt.Errorf("command is empty in response: %s", jsonStr)
 	}
 
+	// Warnings are only added by tell itself
+	response.Warnings = nil
+	if response.EstimatedImpact != "" {
+		response.AddWarning(model.WarningImpact, response.EstimatedImpact)
+	}
+
 	return &response, nil
 }
 
-func (c *Client) GenerateCommandContinuation(prompt string, previousEntry *model.HistoryEntry) (*model.CommandResponse, *model.LLMUsage, error) {
-	// Build the system prompt
-	systemPrompt := buildSystemPrompt(c.config)
+// extractJSON returns the JSON object in a response, from the first '{' to the last '}',
+// ignoring any text or markdown fences the model added around it
+func extractJSON(responseText string) (string, error) {
+	startIdx := strings.Index(responseText, "{")
+	endIdx := strings.LastIndex(responseText, "}")
+
+	if startIdx == -1 || endIdx == -1 || endIdx <= startIdx {
+		return "", fmt.Errorf("could not find valid JSON in response: %s", responseText)
+	}
+
+	return responseText[startIdx : endIdx+1], nil
+}
+
+// GenerateCommandContinuation generates a command continuing a conversation: the previous
+// entries, oldest first, are sent as earlier turns, e.g. the most recent command with --continue
+// or the commands of a session
+func (c *Client) GenerateCommandContinuation(prompt string, previous []model.HistoryEntry) (*model.CommandResponse, *model.LLMUsage, error) {
+	// Send the request with conversation history
+	messages, executionNote := conversation(previous)
+	messages = append(messages, userMessage(executionNote+buildUserMessage(prompt, c.contextItems)))
 
-	// Create context for the request
-	ctx := context.Background()
+	cmdResponse, usage, err := c.complete(messages)
+	if err != nil {
+		return cmdResponse, usage, fmt.Errorf("error generating command continuation: %w", err)
+	}
+
+	return cmdResponse, usage, nil
+}
+
+// RefineCommand generates a new command for prompt after the user rejected earlier attempts.
+// Each attempt is sent back as the model's answer, followed by the user's feedback, so the
+// model corrects its own command. previous are the entries being continued, oldest first.
+func (c *Client) RefineCommand(prompt string, previous []model.HistoryEntry, attempts []model.RejectedAttempt) (*model.CommandResponse, *model.LLMUsage, error) {
+	messages, executionNote := conversation(previous)
+	messages = append(messages, userMessage(executionNote+buildUserMessage(prompt, c.contextItems)))
+	for _, attempt := range attempts {
+		messages = append(messages,
+			assistantMessage(marshalResponse(model.CommandResponse{
+				Command:     attempt.Response.Command,
+				Details:     attempt.Response.Details,
+				ShowDetails: attempt.Response.ShowDetails,
+			})),
+			userMessage(buildFeedbackPrompt(attempt.Feedback)),
+		)
+	}
+
+	cmdResponse, usage, err := c.complete(messages)
+	if err != nil {
+		return cmdResponse, usage, fmt.Errorf("error regenerating command: %w", err)
+	}
+
+	return cmdResponse, usage, nil
+}
 
-	// Create response string for the previous command
-	previousResponse := buildAssistantResponse(previousEntry)
-
-	// Create the message request with conversation history
-	message, err := c.client.Messages.New(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.F(c.config.LLMModel),
-		MaxTokens: anthropic.F(int64(1024)),
-		System: anthropic.F([]anthropic.TextBlockParam{
-			anthropic.NewTextBlock(systemPrompt),
-		}),
-		Messages: anthropic.F([]anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(previousEntry.Prompt)),
-			anthropic.NewAssistantMessage(anthropic.NewTextBlock(previousResponse)),
-			anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
-		}),
+// CompleteCommandLine completes or repairs a partially typed or broken command line
+func (c *Client) CompleteCommandLine(commandLine string) (*model.CommandResponse, *model.LLMUsage, error) {
+	cmdResponse, usage, err := c.complete([]Message{
+		userMessage(buildUserMessage(buildCompletionPrompt(commandLine), c.contextItems)),
 	})
+	if err != nil {
+		return cmdResponse, usage, fmt.Errorf("error completing command line: %w", err)
+	}
+
+	return cmdResponse, usage, nil
+}
 
+// FixCommand asks for a corrected version of a command that failed
+func (c *Client) FixCommand(failed model.FailedCommand) (*model.CommandResponse, *model.LLMUsage, error) {
+	cmdResponse, usage, err := c.complete([]Message{
+		userMessage(buildUserMessage(buildFixPrompt(failed), c.contextItems)),
+	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("error generating command continuation: %w", err)
+		return cmdResponse, usage, fmt.Errorf("error fixing command: %w", err)
 	}
 
-	// Create usage info
-	usage := &model.LLMUsage{
-		Model:        c.config.LLMModel,
-		InputTokens:  int(message.Usage.OutputTokens),
-		OutputTokens: int(message.Usage.InputTokens),
+	return cmdResponse, usage, nil
+}
+
+// Ask answers a general question about the terminal in plain text instead of generating a command
+func (c *Client) Ask(question string) (string, *model.LLMUsage, error) {
+	answer, usage, err := c.send(buildAskSystemPrompt(c.config, c.target), []Message{
+		userMessage(buildUserMessage(question, c.contextItems)),
+	})
+	if err != nil {
+		return "", usage, fmt.Errorf("error answering question: %w", err)
 	}
 
-	// Extract the text content from the assistant's response
-	var responseText string
-	for _, content := range message.Content {
-		if content.Type == anthropic.ContentBlockTypeText {
-			responseText += content.Text
-		}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "", usage, fmt.Errorf("answer is empty in response")
+	}
+
+	return answer, usage, nil
+}
+
+// complete sends the conversation to the model and parses the command response.
+// If the response isn't valid JSON, the model is asked once to re-emit it before giving up.
+func (c *Client) complete(messages []Message) (*model.CommandResponse, *model.LLMUsage, error) {
+	systemPrompt := buildSystemPrompt(c.config, c.promptVariant, c.target)
+	if c.undo {
+		systemPrompt += undoInstructions
+	}
+
+	responseText, usage, err := c.send(systemPrompt, messages)
+	if err != nil {
+		return nil, nil, err
 	}
+	usage.PromptVariant = c.promptVariant
+	usage.ParseAttempts = 1
 
 	// Parse the JSON output
-	cmdResponse, err := parseAndValidateResponse(responseText)
+	cmdResponse, parseErr := parseAndValidateResponse(responseText)
+	if parseErr != nil {
+		// Ask the model to repair its own output, bounded to a single retry
+		slog.Debug("Response was not valid JSON, asking the model to repair it", "error", parseErr)
+		messages = append(messages,
+			assistantMessage(responseText),
+			userMessage(buildRepairPrompt(parseErr)),
+		)
+
+		usage.ParseAttempts = 2
+		repairedText, repairUsage, err := c.send(systemPrompt, messages)
+		if err != nil {
+			return nil, usage, fmt.Errorf("error parsing response: %w (repair request failed: %v)", parseErr, err)
+		}
+		addUsage(usage, repairUsage)
+
+		cmdResponse, err = parseAndValidateResponse(repairedText)
+		if err != nil {
+			return nil, usage, fmt.Errorf("error parsing response: %w", err)
+		}
+		responseText = repairedText
+	}
+
+	cmdResponse = c.correctSyntax(systemPrompt, messages, responseText, cmdResponse, usage)
+
+	return c.finishResponse(cmdResponse, usage)
+}
+
+// correctSyntax parses the command with the shell and, when the shell rejects it, asks the model
+// once to correct it. A command that can't be corrected is returned with a warning, since the
+// user may still fix it by hand.
+func (c *Client) correctSyntax(
+	systemPrompt string,
+	messages []Message,
+	responseText string,
+	cmdResponse *model.CommandResponse,
+	usage *model.LLMUsage,
+) *model.CommandResponse {
+	if c.syntaxShell == "" {
+		return cmdResponse
+	}
+	syntaxErr := shellenv.CheckSyntax(c.syntaxShell, cmdResponse.Command)
+	if syntaxErr == nil {
+		return cmdResponse
+	}
+
+	slog.Debug("Command has a syntax error, asking the model to correct it", "error", syntaxErr)
+	messages = append(messages,
+		assistantMessage(responseText),
+		userMessage(buildSyntaxPrompt(syntaxErr)),
+	)
+
+	correctedText, correctUsage, err := c.send(systemPrompt, messages)
 	if err != nil {
-		return nil, usage, fmt.Errorf("error parsing response: %w", err)
+		slog.Warn("Syntax correction request failed", "error", err)
+	} else {
+		addUsage(usage, correctUsage)
+		corrected, err := parseAndValidateResponse(correctedText)
+		if err != nil {
+			slog.Warn("Could not parse syntax correction", "error", err)
+		} else {
+			cmdResponse = corrected
+			syntaxErr = shellenv.CheckSyntax(c.syntaxShell, cmdResponse.Command)
+		}
+	}
+
+	if syntaxErr != nil {
+		cmdResponse.AddWarning(model.WarningSyntax, fmt.Sprintf("The command may not run, %v", syntaxErr))
+	}
+	return cmdResponse
+}
+
+// finishResponse applies the file conventions to a parsed command and checks it against the
+// command policy. A refused command is returned along with the error, so it can be saved to
+// history with the reason.
+func (c *Client) finishResponse(cmdResponse *model.CommandResponse, usage *model.LLMUsage) (*model.CommandResponse, *model.LLMUsage, error) {
+	cmdResponse.Command = conventions.Apply(cmdResponse.Command, c.config.FileConventions)
+
+	// Flag flags the system's coreutils don't have, e.g. date -d on macOS
+	system := "this system"
+	if c.target != nil {
+		system = "the target system"
+	}
+	for _, issue := range portability.Lint(cmdResponse.Command, coreutilsFlavor(c.config, c.target)) {
+		cmdResponse.AddWarning(model.WarningCoreutils, fmt.Sprintf("May not work on %s, %s", system, issue))
+	}
+
+	// Flag commands that need root, so callers can handle elevation deliberately
+	requires, elevated, reason := privilege.RequiresRoot(cmdResponse.Command)
+	cmdResponse.RequiresRoot = requires
+	if elevated {
+		cmdResponse.AddWarning(model.WarningRoot, fmt.Sprintf("Runs with root privileges through %s", reason))
+	} else if requires {
+		cmdResponse.AddWarning(model.WarningRoot, fmt.Sprintf("Needs root privileges for %s, run it with sudo", reason))
+	}
+
+	if err := policy.Check(cmdResponse.Command, c.config.Policy); err != nil {
+		return cmdResponse, usage, err
+	}
+
+	// Flag commands that delete or overwrite data, which the strict safety level refuses
+	if c.config.Safety() != config.SafetyOff {
+		if err := policy.CheckSafety(cmdResponse.Command, c.config.Safety(), c.force); err != nil {
+			return cmdResponse, usage, err
+		}
+		if reason := policy.Destructive(cmdResponse.Command); reason != "" {
+			cmdResponse.AddWarning(model.WarningDestructive, fmt.Sprintf("Destructive, %s", reason))
+		}
 	}
 
 	return cmdResponse, usage, nil
 }
 
+// send sends the conversation to the model with the given system prompt and returns the raw response text
+func (c *Client) send(systemPrompt string, messages []Message) (string, *model.LLMUsage, error) {
+	// Create context for the request
+	ctx := context.Background()
+
+	req := &Request{
+		Model:      c.model,
+		System:     systemPrompt,
+		Messages:   messages,
+		MaxTokens:  1024,
+		OnProgress: c.onProgress,
+	}
+
+	if c.beforeRequest != nil {
+		if err := c.beforeRequest(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if c.tracer != nil {
+		c.tracer.request(req)
+	}
+
+	// Retry transient failures with exponential backoff
+	var resp *Response
+	var err error
+	retries := 0
+	for {
+		resp, err = c.provider.Complete(ctx, req)
+		if err == nil || retries >= c.config.Retry.MaxRetries || !isRetryable(err) {
+			break
+		}
+
+		retries++
+		delay := backoff(c.config.Retry, retries)
+		slog.Debug("Retrying LLM request", "retry", retries, "delay", delay, "error", err)
+		time.Sleep(delay)
+	}
+	if err != nil {
+		if retries > 0 {
+			err = fmt.Errorf("%w (retried %d times)", err, retries)
+		}
+		if c.tracer != nil {
+			c.tracer.response("", err)
+		}
+		return "", nil, err
+	}
+
+	if fault.Active(fault.MalformedJSON) {
+		resp.Text = "Sure! Here is the command you asked for: ls -la (injected fault)"
+	}
+
+	if c.tracer != nil {
+		c.tracer.response(resp.Text, nil)
+	}
+
+	// Create usage info
+	usage := &model.LLMUsage{
+		Model:        c.model,
+		InputTokens:  resp.InputTokens,
+		OutputTokens: resp.OutputTokens,
+		Retries:      retries,
+	}
+
+	return resp.Text, usage, nil
+}
+
 // Helper function to build the assistant's response for the conversation history
 func buildAssistantResponse(entry *model.HistoryEntry) string {
-	// Create a response object
-	response := model.CommandResponse{
+	return marshalResponse(model.CommandResponse{
 		Command:     entry.Command,
 		Details:     entry.Details,
 		ShowDetails: entry.ShowDetails,
+	})
+}
+
+// conversation turns history entries, oldest first, into the earlier turns of a conversation:
+// each prompt followed by the command as the model's answer. How a command went when it was run
+// is told in the next prompt, so the note for the last command is returned for the caller's.
+func conversation(entries []model.HistoryEntry) ([]Message, string) {
+	var messages []Message
+	var executionNote string
+	for _, entry := range entries {
+		messages = append(messages,
+			userMessage(executionNote+entry.Prompt),
+			assistantMessage(buildAssistantResponse(&entry)),
+		)
+		executionNote = buildExecutionNote(&entry)
 	}
+	return messages, executionNote
+}
 
-	// Marshal to JSON
+// marshalResponse renders a command response as the JSON the model is asked to return
+func marshalResponse(response model.CommandResponse) string {
 	jsonData, err := json.Marshal(response)
 	if err != nil {
 		// If marshaling fails, return a simplified response
 		return fmt.Sprintf("{\n  \"command\": %q,\n  \"show_details\": %t,\n  \"details\": %q\n}",
-			entry.Command, entry.ShowDetails, entry.Details)
+			response.Command, response.ShowDetails, response.Details)
 	}
 
 	return string(jsonData)
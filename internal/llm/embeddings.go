@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/fault"
+)
+
+// Embedder turns text into embedding vectors with a provider exposing an OpenAI-compatible
+// embeddings API, such as OpenAI, Mistral or a local Ollama
+type Embedder struct {
+	provider   string
+	model      string
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// openAIEmbeddingRequest is the request body of the embeddings endpoint
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// openAIEmbeddingResponse is the subset of the embeddings response we use
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// NewEmbedder creates an embedder for the embedding provider and model in the configuration.
+// A nil httpClient uses the default one.
+func NewEmbedder(cfg *config.Config, httpClient *http.Client) (*Embedder, error) {
+	provider, settings, err := cfg.EmbeddingSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	// Fail API requests on purpose when fault injection asks for it
+	if fault.HTTPActive() {
+		httpClient = withFaults(httpClient)
+	}
+
+	return &Embedder{
+		provider:   provider,
+		model:      settings.Model,
+		apiKey:     settings.APIKey,
+		baseURL:    strings.TrimSuffix(settings.BaseURL, "/"),
+		httpClient: httpClient,
+	}, nil
+}
+
+// Name identifies the provider and model, e.g. openai/text-embedding-3-small. Vectors from
+// different models can't be compared.
+func (e *Embedder) Name() string {
+	return e.provider + "/" + e.model
+}
+
+// Embed returns a vector for each of texts, in the same order
+func (e *Embedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(openAIEmbeddingRequest{Model: e.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	// Local servers such as Ollama don't need a key
+	if e.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", e.provider, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s response: %w", e.provider, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &StatusError{Provider: e.provider, StatusCode: resp.StatusCode, Message: errorMessage(respBody)}
+	}
+
+	var embedResp openAIEmbeddingResponse
+	if err := json.Unmarshal(respBody, &embedResp); err != nil {
+		return nil, fmt.Errorf("could not parse %s response: %w", e.provider, err)
+	}
+
+	// Vectors are placed by index, the API doesn't promise to keep the order
+	vectors := make([][]float32, len(texts))
+	for _, data := range embedResp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("%s response has an embedding for unknown input %d", e.provider, data.Index)
+		}
+		vectors[data.Index] = data.Embedding
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("%s response has no embedding for input %d", e.provider, i)
+		}
+	}
+
+	return vectors, nil
+}
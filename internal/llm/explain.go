@@ -0,0 +1,45 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// Explain breaks an existing shell command down into its parts and explains each of them
+func (c *Client) Explain(command string) (*model.Explanation, *model.LLMUsage, error) {
+	responseText, usage, err := c.send(buildExplainSystemPrompt(c.config), []Message{
+		userMessage("Explain this command:\n" + command),
+	})
+	if err != nil {
+		return nil, usage, fmt.Errorf("error explaining command: %w", err)
+	}
+
+	explanation, err := parseExplanation(responseText)
+	if err != nil {
+		return nil, usage, fmt.Errorf("error parsing explanation: %w", err)
+	}
+
+	return explanation, usage, nil
+}
+
+// parseExplanation parses and validates the JSON explanation returned by the model
+func parseExplanation(responseText string) (*model.Explanation, error) {
+	jsonStr, err := extractJSON(responseText)
+	if err != nil {
+		return nil, err
+	}
+
+	var explanation model.Explanation
+	if err := json.Unmarshal([]byte(jsonStr), &explanation); err != nil {
+		return nil, fmt.Errorf("error unmarshaling JSON: %w, response: %s", err, jsonStr)
+	}
+
+	if strings.TrimSpace(explanation.Summary) == "" {
+		return nil, fmt.Errorf("summary is empty in response: %s", jsonStr)
+	}
+
+	return &explanation, nil
+}
@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/fault"
+)
+
+// stubServer answers every chat completion request with the same command, counting the requests
+// that reach it. It stands in for the API while fixtures are recorded.
+type stubServer struct {
+	requests atomic.Int32
+}
+
+// RoundTrip implements http.RoundTripper
+func (s *stubServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.requests.Add(1)
+
+	content, _ := json.Marshal(map[string]any{
+		"command":      "ls -la",
+		"details":      "Lists all files in the current directory",
+		"show_details": false,
+	})
+	body, _ := json.Marshal(map[string]any{
+		"choices": []map[string]any{
+			{"message": map[string]any{"role": RoleAssistant, "content": string(content)}},
+		},
+		"usage": map[string]any{"prompt_tokens": 100, "completion_tokens": 20},
+	})
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// faultConfig returns a configuration for an OpenAI-compatible provider at an address that
+// doesn't resolve, so only fixtures can answer, retrying without waiting so tests stay fast
+func faultConfig() *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.Provider = config.ProviderMistral
+	cfg.Providers = map[string]config.ProviderConfig{
+		config.ProviderMistral: {
+			APIKey:  "test-key",
+			Model:   "mistral-small-latest",
+			BaseURL: "http://fixtures.invalid/v1",
+		},
+	}
+	cfg.Retry = config.RetryConfig{MaxRetries: 2}
+	return cfg
+}
+
+// recordFixtures generates a command through a record transport in front of the stub, so the
+// requests the same prompt sends later can be replayed from dir
+func recordFixtures(t *testing.T, dir string, prompt string) *stubServer {
+	t.Helper()
+
+	stub := &stubServer{}
+	record, err := NewRecordTransport(dir, stub)
+	if err != nil {
+		t.Fatalf("NewRecordTransport: %v", err)
+	}
+	client, err := NewClient(faultConfig(), WithHTTPClient(&http.Client{Transport: record}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	// Errors are checked by the replaying tests, e.g. malformed JSON is recorded on purpose
+	_, _, _ = client.GenerateCommand(prompt)
+
+	return stub
+}
+
+// replayClient creates a client answering from the fixtures in dir, with the faults currently set
+func replayClient(t *testing.T, dir string) *Client {
+	t.Helper()
+
+	replay, err := NewReplayTransport(dir)
+	if err != nil {
+		t.Fatalf("NewReplayTransport: %v", err)
+	}
+	client, err := NewClient(faultConfig(), WithHTTPClient(&http.Client{Transport: replay}))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	return client
+}
+
+func TestReplayWithoutFaults(t *testing.T) {
+	t.Setenv(fault.EnvVar, "")
+	dir := t.TempDir()
+	recordFixtures(t, dir, "list files")
+
+	response, usage, err := replayClient(t, dir).GenerateCommand("list files")
+	if err != nil {
+		t.Fatalf("GenerateCommand: %v", err)
+	}
+	if response.Command != "ls -la" {
+		t.Errorf("command = %q, want %q", response.Command, "ls -la")
+	}
+	if usage.ParseAttempts != 1 {
+		t.Errorf("parse attempts = %d, want 1", usage.ParseAttempts)
+	}
+}
+
+func TestFaultAPI500IsRetriedAndReported(t *testing.T) {
+	t.Setenv(fault.EnvVar, "")
+	dir := t.TempDir()
+	recordFixtures(t, dir, "list files")
+
+	t.Setenv(fault.EnvVar, fault.API500)
+	response, _, err := replayClient(t, dir).GenerateCommand("list files")
+	if err == nil {
+		t.Fatalf("GenerateCommand succeeded with %q, want an error", response.Command)
+	}
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("error = %v, want a 500 status error", err)
+	}
+	if !strings.Contains(err.Error(), "retried 2 times") {
+		t.Errorf("error = %q, want it to report the 2 retries", err)
+	}
+}
+
+func TestFaultMalformedJSONAsksForRepair(t *testing.T) {
+	// The repair request is only sent after a malformed reply, so it is recorded with the fault set
+	t.Setenv(fault.EnvVar, fault.MalformedJSON)
+	dir := t.TempDir()
+	stub := recordFixtures(t, dir, "list files")
+	if got := stub.requests.Load(); got != 2 {
+		t.Fatalf("recorded %d requests, want the request and its repair", got)
+	}
+
+	_, usage, err := replayClient(t, dir).GenerateCommand("list files")
+	if err == nil {
+		t.Fatal("GenerateCommand succeeded, want an error parsing the response")
+	}
+	if !strings.Contains(err.Error(), "error parsing response") {
+		t.Errorf("error = %q, want a parse error", err)
+	}
+	if usage == nil || usage.ParseAttempts != 2 {
+		t.Errorf("usage = %+v, want 2 parse attempts", usage)
+	}
+}
+
+func TestFaultTimeoutReturnsCleanError(t *testing.T) {
+	t.Setenv(fault.EnvVar, "")
+	dir := t.TempDir()
+	recordFixtures(t, dir, "list files")
+
+	t.Setenv(fault.EnvVar, fault.Timeout)
+	response, usage, err := replayClient(t, dir).GenerateCommand("list files")
+	if err == nil {
+		t.Fatalf("GenerateCommand succeeded with %q, want an error", response.Command)
+	}
+	if response != nil || usage != nil {
+		t.Errorf("got response %+v and usage %+v with the error, want neither", response, usage)
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("error = %v, want a deadline exceeded error", err)
+	}
+	if !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("error = %q, want it to say the request timed out", err)
+	}
+}
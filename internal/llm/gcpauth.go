@@ -0,0 +1,283 @@
+package llm
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	googleTokenURL       = "https://oauth2.googleapis.com/token"
+	googleMetadataURL    = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	googleCloudScope     = "https://www.googleapis.com/auth/cloud-platform"
+	tokenExpiryLeeway    = time.Minute
+	serviceAccountJWTTTL = time.Hour
+)
+
+// adcCredentials is the subset of a Google Application Default Credentials file we use
+type adcCredentials struct {
+	Type string `json:"type"`
+
+	// authorized_user credentials, as written by `gcloud auth application-default login`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+	// quota_project_id is used as the default project for authorized users
+	QuotaProjectID string `json:"quota_project_id"`
+
+	// service_account credentials
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+	ProjectID    string `json:"project_id"`
+}
+
+// googleTokenSource fetches and caches OAuth access tokens using Google Application Default Credentials
+type googleTokenSource struct {
+	httpClient *http.Client
+	creds      *adcCredentials
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// tokenResponse is the response of the OAuth token and metadata endpoints
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// newGoogleTokenSource loads Application Default Credentials. Credentials are read from
+// GOOGLE_APPLICATION_CREDENTIALS, then the gcloud well-known file. If neither exists the
+// GCE metadata server is used. Tokens are fetched with the default HTTP client, never the one
+// injected for API requests, so a recording transport can't write access tokens to fixtures.
+func newGoogleTokenSource() (*googleTokenSource, error) {
+	path, err := adcPath()
+	if err != nil {
+		return nil, err
+	}
+
+	ts := &googleTokenSource{httpClient: http.DefaultClient}
+	if path == "" {
+		// Fall back to the metadata server when running on GCP
+		return ts, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read Google credentials: %w", err)
+	}
+
+	var creds adcCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("could not parse Google credentials %s: %w", path, err)
+	}
+	if creds.Type != "authorized_user" && creds.Type != "service_account" {
+		return nil, fmt.Errorf("unsupported Google credentials type %q in %s", creds.Type, path)
+	}
+	ts.creds = &creds
+
+	return ts, nil
+}
+
+// adcPath returns the path of the Application Default Credentials file, or "" if there is none
+func adcPath() (string, error) {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		return path, nil
+	}
+
+	var configDir string
+	if runtime.GOOS == "windows" {
+		configDir = filepath.Join(os.Getenv("APPDATA"), "gcloud")
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine home directory: %w", err)
+		}
+		configDir = filepath.Join(home, ".config", "gcloud")
+	}
+
+	path := filepath.Join(configDir, "application_default_credentials.json")
+	if _, err := os.Stat(path); err != nil {
+		return "", nil
+	}
+	return path, nil
+}
+
+// ProjectID returns the project associated with the credentials, if any
+func (ts *googleTokenSource) ProjectID() string {
+	if ts.creds == nil {
+		return ""
+	}
+	if ts.creds.ProjectID != "" {
+		return ts.creds.ProjectID
+	}
+	return ts.creds.QuotaProjectID
+}
+
+// Token returns a valid access token, refreshing it when it is about to expire
+func (ts *googleTokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Now().Add(tokenExpiryLeeway).Before(ts.expires) {
+		return ts.token, nil
+	}
+
+	var resp *tokenResponse
+	var err error
+	switch {
+	case ts.creds == nil:
+		resp, err = ts.metadataToken(ctx)
+	case ts.creds.Type == "authorized_user":
+		resp, err = ts.exchange(ctx, googleTokenURL, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {ts.creds.ClientID},
+			"client_secret": {ts.creds.ClientSecret},
+			"refresh_token": {ts.creds.RefreshToken},
+		})
+	default:
+		resp, err = ts.serviceAccountToken(ctx)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not get Google access token: %w", err)
+	}
+
+	ts.token = resp.AccessToken
+	ts.expires = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	return ts.token, nil
+}
+
+// serviceAccountToken exchanges a self-signed JWT for an access token
+func (ts *googleTokenSource) serviceAccountToken(ctx context.Context) (*tokenResponse, error) {
+	tokenURI := ts.creds.TokenURI
+	if tokenURI == "" {
+		tokenURI = googleTokenURL
+	}
+
+	assertion, err := signJWT(ts.creds, tokenURI)
+	if err != nil {
+		return nil, err
+	}
+
+	return ts.exchange(ctx, tokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+}
+
+// exchange posts a token request to the OAuth endpoint
+func (ts *googleTokenSource) exchange(ctx context.Context, tokenURL string, form url.Values) (*tokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return ts.doTokenRequest(req)
+}
+
+// metadataToken fetches a token for the default service account from the GCE metadata server
+func (ts *googleTokenSource) metadataToken(ctx context.Context) (*tokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleMetadataURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := ts.doTokenRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("no Application Default Credentials found and metadata server unavailable (run 'gcloud auth application-default login'): %w", err)
+	}
+	return resp, nil
+}
+
+// doTokenRequest sends a token request and decodes the response
+func (ts *googleTokenSource) doTokenRequest(req *http.Request) (*tokenResponse, error) {
+	resp, err := ts.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("could not parse token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token response contained no access token")
+	}
+
+	return &token, nil
+}
+
+// signJWT creates an RS256 signed JWT assertion for a service account
+func signJWT(creds *adcCredentials, audience string) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("could not decode service account private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("could not parse service account private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account private key is not an RSA key")
+	}
+
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": creds.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iss":   creds.ClientEmail,
+		"scope": googleCloudScope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(serviceAccountJWTTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("could not sign JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
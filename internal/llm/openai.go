@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+)
+
+// openAIProvider talks to any provider exposing an OpenAI-compatible chat completions API
+type openAIProvider struct {
+	name       string
+	apiKey     string
+	baseURL    string
+	httpClient *http.Client
+}
+
+// openAIChatRequest is the request body of the chat completions endpoint
+type openAIChatRequest struct {
+	Model     string    `json:"model"`
+	Messages  []Message `json:"messages"`
+	MaxTokens int       `json:"max_tokens,omitempty"`
+}
+
+// openAIChatResponse is the subset of the chat completions response we use
+type openAIChatResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// openAIErrorResponse is the error body returned by OpenAI-compatible APIs
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+	Message string `json:"message"`
+}
+
+// newOpenAIProvider creates a provider for an OpenAI-compatible API
+func newOpenAIProvider(name string, settings config.ProviderConfig, httpClient *http.Client) *openAIProvider {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &openAIProvider{
+		name:       name,
+		apiKey:     settings.APIKey,
+		baseURL:    strings.TrimSuffix(settings.BaseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// Complete implements Provider
+func (p *openAIProvider) Complete(ctx context.Context, req *Request) (*Response, error) {
+	// The system prompt is sent as the first message
+	messages := append([]Message{{Role: "system", Content: req.System}}, req.Messages...)
+
+	body, err := json.Marshal(openAIChatRequest{
+		Model:     req.Model,
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	// Local servers such as Ollama don't need a key
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s response: %w", p.name, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &StatusError{Provider: p.name, StatusCode: resp.StatusCode, Message: errorMessage(respBody)}
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		return nil, fmt.Errorf("could not parse %s response: %w", p.name, err)
+	}
+	if len(chatResp.Choices) == 0 {
+		return nil, fmt.Errorf("%s response contained no choices", p.name)
+	}
+
+	return &Response{
+		Text:         chatResp.Choices[0].Message.Content,
+		InputTokens:  chatResp.Usage.PromptTokens,
+		OutputTokens: chatResp.Usage.CompletionTokens,
+	}, nil
+}
+
+// errorMessage extracts a readable message from an API error body
+func errorMessage(body []byte) string {
+	var errResp openAIErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil {
+		if errResp.Error.Message != "" {
+			return errResp.Error.Message
+		}
+		if errResp.Message != "" {
+			return errResp.Message
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -1,23 +1,41 @@
 package llm
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jonfk/tell/internal/config"
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/sysinfo"
 )
 
-// buildSystemPrompt builds the system prompt for the LLM
-func buildSystemPrompt(cfg *config.Config) string {
+// buildSystemPrompt builds the system prompt for the LLM. The compact variant drops
+// the formatting guidelines and examples to use fewer input tokens per request.
+// With a target host, the host is described instead of the local system.
+func buildSystemPrompt(cfg *config.Config, variant string, target *sysinfo.RemoteHost) string {
 	var sb strings.Builder
 
-	// Use raw string for the introduction
-	sb.WriteString(`You are TELL (Terminal English Language Liaison), an expert in Unix/Linux command line tools. 
-Your task is to convert natural language requests into shell commands.
+	sb.WriteString(persona(cfg))
+	if cfg.PowerShell {
+		sb.WriteString("Your task is to convert natural language requests into PowerShell commands.\n\n")
+	} else if cfg.Cmd {
+		sb.WriteString("Your task is to convert natural language requests into cmd.exe commands.\n\n")
+	} else {
+		sb.WriteString("Your task is to convert natural language requests into shell commands.\n\n")
+	}
 
-`)
+	// Describe the system so commands use the right package manager and flavor of flags
+	if target != nil {
+		sb.WriteString(buildTargetInfo(target))
+	} else if cfg.Context.System {
+		sb.WriteString(buildSystemInfo(localSystem(cfg)))
+	}
 
-	// Add preferred commands
-	if len(cfg.PreferredCommands) > 0 {
+	// Add preferred commands, and which tools are actually installed when detection is enabled
+	if cfg.Context.Tools || target != nil {
+		sb.WriteString(buildToolsInfo(cfg, target))
+	} else if len(cfg.PreferredCommands) > 0 {
 		sb.WriteString("Preferred commands: ")
 		sb.WriteString(strings.Join(cfg.PreferredCommands, ", "))
 		sb.WriteString("\n\n")
@@ -34,14 +52,54 @@ Your task is to convert natural language requests into shell commands.
 		sb.WriteString("\n")
 	}
 
+	// Keep to POSIX sh, or BusyBox applets, when the commands must run on minimal systems
+	if cfg.Posix {
+		sb.WriteString(posixInstructions)
+	}
+	if cfg.BusyBox {
+		sb.WriteString(busyboxInstructions)
+	}
+	if cfg.PowerShell {
+		sb.WriteString(powershellInstructions)
+	}
+	if cfg.Cmd {
+		sb.WriteString(cmdInstructions)
+	}
+
+	if variant == config.PromptStyleCompact {
+		if cfg.PowerShell {
+			sb.WriteString("Break long pipelines after a pipe, quote properly, and prefer cmdlets.\n")
+		} else if cfg.Cmd {
+			sb.WriteString("Keep commands on one line joined with &&, and quote paths with double quotes.\n")
+		} else {
+			sb.WriteString("Use backslash line continuations for long commands, quote properly, and prefer modern commands.\n")
+		}
+		sb.WriteString(compactSafetyGuidelines[cfg.Safety()])
+		sb.WriteString(`Write a named placeholder such as {{filename}} for a value only the user knows instead of guessing it.
+
+Return ONLY this JSON object, with no markdown or other text:
+{"command": "<the command>", "show_details": <true if the command is non-obvious>, "details": "<2-5 line explanation>", "estimated_impact": "<empty, or one sentence if the command is slow or resource heavy>"}
+`)
+		return sb.String()
+	}
+
 	// Use raw string for command formatting guidelines
-	sb.WriteString(`Command formatting guidelines:
-- Use backslashes (\) to break long commands into multiple lines for readability
-- Include proper quoting for filenames and variables
-- Prefer safe commands that won't accidentally destroy data
+	sb.WriteString("Command formatting guidelines:\n")
+	if cfg.PowerShell {
+		sb.WriteString("- Break long pipelines into multiple lines after a pipe (|) for readability\n")
+	} else if cfg.Cmd {
+		sb.WriteString("- Keep commands on one line, joining steps with && so later steps only run after earlier ones succeed\n")
+	} else {
+		sb.WriteString("- Use backslashes (\\) to break long commands into multiple lines for readability\n")
+	}
+	sb.WriteString(`- Include proper quoting for filenames and variables
 - Use modern alternatives to legacy commands when appropriate
-
+- When the request leaves out a value only the user knows (a file name, host, port, user name), write a
+  named placeholder such as {{filename}} or {{port}} instead of guessing; the user is asked for each value.
+  Quote placeholders like the values they stand for
 `)
+	sb.WriteString(safetyGuidelines[cfg.Safety()])
+	sb.WriteString("\n")
 
 	// Output Format
 	sb.WriteString(`IMPORTANT: Return ONLY valid JSON with the following structure:
@@ -49,27 +107,766 @@ Your task is to convert natural language requests into shell commands.
 {
   "command": "The exact command to run, with proper formatting for multi-line commands if needed",
   "show_details": true,
-  "details": "A more detailed explanation (2-5 lines) of how the command works, what each part does, and any important notes, pitfalls, subtleties"
+  "details": "A more detailed explanation (2-5 lines) of how the command works, what each part does, and any important notes, pitfalls, subtleties",
+  "estimated_impact": "Empty string, unless the command is expected to be slow or resource heavy (e.g. scanning a whole disk, archiving large trees, recursive permission changes). Then one short sentence describing the cost and how to reduce it (e.g. nice/ionice, narrowing the path)"
 }
 
-Examples:
+`)
+	sb.WriteString(commandExamples(cfg))
+	sb.WriteString(`Your response must contain ONLY the JSON object with no additional text, markdown, or commentary before or after it. Ensure all quotes are properly escaped and the JSON is valid and parseable.
+`)
+
+	return sb.String()
+}
+
+// persona introduces TELL as an expert in the shell commands are written for
+func persona(cfg *config.Config) string {
+	switch {
+	case cfg.PowerShell:
+		return "You are TELL (Terminal English Language Liaison), an expert in PowerShell.\n"
+	case cfg.Cmd:
+		return "You are TELL (Terminal English Language Liaison), an expert in the Windows command prompt.\n"
+	default:
+		return "You are TELL (Terminal English Language Liaison), an expert in Unix/Linux command line tools.\n"
+	}
+}
+
+// commandExamples returns the example responses for the shell commands are written for
+func commandExamples(cfg *config.Config) string {
+	switch {
+	case cfg.PowerShell:
+		return powershellExamples
+	case cfg.Cmd:
+		return cmdExamples
+	default:
+		return unixExamples
+	}
+}
+
+// unixExamples are example responses with Unix commands
+const unixExamples = `Examples:
 
 1. Simple command (listing files):
 {
   "command": "ls -la",
   "show_details": false,
-  "details": "Lists all files and directories in the current directory with detailed information."
+  "details": "Lists all files and directories in the current directory with detailed information.",
+  "estimated_impact": ""
 }
 
 2. Complex command (finding and processing files):
 {
-  "command": "find /path/to/search -type f -name \"*.log\" -mtime -7 | \\\n  xargs grep -l \"ERROR\" | \\\n  xargs wc -l | \\\n  sort -nr",
+  "command": "find {{directory}} -type f -name \"*.log\" -mtime -7 | \\\n  xargs grep -l \"ERROR\" | \\\n  xargs wc -l | \\\n  sort -nr",
   "show_details": true,
-  "details": "This command searches for .log files modified in the last 7 days, then filters for files containing 'ERROR', counts the lines in each file, and sorts the results by line count in descending order. The -l flag with grep only shows filenames instead of matching lines. Using xargs is more efficient than command substitution for large file sets. Be careful with file paths containing spaces."
+  "details": "This command searches for .log files modified in the last 7 days, then filters for files containing 'ERROR', counts the lines in each file, and sorts the results by line count in descending order. The -l flag with grep only shows filenames instead of matching lines. Using xargs is more efficient than command substitution for large file sets. Be careful with file paths containing spaces.",
+  "estimated_impact": ""
+}
+
+3. Resource heavy command (searching the whole filesystem):
+{
+  "command": "find / -xdev -type f -size +1G 2>/dev/null",
+  "show_details": false,
+  "details": "Finds files larger than 1GB on the root filesystem without crossing into other mounts, hiding permission errors.",
+  "estimated_impact": "Scans the entire root filesystem, which can take minutes and cause heavy disk I/O; prefix with 'nice -n 19 ionice -c3' or narrow the starting path."
+}
+
+`
+
+// powershellExamples are example responses with PowerShell commands
+const powershellExamples = `Examples:
+
+1. Simple command (listing files):
+{
+  "command": "Get-ChildItem -Force",
+  "show_details": false,
+  "details": "Lists all files and directories in the current directory, including hidden ones.",
+  "estimated_impact": ""
+}
+
+2. Complex command (finding and processing files):
+{
+  "command": "Get-ChildItem -Path {{directory}} -Filter *.log -Recurse -File |\n  Where-Object LastWriteTime -gt (Get-Date).AddDays(-7) |\n  Select-String -Pattern 'ERROR' |\n  Group-Object Path |\n  Sort-Object Count -Descending",
+  "show_details": true,
+  "details": "This command finds .log files modified in the last 7 days, searches them for lines containing 'ERROR', groups the matches by file and sorts the files by number of matches, most first. Select-String reads the files passed down the pipeline as objects, so paths with spaces need no extra quoting.",
+  "estimated_impact": ""
+}
+
+3. Resource heavy command (searching a whole drive):
+{
+  "command": "Get-ChildItem -Path C:\\ -Recurse -File -ErrorAction SilentlyContinue |\n  Where-Object Length -gt 1GB",
+  "show_details": false,
+  "details": "Finds files larger than 1GB on drive C:, skipping folders it isn't allowed to read.",
+  "estimated_impact": "Scans the entire drive, which can take minutes and cause heavy disk I/O; narrow the starting path."
+}
+
+`
+
+// cmdExamples are example responses with cmd.exe commands
+const cmdExamples = `Examples:
+
+1. Simple command (listing files):
+{
+  "command": "dir /a",
+  "show_details": false,
+  "details": "Lists all files and directories in the current directory, including hidden and system files.",
+  "estimated_impact": ""
+}
+
+2. Complex command (finding files by content):
+{
+  "command": "findstr /s /m /c:\"ERROR\" \"{{directory}}\\*.log\"",
+  "show_details": true,
+  "details": "This command searches the .log files in the directory and its subdirectories for lines containing ERROR and prints the names of the files that match. /s searches subdirectories, /m prints only file names, and /c: searches for the text as a literal string.",
+  "estimated_impact": ""
+}
+
+3. Resource heavy command (searching a whole drive):
+{
+  "command": "dir C:\\*.log /s /b",
+  "show_details": false,
+  "details": "Lists every .log file on drive C: and in its subdirectories, one full path per line.",
+  "estimated_impact": "Walks the entire drive, which can take minutes and cause heavy disk I/O; narrow the starting directory."
+}
+
+`
+
+// posixInstructions restrict commands to what any POSIX sh and POSIX utilities support
+const posixInstructions = `POSIX compatibility (required):
+- Write commands for a strictly POSIX sh such as dash or BusyBox ash: no bashisms like [[ ]], arrays,
+  brace expansion {a,b}, $'...' strings, <(...) process substitution, &>, ==, function keyword, let or source
+- Use only options the POSIX standard defines for each utility: no GNU-only flags (grep -P, sed -i, find
+  -printf, xargs -r, cp --parents, date -d, readlink -f, long --options) and no tools outside POSIX when a
+  POSIX utility can do the job
+- Use printf rather than echo -e or echo -n, and $(...) with POSIX parameter expansions
+
+`
+
+// powershellInstructions ask for PowerShell cmdlets instead of Unix tools
+const powershellInstructions = `PowerShell (required):
+- Commands run in PowerShell 7 (pwsh): write PowerShell, not POSIX shell syntax. Use $env:NAME for environment
+  variables, ; or -and/-or instead of && in conditions, and $null instead of /dev/null
+- Use cmdlets and their object pipeline (Get-ChildItem, Select-String, Where-Object, Sort-Object, Measure-Object,
+  Get-Process, Invoke-WebRequest, ...) instead of Unix tools; use native programs only for what has no cmdlet
+- Write full cmdlet and parameter names, not aliases like ls, gci, % or ?, since aliases differ between systems
+- Quote with single quotes unless a string expands variables; the escape character is the backtick, not the backslash
+
+`
+
+// cmdInstructions ask for cmd.exe syntax and the programs that ship with Windows
+const cmdInstructions = `Windows command prompt (required):
+- Commands run in cmd.exe, not PowerShell or a POSIX shell: use %NAME% for environment variables, NUL instead of
+  /dev/null, double quotes around paths, and backslashes in paths
+- Use cmd built-ins (dir, copy, move, del, mkdir, rmdir, type, set, where, for) and programs that ship with Windows
+  (findstr, robocopy, xcopy, tasklist, taskkill, ipconfig, netstat, curl, tar), with their /option syntax
+- For what cmd can't do, call PowerShell with powershell -NoProfile -Command "..." rather than Unix tools
+- In for loops typed at the prompt write %i, not the %%i of batch files
+
+`
+
+// powershellScriptGuidelines replace the script guidelines for PowerShell scripts
+const powershellScriptGuidelines = `- Start with #!/usr/bin/env pwsh, then comment-based help saying what the script does and how to call it
+  (.SYNOPSIS, .PARAMETER, .EXAMPLE), and comment each step
+- Take arguments with a param() block of typed parameters, marking required ones Mandatory, with sensible
+  defaults where possible, then set $ErrorActionPreference = 'Stop'
+- Check that required commands are installed with Get-Command before using them
+- Report errors with Write-Error or throw, and clean up temporary files in a finally block
+- Prefer cmdlets that ship with PowerShell over external programs
+
+`
+
+// busyboxInstructions restrict commands to BusyBox applets and the options they implement
+const busyboxInstructions = `BusyBox compatibility (required):
+- Commands run in BusyBox ash on a minimal system such as an embedded device or an Alpine container: use POSIX
+  sh syntax, without bash arrays, <(...) process substitution or $'...' strings
+- Only use BusyBox applets (ls, find, grep, sed, awk, tar, wget, ps, ...) with the options BusyBox implements:
+  no GNU-only flags such as grep -P, find -printf, sort -V, ls --time-style or du --max-depth (use du -d), and
+  short options rather than long --options
+- Don't rely on tools a minimal system lacks (bash, curl, jq, rg, fd, python, systemctl, sudo): prefer wget,
+  awk and sed, and check with command -v before using anything else
+
+`
+
+// safetyGuidelines are the command formatting guidelines for each safety level
+var safetyGuidelines = map[string]string{
+	config.SafetyStrict: `- Be conservative: never delete, overwrite or change data the request doesn't clearly ask to change
+- Prefer forms that can be previewed or undone: dry runs (--dry-run, -n), interactive flags (rm -i, mv -i,
+  cp -i), moving files to a trash directory over deleting them, backups (sed -i.bak)
+- Limit recursive and wildcard operations to the paths requested, and only use sudo when root is needed
+`,
+	config.SafetyNormal: "- Prefer safe commands that won't accidentally destroy data\n",
+	config.SafetyOff:    "",
+}
+
+// compactSafetyGuidelines are the safety guidelines of the compact system prompt for each safety level
+var compactSafetyGuidelines = map[string]string{
+	config.SafetyStrict: "Be conservative: never delete or overwrite data the request doesn't ask to change, and prefer dry runs, interactive flags and backups.\n",
+	config.SafetyNormal: "Prefer safe commands that won't accidentally destroy data.\n",
+	config.SafetyOff:    "",
 }
 
-Your response must contain ONLY the JSON object with no additional text, markdown, or commentary before or after it. Ensure all quotes are properly escaped and the JSON is valid and parseable.
+// undoInstructions are added to the system prompt to get an undo command with each command
+const undoInstructions = `
+Also add an "undo" field to the JSON object: a command that reverses the changes the command makes, e.g. restoring
+what it overwrites or deletes, deleting what it creates, or reverting what it changes. Use an empty string when the
+command changes nothing. When the changes can't be undone (deleted files without a backup, sent requests), use an
+empty string and say so in the details.
+`
+
+// buildAskSystemPrompt builds the system prompt for general questions answered in plain text.
+// With a target host, questions are answered for the host instead of the local system.
+func buildAskSystemPrompt(cfg *config.Config, target *sysinfo.RemoteHost) string {
+	var sb strings.Builder
+
+	sb.WriteString(persona(cfg))
+	sb.WriteString(`Your task is to answer conceptual questions about shells, commands and the terminal environment.
+
+Answer guidelines:
+- Be concise: a short paragraph or a few bullet points, suitable for reading in a terminal
+- Answer in plain text, without markdown headings, tables or bold text
+- Include a short example command when it helps understanding, indented by two spaces
+- If the question is really a request for a command, answer it briefly and mention that 'tell prompt' can generate it
+
 `)
 
+	if target != nil {
+		sb.WriteString(buildTargetInfo(target))
+	} else if cfg.Context.System {
+		sb.WriteString(buildSystemInfo(localSystem(cfg)))
+	}
+
+	// Add extra instructions
+	if len(cfg.ExtraInstructions) > 0 {
+		sb.WriteString("Additional guidelines:\n")
+		for _, instruction := range cfg.ExtraInstructions {
+			sb.WriteString("- ")
+			sb.WriteString(instruction)
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String()
+}
+
+// buildExplainSystemPrompt builds the system prompt for explaining an existing command
+func buildExplainSystemPrompt(cfg *config.Config) string {
+	var sb strings.Builder
+
+	sb.WriteString(persona(cfg))
+	sb.WriteString(`Your task is to explain existing shell commands, such as ones found online, piece by piece.
+
+Explanation guidelines:
+- Split the command into meaningful parts in order: programs, subcommands, flags with their values, arguments,
+  pipes, redirections, substitutions and control operators. Group a flag with its value
+- Explain each part in one short sentence, saying what it does in this command rather than in general
+- List caveats: destructive effects, commands that need root, behaviour that differs between GNU and BSD tools,
+  and anything surprising. Leave caveats empty if there are none
+- Never run or rewrite the command
+
+`)
+
+	if cfg.Context.System {
+		sb.WriteString(buildSystemInfo(localSystem(cfg)))
+	}
+
+	sb.WriteString(`IMPORTANT: Return ONLY valid JSON with the following structure, with no markdown or other text:
+
+{
+  "summary": "One or two sentences saying what the whole command does",
+  "parts": [
+    {"part": "find /var/log", "explanation": "Searches the /var/log directory recursively"},
+    {"part": "-name '*.gz'", "explanation": "Matches only gzip-compressed files"}
+  ],
+  "caveats": ["Anything worth knowing before running it"]
+}
+`)
+
+	return sb.String()
+}
+
+// buildAnalyzeSystemPrompt builds the system prompt for listing the side effects of a command
+// before it is run. With a target host, the command is analyzed as run on the host.
+func buildAnalyzeSystemPrompt(cfg *config.Config, target *sysinfo.RemoteHost) string {
+	var sb strings.Builder
+
+	sb.WriteString(persona(cfg))
+	sb.WriteString(`Your task is to list the side effects of a shell command before the user runs it, like a dry run.
+
+Analysis guidelines:
+- List the files and directories the command creates or modifies, and those it deletes, as paths or glob patterns.
+  Include files changed indirectly, e.g. by a package manager or an in-place edit
+- List network activity: hosts contacted, data uploaded or downloaded, ports opened
+- List the privileges needed: root, sudo, group membership, access to other users' files
+- Leave a list empty when the command has no such effect, and never guess beyond what the command shows
+- Rate the risk: "low" for read-only or easily undone commands, "medium" for changes that are tedious to undo,
+  "high" for data loss, system-wide changes or anything irreversible
+- Never run or rewrite the command
+
+`)
+
+	if target != nil {
+		sb.WriteString(buildTargetInfo(target))
+	} else if cfg.Context.System {
+		sb.WriteString(buildSystemInfo(localSystem(cfg)))
+	}
+
+	sb.WriteString(`IMPORTANT: Return ONLY valid JSON with the following structure, with no markdown or other text:
+
+{
+  "risk": "high",
+  "summary": "One sentence saying what running the command changes",
+  "writes": ["./archive.tar.gz"],
+  "deletes": ["./logs/*.log older than 7 days"],
+  "network": [],
+  "privileges": []
+}
+`)
+
+	return sb.String()
+}
+
+// buildScriptSystemPrompt builds the system prompt for writing a complete shell script instead
+// of a one-liner. With a target host, the script is written to run on the host.
+func buildScriptSystemPrompt(cfg *config.Config, target *sysinfo.RemoteHost) string {
+	var sb strings.Builder
+
+	sb.WriteString(persona(cfg))
+	sb.WriteString(`Your task is to write complete, reusable shell scripts from natural language descriptions.
+
+Script guidelines:
+`)
+	if cfg.PowerShell {
+		sb.WriteString(powershellScriptGuidelines)
+	} else {
+		if cfg.BusyBox {
+			sb.WriteString("- Start with the shebang line #!/bin/sh, then set -eu; the script must run in BusyBox ash\n")
+		} else if cfg.Posix {
+			sb.WriteString("- Start with the shebang line #!/bin/sh, then set -eu; the script must run in any POSIX sh\n")
+		} else {
+			sb.WriteString("- Start with a shebang line, #!/usr/bin/env bash unless the user asks for another shell, then set -euo pipefail\n")
+		}
+		sb.WriteString(`- Start with a comment saying what the script does and how to call it, and comment each step
+- Parse arguments and options with getopts or a case loop, print a usage message for -h and for missing arguments,
+  and exit with a non-zero status on errors
+- Take paths, hosts and other values that change between runs as arguments, with sensible defaults where possible
+- Quote every variable expansion, and check that the required commands are installed before using them
+- Write errors to stderr, and clean up temporary files with a trap on EXIT
+- Prefer standard, commonly available tools over less common ones
+
+`)
+	}
+
+	if target != nil {
+		sb.WriteString(buildTargetInfo(target))
+	} else if cfg.Context.System {
+		sb.WriteString(buildSystemInfo(localSystem(cfg)))
+	}
+	sb.WriteString(buildToolsInfo(cfg, target))
+
+	if cfg.Posix {
+		sb.WriteString(posixInstructions)
+	}
+	if cfg.BusyBox {
+		sb.WriteString(busyboxInstructions)
+	}
+	if cfg.PowerShell {
+		sb.WriteString(powershellInstructions)
+	}
+
+	// Add extra instructions
+	if len(cfg.ExtraInstructions) > 0 {
+		sb.WriteString("Additional guidelines:\n")
+		for _, instruction := range cfg.ExtraInstructions {
+			sb.WriteString("- ")
+			sb.WriteString(instruction)
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	script, usage := `#!/usr/bin/env bash\nset -euo pipefail\n...`, "backup.sh [-n] SOURCE DEST"
+	if cfg.PowerShell {
+		script, usage = `#!/usr/bin/env pwsh\n<#\n.SYNOPSIS\n...`, "backup.ps1 -Source SOURCE -Destination DEST [-WhatIf]"
+	}
+	fmt.Fprintf(&sb, `IMPORTANT: Return ONLY valid JSON with the following structure, with no markdown or other text:
+
+{
+  "script": "%s",
+  "description": "One sentence saying what the script does",
+  "usage": "%s"
+}
+`, script, usage)
+
+	return sb.String()
+}
+
+// buildSummarizeSystemPrompt builds the system prompt for summarizing piped command output
+func buildSummarizeSystemPrompt(cfg *config.Config) string {
+	var sb strings.Builder
+
+	sb.WriteString(persona(cfg))
+	sb.WriteString(`Your task is to summarize the output of shell commands (logs, diffs, process lists, test output, ...) piped to you.
+
+Summary guidelines:
+- Start with what the output is and a 1-3 sentence overview of what it shows
+- Then list notable anomalies under "Notable:" as short bullet points: errors, warnings, failures, unusual values,
+  spikes, repeated messages (with counts) and anything that looks wrong. Write "Notable: nothing unusual" if there are none
+- Quote identifiers (file names, process names, error codes, timestamps) exactly as they appear
+- Be concise and answer in plain text suitable for a terminal, without markdown headings, tables or bold text
+
+`)
+
+	if cfg.Context.System {
+		sb.WriteString(buildSystemInfo(localSystem(cfg)))
+	}
+
+	return sb.String()
+}
+
+// buildSummarizeMessage builds the user message with one part of the input to summarize.
+// skipped is the number of bytes left out of the input, mentioned when there is a single part.
+func buildSummarizeMessage(chunk string, focus string, part int, parts int, skipped int) string {
+	var sb strings.Builder
+
+	if parts > 1 {
+		fmt.Fprintf(&sb, "Summarize part %d of %d of the output below. The part summaries will be combined later, so keep every notable detail.\n", part, parts)
+	} else {
+		sb.WriteString("Summarize the output below.\n")
+		if skipped > 0 {
+			fmt.Fprintf(&sb, "The output was too large: the first %d bytes were left out.\n", skipped)
+		}
+	}
+	if focus != "" {
+		fmt.Fprintf(&sb, "The user is especially interested in: %s\n", focus)
+	}
+
+	sb.WriteString("\nOutput:\n")
+	sb.WriteString(chunk)
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// buildCombineSummariesMessage builds the user message asking to merge the summaries of each part into one
+func buildCombineSummariesMessage(summaries []string, focus string, skipped int) string {
+	var sb strings.Builder
+
+	sb.WriteString("The output was too large for a single request, so it was split into parts and each part was summarized.\n")
+	sb.WriteString("Combine the part summaries below into a single summary of the whole output, following the summary guidelines.\n")
+	sb.WriteString("Merge repeated anomalies and add up their counts.\n")
+	if skipped > 0 {
+		fmt.Fprintf(&sb, "%d bytes from the middle of the output were left out and not summarized; mention this.\n", skipped)
+	}
+	if focus != "" {
+		fmt.Fprintf(&sb, "The user is especially interested in: %s\n", focus)
+	}
+
+	for i, summary := range summaries {
+		fmt.Fprintf(&sb, "\n--- part %d ---\n%s\n", i+1, summary)
+	}
+
+	return sb.String()
+}
+
+// buildToolsInfo lists the preferred commands and extended tools found on PATH, and those
+// that are missing so the model doesn't suggest them. With a target host, the tools found
+// on the host are listed.
+func buildToolsInfo(cfg *config.Config, target *sysinfo.RemoteHost) string {
+	var sb strings.Builder
+
+	// Nothing is known about the tools of a machine given only by its operating system
+	if target != nil && target.Name == "" {
+		if len(cfg.PreferredCommands) > 0 {
+			fmt.Fprintf(&sb, "Preferred commands, if installed: %s\n\n", strings.Join(cfg.PreferredCommands, ", "))
+		}
+		return sb.String()
+	}
+
+	var installed, missing []string
+	if target != nil {
+		installed, missing = target.Installed, target.Missing
+	} else {
+		installed, missing = sysinfo.DetectTools(cfg.ToolNames(), cfg.Context.ToolsCacheTTL)
+	}
+
+	preferred := make(map[string]bool)
+	for _, name := range cfg.PreferredCommands {
+		preferred[name] = true
+	}
+
+	var installedPreferred, installedOther []string
+	for _, name := range installed {
+		if preferred[name] {
+			installedPreferred = append(installedPreferred, name)
+		} else {
+			installedOther = append(installedOther, name)
+		}
+	}
+
+	if len(installedPreferred) > 0 {
+		fmt.Fprintf(&sb, "Preferred commands: %s\n", strings.Join(installedPreferred, ", "))
+	}
+	if len(installedOther) > 0 {
+		fmt.Fprintf(&sb, "Other installed tools: %s\n", strings.Join(installedOther, ", "))
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(&sb, "Not installed, never use them: %s\n", strings.Join(missing, ", "))
+	}
+	if sb.Len() > 0 {
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// buildSystemInfo describes the user's operating system for the system prompt
+func buildSystemInfo(info sysinfo.OSInfo) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "The user's system: %s.\n", info)
+	if len(info.DistroLike) > 0 {
+		fmt.Fprintf(&sb, "The distribution is based on %s.\n", strings.Join(info.DistroLike, ", "))
+	}
+	sb.WriteString("Only suggest commands, flags and package managers that are available on this system.\n")
+	sb.WriteString(buildCoreutilsInfo(info))
+	sb.WriteString(buildPackageManagerInfo(info))
+	if info.Container != nil {
+		sb.WriteString(buildContainerInfo(info.Container))
+	}
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// localSystem describes the local system, with the coreutils flavor and package manager from
+// the configuration, or detected when they are auto
+func localSystem(cfg *config.Config) sysinfo.OSInfo {
+	info := sysinfo.DetectOS()
+	info.Coreutils = coreutilsFlavor(cfg, nil)
+	if info.Coreutils == sysinfo.CoreutilsBSD {
+		info.GNUPrefixed = sysinfo.DetectGNUPrefixed()
+	}
+	info.PackageManager = cfg.Context.PackageManager
+	if info.PackageManager == "auto" || info.PackageManager == "" {
+		info.PackageManager = sysinfo.DetectPackageManager(info)
+	}
+	return info
+}
+
+// coreutilsFlavor returns the coreutils flavor commands are generated for: BusyBox in BusyBox
+// mode, the target host's, or the configured one, or the one detected locally. Empty when unknown.
+func coreutilsFlavor(cfg *config.Config, target *sysinfo.RemoteHost) string {
+	if cfg.BusyBox {
+		return sysinfo.CoreutilsBusyBox
+	}
+	if target != nil {
+		return target.OS.Coreutils
+	}
+	switch cfg.Context.Coreutils {
+	case sysinfo.CoreutilsGNU, sysinfo.CoreutilsBSD, sysinfo.CoreutilsBusyBox:
+		return cfg.Context.Coreutils
+	default:
+		return sysinfo.DetectCoreutils(cfg.Context.ProbeTimeout)
+	}
+}
+
+// buildCoreutilsInfo tells the model which flavor of sed, date, stat and friends to write
+// flags for, since GNU and BSD flags differ in ways that break commands silently
+func buildCoreutilsInfo(info sysinfo.OSInfo) string {
+	switch info.Coreutils {
+	case sysinfo.CoreutilsGNU:
+		return "Core utilities are GNU (coreutils, GNU sed, grep and findutils): use GNU flags, e.g. sed -i, date -d and stat -c.\n"
+	case sysinfo.CoreutilsBSD:
+		var sb strings.Builder
+		sb.WriteString(`Core utilities are BSD flavored, as on macOS: use BSD flags, e.g. sed -i '' for in-place edits, date -v or
+date -j -f instead of date -d, stat -f instead of stat -c, du -d instead of du --max-depth, and avoid GNU-only
+options such as grep -P, find -printf and long --options of coreutils.
+`)
+		if len(info.GNUPrefixed) > 0 {
+			fmt.Fprintf(&sb, "GNU versions are also installed as %s; only use them when a GNU-only feature is needed.\n",
+				strings.Join(info.GNUPrefixed, ", "))
+		}
+		return sb.String()
+	case sysinfo.CoreutilsBusyBox:
+		return "Core utilities are BusyBox applets: use only the options BusyBox implements, e.g. du -d, and no GNU-only ones such as grep -P or find -printf.\n"
+	default:
+		return ""
+	}
+}
+
+// buildPackageManagerInfo tells the model which package manager installs software, so install
+// commands don't default to apt
+func buildPackageManagerInfo(info sysinfo.OSInfo) string {
+	switch info.PackageManager {
+	case "":
+		return ""
+	case "brew", "scoop", "nix-env":
+		// These install for the user and refuse to run as root
+		return fmt.Sprintf("Install software with %s, without sudo, and use the package names it knows.\n", info.PackageManager)
+	default:
+		return fmt.Sprintf("Install software with %s, never another package manager, and use the package names it knows.\n", info.PackageManager)
+	}
+}
+
+// buildContainerInfo tells the model that commands run inside a container, where images
+// are usually minimal, so suggestions work there
+func buildContainerInfo(container *sysinfo.ContainerInfo) string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "The user is inside a %s container. Images are usually minimal: prefer basic tools and flags,\n", container.Runtime)
+	sb.WriteString("and when a tool is likely missing, say how to install it with the distribution's package manager.\n")
+	if !container.Systemd {
+		sb.WriteString("systemd is not running: never use systemctl or journalctl; run or signal services directly and read logs from files or stdout.\n")
+	}
+	if container.Root && !container.Sudo {
+		sb.WriteString("The user is root and sudo is not installed: never prefix commands with sudo.\n")
+	} else if !container.Sudo {
+		sb.WriteString("sudo is not installed: never prefix commands with sudo.\n")
+	} else if container.Root {
+		sb.WriteString("The user is root: sudo is not needed.\n")
+	}
+
+	return sb.String()
+}
+
+// buildTargetInfo describes the remote host that commands will run on for the system prompt
+func buildTargetInfo(target *sysinfo.RemoteHost) string {
+	var sb strings.Builder
+
+	if target.Name == "" {
+		fmt.Fprintf(&sb, "Commands will be run on another machine, not on the user's machine.\n")
+	} else {
+		fmt.Fprintf(&sb, "Commands will be run on the remote host %s over SSH, not on the user's machine.\n", target.Name)
+	}
+	fmt.Fprintf(&sb, "The host's system: %s.\n", target.OS)
+	if len(target.OS.DistroLike) > 0 {
+		fmt.Fprintf(&sb, "The distribution is based on %s.\n", strings.Join(target.OS.DistroLike, ", "))
+	}
+	sb.WriteString("Only suggest commands, flags and package managers that are available on that host.\n")
+	sb.WriteString(buildCoreutilsInfo(target.OS))
+	sb.WriteString(buildPackageManagerInfo(target.OS))
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// buildCompletionPrompt builds the user message asking the LLM to finish or fix a command line
+func buildCompletionPrompt(commandLine string) string {
+	var sb strings.Builder
+
+	sb.WriteString(`The following is a partially typed or broken shell command line. Complete or correct it.
+Keep the user's intent, the tools they chose, and any arguments they already typed wherever possible.
+Do not replace it with an unrelated command. If the command line is already correct, return it unchanged.
+
+Command line:
+`)
+	sb.WriteString(commandLine)
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// buildFixPrompt builds the user message asking the LLM to correct a command that failed
+func buildFixPrompt(failed model.FailedCommand) string {
+	var sb strings.Builder
+
+	sb.WriteString(`The following shell command did not work. Return a corrected command that does what it was meant to do.
+Keep the user's intent and the tools they chose where possible, and fix only what caused the failure.
+Explain in the details what was wrong.
+
+Command:
+`)
+	sb.WriteString(failed.Command)
+	sb.WriteString("\n")
+
+	if failed.ExitCode >= 0 {
+		fmt.Fprintf(&sb, "\nExit code: %d\n", failed.ExitCode)
+	}
+	if failed.Stderr != "" {
+		sb.WriteString("\nError output:\n")
+		sb.WriteString(failed.Stderr)
+		sb.WriteString("\n")
+	}
+	if failed.Note != "" {
+		sb.WriteString("\nWhat went wrong according to the user: ")
+		sb.WriteString(failed.Note)
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// buildExecutionNote tells the model how running a previous command went, so a continuation
+// builds on its result. Returns "" when the command wasn't run.
+func buildExecutionNote(entry *model.HistoryEntry) string {
+	if !entry.ExitCode.Valid {
+		return ""
+	}
+
+	var sb strings.Builder
+	subject := "I ran that command and it"
+	if entry.RanCommand != "" {
+		fmt.Fprintf(&sb, "I edited that command before running it:\n%s\n", entry.RanCommand)
+		subject = "It"
+	}
+	if entry.TimedOut {
+		fmt.Fprintf(&sb, "%s hung, so it was stopped after %s (exit code %d).\n",
+			subject, time.Duration(entry.DurationMS.Int64)*time.Millisecond, entry.ExitCode.Int64)
+	} else {
+		fmt.Fprintf(&sb, "%s exited with code %d.\n", subject, entry.ExitCode.Int64)
+	}
+	if entry.Output.Valid {
+		sb.WriteString("The end of its output:\n")
+		sb.WriteString(strings.TrimRight(entry.Output.String, "\n"))
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+
+	return sb.String()
+}
+
+// buildRepairPrompt builds the follow-up message asking the LLM to re-emit a malformed response as valid JSON
+func buildRepairPrompt(parseErr error) string {
+	return fmt.Sprintf(`Your previous response could not be parsed: %v
+
+Re-emit your answer as ONLY the valid JSON object described in the instructions, with no markdown, backticks, or commentary. Ensure all quotes and backslashes inside strings are properly escaped.`, parseErr)
+}
+
+// buildSyntaxPrompt builds the follow-up message asking the LLM to correct a command the shell's
+// parser rejected
+func buildSyntaxPrompt(syntaxErr error) string {
+	return fmt.Sprintf(`The command does not parse: %v
+
+Return the corrected command as the same JSON object. Check that every quote, bracket, here-document and control
+structure is closed, and that multi-line commands are joined correctly.`, syntaxErr)
+}
+
+// buildFeedbackPrompt builds the follow-up message asking for a new command after the user
+// rejected the previous one
+func buildFeedbackPrompt(feedback string) string {
+	var sb strings.Builder
+
+	sb.WriteString("That command is not what I want.")
+	if feedback != "" {
+		sb.WriteString(" ")
+		sb.WriteString(feedback)
+	}
+	sb.WriteString("\nReturn a corrected command as the same JSON object. Keep what was right and change only what I asked for.")
+
+	return sb.String()
+}
+
+// buildUserMessage appends any gathered environment context to the user's prompt
+func buildUserMessage(prompt string, contextItems []model.ContextItem) string {
+	if len(contextItems) == 0 {
+		return prompt
+	}
+
+	var sb strings.Builder
+	sb.WriteString(prompt)
+	sb.WriteString("\n\nContext about the user's environment (use it to make the command concrete, do not repeat it back):\n")
+	for _, item := range contextItems {
+		fmt.Fprintf(&sb, "\n--- %s ---\n%s\n", item.Name, item.Content)
+	}
+
 	return sb.String()
 }
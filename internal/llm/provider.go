@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/jonfk/tell/internal/config"
+)
+
+// Message roles
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is a single turn of the conversation sent to a provider
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a provider-agnostic completion request
+type Request struct {
+	Model     string
+	System    string
+	Messages  []Message
+	MaxTokens int
+	// OnProgress, if set, is called with the estimated output token count while the
+	// response streams in. Providers that can't stream may never call it.
+	OnProgress func(outputTokens int)
+}
+
+// Response is the raw text and token usage returned by a provider
+type Response struct {
+	Text         string
+	InputTokens  int
+	OutputTokens int
+}
+
+// Provider sends a conversation to an LLM backend
+type Provider interface {
+	Complete(ctx context.Context, req *Request) (*Response, error)
+}
+
+// newProvider creates the provider with the given name from its resolved settings
+func newProvider(name string, settings config.ProviderConfig, httpClient *http.Client) (Provider, error) {
+	switch name {
+	case config.ProviderAnthropic:
+		return newAnthropicProvider(settings, httpClient), nil
+	case config.ProviderVertex:
+		return newVertexProvider(settings, httpClient)
+	case config.ProviderOpenAI, config.ProviderOllama, config.ProviderMistral, config.ProviderGroq,
+		config.ProviderDeepSeek, config.ProviderXAI:
+		return newOpenAIProvider(name, settings, httpClient), nil
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", name)
+	}
+}
+
+// userMessage creates a user turn
+func userMessage(content string) Message {
+	return Message{Role: RoleUser, Content: content}
+}
+
+// assistantMessage creates an assistant turn
+func assistantMessage(content string) Message {
+	return Message{Role: RoleAssistant, Content: content}
+}
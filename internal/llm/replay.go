@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// fixture is a recorded HTTP response stored on disk
+type fixture struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Body        string `json:"body"`
+}
+
+// recordTransport forwards requests to the wrapped transport and saves each response as a fixture
+type recordTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+// replayTransport serves responses from previously recorded fixtures without touching the network
+type replayTransport struct {
+	dir string
+}
+
+// NewRecordTransport returns a transport that performs real requests through next
+// and records every response into dir, keyed by the request contents.
+func NewRecordTransport(dir string, next http.RoundTripper) (http.RoundTripper, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create fixture directory: %w", err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recordTransport{dir: dir, next: next}, nil
+}
+
+// NewReplayTransport returns a transport that answers requests from fixtures
+// previously written to dir by a record transport.
+func NewReplayTransport(dir string) (http.RoundTripper, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("could not open fixture directory: %w", err)
+	}
+	return &replayTransport{dir: dir}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := fixtureKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	data, err := json.MarshalIndent(fixture{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal fixture: %w", err)
+	}
+
+	path := filepath.Join(t.dir, key+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("could not write fixture: %w", err)
+	}
+	slog.Debug("Recorded LLM response fixture", "path", path)
+
+	return resp, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := fixtureKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(t.dir, key+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no recorded fixture for request %s %s: %w", req.Method, req.URL, err)
+	}
+
+	var f fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("could not parse fixture %s: %w", path, err)
+	}
+	slog.Debug("Replaying LLM response fixture", "path", path)
+
+	header := make(http.Header)
+	if f.ContentType != "" {
+		header.Set("Content-Type", f.ContentType)
+	}
+
+	return &http.Response{
+		Status:        http.StatusText(f.StatusCode),
+		StatusCode:    f.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(f.Body))),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}, nil
+}
+
+// fixtureKey derives a stable fixture name from the request method, path and body.
+// The request body is restored so the request can still be sent.
+func fixtureKey(req *http.Request) (string, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", fmt.Errorf("could not read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	h := sha256.New()
+	io.WriteString(h, req.Method)
+	io.WriteString(h, req.URL.Path)
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
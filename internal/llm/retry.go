@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/jonfk/tell/internal/config"
+)
+
+// StatusError is returned by providers when the API responds with a non-2xx status
+type StatusError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+}
+
+// Error implements error
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s API error (%d): %s", e.Provider, e.StatusCode, e.Message)
+}
+
+// isRetryable reports whether a failed request may succeed if sent again:
+// rate limits, server errors, timeouts and dropped connections
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.StatusCode)
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.StatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// retryableStatus reports whether an HTTP status is worth retrying
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	default:
+		return status >= 500
+	}
+}
+
+// backoff returns how long to wait before the given retry (starting at 1): the initial
+// backoff doubled for each retry, capped at the maximum, with up to 25% jitter
+func backoff(policy config.RetryConfig, retry int) time.Duration {
+	delay := policy.InitialBackoff
+	for i := 1; i < retry && delay < policy.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+		delay = policy.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	jitter := time.Duration(rand.Int64N(int64(delay)/4 + 1))
+	return delay - jitter
+}
@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// GenerateScript writes a complete, commented shell script for a task too big for a one-liner,
+// with a shebang, strict mode and argument parsing
+func (c *Client) GenerateScript(prompt string) (*model.Script, *model.LLMUsage, error) {
+	responseText, usage, err := c.send(buildScriptSystemPrompt(c.config, c.target), []Message{
+		userMessage(buildUserMessage(prompt, c.contextItems)),
+	})
+	if err != nil {
+		return nil, usage, fmt.Errorf("error generating script: %w", err)
+	}
+
+	script, err := parseScript(responseText)
+	if err != nil {
+		return nil, usage, fmt.Errorf("error parsing script: %w", err)
+	}
+
+	return script, usage, nil
+}
+
+// parseScript parses and validates the JSON script returned by the model
+func parseScript(responseText string) (*model.Script, error) {
+	jsonStr, err := extractJSON(responseText)
+	if err != nil {
+		return nil, err
+	}
+
+	var script model.Script
+	if err := json.Unmarshal([]byte(jsonStr), &script); err != nil {
+		return nil, fmt.Errorf("error unmarshaling JSON: %w, response: %s", err, jsonStr)
+	}
+
+	script.Script = strings.TrimSpace(script.Script)
+	if script.Script == "" {
+		return nil, fmt.Errorf("script is empty in response: %s", jsonStr)
+	}
+	if !strings.HasPrefix(script.Script, "#!") {
+		return nil, fmt.Errorf("script has no shebang line in response: %s", jsonStr)
+	}
+
+	return &script, nil
+}
@@ -0,0 +1,110 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// Summarize summarizes command output piped to tell (logs, diffs, ps output, ...) and points out
+// anomalies. Input larger than a chunk is summarized part by part, then the part summaries are
+// combined. focus optionally tells the model what the user cares about.
+func (c *Client) Summarize(input string, focus string) (string, *model.LLMUsage, error) {
+	chunks, skipped := chunkInput(input, c.config.Summarize.ChunkSize, c.config.Summarize.MaxChunks)
+	if len(chunks) == 0 {
+		return "", nil, fmt.Errorf("nothing to summarize: input is empty")
+	}
+
+	systemPrompt := buildSummarizeSystemPrompt(c.config)
+	total := &model.LLMUsage{Model: c.model}
+
+	// Summarize each part on its own
+	var summaries []string
+	for i, chunk := range chunks {
+		summary, usage, err := c.send(systemPrompt, []Message{
+			userMessage(buildSummarizeMessage(chunk, focus, i+1, len(chunks), skipped)),
+		})
+		addUsage(total, usage)
+		if err != nil && len(chunks) == 1 {
+			return "", total, fmt.Errorf("error summarizing input: %w", err)
+		}
+		if err != nil {
+			return "", total, fmt.Errorf("error summarizing part %d of %d: %w", i+1, len(chunks), err)
+		}
+		summaries = append(summaries, strings.TrimSpace(summary))
+	}
+
+	if len(summaries) == 1 {
+		if summaries[0] == "" {
+			return "", total, fmt.Errorf("summary is empty in response")
+		}
+		return summaries[0], total, nil
+	}
+
+	// Combine the part summaries into one
+	summary, usage, err := c.send(systemPrompt, []Message{
+		userMessage(buildCombineSummariesMessage(summaries, focus, skipped)),
+	})
+	addUsage(total, usage)
+	if err != nil {
+		return "", total, fmt.Errorf("error combining summaries: %w", err)
+	}
+
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", total, fmt.Errorf("summary is empty in response")
+	}
+
+	return summary, total, nil
+}
+
+// chunkInput splits input into chunks of at most chunkSize bytes, breaking at line ends
+// where possible. When there are more than maxChunks chunks, chunks from the middle are
+// dropped, keeping the start and the end of the input, which usually matter most for logs.
+// skipped is the number of bytes dropped.
+func chunkInput(input string, chunkSize int, maxChunks int) (chunks []string, skipped int) {
+	if strings.TrimSpace(input) == "" {
+		return nil, 0
+	}
+	if chunkSize <= 0 {
+		chunkSize = len(input)
+	}
+
+	for len(input) > 0 {
+		if len(input) <= chunkSize {
+			chunks = append(chunks, input)
+			break
+		}
+
+		// Break after the last newline that fits, or mid-line for very long lines
+		end := strings.LastIndexByte(input[:chunkSize], '\n') + 1
+		if end == 0 {
+			end = chunkSize
+		}
+		chunks = append(chunks, input[:end])
+		input = input[end:]
+	}
+
+	if maxChunks <= 0 || len(chunks) <= maxChunks {
+		return chunks, 0
+	}
+
+	head := maxChunks / 2
+	tail := maxChunks - head
+	for _, chunk := range chunks[head : len(chunks)-tail] {
+		skipped += len(chunk)
+	}
+
+	return append(chunks[:head:head], chunks[len(chunks)-tail:]...), skipped
+}
+
+// addUsage adds the tokens and retries of a request to a running total
+func addUsage(total *model.LLMUsage, usage *model.LLMUsage) {
+	if usage == nil {
+		return
+	}
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.Retries += usage.Retries
+}
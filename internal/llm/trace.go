@@ -0,0 +1,71 @@
+package llm
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// apiKeyPattern matches strings that look like API keys so they never end up in trace files
+var apiKeyPattern = regexp.MustCompile(`sk-[A-Za-z0-9_\-]{8,}`)
+
+// tracer dumps the full request and raw response of each LLM call for debugging
+type tracer struct {
+	w       io.Writer
+	secrets []string
+}
+
+// WithTrace writes the system prompt, messages and raw model response of every
+// request to w. Configured API keys are redacted.
+func WithTrace(w io.Writer) Option {
+	return func(c *Client) {
+		c.tracer = &tracer{w: w}
+	}
+}
+
+// request writes the outgoing request to the trace
+func (t *tracer) request(req *Request) {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "=== request %s ===\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&sb, "model: %s\n\n", req.Model)
+	sb.WriteString("--- system ---\n")
+	sb.WriteString(req.System)
+	sb.WriteString("\n")
+
+	for i, message := range req.Messages {
+		fmt.Fprintf(&sb, "--- message %d (%s) ---\n%s\n", i, message.Role, message.Content)
+	}
+
+	t.write(sb.String())
+}
+
+// response writes the raw model response, or the error returned instead, to the trace
+func (t *tracer) response(responseText string, err error) {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "=== response %s ===\n", time.Now().Format(time.RFC3339))
+	if err != nil {
+		fmt.Fprintf(&sb, "error: %v\n", err)
+	} else {
+		sb.WriteString(responseText)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+
+	t.write(sb.String())
+}
+
+// write redacts secrets from the text and appends it to the trace
+func (t *tracer) write(text string) {
+	for _, secret := range t.secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "[REDACTED]")
+		}
+	}
+	text = apiKeyPattern.ReplaceAllString(text, "[REDACTED]")
+
+	io.WriteString(t.w, text)
+}
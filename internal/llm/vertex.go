@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/jonfk/tell/internal/config"
+)
+
+// vertexAnthropicVersion is the API version Vertex AI expects in the request body
+const vertexAnthropicVersion = "vertex-2023-10-16"
+
+// newVertexProvider creates a provider that sends Anthropic Messages API requests
+// through Google Vertex AI, authenticating with Application Default Credentials
+func newVertexProvider(settings config.ProviderConfig, httpClient *http.Client) (*anthropicProvider, error) {
+	if settings.Region == "" {
+		return nil, fmt.Errorf("vertex provider requires a region (set providers.vertex.region or CLOUD_ML_REGION)")
+	}
+
+	tokens, err := newGoogleTokenSource()
+	if err != nil {
+		return nil, err
+	}
+
+	projectID := settings.ProjectID
+	if projectID == "" {
+		projectID = tokens.ProjectID()
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("vertex provider requires a project (set providers.vertex.project_id or ANTHROPIC_VERTEX_PROJECT_ID)")
+	}
+
+	baseURL := settings.BaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1", settings.Region)
+		if settings.Region == "global" {
+			baseURL = "https://aiplatform.googleapis.com/v1"
+		}
+	}
+
+	return newAnthropicProvider(settings, httpClient,
+		option.WithBaseURL(baseURL),
+		option.WithMiddleware(vertexMiddleware(settings.Region, projectID, tokens)),
+	), nil
+}
+
+// vertexMiddleware rewrites Messages API requests into Vertex AI rawPredict calls and
+// replaces the Anthropic API key with a Google access token
+func vertexMiddleware(region, projectID string, tokens *googleTokenSource) option.Middleware {
+	return func(r *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		// Never send an Anthropic API key to Google
+		r.Header.Del("X-Api-Key")
+
+		token, err := tokens.Token(r.Context())
+		if err != nil {
+			return nil, err
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+
+		if r.Body != nil && r.URL.Path == "/v1/messages" && r.Method == http.MethodPost {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+			r.Body.Close()
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(body, &fields); err != nil {
+				return nil, fmt.Errorf("could not parse request body: %w", err)
+			}
+
+			// The model moves from the body into the URL
+			var model string
+			if err := json.Unmarshal(fields["model"], &model); err != nil {
+				return nil, fmt.Errorf("request has no model: %w", err)
+			}
+			var stream bool
+			if raw, ok := fields["stream"]; ok {
+				json.Unmarshal(raw, &stream)
+			}
+			delete(fields, "model")
+			if _, ok := fields["anthropic_version"]; !ok {
+				fields["anthropic_version"] = json.RawMessage(`"` + vertexAnthropicVersion + `"`)
+			}
+
+			body, err = json.Marshal(fields)
+			if err != nil {
+				return nil, fmt.Errorf("could not marshal request body: %w", err)
+			}
+
+			specifier := "rawPredict"
+			if stream {
+				specifier = "streamRawPredict"
+			}
+			r.URL.Path = fmt.Sprintf("/v1/projects/%s/locations/%s/publishers/anthropic/models/%s:%s", projectID, region, model, specifier)
+
+			reader := bytes.NewReader(body)
+			r.Body = io.NopCloser(reader)
+			r.GetBody = func() (io.ReadCloser, error) {
+				_, err := reader.Seek(0, 0)
+				return io.NopCloser(reader), err
+			}
+			r.ContentLength = int64(len(body))
+		}
+
+		return next(r)
+	}
+}
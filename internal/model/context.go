@@ -0,0 +1,7 @@
+package model
+
+// ContextItem is a piece of environment context sent alongside a prompt
+type ContextItem struct {
+	Name    string
+	Content string
+}
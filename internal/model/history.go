@@ -5,6 +5,22 @@ import (
 	"time"
 )
 
+// Entry types stored in the history
+const (
+	// EntryTypeCommand is a generated command
+	EntryTypeCommand = "command"
+	// EntryTypeAnswer is a plain text answer to a question from 'tell ask'
+	EntryTypeAnswer = "answer"
+	// EntryTypeSummary is a summary of piped input from 'tell summarize'
+	EntryTypeSummary = "summary"
+	// EntryTypeExplanation is an explanation of an existing command from 'tell explain'
+	EntryTypeExplanation = "explanation"
+	// EntryTypeAnalysis is a side effect analysis of a command from 'tell analyze' or --analyze
+	EntryTypeAnalysis = "analysis"
+	// EntryTypeScript is a complete shell script from 'tell script', kept in Command
+	EntryTypeScript = "script"
+)
+
 // HistoryEntry represents a single entry in the command history
 type HistoryEntry struct {
 	ID           int64
@@ -19,4 +35,153 @@ type HistoryEntry struct {
 	OutputTokens int
 	Favorite     bool
 	ParentID     sql.NullInt64
+	// EntryType is one of the EntryType constants. Answers keep their text in Details
+	EntryType string
+	// Route records how the model was picked: a routing tier, or "override" for --model. Empty for the configured model
+	Route string
+	// PromptVariant and ParseAttempts track how well each system prompt style is parsed
+	PromptVariant string
+	ParseAttempts int
+	// Retries is the number of times failed LLM requests were sent again
+	Retries int
+	// ExitCode and ExecutedAt are set once the command has been run
+	ExitCode   sql.NullInt64
+	ExecutedAt sql.NullTime
+	// DurationMS is how long the command ran in milliseconds, when known
+	DurationMS sql.NullInt64
+	// Output is the end of the command's output, when it was recorded
+	Output sql.NullString
+	// Undo is the command reversing this one, when it was requested
+	Undo string
+	// TimedOut is set when the command was stopped because it ran longer than the run timeout
+	TimedOut bool
+	// Outcome is what the user did with the command on their command line, one of the Outcome
+	// constants, or empty when unknown
+	Outcome string
+	// RanCommand is the edited command the user ran instead, with OutcomeEdited
+	RanCommand string
+	// Shortcut names the shell abbreviation or alias exported for a favorite, empty for none
+	Shortcut string
+	// Tags organize entries by topic, sorted
+	Tags []string
+	// SessionID is the session the entry was generated in
+	SessionID sql.NullInt64
+	// Edited is set once the command or details were changed with 'tell history edit'
+	Edited bool
+	// Continuations is the number of entries continuing this one
+	Continuations int
+	// UseCount is how many times the entry was run, copied or picked from history on this
+	// machine, last at LastUsedAt
+	UseCount   int
+	LastUsedAt sql.NullTime
+	// UID identifies the entry on every machine its history is synced to
+	UID string
+	// UpdatedAt is when a field that can change after the entry was made, such as Favorite,
+	// Tags or the execution, last did
+	UpdatedAt sql.NullTime
+}
+
+// HistoryGroup is the newest of the history entries repeating the same command, or the same
+// prompt for entries without a command, with how many there are and how often they were used
+type HistoryGroup struct {
+	Latest   HistoryEntry
+	Count    int
+	UseCount int
+}
+
+// TagCount is a tag and the number of history entries that have it
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// Outcomes of a command the shell integration put on the user's command line
+const (
+	// HistorySortRecent lists history entries newest first
+	HistorySortRecent = "recent"
+	// HistorySortUsed lists the entries used most first, then those used last
+	HistorySortUsed = "used"
+)
+
+const (
+	// OutcomeAsIs means the command was run as tell gave it
+	OutcomeAsIs = "as-is"
+	// OutcomeEdited means the user changed the command before running it
+	OutcomeEdited = "edited"
+	// OutcomeDiscarded means the command was cleared or replaced by an unrelated one
+	OutcomeDiscarded = "discarded"
+)
+
+// Execution is the result of running a generated command
+type Execution struct {
+	ExitCode  int
+	StartedAt time.Time
+	// Duration is how long the command ran, negative when unknown
+	Duration time.Duration
+	// Output is the end of the command's output, empty when it wasn't recorded
+	Output string
+	// TimedOut is set when the command was stopped because it ran longer than the run timeout
+	TimedOut bool
+}
+
+// ParseStats summarizes how often responses for a system prompt variant parsed
+type ParseStats struct {
+	PromptVariant string `json:"prompt_variant"`
+	Requests      int    `json:"requests"`
+	// FirstTry responses parsed without a repair request
+	FirstTry int `json:"first_try"`
+	// Repaired responses parsed after a repair request
+	Repaired int `json:"repaired"`
+	// Failed responses never parsed
+	Failed          int     `json:"failed"`
+	AvgInputTokens  float64 `json:"avg_input_tokens"`
+	AvgOutputTokens float64 `json:"avg_output_tokens"`
+}
+
+// UsageStats summarizes the history, for 'tell stats'
+type UsageStats struct {
+	Entries int `json:"entries"`
+	// Requests are the entries the model was asked for, and Errors those that failed
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+	// Runs are the commands that were run, and FailedRuns those that exited with an error
+	Runs       int `json:"runs"`
+	FailedRuns int `json:"failed_runs"`
+	// AvgOutputTokens and AvgResponseChars measure the responses of successful requests, the
+	// characters being those of the command and its explanation
+	AvgOutputTokens  float64 `json:"avg_output_tokens"`
+	AvgResponseChars float64 `json:"avg_response_chars"`
+	// Days and Weeks count the entries made in each, newest first, weeks starting on Monday
+	Days        []PeriodCount  `json:"days"`
+	Weeks       []PeriodCount  `json:"weeks"`
+	Models      []ModelUsage   `json:"models"`
+	TopCommands []CommandUsage `json:"top_commands"`
+}
+
+// PeriodCount is the number of entries made in a day or week, starting on Start (2006-01-02)
+type PeriodCount struct {
+	Start   string `json:"start"`
+	Entries int    `json:"entries"`
+}
+
+// ModelUsage is the requests made to a model and the tokens they used
+type ModelUsage struct {
+	Model        string `json:"model"`
+	Requests     int    `json:"requests"`
+	Errors       int    `json:"errors"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+// MonthlyUsage is the requests made to a model in a month (2006-01)
+type MonthlyUsage struct {
+	Month string `json:"month"`
+	ModelUsage
+}
+
+// CommandUsage is a command generated more than once, and how many times it was run
+type CommandUsage struct {
+	Command   string `json:"command"`
+	Generated int    `json:"generated"`
+	Runs      int    `json:"runs"`
 }
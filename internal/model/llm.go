@@ -5,6 +5,122 @@ type CommandResponse struct {
 	Command     string `json:"command"`
 	Details     string `json:"details"`
 	ShowDetails bool   `json:"show_details"`
+	// EstimatedImpact warns about commands expected to be slow or resource heavy, empty otherwise
+	EstimatedImpact string `json:"estimated_impact,omitempty"`
+	// Undo reverses the command's changes, when requested with --with-undo; empty if it can't be undone
+	Undo string `json:"undo,omitempty"`
+	// RequiresRoot is true when the command runs sudo or needs root privileges; set by tell, never by the model
+	RequiresRoot bool `json:"requires_root"`
+	// Warnings are human-oriented notices added by tell (never by the model) for widgets and scripts to show
+	Warnings []Warning `json:"warnings,omitempty"`
+	// Analysis lists the command's side effects when requested with --analyze
+	Analysis *Analysis `json:"analysis,omitempty"`
+	// HistoryID is the history entry the command was saved as, so the shell integration can
+	// record how running it went; set by tell, never by the model
+	HistoryID int64 `json:"history_id,omitempty"`
+	// Blocked asks the shell integration to show the command without putting it on the command
+	// line, because of its warnings at the strict safety level; set by tell, never by the model
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// Warning kinds
+const (
+	// WarningContinuation notes which previous command a continuation builds on
+	WarningContinuation = "continuation"
+	// WarningImpact flags a command expected to be slow or resource heavy
+	WarningImpact = "impact"
+	// WarningPreviouslyFailed flags a command that already failed when the user ran it
+	WarningPreviouslyFailed = "previously_failed"
+	// WarningPlaceholders lists placeholders left in the command for the user to fill in
+	WarningPlaceholders = "placeholders"
+	// WarningSyntax flags a command the shell's parser still rejects after asking for a correction
+	WarningSyntax = "syntax"
+	// WarningRoot flags a command that runs sudo or needs root privileges
+	WarningRoot = "requires_root"
+	// WarningDestructive flags a command that deletes or overwrites data without a way back
+	WarningDestructive = "destructive"
+	// WarningCoreutils flags GNU-only flags on BSD systems such as macOS, and BSD-only flags on GNU systems
+	WarningCoreutils = "coreutils"
+	// WarningBudget notes that the request is expected to use up 80% or all of the monthly budget
+	WarningBudget = "budget"
+)
+
+// Warning is a notice attached to a command response
+type Warning struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// AddWarning appends a warning of the given kind to the response
+func (r *CommandResponse) AddWarning(kind string, message string) {
+	r.Warnings = append(r.Warnings, Warning{Kind: kind, Message: message})
+}
+
+// Explanation is a breakdown of an existing shell command from 'tell explain'
+type Explanation struct {
+	// Summary says what the whole command does
+	Summary string `json:"summary"`
+	// Parts explain each piece of the command in order
+	Parts []ExplanationPart `json:"parts"`
+	// Caveats are pitfalls and side effects worth knowing before running the command
+	Caveats []string `json:"caveats,omitempty"`
+}
+
+// ExplanationPart explains one piece of a command, such as a program, flag or redirection
+type ExplanationPart struct {
+	Part        string `json:"part"`
+	Explanation string `json:"explanation"`
+}
+
+// Risk levels of an Analysis
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+)
+
+// Analysis lists the side effects of a command before it is run, from 'tell analyze' and --analyze
+type Analysis struct {
+	// Risk is the overall risk of running the command, one of the Risk constants
+	Risk string `json:"risk"`
+	// Summary says in one sentence what running the command changes
+	Summary string `json:"summary"`
+	// Writes are the files and directories created or modified
+	Writes []string `json:"writes,omitempty"`
+	// Deletes are the files, directories and other resources removed
+	Deletes []string `json:"deletes,omitempty"`
+	// Network lists hosts contacted, data sent and ports opened
+	Network []string `json:"network,omitempty"`
+	// Privileges lists the permissions needed, such as root or membership of a group
+	Privileges []string `json:"privileges,omitempty"`
+}
+
+// Script is a complete shell script from 'tell script'
+type Script struct {
+	// Script is the whole script, starting with its shebang line
+	Script string `json:"script"`
+	// Description says in one sentence what the script does
+	Description string `json:"description"`
+	// Usage shows how to call the script, e.g. "backup.sh [-n] SOURCE DEST"
+	Usage string `json:"usage,omitempty"`
+}
+
+// FailedCommand is a command that didn't work, to be repaired by 'tell fix'
+type FailedCommand struct {
+	Command string
+	// ExitCode is the exit status of the command, or -1 if unknown
+	ExitCode int
+	// Stderr is the error output of the command, if available
+	Stderr string
+	// Note is the user's own description of what went wrong
+	Note string
+}
+
+// RejectedAttempt is a generated command the user asked to regenerate, with their feedback
+type RejectedAttempt struct {
+	Response *CommandResponse
+	// Feedback says what was wrong with the command or what to change
+	Feedback string
 }
 
 // LLMUsage tracks API usage information
@@ -12,4 +128,12 @@ type LLMUsage struct {
 	Model        string
 	InputTokens  int
 	OutputTokens int
+	// Route records how the model was picked: a routing tier, or "override" for --model. Empty for the configured model
+	Route string
+	// PromptVariant is the system prompt style used for a command (full or compact)
+	PromptVariant string
+	// ParseAttempts is 1 if the command response parsed first time, 2 if it needed a repair request
+	ParseAttempts int
+	// Retries is the number of times failed requests were sent again
+	Retries int
 }
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Session is a named conversation: each prompt made in it carries the commands generated
+// before, in order
+type Session struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+	// Active is set for the session prompts are currently made in, at most one
+	Active bool
+	// Entries is the number of history entries in the session
+	Entries int
+	// LastUsed is when the last entry was added, the creation time for an empty session
+	LastUsed time.Time
+}
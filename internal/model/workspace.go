@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// WorkspaceTrust records whether the user allowed context to be collected from a workspace
+type WorkspaceTrust struct {
+	Path      string
+	Trusted   bool
+	DecidedAt time.Time
+}
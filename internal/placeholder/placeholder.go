@@ -0,0 +1,54 @@
+package placeholder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pattern matches a named placeholder such as {{filename}} or {{ port }}
+var pattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// Names returns the names of the placeholders in command, once each, in the order they first appear
+func Names(command string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range pattern.FindAllStringSubmatch(command, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// Fill replaces the placeholders in command that have a value in values. Values are inserted
+// as they are, without quoting; placeholders without a value are left in place.
+func Fill(command string, values map[string]string) string {
+	return pattern.ReplaceAllStringFunc(command, func(match string) string {
+		name := pattern.FindStringSubmatch(match)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// Format renders a placeholder name the way it appears in commands
+func Format(name string) string {
+	return "{{" + name + "}}"
+}
+
+// ParseVars parses placeholder values given as name=value
+func ParseVars(vars []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, v := range vars {
+		name, value, ok := strings.Cut(v, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid placeholder value %q, expected name=value", v)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
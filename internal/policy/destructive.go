@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+)
+
+// destructivePatterns match simple commands that delete or overwrite data without a way back.
+// Each is checked against a simple command with its program name reduced to the base name.
+var destructivePatterns = []struct {
+	pattern *regexp.Regexp
+	reason  string
+}{
+	{regexp.MustCompile(`^rm\s.*(-[a-zA-Z]*[rRf]|--recursive|--force)`), "rm deletes files recursively or without asking"},
+	{regexp.MustCompile(`^(shred|wipefs|mkfs(\.\w+)?)\s`), "it erases data on disk"},
+	{regexp.MustCompile(`^dd\s.*\bof=`), "dd overwrites its output file or device"},
+	{regexp.MustCompile(`^find\s.*(-delete\b|-exec\s+rm\b)`), "find deletes the files it matches"},
+	{regexp.MustCompile(`^truncate\s`), "truncate cuts files"},
+	{regexp.MustCompile(`^git\s+(reset\s.*--hard|clean\s.*-[a-zA-Z]*f|push\s.*(--force|-f\b)|checkout\s.*--\s|branch\s.*-D\b|stash\s+(drop|clear))`), "git discards work that can't be recovered"},
+	{regexp.MustCompile(`^(chmod|chown|chgrp)\s.*(-[a-zA-Z]*R|--recursive)`), "it changes permissions recursively"},
+	{regexp.MustCompile(`^docker\s+(system|volume|image|container)\s+prune\b|^docker\s+(rm|rmi|volume\s+rm)\s`), "docker deletes containers, images or volumes"},
+	{regexp.MustCompile(`^kubectl\s+delete\s`), "kubectl deletes cluster resources"},
+	{regexp.MustCompile(`(?i)^Remove-Item\s.*-(Recurse|Force)\b`), "Remove-Item deletes files recursively or without asking"},
+	{regexp.MustCompile(`(?i)^(Format-Volume|Clear-Disk|Initialize-Disk)\b`), "it erases data on disk"},
+	{regexp.MustCompile(`(?i)^Clear-Content\s`), "Clear-Content empties files"},
+	{regexp.MustCompile(`(?i)^(del|erase)\s(.*\s)?/[sq]\s`), "del deletes files in subdirectories or without asking"},
+	{regexp.MustCompile(`(?i)^(rd|rmdir)\s(.*\s)?/s\s`), "rd deletes whole directory trees"},
+	{regexp.MustCompile(`(?i)^format\s+[a-z]:`), "format erases a drive"},
+	{regexp.MustCompile(`(?i)\b(drop\s+(table|database|schema)|truncate\s+table|delete\s+from)\b`), "it deletes database data"},
+}
+
+// Destructive returns why command deletes or overwrites data without a way back, e.g. rm -rf,
+// dd or git reset --hard, or "" if none of its simple commands does
+func Destructive(command string) string {
+	for _, segment := range Segments(command) {
+		words := unwrap(strings.Fields(segment))
+		if len(words) == 0 {
+			continue
+		}
+		words[0] = filepath.Base(words[0])
+		simple := strings.Join(words, " ")
+
+		for _, destructive := range destructivePatterns {
+			if destructive.pattern.MatchString(simple + " ") {
+				return destructive.reason
+			}
+		}
+	}
+
+	return ""
+}
+
+// wrappers are programs that run the command given in their arguments, with the options of each
+// that take a value, e.g. sudo -u root rm or find . | xargs -n 1 rm
+var wrappers = map[string]map[string]bool{
+	"sudo":    {"-u": true, "-g": true, "-C": true, "-D": true, "-h": true, "-p": true, "-r": true, "-t": true, "-T": true, "-U": true, "-R": true},
+	"doas":    {"-u": true, "-C": true},
+	"xargs":   {"-I": true, "-n": true, "-P": true, "-L": true, "-s": true, "-d": true, "-E": true, "-a": true},
+	"env":     {"-u": true, "-C": true, "-S": true},
+	"nice":    {"-n": true},
+	"nohup":   {},
+	"command": {},
+	"exec":    {"-a": true},
+	"time":    {"-f": true, "-o": true},
+}
+
+// unwrap returns the words of a simple command from the program that does the work, looking
+// past variable assignments and wrappers such as sudo, xargs or env, and their options
+func unwrap(words []string) []string {
+	for len(words) > 0 {
+		if strings.Contains(words[0], "=") && !strings.HasPrefix(words[0], "-") {
+			words = words[1:]
+			continue
+		}
+
+		valued, ok := wrappers[filepath.Base(words[0])]
+		if !ok {
+			return words
+		}
+		words = words[1:]
+		for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+			option := words[0]
+			words = words[1:]
+			if option == "--" {
+				break
+			}
+			if valued[option] && len(words) > 0 {
+				words = words[1:]
+			}
+		}
+	}
+	return words
+}
+
+// CheckSafety returns an *Error for a destructive command at the strict safety level, unless
+// force is set. Other levels allow destructive commands.
+func CheckSafety(command string, level string, force bool) error {
+	if level != config.SafetyStrict || force {
+		return nil
+	}
+	if reason := Destructive(command); reason != "" {
+		return &Error{Command: command, Reason: fmt.Sprintf("it is destructive (%s) and safety_level is strict, use --force to allow it", reason)}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package policy
+
+import "testing"
+
+func TestDestructiveLooksPastWrappers(t *testing.T) {
+	tests := []struct {
+		command     string
+		destructive bool
+	}{
+		{"rm -rf build", true},
+		{"find . -name '*.o' | xargs rm -rf", true},
+		{"find . | xargs -I {} rm -rf {}", true},
+		{"sudo -u root rm -rf /", true},
+		{"sudo -- rm -rf /", true},
+		{"env rm -rf build", true},
+		{"env FOO=bar rm -rf build", true},
+		{"nice -n 10 rm -rf build", true},
+		{"FOO=1 nohup rm -rf build", true},
+		{"command rm -rf build", true},
+		{"exec rm -rf build", true},
+		{"time rm -rf build", true},
+		{"ls -la", false},
+		{"sudo apt update", false},
+		{"echo rm -rf build", false},
+		{"find . -name '*.o' | xargs ls -l", false},
+	}
+
+	for _, tt := range tests {
+		if got := Destructive(tt.command) != ""; got != tt.destructive {
+			t.Errorf("Destructive(%q) = %v, want %v", tt.command, got, tt.destructive)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+)
+
+// Error is returned for a command the policy refuses
+type Error struct {
+	Command string
+	Reason  string
+}
+
+func (e *Error) Error() string {
+	return "command refused by policy: " + e.Reason
+}
+
+// Check returns an *Error when command matches one of the blocked patterns or, in allowlist
+// mode, when one of its simple commands matches none of the allowed patterns. Patterns are
+// regular expressions; an invalid one is reported as an error.
+func Check(command string, policy config.PolicyConfig) error {
+	for _, pattern := range policy.Blocked {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid blocked pattern %q: %w", pattern, err)
+		}
+		if re.MatchString(command) {
+			return &Error{Command: command, Reason: fmt.Sprintf("it matches the blocked pattern %s", pattern)}
+		}
+	}
+
+	if len(policy.Allowed) == 0 {
+		return nil
+	}
+
+	allowed := make([]*regexp.Regexp, len(policy.Allowed))
+	for i, pattern := range policy.Allowed {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid allowed pattern %q: %w", pattern, err)
+		}
+		allowed[i] = re
+	}
+
+	for _, segment := range Segments(command) {
+		if !matchesAny(segment, allowed) {
+			return &Error{Command: command, Reason: fmt.Sprintf("'%s' matches none of the allowed patterns", segment)}
+		}
+	}
+
+	return nil
+}
+
+// matchesAny reports whether s matches one of the patterns
+func matchesAny(s string, patterns []*regexp.Regexp) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Segments splits a command line into its simple commands at pipes, lists (;, &, &&, ||),
+// newlines and command substitutions, outside of quotes. Line continuations are joined first.
+func Segments(command string) []string {
+	command = strings.ReplaceAll(command, "\\\n", " ")
+
+	var segments []string
+	var current strings.Builder
+	flush := func() {
+		if segment := strings.TrimSpace(current.String()); segment != "" {
+			segments = append(segments, segment)
+		}
+		current.Reset()
+	}
+
+	var quote rune
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			// Command substitutions run even inside double quotes
+			if quote == '"' && (r == '`' || (r == '$' && i+1 < len(runes) && runes[i+1] == '(')) {
+				flush()
+				if r == '$' {
+					i++
+				}
+				continue
+			}
+			if r == quote {
+				quote = 0
+			}
+			current.WriteRune(r)
+		case r == '\\' && i+1 < len(runes):
+			current.WriteRune(r)
+			current.WriteRune(runes[i+1])
+			i++
+		case r == '\'' || r == '"':
+			quote = r
+			current.WriteRune(r)
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '(':
+			flush()
+			i++
+		case strings.ContainsRune("|;&\n`()", r):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return segments
+}
@@ -0,0 +1,202 @@
+package portability
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/jonfk/tell/internal/policy"
+	"github.com/jonfk/tell/internal/sysinfo"
+)
+
+// bsdLongOptionTools are tools whose BSD versions have no --long options, unlike the GNU ones
+var bsdLongOptionTools = map[string]bool{
+	"ls": true, "cp": true, "mv": true, "rm": true, "du": true, "df": true, "head": true, "tail": true,
+	"cut": true, "wc": true, "mkdir": true, "touch": true, "ln": true, "chmod": true, "chown": true,
+	"tr": true, "uniq": true, "date": true, "stat": true, "sed": true, "xargs": true, "readlink": true,
+}
+
+// Lint returns the flags in command that don't work with the given coreutils flavor
+// (sysinfo.CoreutilsGNU, sysinfo.CoreutilsBSD or sysinfo.CoreutilsBusyBox), e.g. date -d on macOS or an empty sed -i suffix on Linux.
+// It knows the most common differences only, and returns nothing for an unknown flavor.
+func Lint(command string, flavor string) []string {
+	var issues []string
+	for _, segment := range policy.Segments(command) {
+		words := strings.Fields(segment)
+		// Look past elevation and variable assignments to the program
+		for len(words) > 0 && (words[0] == "sudo" || words[0] == "env" || strings.Contains(words[0], "=")) {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			continue
+		}
+		program, args := filepath.Base(words[0]), words[1:]
+
+		var issue string
+		switch flavor {
+		case sysinfo.CoreutilsBSD:
+			issue = lintBSD(program, args)
+		case sysinfo.CoreutilsGNU:
+			issue = lintGNU(program, args)
+		case sysinfo.CoreutilsBusyBox:
+			issue = lintBusyBox(program, args)
+		}
+		if issue != "" {
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+// lintBSD returns why a simple command needs GNU tools, or ""
+func lintBSD(program string, args []string) string {
+	switch program {
+	case "sed":
+		for i, arg := range args {
+			if arg == "--in-place" || strings.HasPrefix(arg, "--in-place=") {
+				return "sed --in-place is GNU-only, BSD sed uses -i ''"
+			}
+			// BSD sed takes the word after -i as the backup suffix
+			if arg == "-i" && (i+1 >= len(args) || !isSuffix(args[i+1])) {
+				return "sed -i needs a backup suffix on BSD, use sed -i '' to edit in place"
+			}
+		}
+	case "date":
+		if hasFlagPrefix(args, "-d") || hasLongFlag(args, "--date") {
+			return "date -d is GNU-only, BSD date uses -v to adjust or -j -f to parse dates"
+		}
+	case "stat":
+		if hasShortFlag(args, 'c') || hasLongFlag(args, "--format") || hasLongFlag(args, "--printf") {
+			return "stat -c is GNU-only, BSD stat uses -f"
+		}
+	case "grep":
+		if hasShortFlag(args, 'P') || hasLongFlag(args, "--perl-regexp") {
+			return "grep -P is GNU-only, BSD grep has no Perl regular expressions"
+		}
+	case "find":
+		for _, arg := range args {
+			if arg == "-printf" || arg == "-regextype" {
+				return "find " + arg + " is GNU-only"
+			}
+		}
+	case "head":
+		for i, arg := range args {
+			if arg == "-n" && i+1 < len(args) && strings.HasPrefix(args[i+1], "-") {
+				return "head -n with a negative count is GNU-only"
+			}
+		}
+	}
+
+	if bsdLongOptionTools[program] {
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "--") && len(arg) > 2 {
+				option, _, _ := strings.Cut(arg, "=")
+				return program + " " + option + " is a GNU long option, BSD " + program + " has none"
+			}
+		}
+	}
+
+	return ""
+}
+
+// lintGNU returns why a simple command needs BSD tools, or ""
+func lintGNU(program string, args []string) string {
+	switch program {
+	case "sed":
+		for i, arg := range args {
+			// GNU sed reads a separate '' after -i as the script
+			if arg == "-i" && i+1 < len(args) && (args[i+1] == "''" || args[i+1] == `""`) {
+				return "sed -i '' is BSD syntax, GNU sed reads '' as the script; use sed -i"
+			}
+		}
+	case "date":
+		if hasFlagPrefix(args, "-v") || hasFlagPrefix(args, "-j") {
+			return "date -v and -j are BSD-only, GNU date uses -d"
+		}
+	case "stat":
+		if hasShortFlag(args, 'f') {
+			return "stat -f is BSD syntax for a format, GNU stat -f shows the file system; use stat -c"
+		}
+	}
+
+	return ""
+}
+
+// busyboxMissing are common programs a minimal BusyBox system doesn't have
+var busyboxMissing = map[string]string{
+	"bash":      "bash isn't installed on BusyBox systems, use sh",
+	"curl":      "curl isn't a BusyBox applet, use wget",
+	"rg":        "rg isn't a BusyBox applet, use grep",
+	"fd":        "fd isn't a BusyBox applet, use find",
+	"jq":        "jq isn't a BusyBox applet",
+	"systemctl": "BusyBox systems have no systemd, use the init system's service command",
+}
+
+// lintBusyBox returns why a simple command needs more than BusyBox applets, or ""
+func lintBusyBox(program string, args []string) string {
+	if reason, ok := busyboxMissing[program]; ok {
+		return reason
+	}
+
+	switch program {
+	case "grep":
+		if hasShortFlag(args, 'P') || hasLongFlag(args, "--perl-regexp") {
+			return "grep -P is GNU-only, BusyBox grep has no Perl regular expressions"
+		}
+	case "find":
+		for _, arg := range args {
+			if arg == "-printf" || arg == "-regextype" {
+				return "find " + arg + " is GNU-only, BusyBox find doesn't have it"
+			}
+		}
+	case "du":
+		if hasLongFlag(args, "--max-depth") {
+			return "du --max-depth is GNU-only, BusyBox du uses -d"
+		}
+	case "sort":
+		if hasShortFlag(args, 'V') || hasLongFlag(args, "--version-sort") {
+			return "sort -V is GNU-only, BusyBox sort has no version sort"
+		}
+	case "ls":
+		if hasLongFlag(args, "--time-style") {
+			return "ls --time-style is GNU-only, BusyBox ls uses --full-time or -e"
+		}
+	}
+
+	return ""
+}
+
+// isSuffix reports whether word is a BSD sed -i backup suffix: empty quotes or an extension
+func isSuffix(word string) bool {
+	return word == "''" || word == `""` || strings.HasPrefix(word, ".") || strings.HasPrefix(word, "'.") || strings.HasPrefix(word, `".`)
+}
+
+// hasShortFlag reports whether one of args is a short option cluster containing flag, e.g. -ud for d
+func hasShortFlag(args []string, flag rune) bool {
+	for _, arg := range args {
+		if len(arg) > 1 && arg[0] == '-' && arg[1] != '-' && strings.ContainsRune(arg[1:], flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasFlagPrefix reports whether one of args is the short option flag, with or without an attached value
+func hasFlagPrefix(args []string, flag string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLongFlag reports whether args contain the long option, with or without a =value
+func hasLongFlag(args []string, option string) bool {
+	for _, arg := range args {
+		if arg == option || strings.HasPrefix(arg, option+"=") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package privilege
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jonfk/tell/internal/policy"
+)
+
+// elevators are programs that run a command as root
+var elevators = map[string]bool{
+	"sudo": true, "doas": true, "pkexec": true, "su": true, "run0": true,
+}
+
+// rootPrograms are programs that only root can usefully run
+var rootPrograms = map[string]bool{
+	"mount": true, "umount": true, "modprobe": true, "insmod": true, "rmmod": true,
+	"iptables": true, "ip6tables": true, "nft": true, "ufw": true, "firewall-cmd": true,
+	"useradd": true, "userdel": true, "usermod": true, "groupadd": true, "groupdel": true, "chpasswd": true,
+	"chroot": true, "fdisk": true, "parted": true, "mkswap": true, "swapon": true, "swapoff": true,
+	"shutdown": true, "reboot": true, "halt": true, "poweroff": true, "visudo": true,
+	"setcap": true, "dmidecode": true, "update-grub": true, "grub-install": true,
+}
+
+// packageManagers maps package managers that need root to their subcommands that change packages
+var packageManagers = map[string][]string{
+	"apt":     {"install", "remove", "purge", "upgrade", "full-upgrade", "dist-upgrade", "autoremove", "update"},
+	"apt-get": {"install", "remove", "purge", "upgrade", "dist-upgrade", "autoremove", "update"},
+	"dnf":     {"install", "remove", "erase", "upgrade", "update", "autoremove"},
+	"yum":     {"install", "remove", "erase", "upgrade", "update", "autoremove"},
+	"zypper":  {"install", "in", "remove", "rm", "update", "up", "dist-upgrade", "dup"},
+	"apk":     {"add", "del", "upgrade", "update"},
+	"pacman":  {"-S", "-R", "-U", "-Syu", "-Sy", "-Rs", "-Rns"},
+	"snap":    {"install", "remove", "refresh"},
+	"dpkg":    {"-i", "--install", "-r", "--remove", "-P", "--purge"},
+	"rpm":     {"-i", "-U", "-e", "--install", "--upgrade", "--erase"},
+}
+
+// systemctlActions are systemctl subcommands that change system services
+var systemctlActions = map[string]bool{
+	"start": true, "stop": true, "restart": true, "reload": true, "enable": true, "disable": true,
+	"mask": true, "unmask": true, "daemon-reload": true, "edit": true, "kill": true,
+}
+
+// writers are programs that write to the paths given as arguments
+var writers = map[string]bool{
+	"cp": true, "mv": true, "rm": true, "install": true, "ln": true, "chmod": true, "chown": true,
+	"chgrp": true, "touch": true, "mkdir": true, "rmdir": true, "tee": true, "truncate": true,
+}
+
+// systemPaths are directories only root can write to
+var systemPaths = []string{"/etc/", "/usr/", "/boot/", "/var/lib/", "/lib/", "/lib64/", "/sbin/", "/bin/", "/sys/", "/proc/sys/"}
+
+// redirectPattern matches an output redirection to a file. Groups: target.
+var redirectPattern = regexp.MustCompile(`>>?\s*['"]?(/[^\s'"]+)`)
+
+// envAssignment matches a variable assignment before a command, e.g. LANG=C
+var envAssignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// RequiresRoot reports whether command needs root privileges, and why: it runs sudo or
+// another elevation program (reason is the program), or one of its simple commands manages
+// packages, services, mounts, users or the firewall, or writes under a system directory such
+// as /etc (reason is what needs root, e.g. "apt install"). elevated is true when the command
+// elevates itself, false when the user has to.
+func RequiresRoot(command string) (requires bool, elevated bool, reason string) {
+	for _, segment := range policy.Segments(command) {
+		words := strings.Fields(segment)
+		for len(words) > 0 && envAssignment.MatchString(words[0]) {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			continue
+		}
+		program := filepath.Base(unquote(words[0]))
+
+		// Elevation wins over any other reason, since the command takes care of it
+		if elevators[program] {
+			return true, true, program
+		}
+		if reason == "" {
+			reason = rootReason(program, words[1:], segment)
+		}
+	}
+
+	return reason != "", false, reason
+}
+
+// rootReason returns what in a simple command needs root, or "" if nothing does
+func rootReason(program string, args []string, segment string) string {
+	if rootPrograms[program] || strings.HasPrefix(program, "mkfs") {
+		return program
+	}
+
+	if subcommands, ok := packageManagers[program]; ok && len(args) > 0 {
+		for _, arg := range args {
+			for _, subcommand := range subcommands {
+				if arg == subcommand {
+					return program + " " + subcommand
+				}
+			}
+		}
+	}
+
+	if program == "systemctl" && !contains(args, "--user") {
+		for _, arg := range args {
+			if systemctlActions[arg] {
+				return "systemctl " + arg
+			}
+		}
+	}
+
+	// Redirections and writers with a system directory as the target
+	if match := redirectPattern.FindStringSubmatch(segment); match != nil && isSystemPath(match[1]) {
+		return "writing to " + match[1]
+	}
+	if writers[program] {
+		targets := args
+		// cp, mv, install and ln only write to their last argument
+		if program == "cp" || program == "mv" || program == "install" || program == "ln" {
+			targets = args[max(len(args)-1, 0):]
+		}
+		for _, arg := range targets {
+			if path := unquote(arg); isSystemPath(path) {
+				return "changing " + path
+			}
+		}
+	}
+
+	return ""
+}
+
+// isSystemPath reports whether path is in a directory only root can write to
+func isSystemPath(path string) bool {
+	for _, dir := range systemPaths {
+		if strings.HasPrefix(path, dir) || path == strings.TrimSuffix(dir, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// unquote strips the quotes around a shell word
+func unquote(word string) string {
+	return strings.Trim(word, `'"`)
+}
+
+// contains reports whether words contains word
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
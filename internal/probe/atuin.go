@@ -0,0 +1,24 @@
+package probe
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Atuin returns a probe that reports the last limit commands Atuin recorded in the current
+// directory, from any shell session
+func Atuin(timeout time.Duration, limit int) Probe {
+	return Probe{
+		Name:    "recent commands in this directory (atuin)",
+		Timeout: timeout,
+		Run: func(ctx context.Context) (string, error) {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return "", err
+			}
+			return runCommand(ctx, "atuin", "search", "--cmd-only", "--cwd", cwd, "--limit", strconv.Itoa(limit))
+		},
+	}
+}
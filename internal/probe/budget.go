@@ -0,0 +1,88 @@
+package probe
+
+import (
+	"log/slog"
+	"sort"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// minItemTokens is the smallest share of the budget worth sending for a context item
+const minItemTokens = 100
+
+// EstimateTokens estimates the number of tokens in s at roughly 4 bytes per token
+func EstimateTokens(s string) int {
+	return (len(s) + 3) / 4
+}
+
+// Budget fits context items into maxTokens. Items are ranked by their order, most important
+// first. The budget is shared fairly: items smaller than their share are kept whole and the
+// rest is split between the larger ones, which are truncated. When there are too many items
+// for each to get a useful share, the lowest ranked ones are dropped. A maxTokens of 0 or
+// less disables the budget.
+func Budget(items []model.ContextItem, maxTokens int) []model.ContextItem {
+	if maxTokens <= 0 || totalTokens(items) <= maxTokens {
+		return items
+	}
+
+	// Drop the lowest ranked items until each remaining one gets a useful share
+	kept := items
+	limits := allocate(kept, maxTokens)
+	for len(kept) > 1 && !useful(kept, limits) {
+		slog.Debug("Dropping context over the token budget", "name", kept[len(kept)-1].Name)
+		kept = kept[:len(kept)-1]
+		limits = allocate(kept, maxTokens)
+	}
+
+	budgeted := make([]model.ContextItem, len(kept))
+	for i, item := range kept {
+		budgeted[i] = item
+		if limits[i] < EstimateTokens(item.Content) {
+			slog.Debug("Truncating context to fit the token budget", "name", item.Name, "tokens", limits[i])
+			budgeted[i].Content = Truncate(item.Content, limits[i]*4)
+		}
+	}
+
+	return budgeted
+}
+
+// allocate shares maxTokens between items, smallest first, so what small items
+// don't need goes to the larger ones. Returns the tokens allowed for each item.
+func allocate(items []model.ContextItem, maxTokens int) []int {
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(items[order[a]].Content) < len(items[order[b]].Content)
+	})
+
+	limits := make([]int, len(items))
+	remaining := maxTokens
+	for n, i := range order {
+		share := remaining / (len(order) - n)
+		limits[i] = min(EstimateTokens(items[i].Content), share)
+		remaining -= limits[i]
+	}
+
+	return limits
+}
+
+// useful reports whether every item gets at least minItemTokens, or all of itself if smaller
+func useful(items []model.ContextItem, limits []int) bool {
+	for i, item := range items {
+		if limits[i] < min(EstimateTokens(item.Content), minItemTokens) {
+			return false
+		}
+	}
+	return true
+}
+
+// totalTokens estimates the number of tokens in all items
+func totalTokens(items []model.ContextItem) int {
+	total := 0
+	for _, item := range items {
+		total += EstimateTokens(item.Content)
+	}
+	return total
+}
@@ -0,0 +1,26 @@
+package probe
+
+import (
+	"context"
+	"time"
+)
+
+// Command returns a probe that runs a user defined shell command with sh and reports its
+// output, truncated to maxBytes. Commands that fail are skipped like any other probe.
+func Command(name string, command string, timeout time.Duration, maxBytes int) Probe {
+	if name == "" {
+		name = command
+	}
+
+	return Probe{
+		Name:    name,
+		Timeout: timeout,
+		Run: func(ctx context.Context) (string, error) {
+			out, err := runCommand(ctx, "sh", "-c", command)
+			if err != nil {
+				return "", err
+			}
+			return Truncate(out, maxBytes), nil
+		},
+	}
+}
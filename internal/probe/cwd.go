@@ -0,0 +1,68 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultMaxEntries is the number of directory entries listed when no limit is configured
+const DefaultMaxEntries = 50
+
+// Cwd returns a probe that reports the working directory and a listing of its
+// entries, like ls, truncated to maxEntries. Directories are marked with a trailing slash.
+func Cwd(timeout time.Duration, maxEntries int) Probe {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+
+	return Probe{
+		Name:    "working directory",
+		Timeout: timeout,
+		Run: func(ctx context.Context) (string, error) {
+			cwd, err := os.Getwd()
+			if err != nil {
+				return "", fmt.Errorf("could not get working directory: %w", err)
+			}
+
+			entries, err := os.ReadDir(cwd)
+			if err != nil {
+				return "", fmt.Errorf("could not list working directory: %w", err)
+			}
+
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "Path: %s\n", cwd)
+
+			// Skip hidden entries, like ls does without -a
+			var names []string
+			for _, entry := range entries {
+				if strings.HasPrefix(entry.Name(), ".") {
+					continue
+				}
+				name := entry.Name()
+				if entry.IsDir() {
+					name += "/"
+				}
+				names = append(names, name)
+			}
+
+			if len(names) == 0 {
+				sb.WriteString("(empty)\n")
+				return sb.String(), nil
+			}
+
+			for i, name := range names {
+				if i == maxEntries {
+					fmt.Fprintf(&sb, "... and %d more\n", len(names)-maxEntries)
+					break
+				}
+				sb.WriteString(name)
+				sb.WriteString("\n")
+			}
+
+			return sb.String(), nil
+		},
+	}
+}
@@ -0,0 +1,18 @@
+package probe
+
+import (
+	"context"
+	"time"
+)
+
+// Git returns a probe that reports the branch and short status of the git repository
+// in the current directory
+func Git(timeout time.Duration) Probe {
+	return Probe{
+		Name:    "git status",
+		Timeout: timeout,
+		Run: func(ctx context.Context) (string, error) {
+			return runCommand(ctx, "git", "status", "--short", "--branch")
+		},
+	}
+}
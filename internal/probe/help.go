@@ -0,0 +1,153 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultMaxHelpTools is the number of tools help is looked up for when no limit is configured
+const DefaultMaxHelpTools = 2
+
+// commonWords are commands that are also everyday English words; a prompt mentioning
+// them rarely means the tool, so their help would only waste tokens
+var commonWords = map[string]bool{
+	"at": true, "cut": true, "date": true, "echo": true, "env": true, "false": true, "file": true,
+	"find": true, "free": true, "head": true, "help": true, "id": true, "install": true, "join": true,
+	"kill": true, "last": true, "less": true, "link": true, "look": true, "make": true, "more": true,
+	"mount": true, "paste": true, "print": true, "read": true, "script": true, "size": true,
+	"sleep": true, "sort": true, "split": true, "tail": true, "test": true, "time": true, "top": true,
+	"touch": true, "true": true, "type": true, "users": true, "wait": true, "watch": true,
+	"which": true, "who": true, "write": true, "yes": true,
+}
+
+// toolWord matches words that can name an executable
+var toolWord = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9._+-]*`)
+
+// ReferencedTools returns the installed tools mentioned in text, in order of appearance,
+// at most maxTools of them
+func ReferencedTools(text string, maxTools int) []string {
+	if maxTools <= 0 {
+		maxTools = DefaultMaxHelpTools
+	}
+
+	var tools []string
+	seen := make(map[string]bool)
+	for _, word := range toolWord.FindAllString(text, -1) {
+		word = strings.TrimRight(word, ".")
+		if len(word) < 2 || seen[word] || commonWords[strings.ToLower(word)] {
+			continue
+		}
+		seen[word] = true
+
+		if _, err := exec.LookPath(word); err != nil {
+			continue
+		}
+		tools = append(tools, word)
+		if len(tools) == maxTools {
+			break
+		}
+	}
+
+	return tools
+}
+
+// Help returns a probe that reports the usage of an installed tool, so suggested flags match
+// the installed version. The synopsis and options are taken from the man page; tools without
+// one are run with --help. The excerpt is truncated to maxBytes.
+func Help(tool string, timeout time.Duration, maxBytes int) Probe {
+	return Probe{
+		Name:    "help for " + tool,
+		Timeout: timeout,
+		Run: func(ctx context.Context) (string, error) {
+			content, err := manExcerpt(ctx, tool)
+			if err != nil {
+				content, err = helpOutput(ctx, tool)
+			}
+			if err != nil {
+				return "", err
+			}
+			return Truncate(content, maxBytes), nil
+		},
+	}
+}
+
+// manSections are the man page sections worth sending, in order of preference for the options
+var manSections = []string{"SYNOPSIS", "OPTIONS", "DESCRIPTION"}
+
+// overstrike matches the backspace sequences man uses for bold and underlined text
+var overstrike = regexp.MustCompile(".\b")
+
+// manExcerpt returns the synopsis and options (or description, when options aren't a
+// section of their own) of the tool's man page
+func manExcerpt(ctx context.Context, tool string) (string, error) {
+	cmd := exec.CommandContext(ctx, "man", tool)
+	cmd.Env = append(os.Environ(), "MANPAGER=cat", "PAGER=cat", "MANWIDTH=100")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("could not read man page for %s: %w", tool, err)
+	}
+
+	sections := splitManSections(overstrike.ReplaceAllString(string(out), ""))
+	synopsis := sections["SYNOPSIS"]
+	if synopsis == "" {
+		return "", fmt.Errorf("man page for %s has no synopsis", tool)
+	}
+
+	excerpt := "SYNOPSIS\n" + synopsis
+	for _, name := range manSections[1:] {
+		if body := sections[name]; body != "" {
+			excerpt += "\n" + name + "\n" + body
+			break
+		}
+	}
+
+	return excerpt, nil
+}
+
+// splitManSections splits a formatted man page into its sections, keyed by heading.
+// Headings are the unindented lines; the page header and footer are dropped with them.
+func splitManSections(page string) map[string]string {
+	sections := make(map[string]string)
+
+	var name string
+	var body strings.Builder
+	flush := func() {
+		if name != "" {
+			sections[name] = strings.Trim(body.String(), "\n")
+		}
+		body.Reset()
+	}
+
+	for _, line := range strings.Split(page, "\n") {
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			flush()
+			name = strings.TrimSpace(line)
+			continue
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	flush()
+
+	return sections
+}
+
+// helpOutput runs the tool with --help. Many tools print their usage to stderr or exit
+// with an error status, so any output counts.
+func helpOutput(ctx context.Context, tool string) (string, error) {
+	cmd := exec.CommandContext(ctx, tool, "--help")
+	out, err := cmd.CombinedOutput()
+	if strings.TrimSpace(string(out)) == "" {
+		if err == nil {
+			err = errors.New("no output")
+		}
+		return "", fmt.Errorf("could not get help for %s: %w", tool, err)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,103 @@
+package probe
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// DefaultTimeout is used for probes that don't set their own timeout
+const DefaultTimeout = 2 * time.Second
+
+// Probe gathers a single piece of context for a prompt
+type Probe struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) (string, error)
+}
+
+// Gather runs all probes concurrently, each bounded by its own timeout.
+// Probes that fail, time out or produce no output are logged and skipped so
+// a single hung probe can't stall command generation. Results keep the order
+// of the given probes.
+func Gather(ctx context.Context, probes []Probe) []model.ContextItem {
+	results := make([]*model.ContextItem, len(probes))
+
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		wg.Add(1)
+		go func(i int, p Probe) {
+			defer wg.Done()
+
+			timeout := p.Timeout
+			if timeout <= 0 {
+				timeout = DefaultTimeout
+			}
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			content, err := run(probeCtx, p)
+			if err != nil {
+				slog.Debug("Context probe failed", "probe", p.Name, "duration", time.Since(start), "error", err)
+				return
+			}
+
+			content = strings.TrimSpace(content)
+			if content == "" {
+				slog.Debug("Context probe returned no output", "probe", p.Name)
+				return
+			}
+
+			slog.Debug("Context probe finished", "probe", p.Name, "duration", time.Since(start), "bytes", len(content))
+			results[i] = &model.ContextItem{Name: p.Name, Content: content}
+		}(i, p)
+	}
+	wg.Wait()
+
+	var items []model.ContextItem
+	for _, result := range results {
+		if result != nil {
+			items = append(items, *result)
+		}
+	}
+
+	return items
+}
+
+// run runs the probe, giving up as soon as its context is done even if the probe ignores it
+func run(ctx context.Context, p Probe) (string, error) {
+	type result struct {
+		content string
+		err     error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		content, err := p.Run(ctx)
+		done <- result{content, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.content, r.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("probe timed out: %w", ctx.Err())
+	}
+}
+
+// runCommand runs an external command and returns its standard output
+func runCommand(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("could not run %s: %w", name, err)
+	}
+	return string(out), nil
+}
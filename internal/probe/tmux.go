@@ -0,0 +1,33 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// DefaultTmuxLines is the number of scrollback lines captured above the visible pane
+// when no limit is configured
+const DefaultTmuxLines = 100
+
+// CaptureTmuxPane returns the visible contents of a tmux pane and up to lines lines of its
+// scrollback, with wrapped lines joined. An empty target captures the pane tell runs in.
+func CaptureTmuxPane(ctx context.Context, target string, lines int) (string, error) {
+	if lines < 0 {
+		lines = DefaultTmuxLines
+	}
+
+	if target == "" {
+		target = os.Getenv("TMUX_PANE")
+		if target == "" {
+			return "", errors.New("not running inside tmux, name the pane to capture with --tmux-pane=<target>")
+		}
+	}
+
+	out, err := runCommand(ctx, "tmux", "capture-pane", "-p", "-J", "-t", target, "-S", fmt.Sprintf("-%d", lines))
+	if err != nil {
+		return "", fmt.Errorf("could not capture tmux pane %s: %w", target, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,21 @@
+package probe
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Truncate shortens content to at most maxBytes, cutting at the last line break that fits
+// and noting how much was left out. Content within the limit is returned unchanged.
+func Truncate(content string, maxBytes int) string {
+	if maxBytes <= 0 || len(content) <= maxBytes {
+		return content
+	}
+
+	cut := strings.LastIndexByte(content[:maxBytes], '\n')
+	if cut <= 0 {
+		cut = maxBytes
+	}
+
+	return fmt.Sprintf("%s\n[... truncated, %d more bytes]", content[:cut], len(content)-cut)
+}
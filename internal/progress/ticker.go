@@ -0,0 +1,94 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// tickInterval is how often the status line is redrawn
+const tickInterval = 100 * time.Millisecond
+
+// spinnerFrames are the characters cycled through on the status line
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Ticker renders a single self-updating status line while a request is in flight
+type Ticker struct {
+	w      io.Writer
+	model  string
+	start  time.Time
+	mu     sync.Mutex
+	tokens int
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewTicker creates a new status line ticker writing to w
+func NewTicker(w io.Writer, model string) *Ticker {
+	return &Ticker{
+		w:     w,
+		model: model,
+	}
+}
+
+// Start begins redrawing the status line in the background. A stopped ticker can be
+// started again for the next request.
+func (t *Ticker) Start() {
+	t.start = time.Now()
+	t.done = make(chan struct{})
+	t.SetTokens(0)
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(tickInterval)
+		defer ticker.Stop()
+
+		frame := 0
+		for {
+			t.draw(spinnerFrames[frame%len(spinnerFrames)])
+			frame++
+
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// SetTokens updates the number of output tokens streamed so far
+func (t *Ticker) SetTokens(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tokens = n
+}
+
+// Stop stops the ticker and clears the status line
+func (t *Ticker) Stop() {
+	close(t.done)
+	t.wg.Wait()
+	// Clear the whole line and return the cursor to the start
+	fmt.Fprint(t.w, "\r\033[K")
+}
+
+// draw writes the current status line, overwriting the previous one
+func (t *Ticker) draw(frame string) {
+	t.mu.Lock()
+	tokens := t.tokens
+	t.mu.Unlock()
+
+	elapsed := time.Since(t.start).Seconds()
+	fmt.Fprintf(t.w, "\r\033[K%s Generating with %s (%.1fs, %d tokens)", frame, t.model, elapsed, tokens)
+}
+
+// IsTerminal reports whether the given file is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
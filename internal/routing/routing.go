@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jonfk/tell/internal/config"
+)
+
+// Route tiers recorded in history
+const (
+	TierSimple  = "simple"
+	TierComplex = "complex"
+	// TierOverride is recorded when the model was given for a single request with --model
+	TierOverride = "override"
+	// TierEscalated is recorded when the user retried a prompt with a stronger model
+	TierEscalated = "escalated"
+)
+
+// Decision is the model picked for a prompt and why
+type Decision struct {
+	Model  string
+	Tier   string
+	Reason string
+}
+
+// Route picks the simple or complex model for a prompt using the configured heuristics:
+// an earlier failure of the same prompt, complexity keywords, then the estimated prompt size.
+// defaultModel is used for a tier whose model isn't configured.
+func Route(cfg config.RoutingConfig, defaultModel string, prompt string, priorFailure bool) Decision {
+	escalate := func(reason string) Decision {
+		return Decision{Model: modelOrDefault(cfg.ComplexModel, defaultModel), Tier: TierComplex, Reason: reason}
+	}
+
+	if priorFailure && cfg.EscalateOnFailure {
+		return escalate("the same prompt failed before")
+	}
+
+	lower := strings.ToLower(prompt)
+	for _, keyword := range cfg.ComplexKeywords {
+		if keyword != "" && strings.Contains(lower, strings.ToLower(keyword)) {
+			return escalate(fmt.Sprintf("prompt mentions %q", keyword))
+		}
+	}
+
+	// Roughly 4 characters per token
+	tokens := len(prompt) / 4
+	if cfg.MaxSimpleTokens > 0 && tokens > cfg.MaxSimpleTokens {
+		return escalate(fmt.Sprintf("prompt is about %d tokens", tokens))
+	}
+
+	return Decision{
+		Model:  modelOrDefault(cfg.SimpleModel, defaultModel),
+		Tier:   TierSimple,
+		Reason: "short prompt",
+	}
+}
+
+// Escalate returns the model after current in the fallback chain, or the first one if
+// current isn't in it. Without a chain the complex model is used. ok is false when
+// there is no stronger model to try.
+func Escalate(cfg config.RoutingConfig, current string) (decision Decision, ok bool) {
+	chain := cfg.FallbackModels
+	if len(chain) == 0 && cfg.ComplexModel != "" {
+		chain = []string{cfg.ComplexModel}
+	}
+
+	next := 0
+	for i, model := range chain {
+		if model == current {
+			next = i + 1
+			break
+		}
+	}
+	if next >= len(chain) {
+		return Decision{}, false
+	}
+
+	return Decision{
+		Model:  chain[next],
+		Tier:   TierEscalated,
+		Reason: fmt.Sprintf("retried after %s", current),
+	}, true
+}
+
+func modelOrDefault(model string, defaultModel string) string {
+	if model == "" {
+		return defaultModel
+	}
+	return model
+}
@@ -0,0 +1,43 @@
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+)
+
+// Sandbox runs commands without network access, with the whole filesystem read-only and a
+// private temporary directory
+type Sandbox struct {
+	path string
+}
+
+// Find returns a sandbox built with bubblewrap, which needs Linux namespaces. Without bwrap
+// there is no sandbox: tools such as unshare only protect some directories, and a trial run
+// must not change anything outside the sandbox.
+func Find() (*Sandbox, error) {
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("sandboxing needs Linux namespaces, which " + runtime.GOOS + " doesn't have")
+	}
+
+	path, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, errors.New("sandboxing needs bwrap (bubblewrap), which isn't installed")
+	}
+	return &Sandbox{path: path}, nil
+}
+
+// Command builds the command that runs command with shell -c in the sandbox, in dir, with
+// scratch as its writable temporary directory (TMPDIR)
+func (s *Sandbox) Command(shell string, command string, dir string, scratch string) *exec.Cmd {
+	return exec.Command(s.path,
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--bind", scratch, scratch,
+		"--unshare-all",
+		"--die-with-parent",
+		"--setenv", "TMPDIR", scratch,
+		"--chdir", dir,
+		shell, "-c", command)
+}
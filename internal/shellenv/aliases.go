@@ -0,0 +1,153 @@
+package shellenv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Environment variables the shell integration passes the user's aliases and function names
+// in, since a child process can't see them. TELL_ALIASES holds the output of alias -p (bash)
+// or alias -L (zsh), TELL_FUNCTIONS one function name per line.
+const (
+	AliasesEnvVar   = "TELL_ALIASES"
+	FunctionsEnvVar = "TELL_FUNCTIONS"
+)
+
+// MaxAliases bounds the aliases and functions described to the model, frameworks like
+// oh-my-zsh define hundreds
+const MaxAliases = 150
+
+// Alias is a shell alias, e.g. ll='ls -l'
+type Alias struct {
+	Name  string
+	Value string
+	// Global is set for zsh aliases expanded anywhere on the line (alias -g), not only as a command
+	Global bool
+}
+
+// ParseAliases parses the output of bash's alias -p or zsh's alias -L. zsh suffix aliases
+// (alias -s) are skipped since they only apply to file names typed as commands.
+func ParseAliases(output string) []Alias {
+	var aliases []Alias
+	for _, line := range strings.Split(output, "\n") {
+		words, ok := strings.CutPrefix(strings.TrimSpace(line), "alias ")
+		if !ok {
+			continue
+		}
+
+		var alias Alias
+		var suffix bool
+		// Options come before the definition, -- ends them for names starting with a dash
+		for strings.HasPrefix(words, "-") {
+			option, rest, _ := strings.Cut(words, " ")
+			switch option {
+			case "-g":
+				alias.Global = true
+			case "-s":
+				suffix = true
+			}
+			words = strings.TrimLeft(rest, " ")
+			if option == "--" {
+				break
+			}
+		}
+		if suffix {
+			continue
+		}
+
+		name, value, ok := strings.Cut(words, "=")
+		if !ok || name == "" {
+			continue
+		}
+		alias.Name = unquote(name)
+		alias.Value = unquote(value)
+		aliases = append(aliases, alias)
+	}
+
+	return aliases
+}
+
+// ParseFunctions returns the function names listed one per line, without tell's own and
+// private ones starting with an underscore, such as completion functions
+func ParseFunctions(output string) []string {
+	var functions []string
+	for _, name := range strings.Fields(output) {
+		if strings.HasPrefix(name, "_") || name == "tellme" || name == "tellfix" || strings.HasPrefix(name, "tell-") {
+			continue
+		}
+		functions = append(functions, name)
+	}
+	return functions
+}
+
+// DescribeAliases describes the user's aliases and functions for the model, at most
+// MaxAliases of them, or returns "" when there are none
+func DescribeAliases(aliases []Alias, functions []string) string {
+	if len(aliases) == 0 && len(functions) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("The user's interactive shell defines these. Commands put on the command line expand them, " +
+		"so use them when they fit, and remember an aliased command runs its alias: e.g. with rm='rm -i', rm asks " +
+		"before each file, and \\rm or command rm runs the plain command.\n")
+
+	shown := 0
+	for _, alias := range aliases {
+		if shown == MaxAliases {
+			break
+		}
+		if shown == 0 {
+			sb.WriteString("Aliases:\n")
+		}
+		kind := ""
+		if alias.Global {
+			kind = " (global, expanded anywhere on the line)"
+		}
+		fmt.Fprintf(&sb, "%s=%q%s\n", alias.Name, alias.Value, kind)
+		shown++
+	}
+
+	if remaining := MaxAliases - shown; remaining > 0 && len(functions) > 0 {
+		if len(functions) > remaining {
+			functions = functions[:remaining]
+		}
+		fmt.Fprintf(&sb, "Functions: %s\n", strings.Join(functions, ", "))
+	}
+
+	return sb.String()
+}
+
+// unquote removes shell quoting from a word as alias -p and alias -L print it: single quoted
+// parts, where a quote is written as quote, backslash, quote, quote, double quoted parts and
+// backslash escapes
+func unquote(word string) string {
+	var sb strings.Builder
+	for i := 0; i < len(word); i++ {
+		switch c := word[i]; c {
+		case '\'':
+			end := strings.IndexByte(word[i+1:], '\'')
+			if end < 0 {
+				sb.WriteString(word[i+1:])
+				return sb.String()
+			}
+			sb.WriteString(word[i+1 : i+1+end])
+			i += end + 1
+		case '"':
+			for i++; i < len(word) && word[i] != '"'; i++ {
+				if word[i] == '\\' && i+1 < len(word) {
+					i++
+				}
+				sb.WriteByte(word[i])
+			}
+		case '\\':
+			if i+1 < len(word) {
+				i++
+				sb.WriteByte(word[i])
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
@@ -4,12 +4,44 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 )
 
+// PowerShell is the name tell uses for PowerShell, after its pwsh executable
+const PowerShell = "pwsh"
+
+// Cmd is the name tell uses for the Windows command prompt, cmd.exe
+const Cmd = "cmd"
+
+// ShellEnvVar names the shell commands are for. Integrations of shells that don't set SHELL,
+// like PowerShell, set it when calling tell.
+const ShellEnvVar = "TELL_SHELL"
+
+// NormalizeShell maps the names a shell goes by to the one tell uses, e.g. powershell.exe to pwsh
+// and CMD.EXE to cmd
+func NormalizeShell(shell string) string {
+	switch name := strings.TrimSuffix(strings.ToLower(shell), ".exe"); name {
+	case "pwsh", "powershell":
+		return PowerShell
+	case Cmd:
+		return Cmd
+	default:
+		if name != strings.ToLower(shell) {
+			// Windows program names, e.g. bash.exe from Git for Windows
+			return name
+		}
+		return shell
+	}
+}
+
 // DetectShell attempts to detect the current shell
 func DetectShell() string {
+	// The integration of a shell that doesn't set SHELL names it
+	if shell := os.Getenv(ShellEnvVar); shell != "" {
+		slog.Debug("Detected shell from "+ShellEnvVar, "name", shell)
+		return NormalizeShell(shell)
+	}
+
 	// Check SHELL environment variable
 	shell := os.Getenv("SHELL")
 	if shell != "" {
@@ -19,31 +51,31 @@ func DetectShell() string {
 		slog.Debug("Detected shell from SHELL env var", "path", shell, "name", shellName)
 
 		// Return known shell types
-		switch shellName {
-		case "bash":
-			return "bash"
-		case "zsh":
-			return "zsh"
+		if known := knownShell(shellName); known != "" {
+			return known
 		}
 	}
 
 	// Check parent process name as fallback
 	ppid := os.Getppid()
-	procPath := filepath.Join("/proc", strconv.Itoa(ppid), "comm")
-	if data, err := os.ReadFile(procPath); err == nil {
-		procName := strings.TrimSpace(string(data))
+	if procName := processName(ppid); procName != "" {
 		slog.Debug("Detected shell from parent process", "ppid", ppid, "name", procName)
-		switch procName {
-		case "bash":
-			return "bash"
-		case "zsh":
-			return "zsh"
+		if known := knownShell(procName); known != "" {
+			return known
 		}
-	} else {
-		slog.Debug("Failed to read parent process info", "error", err)
 	}
 
 	slog.Info("Could not detect shell, defaulting to bash")
 	// Default to bash if we can't detect
 	return "bash"
 }
+
+// knownShell returns the name tell uses for a shell it recognizes, or ""
+func knownShell(name string) string {
+	switch shell := NormalizeShell(name); shell {
+	case "bash", "zsh", "fish", PowerShell, Cmd:
+		return shell
+	default:
+		return ""
+	}
+}
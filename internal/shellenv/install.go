@@ -0,0 +1,196 @@
+package shellenv
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Markers around the lines InstallIntegration adds to a shell's startup file, so they can be
+// updated and removed without touching the rest of the file
+const (
+	installBeginMarker = "# >>> tell shell integration >>>"
+	installEndMarker   = "# <<< tell shell integration <<<"
+)
+
+// StartupFile returns the file the shell reads when an interactive session starts, where
+// InstallIntegration sources the integration: ~/.zshrc, ~/.bashrc, fish's config.fish,
+// PowerShell's $PROFILE or ~/.tmux.conf
+func StartupFile(shell string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not determine home directory: %w", err)
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	switch ResolveShell(shell) {
+	case "zsh":
+		if zdotdir := os.Getenv("ZDOTDIR"); zdotdir != "" {
+			return filepath.Join(zdotdir, ".zshrc"), nil
+		}
+		return filepath.Join(home, ".zshrc"), nil
+	case "bash":
+		return filepath.Join(home, ".bashrc"), nil
+	case "fish":
+		return filepath.Join(configHome, "fish", "config.fish"), nil
+	case PowerShell:
+		if runtime.GOOS == "windows" {
+			return filepath.Join(home, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1"), nil
+		}
+		return filepath.Join(configHome, "powershell", "Microsoft.PowerShell_profile.ps1"), nil
+	case Tmux:
+		// tmux 3.1 and later also read the XDG location, used when it exists
+		xdgConf := filepath.Join(configHome, "tmux", "tmux.conf")
+		if _, err := os.Stat(xdgConf); err == nil {
+			return xdgConf, nil
+		}
+		return filepath.Join(home, ".tmux.conf"), nil
+	default:
+		return "", fmt.Errorf("unsupported shell: %s", shell)
+	}
+}
+
+// sourceLine returns the line loading the integration script at path in the shell's startup
+// file. It does nothing when the script is missing, so a removed tell doesn't break the shell.
+func sourceLine(shell string, path string) string {
+	quoted := "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+	switch shell {
+	case "fish":
+		quoted = "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(path) + "'"
+		return "test -f " + quoted + "; and source " + quoted
+	case PowerShell:
+		quoted = "'" + strings.ReplaceAll(path, "'", "''") + "'"
+		return "if (Test-Path " + quoted + ") { . " + quoted + " }"
+	case Tmux:
+		return "source-file -q " + quoted
+	default:
+		return "[ -f " + quoted + " ] && source " + quoted
+	}
+}
+
+// InstallIntegration writes the integration script for the shell to ScriptPath and sources it
+// from the shell's startup file, between markers. Installing again rewrites the script and
+// replaces the marked lines, so the startup file never sources it twice. Returns the startup
+// file.
+func InstallIntegration(shell string, opts Options) (string, error) {
+	shell = ResolveShell(shell)
+
+	startupFile, err := StartupFile(shell)
+	if err != nil {
+		return "", err
+	}
+
+	scriptPath, err := WriteIntegrationScript(shell, opts)
+	if err != nil {
+		return "", err
+	}
+
+	content, mode, err := readStartupFile(startupFile)
+	if err != nil {
+		return "", err
+	}
+
+	block := installBeginMarker + "\n" + sourceLine(shell, scriptPath) + "\n" + installEndMarker + "\n"
+	if before, after, found := cutInstallBlock(content); found {
+		// Keep the block where it was, its position may matter to the user
+		content = before + block + after
+	} else {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if content != "" {
+			content += "\n"
+		}
+		content += block
+	}
+
+	if err := os.MkdirAll(filepath.Dir(startupFile), 0755); err != nil {
+		return "", fmt.Errorf("could not create directory for %s: %w", startupFile, err)
+	}
+	if err := os.WriteFile(startupFile, []byte(content), mode); err != nil {
+		return "", fmt.Errorf("could not write %s: %w", startupFile, err)
+	}
+
+	return startupFile, nil
+}
+
+// UninstallIntegration removes the lines InstallIntegration added to the shell's startup file
+// and the integration script. Returns the startup file, and whether it had the lines.
+func UninstallIntegration(shell string) (string, bool, error) {
+	shell = ResolveShell(shell)
+
+	startupFile, err := StartupFile(shell)
+	if err != nil {
+		return "", false, err
+	}
+
+	content, mode, err := readStartupFile(startupFile)
+	if err != nil {
+		return "", false, err
+	}
+
+	before, after, found := cutInstallBlock(content)
+	if found {
+		// Also drop the blank line installing added before the block
+		if strings.HasSuffix(before, "\n\n") {
+			before = before[:len(before)-1]
+		}
+		if err := os.WriteFile(startupFile, []byte(before+after), mode); err != nil {
+			return "", false, fmt.Errorf("could not write %s: %w", startupFile, err)
+		}
+	}
+
+	scriptPath, err := ScriptPath(shell)
+	if err != nil {
+		return "", false, err
+	}
+	if err := os.Remove(scriptPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", false, fmt.Errorf("could not remove integration script: %w", err)
+	}
+
+	return startupFile, found, nil
+}
+
+// readStartupFile returns the content and permissions of a startup file, empty with the usual
+// permissions when it doesn't exist yet
+func readStartupFile(path string) (string, fs.FileMode, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", 0644, nil
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	return string(data), mode, nil
+}
+
+// cutInstallBlock returns content before and after the marked lines, and whether it has them.
+// A begin marker without an end marker is left alone rather than cutting the file short.
+func cutInstallBlock(content string) (string, string, bool) {
+	start := strings.Index(content, installBeginMarker)
+	if start < 0 {
+		return content, "", false
+	}
+	end := strings.Index(content[start:], installEndMarker)
+	if end < 0 {
+		return content, "", false
+	}
+	end += start + len(installEndMarker)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+
+	return content[:start], content[end:], true
+}
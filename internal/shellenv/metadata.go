@@ -0,0 +1,134 @@
+package shellenv
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jonfk/tell/internal/xdg"
+)
+
+// Metadata describes a shell integration script so installers and dotfile
+// managers can manage it without parsing the script
+type Metadata struct {
+	Shell   string `json:"shell"`
+	Version string `json:"version"`
+	// Functions are the shell functions defined by the script
+	Functions []string `json:"functions"`
+	// RequiredBinaries must be on PATH for the functions to work
+	RequiredBinaries []string `json:"required_binaries"`
+	// SuggestedKeybindings are not bound by the script itself
+	SuggestedKeybindings []Keybinding `json:"suggested_keybindings"`
+	// ScriptPath is where --print-path writes the script
+	ScriptPath string `json:"script_path"`
+}
+
+// Keybinding is a key sequence bound to a function of the integration
+type Keybinding struct {
+	Key      string `json:"key"`
+	Function string `json:"function"`
+	// Command is the line to add to the shell rc file to set up the binding
+	Command string `json:"command"`
+}
+
+// ResolveShell returns the shell to generate an integration for, detecting it for "auto"
+func ResolveShell(shell string) string {
+	if shell == "auto" {
+		return DetectShell()
+	}
+	return NormalizeShell(shell)
+}
+
+// IntegrationMetadata describes the integration script for the specified shell
+func IntegrationMetadata(shell string, version string, opts Options) (*Metadata, error) {
+	shell = ResolveShell(shell)
+
+	scriptPath, err := ScriptPath(shell)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &Metadata{
+		Shell:            shell,
+		Version:          version,
+		RequiredBinaries: []string{"tell"},
+		ScriptPath:       scriptPath,
+	}
+
+	switch shell {
+	case "zsh":
+		metadata.Functions = []string{opts.FunctionName, "tell-complete-prompt", "tell-prompt", "tell-history", "tellfix"}
+		metadata.SuggestedKeybindings = []Keybinding{
+			{Key: "^X^R", Function: "tell-complete-prompt", Command: "bindkey '^X^R' tell-complete-prompt"},
+			{Key: "^X^T", Function: "tell-prompt", Command: "bindkey '^X^T' tell-prompt"},
+			{Key: "^X^H", Function: "tell-history", Command: "bindkey '^X^H' tell-history"},
+		}
+	case "bash":
+		metadata.Functions = []string{opts.FunctionName, "_tell_complete_prompt", "_tell_prompt", "_tell_history", "tellfix"}
+		metadata.SuggestedKeybindings = []Keybinding{
+			{Key: `\C-x\C-r`, Function: "_tell_complete_prompt", Command: `bind -x '"\C-x\C-r": _tell_complete_prompt'`},
+			{Key: `\C-x\C-t`, Function: "_tell_prompt", Command: `bind -x '"\C-x\C-t": _tell_prompt'`},
+			{Key: `\C-x\C-h`, Function: "_tell_history", Command: `bind -x '"\C-x\C-h": _tell_history'`},
+		}
+	case "fish":
+		metadata.Functions = []string{opts.FunctionName, "tell-complete-prompt", "tell-prompt", "tell-history", "tellfix"}
+		metadata.SuggestedKeybindings = []Keybinding{
+			{Key: `\cx\cr`, Function: "tell-complete-prompt", Command: `bind \cx\cr tell-complete-prompt`},
+			{Key: `\cx\ct`, Function: "tell-prompt", Command: `bind \cx\ct tell-prompt`},
+			{Key: `\cx\ch`, Function: "tell-history", Command: `bind \cx\ch tell-history`},
+		}
+	case PowerShell:
+		metadata.Functions = []string{opts.FunctionName, "TellCompletePrompt", "TellPrompt", "tellfix"}
+		metadata.SuggestedKeybindings = []Keybinding{
+			{Key: "Ctrl+x,Ctrl+r", Function: "TellCompletePrompt", Command: "Set-PSReadLineKeyHandler -Chord 'Ctrl+x,Ctrl+r' -ScriptBlock { TellCompletePrompt }"},
+			{Key: "Ctrl+x,Ctrl+t", Function: "TellPrompt", Command: "Set-PSReadLineKeyHandler -Chord 'Ctrl+x,Ctrl+t' -ScriptBlock { TellPrompt }"},
+		}
+	case Tmux:
+		// The snippet binds its key itself and defines no functions
+		metadata.Functions = []string{}
+		metadata.RequiredBinaries = []string{"tell", "tmux"}
+		metadata.SuggestedKeybindings = []Keybinding{}
+	default:
+		return nil, fmt.Errorf("unsupported shell: %s", shell)
+	}
+
+	return metadata, nil
+}
+
+// ScriptPath returns where the integration script for the shell is written,
+// $XDG_DATA_HOME/tell-llm/tell.<shell>, or tell.ps1 for PowerShell, which only dot-sources
+// files with that extension
+func ScriptPath(shell string) (string, error) {
+	dataDir, err := xdg.DataDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get data directory: %w", err)
+	}
+
+	extension := ResolveShell(shell)
+	if extension == PowerShell {
+		extension = "ps1"
+	}
+	return filepath.Join(dataDir, "tell."+extension), nil
+}
+
+// WriteIntegrationScript writes the integration script for the shell to ScriptPath
+// and returns the path, so shell rc files can source a file kept up to date by tell
+func WriteIntegrationScript(shell string, opts Options) (string, error) {
+	shell = ResolveShell(shell)
+
+	script, err := GenerateIntegrationScript(shell, opts)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := ScriptPath(shell)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(path, []byte(script+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("could not write integration script: %w", err)
+	}
+
+	return path, nil
+}
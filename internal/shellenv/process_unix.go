@@ -0,0 +1,30 @@
+//go:build !windows
+
+package shellenv
+
+import (
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// processName returns the program name of a process, or "" when it can't be found. Linux has
+// it in /proc; macOS and the BSDs have no /proc, so ps is asked instead.
+func processName(pid int) string {
+	if data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm")); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		slog.Debug("Failed to read parent process info", "pid", pid, "error", err)
+		return ""
+	}
+
+	// macOS prints the path of the program, and login shells start with a dash, e.g. -zsh
+	name := filepath.Base(strings.TrimSpace(string(out)))
+	return strings.TrimPrefix(name, "-")
+}
@@ -0,0 +1,29 @@
+package shellenv
+
+import (
+	"log/slog"
+	"syscall"
+	"unsafe"
+)
+
+// processName returns the program name of a process, e.g. pwsh.exe or cmd.exe, or "" when it
+// can't be found. Windows lists processes in a snapshot instead of /proc.
+func processName(pid int) string {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		slog.Debug("Failed to list processes", "error", err)
+		return ""
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		if int(entry.ProcessID) == pid {
+			return syscall.UTF16ToString(entry.ExeFile[:])
+		}
+	}
+
+	slog.Debug("Parent process not found", "pid", pid)
+	return ""
+}
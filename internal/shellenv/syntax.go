@@ -0,0 +1,85 @@
+package shellenv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// syntaxCheckTimeout bounds how long the shell may take to parse a command
+const syntaxCheckTimeout = 2 * time.Second
+
+// syntaxCheckArgs are the arguments that make each shell parse a command without running it
+var syntaxCheckArgs = map[string][]string{
+	"bash": {"-n", "-c"},
+	"zsh":  {"-n", "-c"},
+	"sh":   {"-n", "-c"},
+	"dash": {"-n", "-c"},
+	"fish": {"--no-execute", "-c"},
+}
+
+// SyntaxError is returned for a command the shell's parser rejects
+type SyntaxError struct {
+	Shell string
+	// Message is the parser's error output
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Shell + " syntax error: " + e.Message
+}
+
+// PosixShell returns the shell that checks commands meant for POSIX sh: dash when installed,
+// since it rejects most bashisms, otherwise sh, which may be bash in POSIX mode
+func PosixShell() string {
+	if _, err := exec.LookPath("dash"); err == nil {
+		return "dash"
+	}
+	return "sh"
+}
+
+// CheckSyntax parses command with shell without running it (bash -n, zsh -n, fish --no-execute)
+// and returns a *SyntaxError when the parser rejects it. Commands are assumed valid when the
+// shell isn't one tell knows, isn't installed or takes too long to parse.
+func CheckSyntax(shell string, command string) error {
+	args, ok := syntaxCheckArgs[shell]
+	if !ok {
+		return nil
+	}
+	path, err := exec.LookPath(shell)
+	if err != nil {
+		slog.Debug("Shell not installed, skipping syntax check", "shell", shell)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), syntaxCheckTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, append(args, command)...)
+	cmd.Args[0] = shell
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	if err == nil || ctx.Err() != nil || !errors.As(err, &exitErr) {
+		if err != nil {
+			slog.Debug("Could not check syntax", "shell", shell, "error", err)
+		}
+		return nil
+	}
+
+	// bash prefixes its errors with "bash: -c: " and dash with "dash: 1: ", which say nothing
+	// about the command
+	message := strings.TrimSpace(stderr.String())
+	message = strings.TrimPrefix(message, shell+": -c: ")
+	message = strings.TrimPrefix(message, shell+": 1: ")
+	if message == "" {
+		message = exitErr.Error()
+	}
+	return &SyntaxError{Shell: shell, Message: message}
+}
@@ -1,21 +1,31 @@
 package storage
 
 import (
+	"crypto/cipher"
 	"database/sql"
 	"fmt"
 	"log/slog"
-	"os"
 	"path/filepath"
 
+	"github.com/jonfk/tell/internal/xdg"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // DB handles database operations
 type DB struct {
 	conn *sql.DB
+	// fullText is set when SQLite has FTS5 and history is searched with ftsSchema
+	fullText bool
+	// encrypt and key are set with SetEncryption
+	encrypt bool
+	key     KeyFunc
+	// aead encrypts and decrypts the text of history entries while history is encrypted
+	aead cipher.AEAD
+	// nonceKey derives the nonces of values encrypted for 'tell sync' from the values
+	nonceKey []byte
 }
 
-// schema is the SQLite database schema
+// schema is the initial SQLite database schema, migration 1. Later changes are in migrations.
 const schema = `
 -- Schema for tell command history
 CREATE TABLE IF NOT EXISTS command_history (
@@ -39,28 +49,134 @@ CREATE INDEX IF NOT EXISTS idx_command_history_prompt ON command_history(prompt)
 CREATE INDEX IF NOT EXISTS idx_command_history_command ON command_history(command);
 CREATE INDEX IF NOT EXISTS idx_command_history_timestamp ON command_history(timestamp);
 CREATE INDEX IF NOT EXISTS idx_command_history_parent_id ON command_history(parent_id);
+-- Workspaces the user allowed (or refused) to collect context from
+CREATE TABLE IF NOT EXISTS workspace_trust (
+    path TEXT PRIMARY KEY,          -- Absolute path of the workspace root
+    trusted BOOLEAN NOT NULL,       -- Whether context may be collected from it
+    decided_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+-- Named conversations, whose entries are linked with command_history.session_id
+CREATE TABLE IF NOT EXISTS sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    active BOOLEAN NOT NULL DEFAULT 0 -- The session prompts are made in, at most one
+);
+-- Embeddings of history entries for semantic search
+CREATE TABLE IF NOT EXISTS history_embeddings (
+    entry_id INTEGER NOT NULL REFERENCES command_history(id),
+    model TEXT NOT NULL,            -- Provider and model the vector was computed with
+    vector BLOB NOT NULL,           -- Little-endian float32 values
+    PRIMARY KEY (entry_id, model)
+);
+-- Embeddings go with their entry, and are computed again when its text changes
+CREATE TRIGGER IF NOT EXISTS history_embeddings_delete AFTER DELETE ON command_history BEGIN
+    DELETE FROM history_embeddings WHERE entry_id = old.id;
+END;
+-- Tags organizing history entries by topic
+CREATE TABLE IF NOT EXISTS history_tags (
+    entry_id INTEGER NOT NULL REFERENCES command_history(id),
+    tag TEXT NOT NULL,
+    PRIMARY KEY (entry_id, tag)
+);
+CREATE INDEX IF NOT EXISTS idx_history_tags_tag ON history_tags(tag);
+CREATE TRIGGER IF NOT EXISTS history_tags_delete AFTER DELETE ON command_history BEGIN
+    DELETE FROM history_tags WHERE entry_id = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS history_embeddings_update AFTER UPDATE OF prompt, command, details ON command_history BEGIN
+    DELETE FROM history_embeddings WHERE entry_id = old.id;
+END;
+`
+
+// foreignKeySchema prepares the history for foreign keys, which were declared but not enforced
+// before. Changing what a foreign key does on delete means rebuilding its table in SQLite, so a
+// trigger does what ON DELETE SET NULL would for continuations of deleted entries.
+const foreignKeySchema = `
+CREATE TRIGGER IF NOT EXISTS command_history_orphan BEFORE DELETE ON command_history BEGIN
+    UPDATE command_history SET parent_id = NULL WHERE parent_id = old.id;
+END;
+-- Entries deleted while foreign keys weren't enforced left references to them behind
+UPDATE command_history SET parent_id = NULL
+WHERE parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM command_history);
+DELETE FROM history_embeddings WHERE entry_id NOT IN (SELECT id FROM command_history);
+DELETE FROM history_tags WHERE entry_id NOT IN (SELECT id FROM command_history);
+`
+
+// ftsSchema indexes the prompt, command and details of history entries for full-text search.
+// The index has no copy of the text, it reads command_history, and is kept in sync by triggers.
+// go-sqlite3 only has FTS5 when built with the sqlite_fts5 tag.
+const ftsSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS command_history_fts USING fts5(
+    prompt, command, details,
+    content='command_history', content_rowid='id'
+);
+CREATE TRIGGER IF NOT EXISTS command_history_fts_insert AFTER INSERT ON command_history BEGIN
+    INSERT INTO command_history_fts(rowid, prompt, command, details)
+    VALUES (new.id, new.prompt, new.command, new.details);
+END;
+CREATE TRIGGER IF NOT EXISTS command_history_fts_delete AFTER DELETE ON command_history BEGIN
+    INSERT INTO command_history_fts(command_history_fts, rowid, prompt, command, details)
+    VALUES ('delete', old.id, old.prompt, old.command, old.details);
+END;
+CREATE TRIGGER IF NOT EXISTS command_history_fts_update AFTER UPDATE OF prompt, command, details ON command_history BEGIN
+    INSERT INTO command_history_fts(command_history_fts, rowid, prompt, command, details)
+    VALUES ('delete', old.id, old.prompt, old.command, old.details);
+    INSERT INTO command_history_fts(rowid, prompt, command, details)
+    VALUES (new.id, new.prompt, new.command, new.details);
+END;
+`
+
+// syncSchema gives every history entry a globally unique ID, and records when entries change and
+// are deleted, for 'tell sync'. It is applied by migration 13, along with the columns it uses.
+const syncSchema = `
+CREATE UNIQUE INDEX IF NOT EXISTS idx_command_history_uid ON command_history(uid);
+-- Entries made before there were UIDs get one
+UPDATE command_history SET uid = lower(hex(randomblob(16))) WHERE uid IS NULL;
+CREATE TRIGGER IF NOT EXISTS command_history_uid AFTER INSERT ON command_history WHEN new.uid IS NULL BEGIN
+    UPDATE command_history SET uid = lower(hex(randomblob(16))) WHERE id = new.id;
+END;
+-- Changes of fields set after the entry was made, unless the update sets updated_at itself
+CREATE TRIGGER IF NOT EXISTS command_history_touch AFTER UPDATE OF
+    favorite, shortcut, exit_code, executed_at, duration_ms, output, timed_out, outcome, ran_command
+ON command_history WHEN new.updated_at IS old.updated_at BEGIN
+    UPDATE command_history SET updated_at = CURRENT_TIMESTAMP WHERE id = new.id;
+END;
+CREATE TRIGGER IF NOT EXISTS history_tags_touch_insert AFTER INSERT ON history_tags BEGIN
+    UPDATE command_history SET updated_at = CURRENT_TIMESTAMP WHERE id = new.entry_id;
+END;
+CREATE TRIGGER IF NOT EXISTS history_tags_touch_delete AFTER DELETE ON history_tags BEGIN
+    UPDATE command_history SET updated_at = CURRENT_TIMESTAMP WHERE id = old.entry_id;
+END;
+-- Deleted entries, so they are deleted on the other machines too instead of synced back
+CREATE TABLE IF NOT EXISTS history_deletions (
+    uid TEXT PRIMARY KEY,
+    deleted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TRIGGER IF NOT EXISTS history_deletions_record AFTER DELETE ON command_history WHEN old.uid IS NOT NULL BEGIN
+    INSERT OR IGNORE INTO history_deletions (uid) VALUES (old.uid);
+END;
+`
+
+// editSchema has edits of the command and details of entries, and whether they were edited,
+// count as changes for 'tell history edit' to sync
+const editSchema = `
+DROP TRIGGER IF EXISTS command_history_touch;
+CREATE TRIGGER IF NOT EXISTS command_history_touch AFTER UPDATE OF
+    favorite, shortcut, exit_code, executed_at, duration_ms, output, timed_out, outcome, ran_command,
+    command, details, edited
+ON command_history WHEN new.updated_at IS old.updated_at BEGIN
+    UPDATE command_history SET updated_at = CURRENT_TIMESTAMP WHERE id = new.id;
+END;
 `
 
 // GetDBPath returns the path to the SQLite database file
 func GetDBPath() (string, error) {
-	// Try XDG_DATA_HOME first
-	dataDir := os.Getenv("XDG_DATA_HOME")
-	if dataDir == "" {
-		// Fall back to HOME/.local/share
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("could not determine home directory: %w", err)
-		}
-		dataDir = filepath.Join(home, ".local", "share")
-	}
-
-	// Ensure the directory exists
-	tellDataDir := filepath.Join(dataDir, "tell-llm")
-	if err := os.MkdirAll(tellDataDir, 0755); err != nil {
-		return "", fmt.Errorf("could not create data directory: %w", err)
+	dataDir, err := xdg.DataDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get data directory: %w", err)
 	}
 
-	return filepath.Join(tellDataDir, "tell.db"), nil
+	return filepath.Join(dataDir, "tell.db"), nil
 }
 
 // NewDB creates a new database connection
@@ -70,8 +186,18 @@ func NewDB() (*DB, error) {
 		return nil, fmt.Errorf("could not get database path: %w", err)
 	}
 
+	return OpenAt(dbPath)
+}
+
+// OpenAt creates a connection to the database at dbPath instead of the default location
+func OpenAt(dbPath string) (*DB, error) {
+	// WAL lets tell read the history while another tell writes it, busy_timeout has writers wait
+	// for each other instead of failing with "database is locked", and foreign keys keep
+	// references to entries valid. go-sqlite3 sets them on every connection it opens.
+	dsn := dbPath + "?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on"
+
 	slog.Debug("Opening database", "path", dbPath)
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("could not open database: %w", err)
 	}
@@ -88,13 +214,108 @@ func NewDB() (*DB, error) {
 // InitSchema initializes the database schema
 func (db *DB) InitSchema() error {
 	slog.Debug("Initializing database schema")
-	_, err := db.conn.Exec(schema)
+	if err := db.migrate(); err != nil {
+		return err
+	}
+
+	// Encryption and the full-text index follow the config and the build, so they are checked
+	// every time instead of migrated once
+	if err := db.initEncryption(); err != nil {
+		return fmt.Errorf("could not initialize history encryption: %w", err)
+	}
+
+	// Encrypted history is searched by decrypting it instead
+	if db.aead == nil {
+		if err := db.initFullText(); err != nil {
+			return fmt.Errorf("could not initialize full-text search: %w", err)
+		}
+	}
+	return nil
+}
+
+// initFullText creates the full-text index of the history, indexing the existing entries when
+// the triggers keeping it in sync are new. Without FTS5 in SQLite, history is searched with LIKE
+// instead, and triggers left by a build with FTS5 are dropped since they would make every
+// change to the history fail.
+func (db *DB) initFullText() error {
+	hasFTS5, err := db.hasFTS5()
+	if err != nil {
+		return err
+	}
+	if !hasFTS5 {
+		slog.Debug("SQLite has no FTS5, searching history with LIKE")
+		return db.dropFullTextTriggers()
+	}
+
+	var synced int
+	err = db.conn.QueryRow("SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'command_history_fts_insert'").Scan(&synced)
 	if err != nil {
-		return fmt.Errorf("could not initialize schema: %w", err)
+		return fmt.Errorf("could not check for full-text index: %w", err)
+	}
+
+	if _, err := db.conn.Exec(ftsSchema); err != nil {
+		return err
+	}
+	db.fullText = true
+
+	if synced == 0 {
+		slog.Debug("Indexing history for full-text search")
+		if _, err := db.conn.Exec("INSERT INTO command_history_fts(command_history_fts) VALUES ('rebuild')"); err != nil {
+			return fmt.Errorf("could not index history: %w", err)
+		}
+	}
+	return nil
+}
+
+// hasFTS5 reports whether SQLite was built with FTS5
+func (db *DB) hasFTS5() (bool, error) {
+	var hasFTS5 bool
+	if err := db.conn.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&hasFTS5); err != nil {
+		return false, fmt.Errorf("could not check for FTS5: %w", err)
+	}
+	return hasFTS5, nil
+}
+
+// dropFullTextTriggers drops the triggers keeping the full-text index in sync
+func (db *DB) dropFullTextTriggers() error {
+	for _, trigger := range []string{"command_history_fts_insert", "command_history_fts_delete", "command_history_fts_update"} {
+		if _, err := db.conn.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+			return fmt.Errorf("could not drop trigger %s: %w", trigger, err)
+		}
 	}
 	return nil
 }
 
+// dropFullText drops the full-text index and its triggers, and reports whether there was an
+// index. Without FTS5 SQLite can't drop the index, which is left as it is.
+func (db *DB) dropFullText() (bool, error) {
+	if err := db.dropFullTextTriggers(); err != nil {
+		return false, err
+	}
+
+	var exists int
+	if err := db.conn.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = 'command_history_fts'").Scan(&exists); err != nil {
+		return false, fmt.Errorf("could not check for full-text index: %w", err)
+	}
+	if exists == 0 {
+		return false, nil
+	}
+
+	hasFTS5, err := db.hasFTS5()
+	if err != nil {
+		return false, err
+	}
+	if !hasFTS5 {
+		slog.Warn("SQLite has no FTS5 to drop the full-text index of the history, which keeps the words of entries made before encryption")
+		return false, nil
+	}
+
+	if _, err := db.conn.Exec("DROP TABLE command_history_fts"); err != nil {
+		return false, fmt.Errorf("could not drop full-text index: %w", err)
+	}
+	return true, nil
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	if db.conn != nil {
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// GetUnembeddedEntries returns up to limit history entries, oldest first, that have no embedding
+// computed with the named embedding model
+func (db *DB) GetUnembeddedEntries(embeddingModel string, limit int) ([]model.HistoryEntry, error) {
+	query := `
+		SELECT ` + historyColumns + `
+		FROM command_history
+		WHERE NOT EXISTS (
+			SELECT 1 FROM history_embeddings
+			WHERE history_embeddings.entry_id = command_history.id AND history_embeddings.model = ?
+		)
+		ORDER BY id
+		LIMIT ?
+	`
+
+	rows, err := db.conn.Query(query, embeddingModel, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not get entries without embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.HistoryEntry
+	for rows.Next() {
+		entry, err := db.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// SaveEmbedding stores the embedding of a history entry computed with the named embedding model
+func (db *DB) SaveEmbedding(entryID int64, embeddingModel string, vector []float32) error {
+	query := `
+		INSERT INTO history_embeddings (entry_id, model, vector) VALUES (?, ?, ?)
+		ON CONFLICT(entry_id, model) DO UPDATE SET vector = excluded.vector
+	`
+
+	if _, err := db.conn.Exec(query, entryID, embeddingModel, encodeVector(vector)); err != nil {
+		return fmt.Errorf("could not save embedding: %w", err)
+	}
+
+	return nil
+}
+
+// SemanticSearch returns up to limit history entries whose embedding is closest in meaning to
+// the query's, computed with the same embedding model, most similar first. An empty entryType
+// searches entries of every type, an empty tag entries with any tags.
+func (db *DB) SemanticSearch(queryVector []float32, embeddingModel string, limit int, entryType string, tag string) ([]model.HistoryEntry, error) {
+	query := `
+		SELECT history_embeddings.entry_id, history_embeddings.vector
+		FROM history_embeddings
+		JOIN command_history ON command_history.id = history_embeddings.entry_id
+		WHERE history_embeddings.model = ?
+		AND (? = '' OR command_history.entry_type = ?)
+		AND (? = '' OR command_history.id IN (SELECT entry_id FROM history_tags WHERE tag = ?))
+	`
+
+	rows, err := db.conn.Query(query, embeddingModel, entryType, entryType, tag, tag)
+	if err != nil {
+		return nil, fmt.Errorf("could not read embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	// Vectors are compared in Go, SQLite has no vector functions
+	type match struct {
+		id         int64
+		similarity float64
+	}
+	var matches []match
+	for rows.Next() {
+		var id int64
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		vector := decodeVector(blob)
+		if len(vector) != len(queryVector) {
+			continue
+		}
+		matches = append(matches, match{id: id, similarity: cosineSimilarity(queryVector, vector)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	rows.Close()
+
+	// Newer entries win ties
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].similarity != matches[j].similarity {
+			return matches[i].similarity > matches[j].similarity
+		}
+		return matches[i].id > matches[j].id
+	})
+	if limit >= 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	var entries []model.HistoryEntry
+	for _, m := range matches {
+		entry, err := db.GetHistoryEntry(m.id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+
+	return entries, nil
+}
+
+// encodeVector stores a vector as little-endian float32 values
+func encodeVector(vector []float32) []byte {
+	blob := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(blob[4*i:], math.Float32bits(v))
+	}
+	return blob
+}
+
+// decodeVector reads a vector stored by encodeVector
+func decodeVector(blob []byte) []float32 {
+	vector := make([]float32, len(blob)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+	}
+	return vector
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors of the same length, 0
+// when either is all zeros
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
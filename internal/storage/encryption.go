@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// encryptedPrefix starts encrypted values, followed by the base64 of the nonce and ciphertext
+const encryptedPrefix = "tell-encrypted:v1:"
+
+// encryptedColumns are the columns of command_history holding what was asked and generated,
+// encrypted while history encryption is on
+var encryptedColumns = []string{"prompt", "command", "details", "undo", "output", "ran_command"}
+
+// KeyFunc returns the 32 byte key history is encrypted with, creating it when create is set
+type KeyFunc func(create bool) ([]byte, error)
+
+// SetEncryption has InitSchema encrypt the text of history entries with the key from key when
+// encrypt is set, and decrypt the entries encrypted before otherwise
+func (db *DB) SetEncryption(encrypt bool, key KeyFunc) {
+	db.encrypt = encrypt
+	db.key = key
+}
+
+// initEncryption encrypts the entries that aren't when history encryption is on, and decrypts
+// those that are when it is off. The full-text index holds the words of every entry, so it is
+// dropped while history is encrypted, and built again once it isn't.
+func (db *DB) initEncryption() error {
+	if db.encrypt {
+		key, err := db.key(true)
+		if err != nil {
+			return fmt.Errorf("could not get history encryption key: %w", err)
+		}
+		if db.aead, err = newAEAD(key); err != nil {
+			return err
+		}
+		db.nonceKey = deriveNonceKey(key)
+		if err := db.checkKey(); err != nil {
+			return err
+		}
+
+		dropped, err := db.dropFullText()
+		if err != nil {
+			return err
+		}
+		encrypted, err := db.rewriteEntries(true)
+		if err != nil {
+			return err
+		}
+
+		// The plain text stays in free pages of the database file until it is rebuilt
+		if dropped || encrypted > 0 {
+			slog.Debug("Encrypted history", "entries", encrypted)
+			if _, err := db.conn.Exec("VACUUM"); err != nil {
+				return fmt.Errorf("could not rebuild database: %w", err)
+			}
+		}
+		return nil
+	}
+
+	var encrypted int
+	if err := db.conn.QueryRow("SELECT count(*) FROM command_history WHERE " + encryptedCondition(true)).Scan(&encrypted); err != nil {
+		return fmt.Errorf("could not check for encrypted history: %w", err)
+	}
+	if encrypted == 0 {
+		return nil
+	}
+	if db.key == nil {
+		return errors.New("history is encrypted, but there is no key to decrypt it")
+	}
+
+	key, err := db.key(false)
+	if err != nil {
+		return fmt.Errorf("could not get history encryption key: %w", err)
+	}
+	if db.aead, err = newAEAD(key); err != nil {
+		return err
+	}
+	decrypted, err := db.rewriteEntries(false)
+	if err != nil {
+		return err
+	}
+	slog.Debug("Decrypted history", "entries", decrypted)
+
+	db.aead = nil
+	return nil
+}
+
+// checkKey makes sure the key is the one history was encrypted with, by decrypting an entry
+func (db *DB) checkKey() error {
+	var id int64
+	var prompt string
+	err := db.conn.QueryRow(fmt.Sprintf("SELECT id, prompt FROM command_history WHERE substr(prompt, 1, %d) = '%s' LIMIT 1", len(encryptedPrefix), encryptedPrefix)).Scan(&id, &prompt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read history: %w", err)
+	}
+	if err := db.open(&prompt); err != nil {
+		return fmt.Errorf("history entry %d: %w", id, err)
+	}
+	return nil
+}
+
+// newAEAD returns AES-256-GCM with key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("history encryption key must be 32 bytes, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveNonceKey derives the key the nonces of synced values are made with from the history key,
+// so the two are never used for the same thing
+func deriveNonceKey(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("tell sync nonce"))
+	return mac.Sum(nil)
+}
+
+// encryptedCondition is an SQL condition matching entries with encrypted values, or with values
+// that aren't encrypted yet when encrypted is false. Empty values are never encrypted.
+func encryptedCondition(encrypted bool) string {
+	var conditions []string
+	for _, column := range encryptedColumns {
+		if encrypted {
+			conditions = append(conditions, fmt.Sprintf("substr(%s, 1, %d) = '%s'", column, len(encryptedPrefix), encryptedPrefix))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%s != '' AND substr(%s, 1, %d) != '%s')", column, column, len(encryptedPrefix), encryptedPrefix))
+		}
+	}
+	return strings.Join(conditions, " OR ")
+}
+
+// rewriteEntries encrypts the values of encryptedColumns that aren't encrypted when encrypt is
+// set, or decrypts those that are otherwise, and returns the number of entries changed. When
+// the entries last changed is kept, so 'tell sync' doesn't take this for a change.
+func (db *DB) rewriteEntries(encrypt bool) (int, error) {
+	query := fmt.Sprintf("SELECT id, %s, updated_at FROM command_history WHERE %s",
+		strings.Join(encryptedColumns, ", "), encryptedCondition(!encrypt))
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("could not read history: %w", err)
+	}
+	defer rows.Close()
+
+	type rewrite struct {
+		id        int64
+		values    []sql.NullString
+		updatedAt sql.NullString
+	}
+	var rewrites []rewrite
+	for rows.Next() {
+		r := rewrite{values: make([]sql.NullString, len(encryptedColumns))}
+		dest := []any{&r.id}
+		for i := range r.values {
+			dest = append(dest, &r.values[i])
+		}
+		dest = append(dest, &r.updatedAt)
+		if err := rows.Scan(dest...); err != nil {
+			return 0, fmt.Errorf("could not scan row: %w", err)
+		}
+		rewrites = append(rewrites, r)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating rows: %w", err)
+	}
+	rows.Close()
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var assignments []string
+	for _, column := range encryptedColumns {
+		assignments = append(assignments, column+" = ?")
+	}
+	update := fmt.Sprintf("UPDATE command_history SET %s WHERE id = ?", strings.Join(assignments, ", "))
+
+	for _, r := range rewrites {
+		var args []any
+		for i := range r.values {
+			var err error
+			if encrypt {
+				err = db.seal(&r.values[i].String)
+			} else {
+				err = db.open(&r.values[i].String)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("history entry %d: %w", r.id, err)
+			}
+			args = append(args, r.values[i])
+		}
+		if _, err := tx.Exec(update, append(args, r.id)...); err != nil {
+			return 0, fmt.Errorf("could not update history entry %d: %w", r.id, err)
+		}
+		if _, err := tx.Exec("UPDATE command_history SET updated_at = ? WHERE id = ?", r.updatedAt, r.id); err != nil {
+			return 0, fmt.Errorf("could not update history entry %d: %w", r.id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit transaction: %w", err)
+	}
+	return len(rewrites), nil
+}
+
+// seal encrypts the values in place when history is encrypted. Empty values stay empty, so
+// queries can still tell entries without a command apart.
+func (db *DB) seal(values ...*string) error {
+	return db.sealWith(func(value string) ([]byte, error) {
+		nonce := make([]byte, db.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("could not encrypt: %w", err)
+		}
+		return nonce, nil
+	}, values...)
+}
+
+// sealWith encrypts the values in place like seal, with the nonce newNonce returns for each value
+func (db *DB) sealWith(newNonce func(value string) ([]byte, error), values ...*string) error {
+	if db.aead == nil {
+		return nil
+	}
+	for _, value := range values {
+		if *value == "" || strings.HasPrefix(*value, encryptedPrefix) {
+			continue
+		}
+		nonce, err := newNonce(*value)
+		if err != nil {
+			return err
+		}
+		sealed := db.aead.Seal(nonce, nonce, []byte(*value), nil)
+		*value = encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+	}
+	return nil
+}
+
+// SealSynced encrypts the text of entry for the files 'tell sync' writes when history is
+// encrypted, as it is in the database. The nonce of each value is derived from it, so writing
+// an unchanged history again writes the same file; only values that are the same can be told
+// apart.
+func (db *DB) SealSynced(entry *model.HistoryEntry) error {
+	return db.sealWith(func(value string) ([]byte, error) {
+		mac := hmac.New(sha256.New, db.nonceKey)
+		mac.Write([]byte(value))
+		return mac.Sum(nil)[:db.aead.NonceSize()], nil
+	}, &entry.Prompt, &entry.Command, &entry.Details, &entry.Undo, &entry.Output.String, &entry.RanCommand)
+}
+
+// OpenSynced decrypts the text of an entry from a file 'tell sync' wrote, which needs history
+// encryption on with the key of the machine that wrote it
+func (db *DB) OpenSynced(entry *model.HistoryEntry) error {
+	return db.open(&entry.Prompt, &entry.Command, &entry.Details, &entry.Undo, &entry.Output.String, &entry.RanCommand)
+}
+
+// open decrypts the encrypted values in place
+func (db *DB) open(values ...*string) error {
+	for _, value := range values {
+		if !strings.HasPrefix(*value, encryptedPrefix) {
+			continue
+		}
+		if db.aead == nil {
+			return errors.New("value is encrypted, but history encryption is off")
+		}
+
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(*value, encryptedPrefix))
+		if err != nil || len(sealed) < db.aead.NonceSize() {
+			return errors.New("could not decrypt: malformed value")
+		}
+		nonce, ciphertext := sealed[:db.aead.NonceSize()], sealed[db.aead.NonceSize():]
+		plain, err := db.aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return errors.New("could not decrypt, the key isn't the one history was encrypted with")
+		}
+		*value = string(plain)
+	}
+	return nil
+}
+
+// filterEntries runs query, selecting historyColumns, newest first, and returns up to limit of
+// the entries keep returns true for, after skipping offset of them. Encrypted entries are
+// searched this way, since SQLite only sees their ciphertext.
+func (db *DB) filterEntries(query string, params []any, keep func(entry *model.HistoryEntry) bool, limit int, offset int) ([]model.HistoryEntry, error) {
+	rows, err := db.conn.Query(query+" ORDER BY timestamp DESC", params...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.HistoryEntry
+	for rows.Next() && len(entries) < limit {
+		entry, err := db.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		if !keep(entry) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// containsFold reports whether substr is in s, ignoring case like LIKE does
+func containsFold(s string, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
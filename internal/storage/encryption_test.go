@@ -0,0 +1,81 @@
+package storage_test
+
+import (
+	"bytes"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/jonfk/tell/internal/storage/storagetest"
+)
+
+// openEncrypted creates a history database encrypted with key in a temporary directory
+func openEncrypted(t *testing.T, key []byte) *storage.DB {
+	t.Helper()
+
+	db, err := storage.OpenAt(filepath.Join(t.TempDir(), "tell.db"))
+	if err != nil {
+		t.Fatalf("OpenAt: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	db.SetEncryption(true, func(bool) ([]byte, error) { return key, nil })
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema: %v", err)
+	}
+	return db
+}
+
+func TestSealSynced(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	db := openEncrypted(t, key)
+
+	plain := model.HistoryEntry{
+		Prompt:  "list the files in /srv/customer-data",
+		Command: "ls /srv/customer-data",
+		Output:  sql.NullString{String: "invoices.csv\n", Valid: true},
+	}
+	sealed := plain
+	if err := db.SealSynced(&sealed); err != nil {
+		t.Fatalf("SealSynced: %v", err)
+	}
+	for _, value := range []string{sealed.Prompt, sealed.Command, sealed.Output.String} {
+		if strings.Contains(value, "customer") || strings.Contains(value, "invoices") {
+			t.Errorf("sealed value %q holds the plain text", value)
+		}
+	}
+	if sealed.Details != "" {
+		t.Errorf("empty details sealed as %q", sealed.Details)
+	}
+
+	// An unchanged history writes the same sync file
+	again := plain
+	if err := db.SealSynced(&again); err != nil {
+		t.Fatalf("SealSynced: %v", err)
+	}
+	if again.Prompt != sealed.Prompt || again.Command != sealed.Command || again.Output != sealed.Output {
+		t.Errorf("sealing the same entry twice gave %+v and %+v", sealed, again)
+	}
+
+	// Another machine with the same key reads it
+	opened := sealed
+	if err := openEncrypted(t, key).OpenSynced(&opened); err != nil {
+		t.Fatalf("OpenSynced: %v", err)
+	}
+	if opened.Prompt != plain.Prompt || opened.Command != plain.Command || opened.Output != plain.Output {
+		t.Errorf("OpenSynced = %+v, want %+v", opened, plain)
+	}
+
+	// Machines with another key or without encryption can't
+	other := sealed
+	if err := openEncrypted(t, bytes.Repeat([]byte{2}, 32)).OpenSynced(&other); err == nil {
+		t.Error("OpenSynced with another key succeeded")
+	}
+	other = sealed
+	if err := storagetest.Open(t).OpenSynced(&other); err == nil {
+		t.Error("OpenSynced without encryption succeeded")
+	}
+}
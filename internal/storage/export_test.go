@@ -0,0 +1,4 @@
+package storage
+
+// SimilarCommands exposes similarCommands to the tests of the storage_test package
+var SimilarCommands = similarCommands
@@ -4,12 +4,111 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/jonfk/tell/internal/fault"
 	"github.com/jonfk/tell/internal/model"
 )
 
+// historyColumns are the columns selected for a model.HistoryEntry, in the order scanHistoryEntry expects
+const historyColumns = `
+	id, timestamp, prompt, command, details, show_details,
+	error_message, model, input_tokens, output_tokens, favorite, parent_id,
+	exit_code, executed_at, entry_type, route, prompt_variant, parse_attempts,
+	retries, duration_ms, output, undo, timed_out, outcome, ran_command, shortcut, session_id,
+	edited, use_count, last_used_at, coalesce(uid, ''), updated_at,
+	coalesce((SELECT group_concat(tag, ' ') FROM (
+		SELECT tag FROM history_tags WHERE history_tags.entry_id = command_history.id ORDER BY tag
+	)), ''),
+	(SELECT count(*) FROM command_history AS continuation WHERE continuation.parent_id = command_history.id)`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanHistoryEntry scans a row selected with historyColumns into a history entry
+func (db *DB) scanHistoryEntry(row rowScanner) (*model.HistoryEntry, error) {
+	var entry model.HistoryEntry
+	var timestamp string
+	var executedAt, lastUsedAt, updatedAt sql.NullString
+	var tags string
+
+	err := row.Scan(
+		&entry.ID,
+		&timestamp,
+		&entry.Prompt,
+		&entry.Command,
+		&entry.Details,
+		&entry.ShowDetails,
+		&entry.ErrorMessage,
+		&entry.Model,
+		&entry.InputTokens,
+		&entry.OutputTokens,
+		&entry.Favorite,
+		&entry.ParentID,
+		&entry.ExitCode,
+		&executedAt,
+		&entry.EntryType,
+		&entry.Route,
+		&entry.PromptVariant,
+		&entry.ParseAttempts,
+		&entry.Retries,
+		&entry.DurationMS,
+		&entry.Output,
+		&entry.Undo,
+		&entry.TimedOut,
+		&entry.Outcome,
+		&entry.RanCommand,
+		&entry.Shortcut,
+		&entry.SessionID,
+		&entry.Edited,
+		&entry.UseCount,
+		&lastUsedAt,
+		&entry.UID,
+		&updatedAt,
+		&tags,
+		&entry.Continuations,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.open(&entry.Prompt, &entry.Command, &entry.Details, &entry.Undo, &entry.Output.String, &entry.RanCommand); err != nil {
+		return nil, fmt.Errorf("history entry %d: %w", entry.ID, err)
+	}
+
+	// Parse timestamp
+	entry.Timestamp = parseTimestamp(timestamp)
+	entry.Tags = strings.Fields(tags)
+	if executedAt.Valid {
+		entry.ExecutedAt = sql.NullTime{Time: parseTimestamp(executedAt.String), Valid: true}
+	}
+	if lastUsedAt.Valid {
+		entry.LastUsedAt = sql.NullTime{Time: parseTimestamp(lastUsedAt.String), Valid: true}
+	}
+	if updatedAt.Valid {
+		entry.UpdatedAt = sql.NullTime{Time: parseTimestamp(updatedAt.String), Valid: true}
+	}
+
+	return &entry, nil
+}
+
+// parseTimestamp parses a timestamp stored by SQLite
+func parseTimestamp(timestamp string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, timestamp); err == nil {
+			return t
+		}
+	}
+
+	slog.Warn("Could not parse timestamp", "timestamp", timestamp)
+	// Use current time as fallback
+	return time.Now()
+}
+
 // AddHistoryEntry adds a new entry to the command history
 func (db *DB) AddHistoryEntry(
 	prompt string,
@@ -17,33 +116,51 @@ func (db *DB) AddHistoryEntry(
 	usage *model.LLMUsage,
 	errorMsg string,
 	parentID sql.NullInt64, // New parameter
+	entryType string,
 ) (int64, error) {
 	slog.Debug("Adding history entry",
 		"prompt", prompt,
 		"usage", usage,
-		"parentID", parentID)
+		"parentID", parentID,
+		"entryType", entryType)
+
+	if err := fault.Error(fault.DBLock); err != nil {
+		return 0, fmt.Errorf("could not add history entry: %w", err)
+	}
 
+	// Entries continuing an entry of a session, such as regenerated commands, are part of it
 	query := `
 		INSERT INTO command_history (
-			prompt, command, details, show_details, error_message, model, input_tokens, output_tokens, parent_id
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+			prompt, command, details, show_details, error_message, model, input_tokens, output_tokens, parent_id,
+			entry_type, route, prompt_variant, parse_attempts, retries, undo, session_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+			(SELECT session_id FROM command_history WHERE id = ?))
 	`
 
-	var command, details, model string
-	var inputTokens, outputTokens int
+	var command, details, model, route, promptVariant, undo string
+	var inputTokens, outputTokens, parseAttempts, retries int
 	var showDetails bool
 
 	if response != nil {
 		command = response.Command
 		details = response.Details
 		showDetails = response.ShowDetails
+		undo = response.Undo
 	}
 	if usage != nil {
 		model = usage.Model
+		route = usage.Route
+		promptVariant = usage.PromptVariant
+		parseAttempts = usage.ParseAttempts
+		retries = usage.Retries
 		inputTokens = usage.InputTokens
 		outputTokens = usage.OutputTokens
 	}
 
+	if err := db.seal(&prompt, &command, &details, &undo); err != nil {
+		return 0, fmt.Errorf("could not add history entry: %w", err)
+	}
+
 	result, err := db.conn.Exec(
 		query,
 		prompt,
@@ -54,6 +171,13 @@ func (db *DB) AddHistoryEntry(
 		model,
 		inputTokens, outputTokens,
 		parentID,
+		entryType,
+		route,
+		promptVariant,
+		parseAttempts,
+		retries,
+		undo,
+		parentID,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("could not add history entry: %w", err)
@@ -67,16 +191,17 @@ func (db *DB) AddHistoryEntry(
 	return id, nil
 }
 
-// GetHistoryEntries retrieves entries from the command history with optional filtering
-func (db *DB) GetHistoryEntries(limit int, offset int, onlyFavorites bool, searchTerm string) ([]model.HistoryEntry, error) {
+// GetHistoryEntries retrieves entries from the command history with optional filtering.
+// An empty entryType returns entries of every type, an empty tag entries with any tags.
+// sortBy is one of the model.HistorySort constants, newest first when empty; searches
+// are always newest first.
+func (db *DB) GetHistoryEntries(limit int, offset int, onlyFavorites bool, searchTerm string, entryType string, tag string, sortBy string) ([]model.HistoryEntry, error) {
 	var entries []model.HistoryEntry
 	var params []any
 
 	// Build the query
 	query := `
-		SELECT 
-			id, timestamp, prompt, command, details, show_details, 
-			error_message, model, input_tokens, output_tokens, favorite, parent_id
+		SELECT ` + historyColumns + `
 		FROM command_history
 		WHERE 1=1
 	`
@@ -86,14 +211,35 @@ func (db *DB) GetHistoryEntries(limit int, offset int, onlyFavorites bool, searc
 		query += " AND favorite = 1"
 	}
 
-	if searchTerm != "" {
+	if searchTerm != "" && db.aead == nil {
 		query += " AND (prompt LIKE ? OR command LIKE ?)"
 		searchParam := "%" + searchTerm + "%"
 		params = append(params, searchParam, searchParam)
 	}
 
+	if entryType != "" {
+		query += " AND entry_type = ?"
+		params = append(params, entryType)
+	}
+
+	if tag != "" {
+		query += " AND id IN (SELECT entry_id FROM history_tags WHERE tag = ?)"
+		params = append(params, tag)
+	}
+
+	// Encrypted entries are searched once decrypted
+	if searchTerm != "" && db.aead != nil {
+		return db.filterEntries(query, params, func(entry *model.HistoryEntry) bool {
+			return containsFold(entry.Prompt, searchTerm) || containsFold(entry.Command, searchTerm)
+		}, limit, offset)
+	}
+
 	// Add order and limit
-	query += " ORDER BY timestamp DESC LIMIT ? OFFSET ?"
+	if sortBy == model.HistorySortUsed {
+		query += " ORDER BY use_count DESC, last_used_at DESC, timestamp DESC LIMIT ? OFFSET ?"
+	} else {
+		query += " ORDER BY timestamp DESC LIMIT ? OFFSET ?"
+	}
 	params = append(params, limit, offset)
 
 	// Execute query
@@ -105,36 +251,12 @@ func (db *DB) GetHistoryEntries(limit int, offset int, onlyFavorites bool, searc
 
 	// Process results
 	for rows.Next() {
-		var entry model.HistoryEntry
-		var timestamp string
-
-		err := rows.Scan(
-			&entry.ID,
-			&timestamp,
-			&entry.Prompt,
-			&entry.Command,
-			&entry.Details,
-			&entry.ShowDetails,
-			&entry.ErrorMessage,
-			&entry.Model,
-			&entry.InputTokens,
-			&entry.OutputTokens,
-			&entry.Favorite,
-			&entry.ParentID,
-		)
+		entry, err := db.scanHistoryEntry(rows)
 		if err != nil {
 			return nil, fmt.Errorf("could not scan row: %w", err)
 		}
 
-		// Parse timestamp
-		entry.Timestamp, err = time.Parse("2006-01-02 15:04:05", timestamp)
-		if err != nil {
-			slog.Warn("Could not parse timestamp", "timestamp", timestamp, "error", err)
-			// Use current time as fallback
-			entry.Timestamp = time.Now()
-		}
-
-		entries = append(entries, entry)
+		entries = append(entries, *entry)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -144,34 +266,85 @@ func (db *DB) GetHistoryEntries(limit int, offset int, onlyFavorites bool, searc
 	return entries, nil
 }
 
+// GetUniqueHistoryEntries is GetHistoryEntries with entries repeating the same command grouped,
+// or the same prompt for entries without a command, such as answers. Returns up to limit groups
+// after skipping offset of them, newest first or as sortBy says, and the number of groups.
+// Entries are grouped once read, since encrypted commands differ in the database.
+func (db *DB) GetUniqueHistoryEntries(limit int, offset int, onlyFavorites bool, entryType string, tag string, sortBy string) ([]model.HistoryGroup, int, error) {
+	entries, err := db.GetHistoryEntries(-1, 0, onlyFavorites, "", entryType, tag, model.HistorySortRecent)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var groups []model.HistoryGroup
+	// Index of the group of each command or prompt in groups
+	index := make(map[string]int)
+	for _, entry := range entries {
+		key := entry.EntryType + "\x00" + normalizeCommand(entry.Command)
+		if entry.Command == "" {
+			key += "\x00" + strings.ToLower(strings.TrimSpace(entry.Prompt))
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, model.HistoryGroup{Latest: entry})
+		}
+		groups[i].Count++
+		groups[i].UseCount += entry.UseCount
+	}
+
+	if sortBy == model.HistorySortUsed {
+		sort.SliceStable(groups, func(i, j int) bool {
+			return groups[i].UseCount > groups[j].UseCount
+		})
+	}
+
+	total := len(groups)
+	groups = groups[min(offset, total):]
+	if limit >= 0 && limit < len(groups) {
+		groups = groups[:limit]
+	}
+	return groups, total, nil
+}
+
+// CountHistoryEntries returns how many history entries GetHistoryEntries can list with the same
+// filters and no search term
+func (db *DB) CountHistoryEntries(onlyFavorites bool, entryType string, tag string) (int, error) {
+	var params []any
+	query := "SELECT count(*) FROM command_history WHERE 1=1"
+
+	if onlyFavorites {
+		query += " AND favorite = 1"
+	}
+
+	if entryType != "" {
+		query += " AND entry_type = ?"
+		params = append(params, entryType)
+	}
+
+	if tag != "" {
+		query += " AND id IN (SELECT entry_id FROM history_tags WHERE tag = ?)"
+		params = append(params, tag)
+	}
+
+	var count int
+	if err := db.conn.QueryRow(query, params...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("could not count history entries: %w", err)
+	}
+	return count, nil
+}
+
 // GetHistoryEntry retrieves a single history entry by ID
 func (db *DB) GetHistoryEntry(id int64) (*model.HistoryEntry, error) {
 	query := `
-		SELECT 
-			id, timestamp, prompt, command, details, show_details, 
-			error_message, model, input_tokens, output_tokens, favorite, parent_id
+		SELECT ` + historyColumns + `
 		FROM command_history
 		WHERE id = ?
 	`
 
-	var entry model.HistoryEntry
-	var timestamp string
-
-	err := db.conn.QueryRow(query, id).Scan(
-		&entry.ID,
-		&timestamp,
-		&entry.Prompt,
-		&entry.Command,
-		&entry.Details,
-		&entry.ShowDetails,
-		&entry.ErrorMessage,
-		&entry.Model,
-		&entry.InputTokens,
-		&entry.OutputTokens,
-		&entry.Favorite,
-		&entry.ParentID,
-	)
-
+	entry, err := db.scanHistoryEntry(db.conn.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("no history entry found with ID %d", id)
@@ -179,48 +352,20 @@ func (db *DB) GetHistoryEntry(id int64) (*model.HistoryEntry, error) {
 		return nil, fmt.Errorf("could not get history entry: %w", err)
 	}
 
-	// Parse timestamp
-	entry.Timestamp, err = time.Parse("2006-01-02 15:04:05", timestamp)
-	if err != nil {
-		slog.Warn("Could not parse timestamp", "timestamp", timestamp, "error", err)
-		// Use current time as fallback
-		entry.Timestamp = time.Now()
-	}
-
-	return &entry, nil
+	return entry, nil
 }
 
 // GetMostRecentSuccessfulCommand returns the last successful command
 func (db *DB) GetMostRecentSuccessfulCommand() (*model.HistoryEntry, error) {
 	query := `
-		SELECT 
-			id, timestamp, prompt, command, details, show_details, 
-			error_message, model, input_tokens, output_tokens, favorite, parent_id
+		SELECT ` + historyColumns + `
 		FROM command_history
-		WHERE command != '' AND error_message IS NULL OR error_message = ''
+		WHERE command != '' AND (error_message IS NULL OR error_message = '') AND entry_type = 'command'
 		ORDER BY timestamp DESC
 		LIMIT 1
 	`
 
-	var entry model.HistoryEntry
-	var timestamp string
-	var parentID sql.NullInt64
-
-	err := db.conn.QueryRow(query).Scan(
-		&entry.ID,
-		&timestamp,
-		&entry.Prompt,
-		&entry.Command,
-		&entry.Details,
-		&entry.ShowDetails,
-		&entry.ErrorMessage,
-		&entry.Model,
-		&entry.InputTokens,
-		&entry.OutputTokens,
-		&entry.Favorite,
-		&parentID,
-	)
-
+	entry, err := db.scanHistoryEntry(db.conn.QueryRow(query))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("no previous successful commands found")
@@ -228,21 +373,313 @@ func (db *DB) GetMostRecentSuccessfulCommand() (*model.HistoryEntry, error) {
 		return nil, fmt.Errorf("could not get most recent command: %w", err)
 	}
 
-	entry.ParentID = parentID
+	return entry, nil
+}
 
-	// Parse timestamp
-	entry.Timestamp, err = time.Parse("2006-01-02 15:04:05", timestamp)
+// GetEntryChain returns a history entry and the entries it continues, following parent_id, oldest
+// first
+func (db *DB) GetEntryChain(id int64) ([]model.HistoryEntry, error) {
+	// The depth bound stops a loop of parents, which tell never creates
+	query := `
+		WITH RECURSIVE chain(chain_id, depth) AS (
+			SELECT id, 0 FROM command_history WHERE id = ?
+			UNION ALL
+			SELECT command_history.parent_id, chain.depth + 1
+			FROM command_history JOIN chain ON command_history.id = chain.chain_id
+			WHERE command_history.parent_id IS NOT NULL AND chain.depth < 1000
+		)
+		SELECT ` + historyColumns + `
+		FROM command_history
+		JOIN chain ON chain.chain_id = command_history.id
+		ORDER BY chain.depth DESC
+	`
+
+	rows, err := db.conn.Query(query, id)
 	if err != nil {
-		slog.Warn("Could not parse timestamp", "timestamp", timestamp, "error", err)
-		// Use current time as fallback
-		entry.Timestamp = time.Now()
+		return nil, fmt.Errorf("could not get history chain: %w", err)
 	}
+	defer rows.Close()
 
-	return &entry, nil
+	var entries []model.HistoryEntry
+	for rows.Next() {
+		entry, err := db.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no history entry found with ID %d", id)
+	}
+
+	return entries, nil
+}
+
+// GetEntryTree returns every entry of the continuation tree a history entry is in: the entry its
+// chain starts from and all the entries continuing it, directly or not, oldest first
+func (db *DB) GetEntryTree(id int64) ([]model.HistoryEntry, error) {
+	chain, err := db.GetEntryChain(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The depth bound stops a loop of parents, which tell never creates
+	query := `
+		WITH RECURSIVE tree(tree_id, depth) AS (
+			SELECT ?, 0
+			UNION ALL
+			SELECT command_history.id, tree.depth + 1
+			FROM command_history JOIN tree ON command_history.parent_id = tree.tree_id
+			WHERE tree.depth < 1000
+		)
+		SELECT ` + historyColumns + `
+		FROM command_history
+		JOIN tree ON tree.tree_id = command_history.id
+		ORDER BY command_history.timestamp, command_history.id
+	`
+
+	rows, err := db.conn.Query(query, chain[0].ID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get history tree: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.HistoryEntry
+	for rows.Next() {
+		entry, err := db.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// FindFailedExecution returns the most recent history entry whose command is the same as the
+// given one, or close to it (see similarCommands), and that exited with a non-zero status when it
+// was run. An entry with the same command is preferred over a similar one. Returns nil if there
+// is none.
+func (db *DB) FindFailedExecution(command string) (*model.HistoryEntry, error) {
+	query := `
+		SELECT ` + historyColumns + `
+		FROM command_history
+		WHERE exit_code IS NOT NULL AND exit_code != 0
+		ORDER BY timestamp DESC
+		LIMIT 500
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query failed executions: %w", err)
+	}
+	defer rows.Close()
+
+	normalized := normalizeCommand(command)
+	var similar *model.HistoryEntry
+	for rows.Next() {
+		entry, err := db.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+
+		if normalizeCommand(entry.Command) == normalized {
+			return entry, nil
+		}
+		if similar == nil && similarCommands(entry.Command, command) {
+			similar = entry
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return similar, nil
+}
+
+// FindCommandEntry returns the most recent generated command that is the same as the given
+// one, ignoring whitespace differences. Returns nil if there is none.
+func (db *DB) FindCommandEntry(command string) (*model.HistoryEntry, error) {
+	query := `
+		SELECT ` + historyColumns + `
+		FROM command_history
+		WHERE command != '' AND entry_type = 'command'
+		ORDER BY timestamp DESC
+		LIMIT 500
+	`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query commands: %w", err)
+	}
+	defer rows.Close()
+
+	normalized := normalizeCommand(command)
+	for rows.Next() {
+		entry, err := db.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+
+		if normalizeCommand(entry.Command) == normalized {
+			return entry, nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return nil, nil
+}
+
+// GetMostRecentFailedExecution returns the most recent generated command that exited with a
+// non-zero status when it was run. Returns nil if there is none.
+func (db *DB) GetMostRecentFailedExecution() (*model.HistoryEntry, error) {
+	query := `
+		SELECT ` + historyColumns + `
+		FROM command_history
+		WHERE exit_code IS NOT NULL AND exit_code != 0 AND entry_type = 'command'
+		ORDER BY executed_at DESC
+		LIMIT 1
+	`
+
+	entry, err := db.scanHistoryEntry(db.conn.QueryRow(query))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get most recent failed command: %w", err)
+	}
+
+	return entry, nil
+}
+
+// HasPriorFailure reports whether the same prompt (ignoring case and surrounding
+// whitespace) failed before, either while generating or when the command was run
+func (db *DB) HasPriorFailure(prompt string) (bool, error) {
+	if db.aead != nil {
+		query := `
+			SELECT ` + historyColumns + `
+			FROM command_history
+			WHERE ((error_message IS NOT NULL AND error_message != '') OR (exit_code IS NOT NULL AND exit_code != 0))
+		`
+		failures, err := db.filterEntries(query, nil, func(entry *model.HistoryEntry) bool {
+			return strings.EqualFold(strings.TrimSpace(entry.Prompt), strings.TrimSpace(prompt))
+		}, 1, 0)
+		if err != nil {
+			return false, fmt.Errorf("could not check prior failures: %w", err)
+		}
+		return len(failures) > 0, nil
+	}
+
+	query := `
+		SELECT COUNT(*)
+		FROM command_history
+		WHERE lower(trim(prompt)) = lower(trim(?))
+		AND ((error_message IS NOT NULL AND error_message != '') OR (exit_code IS NOT NULL AND exit_code != 0))
+	`
+
+	var count int
+	if err := db.conn.QueryRow(query, prompt).Scan(&count); err != nil {
+		return false, fmt.Errorf("could not check prior failures: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// normalizeCommand collapses whitespace and line continuations so that commands
+// differing only in formatting compare equal
+func normalizeCommand(command string) string {
+	command = strings.ReplaceAll(command, "\\\n", " ")
+	return strings.Join(strings.Fields(command), " ")
+}
+
+// similarCommands reports whether two commands differ only a little: they run the same program
+// with the same subcommand, and their arguments are the same but for quoting, trailing slashes
+// and order, or the commands are a few characters apart (one in ten, at least two)
+func similarCommands(a string, b string) bool {
+	wordsA, wordsB := commandWords(a), commandWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 || wordsA[0] != wordsB[0] || subcommand(wordsA) != subcommand(wordsB) {
+		return false
+	}
+
+	sortedA := append([]string{}, wordsA...)
+	sortedB := append([]string{}, wordsB...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	if strings.Join(sortedA, " ") == strings.Join(sortedB, " ") {
+		return true
+	}
+
+	joinedA, joinedB := strings.Join(wordsA, " "), strings.Join(wordsB, " ")
+	threshold := max(2, min(len(joinedA), len(joinedB))/10)
+	return editDistance(joinedA, joinedB) <= threshold
+}
+
+// commandWords splits a command into words without their quotes and trailing slashes
+func commandWords(command string) []string {
+	words := strings.Fields(normalizeCommand(command))
+	for i, word := range words {
+		word = strings.NewReplacer(`"`, "", "'", "").Replace(word)
+		if len(word) > 1 {
+			word = strings.TrimRight(word, "/")
+		}
+		words[i] = word
+	}
+	return words
+}
+
+// subcommand returns the second word of a command, such as commit in git commit, or an empty
+// string when there is none or it is a flag
+func subcommand(words []string) string {
+	if len(words) < 2 || strings.HasPrefix(words[1], "-") {
+		return ""
+	}
+	return words[1]
+}
+
+// editDistance returns the number of single character insertions, deletions and substitutions
+// turning a into b
+func editDistance(a string, b string) int {
+	runesA, runesB := []rune(a), []rune(b)
+	previous := make([]int, len(runesB)+1)
+	current := make([]int, len(runesB)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(runesA); i++ {
+		current[0] = i
+		for j := 1; j <= len(runesB); j++ {
+			cost := 1
+			if runesA[i-1] == runesB[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(runesB)]
 }
 
 // SetFavorite marks or unmarks a history entry as favorite
 func (db *DB) SetFavorite(id int64, favorite bool) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not update favorite status: %w", err)
+	}
+
 	query := "UPDATE command_history SET favorite = ? WHERE id = ?"
 
 	result, err := db.conn.Exec(query, favorite, id)
@@ -262,8 +699,156 @@ func (db *DB) SetFavorite(id int64, favorite bool) error {
 	return nil
 }
 
+// SetShortcut marks a history entry as favorite and names the shell abbreviation or alias
+// 'tell favorites export-abbr' defines for its command. An empty name removes it.
+func (db *DB) SetShortcut(id int64, name string) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not set shortcut: %w", err)
+	}
+
+	query := "UPDATE command_history SET favorite = 1, shortcut = ? WHERE id = ?"
+
+	result, err := db.conn.Exec(query, name, id)
+	if err != nil {
+		return fmt.Errorf("could not set shortcut: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("no history entry found with ID %d", id)
+	}
+
+	return nil
+}
+
+// EditHistoryEntry replaces the command and details of a history entry and marks it as edited
+func (db *DB) EditHistoryEntry(id int64, command string, details string) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not edit history entry: %w", err)
+	}
+
+	query := "UPDATE command_history SET command = ?, details = ?, edited = 1 WHERE id = ?"
+
+	if err := db.seal(&command, &details); err != nil {
+		return fmt.Errorf("could not edit history entry: %w", err)
+	}
+
+	result, err := db.conn.Exec(query, command, details, id)
+	if err != nil {
+		return fmt.Errorf("could not edit history entry: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("no history entry found with ID %d", id)
+	}
+
+	return nil
+}
+
+// RecordUse counts a use of a history entry: its command was run again, copied or picked from
+// history. Uses are counted on each machine, so they don't change updated_at for 'tell sync'.
+func (db *DB) RecordUse(id int64) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not record use: %w", err)
+	}
+
+	query := "UPDATE command_history SET use_count = use_count + 1, last_used_at = CURRENT_TIMESTAMP WHERE id = ?"
+
+	result, err := db.conn.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("could not record use: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("no history entry found with ID %d", id)
+	}
+
+	return nil
+}
+
+// RecordExecution records that the command of a history entry was run: when it started,
+// its exit code, and how long it took and the end of its output when they are known
+func (db *DB) RecordExecution(id int64, execution model.Execution) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not record execution: %w", err)
+	}
+
+	query := "UPDATE command_history SET exit_code = ?, executed_at = ?, duration_ms = ?, output = ?, timed_out = ? WHERE id = ?"
+
+	duration := sql.NullInt64{Int64: execution.Duration.Milliseconds(), Valid: execution.Duration >= 0}
+	output := sql.NullString{String: execution.Output, Valid: execution.Output != ""}
+	if err := db.seal(&output.String); err != nil {
+		return fmt.Errorf("could not record execution: %w", err)
+	}
+
+	result, err := db.conn.Exec(query, execution.ExitCode, execution.StartedAt.UTC().Format("2006-01-02 15:04:05"), duration, output, execution.TimedOut, id)
+	if err != nil {
+		return fmt.Errorf("could not record execution: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("no history entry found with ID %d", id)
+	}
+
+	return nil
+}
+
+// RecordOutcome records what the user did with the command of a history entry that the shell
+// integration put on their command line, one of the model.Outcome constants. ranCommand is the
+// edited command they ran instead, if any.
+func (db *DB) RecordOutcome(id int64, outcome string, ranCommand string) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not record outcome: %w", err)
+	}
+
+	query := "UPDATE command_history SET outcome = ?, ran_command = ? WHERE id = ?"
+
+	if err := db.seal(&ranCommand); err != nil {
+		return fmt.Errorf("could not record outcome: %w", err)
+	}
+
+	result, err := db.conn.Exec(query, outcome, ranCommand, id)
+	if err != nil {
+		return fmt.Errorf("could not record outcome: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("no history entry found with ID %d", id)
+	}
+
+	return nil
+}
+
 // DeleteHistoryEntry deletes a history entry by ID
 func (db *DB) DeleteHistoryEntry(id int64) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not delete history entry: %w", err)
+	}
+
 	query := "DELETE FROM command_history WHERE id = ?"
 
 	result, err := db.conn.Exec(query, id)
@@ -283,28 +868,79 @@ func (db *DB) DeleteHistoryEntry(id int64) error {
 	return nil
 }
 
-// SearchHistory searches through history entries
-func (db *DB) SearchHistory(query string, limit int) ([]model.HistoryEntry, error) {
+// PruneHistory deletes the history entries made before cutoff, except favorites when
+// keepFavorites is set, and returns the number of entries deleted. With dryRun, it only
+// counts them.
+func (db *DB) PruneHistory(cutoff time.Time, keepFavorites bool, dryRun bool) (int64, error) {
+	condition := "timestamp < ? AND (? = 0 OR favorite = 0)"
+	params := []any{cutoff.UTC().Format("2006-01-02 15:04:05"), keepFavorites}
+
+	if dryRun {
+		var count int64
+		if err := db.conn.QueryRow("SELECT count(*) FROM command_history WHERE "+condition, params...).Scan(&count); err != nil {
+			return 0, fmt.Errorf("could not count old history entries: %w", err)
+		}
+		return count, nil
+	}
+
+	if err := fault.Error(fault.DBLock); err != nil {
+		return 0, fmt.Errorf("could not prune history: %w", err)
+	}
+
+	result, err := db.conn.Exec("DELETE FROM command_history WHERE "+condition, params...)
+	if err != nil {
+		return 0, fmt.Errorf("could not prune history: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("could not get rows affected: %w", err)
+	}
+
+	return rows, nil
+}
+
+// SearchHistory searches through history entries. An empty entryType searches entries of every
+// type, an empty tag entries with any tags.
+func (db *DB) SearchHistory(query string, limit int, entryType string, tag string) ([]model.HistoryEntry, error) {
 	if query == "" {
 		return nil, fmt.Errorf("search query cannot be empty")
 	}
 
+	if db.fullText {
+		return db.searchFullText(query, limit, entryType, tag)
+	}
+
+	// Encrypted entries are searched once decrypted
+	if db.aead != nil {
+		sqlQuery := `
+			SELECT ` + historyColumns + `
+			FROM command_history
+			WHERE (? = '' OR entry_type = ?)
+			AND (? = '' OR id IN (SELECT entry_id FROM history_tags WHERE tag = ?))
+		`
+		return db.filterEntries(sqlQuery, []any{entryType, entryType, tag, tag}, func(entry *model.HistoryEntry) bool {
+			return containsFold(entry.Prompt, query) || containsFold(entry.Command, query) ||
+				((entry.EntryType == model.EntryTypeAnswer || entry.EntryType == model.EntryTypeSummary) && containsFold(entry.Details, query))
+		}, limit, 0)
+	}
+
 	// Format search terms for LIKE queries
 	searchParam := "%" + strings.Replace(query, "%", "\\%", -1) + "%"
 
 	// Build query
 	sqlQuery := `
-		SELECT 
-			id, timestamp, prompt, command, details, show_details, 
-			error_message, model, input_tokens, output_tokens, favorite, parent_id
+		SELECT ` + historyColumns + `
 		FROM command_history
-		WHERE prompt LIKE ? OR command LIKE ?
+		WHERE (prompt LIKE ? OR command LIKE ? OR (entry_type IN ('answer', 'summary') AND details LIKE ?))
+		AND (? = '' OR entry_type = ?)
+		AND (? = '' OR id IN (SELECT entry_id FROM history_tags WHERE tag = ?))
 		ORDER BY timestamp DESC
 		LIMIT ?
 	`
 
 	// Execute query
-	rows, err := db.conn.Query(sqlQuery, searchParam, searchParam, limit)
+	rows, err := db.conn.Query(sqlQuery, searchParam, searchParam, searchParam, entryType, entryType, tag, tag, limit)
 	if err != nil {
 		return nil, fmt.Errorf("could not search history: %w", err)
 	}
@@ -313,36 +949,59 @@ func (db *DB) SearchHistory(query string, limit int) ([]model.HistoryEntry, erro
 	// Process results
 	var entries []model.HistoryEntry
 	for rows.Next() {
-		var entry model.HistoryEntry
-		var timestamp string
-
-		err := rows.Scan(
-			&entry.ID,
-			&timestamp,
-			&entry.Prompt,
-			&entry.Command,
-			&entry.Details,
-			&entry.ShowDetails,
-			&entry.ErrorMessage,
-			&entry.Model,
-			&entry.InputTokens,
-			&entry.OutputTokens,
-			&entry.Favorite,
-			&entry.ParentID,
-		)
+		entry, err := db.scanHistoryEntry(rows)
 		if err != nil {
 			return nil, fmt.Errorf("could not scan row: %w", err)
 		}
 
-		// Parse timestamp
-		entry.Timestamp, err = time.Parse("2006-01-02 15:04:05", timestamp)
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// searchFullText searches history entries with the full-text index, best matches first. Each
+// word of query must appear in the prompt, command or details, in any order, as a word or the
+// start of one.
+func (db *DB) searchFullText(query string, limit int, entryType string, tag string) ([]model.HistoryEntry, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, fmt.Errorf("search query cannot be empty")
+	}
+
+	// Matches in the prompt and command rank above matches in the details
+	sqlQuery := `
+		SELECT ` + historyColumns + `
+		FROM command_history
+		JOIN (
+			SELECT rowid AS match_id, bm25(command_history_fts, 2.0, 2.0, 1.0) AS rank
+			FROM command_history_fts
+			WHERE command_history_fts MATCH ?
+		) AS matches ON matches.match_id = command_history.id
+		WHERE (? = '' OR entry_type = ?)
+		AND (? = '' OR id IN (SELECT entry_id FROM history_tags WHERE tag = ?))
+		ORDER BY matches.rank, timestamp DESC
+		LIMIT ?
+	`
+
+	rows, err := db.conn.Query(sqlQuery, match, entryType, entryType, tag, tag, limit)
+	if err != nil {
+		return nil, fmt.Errorf("could not search history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.HistoryEntry
+	for rows.Next() {
+		entry, err := db.scanHistoryEntry(rows)
 		if err != nil {
-			slog.Warn("Could not parse timestamp", "timestamp", timestamp, "error", err)
-			// Use current time as fallback
-			entry.Timestamp = time.Now()
+			return nil, fmt.Errorf("could not scan row: %w", err)
 		}
 
-		entries = append(entries, entry)
+		entries = append(entries, *entry)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -351,3 +1010,14 @@ func (db *DB) SearchHistory(query string, limit int) ([]model.HistoryEntry, erro
 
 	return entries, nil
 }
+
+// ftsQuery turns the words of a search into an FTS5 query matching entries with all of them as
+// prefixes. Each word is quoted, so characters FTS5 gives a meaning to, such as - or *, are
+// searched for as text.
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,102 @@
+package storage_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jonfk/tell/internal/model"
+	"github.com/jonfk/tell/internal/storage"
+	"github.com/jonfk/tell/internal/storage/storagetest"
+)
+
+// addExecutedCommand saves a generated command and records that running it exited with exitCode
+func addExecutedCommand(t *testing.T, db *storage.DB, command string, exitCode int) int64 {
+	t.Helper()
+
+	id, err := db.AddHistoryEntry("prompt", &model.CommandResponse{Command: command}, nil, "", sql.NullInt64{}, model.EntryTypeCommand)
+	if err != nil {
+		t.Fatalf("AddHistoryEntry: %v", err)
+	}
+	if err := db.RecordExecution(id, model.Execution{ExitCode: exitCode, StartedAt: time.Now(), Duration: -1}); err != nil {
+		t.Fatalf("RecordExecution: %v", err)
+	}
+	return id
+}
+
+func TestFindFailedExecution(t *testing.T) {
+	db := storagetest.Open(t)
+	failed := addExecutedCommand(t, db, `git commit -m "fix the build"`, 1)
+	addExecutedCommand(t, db, "git status", 0)
+	removed := addExecutedCommand(t, db, "rm -rf ./build/", 1)
+
+	tests := []struct {
+		name    string
+		command string
+		want    int64
+	}{
+		{"exact", `git commit -m "fix the build"`, failed},
+		{"whitespace", "git  commit -m \"fix the build\"\n", failed},
+		{"line continuation", "git commit \\\n  -m \"fix the build\"", failed},
+		{"quoting", "git commit -m 'fix the build'", failed},
+		{"argument order", `git commit "fix the build" -m`, failed},
+		{"small edit", `git commit -m "fix the builds"`, failed},
+		{"trailing slash", "rm -rf ./build", removed},
+		{"succeeded", "git status", 0},
+		{"other subcommand", `git push -m "fix the build"`, 0},
+		{"other program", `hg commit -m "fix the build"`, 0},
+		{"other arguments", `git commit -m "update the readme"`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := db.FindFailedExecution(tt.command)
+			if err != nil {
+				t.Fatalf("FindFailedExecution: %v", err)
+			}
+			var got int64
+			if entry != nil {
+				got = entry.ID
+			}
+			if got != tt.want {
+				t.Errorf("FindFailedExecution(%q) = entry %d, want %d", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindFailedExecutionPrefersExactMatch(t *testing.T) {
+	db := storagetest.Open(t)
+	exact := addExecutedCommand(t, db, "ls -la /tmp", 2)
+	addExecutedCommand(t, db, "ls -la /tm", 2)
+
+	entry, err := db.FindFailedExecution("ls -la /tmp")
+	if err != nil {
+		t.Fatalf("FindFailedExecution: %v", err)
+	}
+	if entry == nil || entry.ID != exact {
+		t.Errorf("FindFailedExecution = %+v, want entry %d", entry, exact)
+	}
+}
+
+func TestSimilarCommands(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"ls -la", "ls -la", true},
+		{"ls -la", "ls -al", true},
+		{"ls -la", "ls -l", true},
+		{"ls -la", "cat -la", false},
+		{"git push origin main", "git push origin dev", false},
+		{"docker run --rm -it ubuntu:22.04 bash", "docker run --rm -it ubuntu:24.04 bash", true},
+		{"kubectl get pods", "kubectl delete pods", false},
+		{"", "ls", false},
+	}
+
+	for _, tt := range tests {
+		if got := storage.SimilarCommands(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarCommands(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
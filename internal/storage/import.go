@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jonfk/tell/internal/fault"
+	"github.com/jonfk/tell/internal/model"
+)
+
+// ContentHash identifies a history entry by what it is rather than by its ID, which differs
+// between machines: when it was made, its type, prompt, command and details
+func ContentHash(timestamp time.Time, entryType string, prompt string, command string, details string) string {
+	h := sha256.New()
+	for _, field := range []string{timestamp.UTC().Format("2006-01-02 15:04:05"), entryType, prompt, command, details} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ImportHistory adds entries, oldest first, to the history with their timestamps, tags and
+// execution details, skipping those with the same ContentHash or UID as an entry that was there
+// before the import. Entries are not de-duplicated against each other. The ParentID of an entry
+// refers to the ID of another entry in entries, and is changed to the ID that entry has here;
+// parents that aren't in entries are dropped. All entries are added, or none. Returns the number
+// of entries added.
+func (db *DB) ImportHistory(entries []model.HistoryEntry) (int, error) {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return 0, fmt.Errorf("could not import history: %w", err)
+	}
+
+	existing, err := db.contentHashes()
+	if err != nil {
+		return 0, err
+	}
+	uids, err := db.entryUIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start import: %w", err)
+	}
+	defer tx.Rollback()
+
+	// IDs in entries mapped to IDs here, for parents
+	ids := make(map[int64]int64)
+	imported := 0
+	for _, entry := range entries {
+		hash := ContentHash(entry.Timestamp, entry.EntryType, entry.Prompt, entry.Command, entry.Details)
+		if id, ok := existing[hash]; ok {
+			ids[entry.ID] = id
+			continue
+		}
+		if id, ok := uids[entry.UID]; ok {
+			ids[entry.ID] = id
+			continue
+		}
+
+		var parentID sql.NullInt64
+		if entry.ParentID.Valid {
+			parentID.Int64, parentID.Valid = ids[entry.ParentID.Int64]
+		}
+
+		id, err := db.insertEntry(tx, entry, parentID)
+		if err != nil {
+			return 0, fmt.Errorf("could not import history entry %d: %w", entry.ID, err)
+		}
+
+		// An entry imported again after it was deleted is no longer deleted for 'tell sync'
+		if entry.UID != "" {
+			if _, err := tx.Exec("DELETE FROM history_deletions WHERE uid = ?", entry.UID); err != nil {
+				return 0, fmt.Errorf("could not import history entry %d: %w", entry.ID, err)
+			}
+		}
+
+		for _, tag := range entry.Tags {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO history_tags (entry_id, tag) VALUES (?, ?)", id, tag); err != nil {
+				return 0, fmt.Errorf("could not import tags of history entry %d: %w", entry.ID, err)
+			}
+		}
+
+		ids[entry.ID] = id
+		imported++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("could not commit import: %w", err)
+	}
+
+	return imported, nil
+}
+
+// contentHashes returns the ContentHash of every history entry, with its ID
+func (db *DB) contentHashes() (map[string]int64, error) {
+	rows, err := db.conn.Query("SELECT id, timestamp, entry_type, prompt, command, coalesce(details, '') FROM command_history")
+	if err != nil {
+		return nil, fmt.Errorf("could not read history: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]int64)
+	for rows.Next() {
+		var id int64
+		var timestamp, entryType, prompt, command, details string
+		if err := rows.Scan(&id, &timestamp, &entryType, &prompt, &command, &details); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		if err := db.open(&prompt, &command, &details); err != nil {
+			return nil, fmt.Errorf("history entry %d: %w", id, err)
+		}
+		hashes[ContentHash(parseTimestamp(timestamp), entryType, prompt, command, details)] = id
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return hashes, nil
+}
+
+// entryUIDs returns the ID of every history entry by its UID
+func (db *DB) entryUIDs() (map[string]int64, error) {
+	rows, err := db.conn.Query("SELECT id, uid FROM command_history WHERE uid IS NOT NULL")
+	if err != nil {
+		return nil, fmt.Errorf("could not read history: %w", err)
+	}
+	defer rows.Close()
+
+	uids := make(map[string]int64)
+	for rows.Next() {
+		var id int64
+		var uid string
+		if err := rows.Scan(&id, &uid); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		uids[uid] = id
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return uids, nil
+}
+
+// insertEntry adds entry to the history as it is, with parentID, keeping its UID when it has
+// one, and returns its ID. Tags are left to the caller.
+func (db *DB) insertEntry(tx *sql.Tx, entry model.HistoryEntry, parentID sql.NullInt64) (int64, error) {
+	query := `
+		INSERT INTO command_history (
+			timestamp, prompt, command, details, show_details, error_message, model, input_tokens, output_tokens,
+			parent_id, entry_type, exit_code, executed_at, duration_ms, output, undo, timed_out, outcome,
+			ran_command, favorite, shortcut, edited, use_count, last_used_at, uid
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	if err := db.seal(&entry.Prompt, &entry.Command, &entry.Details, &entry.Undo, &entry.Output.String, &entry.RanCommand); err != nil {
+		return 0, err
+	}
+	// Entries without a UID get one from the command_history_uid trigger
+	uid := sql.NullString{String: entry.UID, Valid: entry.UID != ""}
+
+	result, err := tx.Exec(query,
+		entry.Timestamp.UTC().Format("2006-01-02 15:04:05"),
+		entry.Prompt,
+		entry.Command,
+		entry.Details,
+		entry.ShowDetails,
+		entry.ErrorMessage,
+		entry.Model,
+		entry.InputTokens, entry.OutputTokens,
+		parentID,
+		entry.EntryType,
+		entry.ExitCode,
+		nullTimestamp(entry.ExecutedAt),
+		entry.DurationMS,
+		entry.Output,
+		entry.Undo,
+		entry.TimedOut,
+		entry.Outcome,
+		entry.RanCommand,
+		entry.Favorite,
+		entry.Shortcut,
+		entry.Edited,
+		entry.UseCount,
+		nullTimestamp(entry.LastUsedAt),
+		uid,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("could not get last insert ID: %w", err)
+	}
+	return id, nil
+}
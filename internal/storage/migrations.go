@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// versionSchema records the migrations applied to the database
+const versionSchema = `
+CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    description TEXT NOT NULL,
+    applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// migration changes the schema of the database. Migrations are applied once each, in order of
+// version, in a transaction of their own. Databases from before schema_version already have
+// some of the tables and columns, so migrations must leave those as they are.
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations are the changes to the schema so far. Append to the list for new columns and
+// tables, never change a migration databases may already have.
+var migrations = []migration{
+	{1, "initial schema", execSchema(schema)},
+	{2, "record command executions", addColumns(
+		column{"command_history", "exit_code", "INTEGER DEFAULT NULL"},    // Exit code when the command was executed
+		column{"command_history", "executed_at", "DATETIME DEFAULT NULL"}, // When the command was executed
+	)},
+	{3, "entry types", addColumns(
+		column{"command_history", "entry_type", "TEXT NOT NULL DEFAULT 'command'"}, // Kind of entry (command, answer)
+	)},
+	{4, "model routing", addColumns(
+		column{"command_history", "route", "TEXT NOT NULL DEFAULT ''"}, // How the model was picked (routing tier, override)
+	)},
+	{5, "system prompt styles", addColumns(
+		column{"command_history", "prompt_variant", "TEXT NOT NULL DEFAULT ''"},   // System prompt style (full, compact)
+		column{"command_history", "parse_attempts", "INTEGER NOT NULL DEFAULT 0"}, // Requests needed to parse the response, 0 if unknown
+	)},
+	{6, "retries", addColumns(
+		column{"command_history", "retries", "INTEGER NOT NULL DEFAULT 0"}, // Times failed LLM requests were retried
+	)},
+	{7, "command duration and output", addColumns(
+		column{"command_history", "duration_ms", "INTEGER DEFAULT NULL"}, // How long the command ran when executed
+		column{"command_history", "output", "TEXT DEFAULT NULL"},         // End of the command's output when executed
+	)},
+	{8, "undo commands", addColumns(
+		column{"command_history", "undo", "TEXT NOT NULL DEFAULT ''"}, // Command reversing this one, when requested
+	)},
+	{9, "run timeouts", addColumns(
+		column{"command_history", "timed_out", "INTEGER NOT NULL DEFAULT 0"}, // Whether the command was stopped by the run timeout
+	)},
+	{10, "command line outcomes", addColumns(
+		column{"command_history", "outcome", "TEXT NOT NULL DEFAULT ''"},     // What the user did with the command on their command line
+		column{"command_history", "ran_command", "TEXT NOT NULL DEFAULT ''"}, // The edited command the user ran instead
+	)},
+	{11, "favorite shortcuts", addColumns(
+		column{"command_history", "shortcut", "TEXT NOT NULL DEFAULT ''"}, // Name of the favorite's shell abbreviation or alias
+	)},
+	{12, "sessions", addColumns(
+		column{"command_history", "session_id", "INTEGER DEFAULT NULL"}, // Session the entry was generated in
+	)},
+	{13, "history sync", func(tx *sql.Tx) error {
+		err := addColumns(
+			column{"command_history", "uid", "TEXT DEFAULT NULL"},            // Globally unique ID, the same on every machine it is synced to
+			column{"command_history", "updated_at", "DATETIME DEFAULT NULL"}, // When a field that can change after the entry was made last did
+		)(tx)
+		if err != nil {
+			return err
+		}
+		return execSchema(syncSchema)(tx)
+	}},
+	{14, "fix swapped token counts", fixSwappedTokens},
+	{15, "foreign keys", execSchema(foreignKeySchema)},
+	{16, "edited entries", func(tx *sql.Tx) error {
+		err := addColumns(
+			column{"command_history", "edited", "INTEGER NOT NULL DEFAULT 0"}, // Whether the command or details were edited after they were generated
+		)(tx)
+		if err != nil {
+			return err
+		}
+		return execSchema(editSchema)(tx)
+	}},
+	{17, "usage counters", addColumns(
+		column{"command_history", "use_count", "INTEGER NOT NULL DEFAULT 0"}, // Times the entry was run, copied or picked from history
+		column{"command_history", "last_used_at", "DATETIME DEFAULT NULL"},   // When it last was
+	)},
+}
+
+// migrate applies the migrations the database doesn't have yet
+func (db *DB) migrate() error {
+	if _, err := db.conn.Exec(versionSchema); err != nil {
+		return fmt.Errorf("could not create schema_version table: %w", err)
+	}
+
+	var current int
+	if err := db.conn.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("the database is at schema version %d, from a newer version of tell that knows up to %d", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		slog.Debug("Migrating database", "version", m.version, "description", m.description)
+		if err := db.applyMigration(m); err != nil {
+			return fmt.Errorf("could not migrate database to version %d (%s): %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration applies m and records it, or does neither when it fails
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_version (version, description) VALUES (?, ?)", m.version, m.description); err != nil {
+		return fmt.Errorf("could not record schema version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %w", err)
+	}
+	return nil
+}
+
+// execSchema returns a migration running statements, which must use IF NOT EXISTS
+func execSchema(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// column describes a column added to an existing table after its initial creation
+type column struct {
+	table      string
+	name       string
+	definition string
+}
+
+// addColumns returns a migration adding columns, except those the table already has
+func addColumns(columns ...column) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, col := range columns {
+			exists, err := columnExists(tx, col.table, col.name)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+
+			slog.Debug("Adding column", "table", col.table, "column", col.name)
+			query := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.name, col.definition)
+			if _, err := tx.Exec(query); err != nil {
+				return fmt.Errorf("could not add column %s.%s: %w", col.table, col.name, err)
+			}
+		}
+		return nil
+	}
+}
+
+// columnExists reports whether the table has a column with the given name
+func columnExists(tx *sql.Tx, table, name string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("could not read table info: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var colName, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &colName, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, fmt.Errorf("could not scan table info: %w", err)
+		}
+		if colName == name {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// fixSwappedTokens swaps back the input and output token counts of Claude models, from the
+// Anthropic API or Vertex AI, which were recorded the wrong way round. Databases from before
+// schema_version that were fixed already have a user_version of 1.
+func fixSwappedTokens(tx *sql.Tx) error {
+	var fixed int
+	if err := tx.QueryRow("PRAGMA user_version").Scan(&fixed); err != nil {
+		return fmt.Errorf("could not read database version: %w", err)
+	}
+	if fixed >= 1 {
+		return nil
+	}
+
+	_, err := tx.Exec("UPDATE command_history SET input_tokens = output_tokens, output_tokens = input_tokens WHERE model LIKE 'claude-%'")
+	return err
+}
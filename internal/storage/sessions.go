@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/jonfk/tell/internal/fault"
+	"github.com/jonfk/tell/internal/model"
+)
+
+// sessionColumns are the columns selected for a model.Session, in the order scanSession expects
+const sessionColumns = `
+	sessions.id, sessions.name, sessions.created_at, sessions.active,
+	(SELECT count(*) FROM command_history WHERE session_id = sessions.id),
+	coalesce((SELECT max(timestamp) FROM command_history WHERE session_id = sessions.id), sessions.created_at)`
+
+// CreateSession creates a session. Its name must be one no other session has.
+func (db *DB) CreateSession(name string) (*model.Session, error) {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return nil, fmt.Errorf("could not create session: %w", err)
+	}
+
+	result, err := db.conn.Exec("INSERT INTO sessions (name) VALUES (?)", name)
+	if err != nil {
+		return nil, fmt.Errorf("could not create session: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("could not get session ID: %w", err)
+	}
+
+	return db.getSessionByID(id)
+}
+
+// GetSession returns the session with the given name, or ID when no session has that name.
+// Returns nil if there is none.
+func (db *DB) GetSession(nameOrID string) (*model.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE name = ?`
+
+	session, err := scanSession(db.conn.QueryRow(query, nameOrID))
+	if err == sql.ErrNoRows {
+		id, convErr := strconv.ParseInt(nameOrID, 10, 64)
+		if convErr != nil {
+			return nil, nil
+		}
+		session, err = db.getSessionByID(id)
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// getSessionByID returns the session with the given ID, sql.ErrNoRows if there is none
+func (db *DB) getSessionByID(id int64) (*model.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = ?`
+	return scanSession(db.conn.QueryRow(query, id))
+}
+
+// GetActiveSession returns the session prompts are made in, nil if there is none
+func (db *DB) GetActiveSession() (*model.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE active = 1 LIMIT 1`
+
+	session, err := scanSession(db.conn.QueryRow(query))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get active session: %w", err)
+	}
+
+	return session, nil
+}
+
+// SetActiveSession makes the session with the given ID the one prompts are made in, or ends
+// the active session with 0
+func (db *DB) SetActiveSession(id int64) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not set active session: %w", err)
+	}
+
+	if _, err := db.conn.Exec("UPDATE sessions SET active = (id = ?)", id); err != nil {
+		return fmt.Errorf("could not set active session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSessions returns every session, most recently used first
+func (db *DB) GetSessions() ([]model.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions ORDER BY 6 DESC, id DESC`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []model.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// GetSessionEntries returns the history entries of a session in the order they were generated
+func (db *DB) GetSessionEntries(sessionID int64) ([]model.HistoryEntry, error) {
+	query := `
+		SELECT ` + historyColumns + `
+		FROM command_history
+		WHERE session_id = ?
+		ORDER BY id
+	`
+
+	rows, err := db.conn.Query(query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get session entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.HistoryEntry
+	for rows.Next() {
+		entry, err := db.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		entries = append(entries, *entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return entries, nil
+}
+
+// AddToSession makes a history entry part of a session
+func (db *DB) AddToSession(entryID int64, sessionID int64) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not add entry to session: %w", err)
+	}
+
+	result, err := db.conn.Exec("UPDATE command_history SET session_id = ? WHERE id = ?", sessionID, entryID)
+	if err != nil {
+		return fmt.Errorf("could not add entry to session: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("no history entry found with ID %d", entryID)
+	}
+
+	return nil
+}
+
+// scanSession scans a row selected with sessionColumns into a session
+func scanSession(row rowScanner) (*model.Session, error) {
+	var session model.Session
+	var createdAt, lastUsed string
+
+	if err := row.Scan(&session.ID, &session.Name, &createdAt, &session.Active, &session.Entries, &lastUsed); err != nil {
+		return nil, err
+	}
+	session.CreatedAt = parseTimestamp(createdAt)
+	session.LastUsed = parseTimestamp(lastUsed)
+
+	return &session, nil
+}
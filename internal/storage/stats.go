@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// GetParseStats returns parse success counts for each system prompt variant, for the entries
+// made since since. Only command entries that got a response from the model are counted.
+func (db *DB) GetParseStats(since time.Time) ([]model.ParseStats, error) {
+	query := `
+		SELECT
+			prompt_variant,
+			COUNT(*),
+			SUM(CASE WHEN parse_attempts = 1 AND error_message = '' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN parse_attempts = 2 AND error_message = '' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN error_message != '' THEN 1 ELSE 0 END),
+			AVG(input_tokens),
+			AVG(output_tokens)
+		FROM command_history
+		WHERE entry_type = 'command' AND parse_attempts > 0 AND timestamp >= ?
+		GROUP BY prompt_variant
+		ORDER BY prompt_variant
+	`
+
+	rows, err := db.conn.Query(query, sinceTimestamp(since))
+	if err != nil {
+		return nil, fmt.Errorf("could not query parse stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []model.ParseStats
+	for rows.Next() {
+		var s model.ParseStats
+		if err := rows.Scan(
+			&s.PromptVariant,
+			&s.Requests,
+			&s.FirstTry,
+			&s.Repaired,
+			&s.Failed,
+			&s.AvgInputTokens,
+			&s.AvgOutputTokens,
+		); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+
+		stats = append(stats, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return stats, nil
+}
+
+// GetUsageStats summarizes the entries made since since, with up to topCommands of the commands
+// generated most often
+func (db *DB) GetUsageStats(since time.Time, topCommands int) (*model.UsageStats, error) {
+	stats := &model.UsageStats{}
+	from := sinceTimestamp(since)
+
+	query := `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN model != '' OR COALESCE(error_message, '') != '' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN COALESCE(error_message, '') != '' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN exit_code IS NOT NULL THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN exit_code IS NOT NULL AND exit_code != 0 THEN 1 ELSE 0 END), 0),
+			COALESCE(AVG(CASE WHEN model != '' AND COALESCE(error_message, '') = '' THEN output_tokens END), 0)
+		FROM command_history
+		WHERE timestamp >= ?
+	`
+	if err := db.conn.QueryRow(query, from).Scan(
+		&stats.Entries,
+		&stats.Requests,
+		&stats.Errors,
+		&stats.Runs,
+		&stats.FailedRuns,
+		&stats.AvgOutputTokens,
+	); err != nil {
+		return nil, fmt.Errorf("could not query usage stats: %w", err)
+	}
+
+	var err error
+	// Timestamps are in UTC, days and weeks are the user's
+	if stats.Days, err = db.periodCounts("date(timestamp, 'localtime')", from); err != nil {
+		return nil, err
+	}
+	if stats.Weeks, err = db.periodCounts("date(timestamp, 'localtime', 'weekday 0', '-6 days')", from); err != nil {
+		return nil, err
+	}
+	if stats.Models, err = db.modelUsage(from); err != nil {
+		return nil, err
+	}
+	if err := db.responseStats(stats, from, topCommands); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// sinceTimestamp returns since as stored in timestamp columns, which the zero time is before
+func sinceTimestamp(since time.Time) string {
+	return since.UTC().Format("2006-01-02 15:04:05")
+}
+
+// periodCounts counts the entries made since from in each period, the start of which the SQL
+// expression period returns, newest first
+func (db *DB) periodCounts(period string, from string) ([]model.PeriodCount, error) {
+	query := fmt.Sprintf(`
+		SELECT %s AS start, COUNT(*)
+		FROM command_history
+		WHERE timestamp >= ?
+		GROUP BY start
+		ORDER BY start DESC
+	`, period)
+
+	rows, err := db.conn.Query(query, from)
+	if err != nil {
+		return nil, fmt.Errorf("could not query entries per period: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []model.PeriodCount{}
+	for rows.Next() {
+		var count model.PeriodCount
+		if err := rows.Scan(&count.Start, &count.Entries); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return counts, nil
+}
+
+// modelUsage returns the requests and tokens of each model since from, most requested first
+func (db *DB) modelUsage(from string) ([]model.ModelUsage, error) {
+	query := `
+		SELECT
+			model,
+			COUNT(*),
+			SUM(CASE WHEN COALESCE(error_message, '') != '' THEN 1 ELSE 0 END),
+			SUM(input_tokens),
+			SUM(output_tokens)
+		FROM command_history
+		WHERE model != '' AND timestamp >= ?
+		GROUP BY model
+		ORDER BY COUNT(*) DESC, model
+	`
+
+	rows, err := db.conn.Query(query, from)
+	if err != nil {
+		return nil, fmt.Errorf("could not query model usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []model.ModelUsage{}
+	for rows.Next() {
+		var u model.ModelUsage
+		if err := rows.Scan(&u.Model, &u.Requests, &u.Errors, &u.InputTokens, &u.OutputTokens); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return usage, nil
+}
+
+// GetMonthlyUsage returns the requests and tokens of each model in each month, newest first, or
+// only in month (2006-01) when it isn't empty. Months are the user's, in local time.
+func (db *DB) GetMonthlyUsage(month string) ([]model.MonthlyUsage, error) {
+	query := `
+		SELECT
+			strftime('%Y-%m', timestamp, 'localtime') AS month,
+			model,
+			COUNT(*),
+			SUM(CASE WHEN COALESCE(error_message, '') != '' THEN 1 ELSE 0 END),
+			SUM(input_tokens),
+			SUM(output_tokens)
+		FROM command_history
+		WHERE model != '' AND (? = '' OR strftime('%Y-%m', timestamp, 'localtime') = ?)
+		GROUP BY month, model
+		ORDER BY month DESC, COUNT(*) DESC, model
+	`
+
+	rows, err := db.conn.Query(query, month, month)
+	if err != nil {
+		return nil, fmt.Errorf("could not query monthly usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []model.MonthlyUsage{}
+	for rows.Next() {
+		var u model.MonthlyUsage
+		if err := rows.Scan(&u.Month, &u.Model, &u.Requests, &u.Errors, &u.InputTokens, &u.OutputTokens); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		usage = append(usage, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return usage, nil
+}
+
+// responseStats sets the average response size and the commands generated most often. These
+// need the text of the entries, which SQLite can't read while history is encrypted, so they are
+// counted here.
+func (db *DB) responseStats(stats *model.UsageStats, from string, topCommands int) error {
+	query := `
+		SELECT command, details, entry_type, exit_code IS NOT NULL
+		FROM command_history
+		WHERE model != '' AND COALESCE(error_message, '') = '' AND timestamp >= ?
+	`
+
+	rows, err := db.conn.Query(query, from)
+	if err != nil {
+		return fmt.Errorf("could not query responses: %w", err)
+	}
+	defer rows.Close()
+
+	var responses, chars int
+	commands := map[string]*model.CommandUsage{}
+	for rows.Next() {
+		var command, entryType string
+		var details sql.NullString
+		var ran bool
+		if err := rows.Scan(&command, &details, &entryType, &ran); err != nil {
+			return fmt.Errorf("could not scan row: %w", err)
+		}
+		if err := db.open(&command, &details.String); err != nil {
+			return err
+		}
+
+		responses++
+		chars += len([]rune(command)) + len([]rune(details.String))
+
+		if entryType != model.EntryTypeCommand || command == "" {
+			continue
+		}
+		usage, ok := commands[command]
+		if !ok {
+			usage = &model.CommandUsage{Command: command}
+			commands[command] = usage
+		}
+		usage.Generated++
+		if ran {
+			usage.Runs++
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	if responses > 0 {
+		stats.AvgResponseChars = float64(chars) / float64(responses)
+	}
+
+	stats.TopCommands = []model.CommandUsage{}
+	for _, usage := range commands {
+		if usage.Generated > 1 {
+			stats.TopCommands = append(stats.TopCommands, *usage)
+		}
+	}
+	sort.Slice(stats.TopCommands, func(i, j int) bool {
+		a, b := stats.TopCommands[i], stats.TopCommands[j]
+		if a.Generated != b.Generated {
+			return a.Generated > b.Generated
+		}
+		if a.Runs != b.Runs {
+			return a.Runs > b.Runs
+		}
+		return a.Command < b.Command
+	})
+	if len(stats.TopCommands) > topCommands {
+		stats.TopCommands = stats.TopCommands[:topCommands]
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package storagetest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jonfk/tell/internal/storage"
+)
+
+// Open creates a history database in a temporary directory, with its schema initialized, and
+// closes it when the test ends
+func Open(t testing.TB) *storage.DB {
+	t.Helper()
+
+	db, err := storage.OpenAt(filepath.Join(t.TempDir(), "tell.db"))
+	if err != nil {
+		t.Fatalf("OpenAt: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.InitSchema(); err != nil {
+		t.Fatalf("InitSchema: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jonfk/tell/internal/fault"
+	"github.com/jonfk/tell/internal/model"
+)
+
+// SyncedEntry is a history entry shared with other machines, with the UID of the entry it
+// continues since IDs differ between machines
+type SyncedEntry struct {
+	model.HistoryEntry
+	ParentUID string
+}
+
+// Deletion records that the entry with UID was deleted
+type Deletion struct {
+	UID       string
+	DeletedAt time.Time
+}
+
+// SyncResult counts the changes ApplySync made to the history
+type SyncResult struct {
+	Added   int
+	Updated int
+	Deleted int
+}
+
+// GetSyncedEntries returns every history entry, oldest first, with the UID of its parent
+func (db *DB) GetSyncedEntries() ([]SyncedEntry, error) {
+	query := fmt.Sprintf("SELECT %s FROM command_history ORDER BY id", historyColumns)
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not query history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []SyncedEntry
+	uids := make(map[int64]string)
+	for rows.Next() {
+		entry, err := db.scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		uids[entry.ID] = entry.UID
+		entries = append(entries, SyncedEntry{HistoryEntry: *entry})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	for i, entry := range entries {
+		if entry.ParentID.Valid {
+			entries[i].ParentUID = uids[entry.ParentID.Int64]
+		}
+	}
+
+	return entries, nil
+}
+
+// GetDeletions returns the entries deleted from the history, oldest first
+func (db *DB) GetDeletions() ([]Deletion, error) {
+	rows, err := db.conn.Query("SELECT uid, deleted_at FROM history_deletions ORDER BY deleted_at, uid")
+	if err != nil {
+		return nil, fmt.Errorf("could not query deletions: %w", err)
+	}
+	defer rows.Close()
+
+	var deletions []Deletion
+	for rows.Next() {
+		var deletion Deletion
+		var deletedAt string
+		if err := rows.Scan(&deletion.UID, &deletedAt); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		deletion.DeletedAt = parseTimestamp(deletedAt)
+		deletions = append(deletions, deletion)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return deletions, nil
+}
+
+// syncState is what ApplySync needs to know about an entry already in the history
+type syncState struct {
+	id        int64
+	updatedAt time.Time
+}
+
+// ApplySync merges the history of another machine into this one. Entries are matched by UID:
+// new ones are added, unless they were deleted here, and entries both have take the favorite,
+// shortcut, tags, execution and edits of the one changed last. Deleted entries are deleted here too.
+// All changes are made, or none.
+func (db *DB) ApplySync(entries []SyncedEntry, deletions []Deletion) (SyncResult, error) {
+	var result SyncResult
+	if err := fault.Error(fault.DBLock); err != nil {
+		return result, fmt.Errorf("could not sync history: %w", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return result, fmt.Errorf("could not start sync: %w", err)
+	}
+	defer tx.Rollback()
+
+	local, err := syncStates(tx)
+	if err != nil {
+		return result, err
+	}
+	deleted, err := deletedUIDs(tx)
+	if err != nil {
+		return result, err
+	}
+
+	for _, deletion := range deletions {
+		if deleted[deletion.UID] {
+			continue
+		}
+		deleted[deletion.UID] = true
+
+		if _, err := tx.Exec("INSERT OR IGNORE INTO history_deletions (uid, deleted_at) VALUES (?, ?)",
+			deletion.UID, deletion.DeletedAt.UTC().Format("2006-01-02 15:04:05")); err != nil {
+			return result, fmt.Errorf("could not record deletion: %w", err)
+		}
+		if state, ok := local[deletion.UID]; ok {
+			if _, err := tx.Exec("DELETE FROM command_history WHERE id = ?", state.id); err != nil {
+				return result, fmt.Errorf("could not delete history entry %d: %w", state.id, err)
+			}
+			delete(local, deletion.UID)
+			result.Deleted++
+		}
+	}
+
+	// Entries added, linked to their parents once all are there
+	var added []SyncedEntry
+	for _, entry := range entries {
+		if entry.UID == "" || deleted[entry.UID] {
+			continue
+		}
+
+		state, ok := local[entry.UID]
+		if !ok {
+			id, err := db.insertEntry(tx, entry.HistoryEntry, sql.NullInt64{})
+			if err != nil {
+				return result, fmt.Errorf("could not add history entry %s: %w", entry.UID, err)
+			}
+			if err := setTags(tx, id, entry.Tags); err != nil {
+				return result, err
+			}
+			// Set after the tags, since changing them touches updated_at
+			if _, err := tx.Exec("UPDATE command_history SET updated_at = ? WHERE id = ?", nullTimestamp(entry.UpdatedAt), id); err != nil {
+				return result, fmt.Errorf("could not add history entry %s: %w", entry.UID, err)
+			}
+			local[entry.UID] = syncState{id: id, updatedAt: entry.UpdatedAt.Time}
+			added = append(added, entry)
+			result.Added++
+			continue
+		}
+
+		if entry.UpdatedAt.Valid && entry.UpdatedAt.Time.After(state.updatedAt) {
+			if err := db.setSyncedFields(tx, state.id, entry.HistoryEntry); err != nil {
+				return result, err
+			}
+			result.Updated++
+		}
+	}
+
+	for _, entry := range added {
+		parent, ok := local[entry.ParentUID]
+		if entry.ParentUID == "" || !ok {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE command_history SET parent_id = ? WHERE id = ?", parent.id, local[entry.UID].id); err != nil {
+			return result, fmt.Errorf("could not link history entry %s to its parent: %w", entry.UID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("could not commit sync: %w", err)
+	}
+
+	return result, nil
+}
+
+// setSyncedFields sets the fields of entry id that can change after it was made to those of
+// entry, along with when they last changed
+func (db *DB) setSyncedFields(tx *sql.Tx, id int64, entry model.HistoryEntry) error {
+	// Tags go first, since changing them touches updated_at
+	if err := setTags(tx, id, entry.Tags); err != nil {
+		return err
+	}
+
+	if err := db.seal(&entry.Command, &entry.Details, &entry.Output.String, &entry.RanCommand); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE command_history SET
+			favorite = ?, shortcut = ?, exit_code = ?, executed_at = ?, duration_ms = ?, output = ?,
+			timed_out = ?, outcome = ?, ran_command = ?, command = ?, details = ?, edited = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	_, err := tx.Exec(query,
+		entry.Favorite,
+		entry.Shortcut,
+		entry.ExitCode,
+		nullTimestamp(entry.ExecutedAt),
+		entry.DurationMS,
+		entry.Output,
+		entry.TimedOut,
+		entry.Outcome,
+		entry.RanCommand,
+		entry.Command,
+		entry.Details,
+		entry.Edited,
+		nullTimestamp(entry.UpdatedAt),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("could not update history entry %d: %w", id, err)
+	}
+	return nil
+}
+
+// setTags replaces the tags of entry id with tags
+func setTags(tx *sql.Tx, id int64, tags []string) error {
+	if _, err := tx.Exec("DELETE FROM history_tags WHERE entry_id = ?", id); err != nil {
+		return fmt.Errorf("could not set tags of history entry %d: %w", id, err)
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO history_tags (entry_id, tag) VALUES (?, ?)", id, tag); err != nil {
+			return fmt.Errorf("could not set tags of history entry %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// nullTimestamp formats t the way SQLite stores timestamps, or NULL when it isn't set
+func nullTimestamp(t sql.NullTime) sql.NullString {
+	if !t.Valid {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Time.UTC().Format("2006-01-02 15:04:05"), Valid: true}
+}
+
+// syncStates returns the ID and time of the last change of every history entry, by UID
+func syncStates(tx *sql.Tx) (map[string]syncState, error) {
+	rows, err := tx.Query("SELECT id, uid, updated_at FROM command_history WHERE uid IS NOT NULL")
+	if err != nil {
+		return nil, fmt.Errorf("could not read history: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]syncState)
+	for rows.Next() {
+		var state syncState
+		var uid string
+		var updatedAt sql.NullString
+		if err := rows.Scan(&state.id, &uid, &updatedAt); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		if updatedAt.Valid {
+			state.updatedAt = parseTimestamp(updatedAt.String)
+		}
+		states[uid] = state
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return states, nil
+}
+
+// deletedUIDs returns the UIDs of the entries deleted from the history
+func deletedUIDs(tx *sql.Tx) (map[string]bool, error) {
+	rows, err := tx.Query("SELECT uid FROM history_deletions")
+	if err != nil {
+		return nil, fmt.Errorf("could not read deletions: %w", err)
+	}
+	defer rows.Close()
+
+	deleted := make(map[string]bool)
+	for rows.Next() {
+		var uid string
+		if err := rows.Scan(&uid); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		deleted[uid] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return deleted, nil
+}
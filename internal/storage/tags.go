@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/jonfk/tell/internal/fault"
+	"github.com/jonfk/tell/internal/model"
+)
+
+// AddTags tags a history entry. Tags it already has are left as they are.
+func (db *DB) AddTags(id int64, tags []string) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not tag history entry: %w", err)
+	}
+
+	var exists int
+	if err := db.conn.QueryRow("SELECT count(*) FROM command_history WHERE id = ?", id).Scan(&exists); err != nil {
+		return fmt.Errorf("could not tag history entry: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("no history entry found with ID %d", id)
+	}
+
+	for _, tag := range tags {
+		if _, err := db.conn.Exec("INSERT OR IGNORE INTO history_tags (entry_id, tag) VALUES (?, ?)", id, tag); err != nil {
+			return fmt.Errorf("could not tag history entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveTags removes tags from a history entry. Tags it doesn't have are ignored.
+func (db *DB) RemoveTags(id int64, tags []string) error {
+	if err := fault.Error(fault.DBLock); err != nil {
+		return fmt.Errorf("could not untag history entry: %w", err)
+	}
+
+	for _, tag := range tags {
+		if _, err := db.conn.Exec("DELETE FROM history_tags WHERE entry_id = ? AND tag = ?", id, tag); err != nil {
+			return fmt.Errorf("could not untag history entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetTags returns every tag in use with the number of entries that have it, most used first
+func (db *DB) GetTags() ([]model.TagCount, error) {
+	rows, err := db.conn.Query("SELECT tag, count(*) FROM history_tags GROUP BY tag ORDER BY count(*) DESC, tag")
+	if err != nil {
+		return nil, fmt.Errorf("could not get tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []model.TagCount
+	for rows.Next() {
+		var tag model.TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+
+	"github.com/jonfk/tell/internal/model"
+)
+
+// GetWorkspaceTrust returns the trust decision for a workspace. A decision recorded
+// for a parent directory applies to everything below it; the closest one wins.
+// Returns nil if the user hasn't decided yet.
+func (db *DB) GetWorkspaceTrust(path string) (*model.WorkspaceTrust, error) {
+	query := `
+		SELECT path, trusted, decided_at
+		FROM workspace_trust
+		WHERE path = ?
+	`
+
+	for dir := path; ; dir = filepath.Dir(dir) {
+		trust, err := scanWorkspaceTrust(db.conn.QueryRow(query, dir))
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("could not get workspace trust: %w", err)
+		}
+		if trust != nil {
+			return trust, nil
+		}
+
+		if parent := filepath.Dir(dir); parent == dir {
+			return nil, nil
+		}
+	}
+}
+
+// SetWorkspaceTrust records whether context may be collected from a workspace
+func (db *DB) SetWorkspaceTrust(path string, trusted bool) error {
+	query := `
+		INSERT INTO workspace_trust (path, trusted, decided_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(path) DO UPDATE SET trusted = excluded.trusted, decided_at = excluded.decided_at
+	`
+
+	if _, err := db.conn.Exec(query, path, trusted); err != nil {
+		return fmt.Errorf("could not set workspace trust: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteWorkspaceTrust forgets the trust decision for a workspace, so the user is asked again
+func (db *DB) DeleteWorkspaceTrust(path string) error {
+	result, err := db.conn.Exec("DELETE FROM workspace_trust WHERE path = ?", path)
+	if err != nil {
+		return fmt.Errorf("could not delete workspace trust: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not get rows affected: %w", err)
+	}
+
+	if rows == 0 {
+		return fmt.Errorf("no trust decision found for %s", path)
+	}
+
+	return nil
+}
+
+// GetWorkspaceTrusts lists every recorded trust decision
+func (db *DB) GetWorkspaceTrusts() ([]model.WorkspaceTrust, error) {
+	rows, err := db.conn.Query("SELECT path, trusted, decided_at FROM workspace_trust ORDER BY path")
+	if err != nil {
+		return nil, fmt.Errorf("could not query workspace trust: %w", err)
+	}
+	defer rows.Close()
+
+	var trusts []model.WorkspaceTrust
+	for rows.Next() {
+		trust, err := scanWorkspaceTrust(rows)
+		if err != nil {
+			return nil, fmt.Errorf("could not scan row: %w", err)
+		}
+
+		trusts = append(trusts, *trust)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return trusts, nil
+}
+
+// scanWorkspaceTrust scans a path, trusted, decided_at row
+func scanWorkspaceTrust(row rowScanner) (*model.WorkspaceTrust, error) {
+	var trust model.WorkspaceTrust
+	var decidedAt string
+
+	if err := row.Scan(&trust.Path, &trust.Trusted, &decidedAt); err != nil {
+		return nil, err
+	}
+	trust.DecidedAt = parseTimestamp(decidedAt)
+
+	return &trust, nil
+}
@@ -0,0 +1,90 @@
+package sysinfo
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// cgroupRuntimes maps markers in /proc/1/cgroup to the container runtime they indicate
+var cgroupRuntimes = []struct {
+	marker  string
+	runtime string
+}{
+	{"kubepods", "kubernetes"},
+	{"docker", "docker"},
+	{"libpod", "podman"},
+	{"containerd", "containerd"},
+	{"lxc", "lxc"},
+}
+
+// ContainerInfo describes the container tell is running in
+type ContainerInfo struct {
+	// Runtime names the container runtime, e.g. docker or podman, or "container" when it is unknown
+	Runtime string
+	// Systemd reports whether systemd is the init process, which is rare in containers
+	Systemd bool
+	// Sudo reports whether sudo is installed
+	Sudo bool
+	// Root reports whether tell runs as root, as is usual in containers
+	Root bool
+}
+
+// DetectContainer reports whether tell runs inside a container, from the marker files
+// runtimes create, the container environment variable and the cgroups of the init process.
+// Returns nil outside a container.
+func DetectContainer() *ContainerInfo {
+	runtime := containerRuntime()
+	if runtime == "" {
+		return nil
+	}
+
+	info := &ContainerInfo{
+		Runtime: runtime,
+		Root:    os.Geteuid() == 0,
+	}
+	if comm, err := os.ReadFile("/proc/1/comm"); err == nil {
+		info.Systemd = strings.TrimSpace(string(comm)) == "systemd"
+	}
+	if _, err := exec.LookPath("sudo"); err == nil {
+		info.Sudo = true
+	}
+
+	return info
+}
+
+// containerRuntime returns the name of the container runtime, or "" outside a container
+func containerRuntime() string {
+	if fileExists("/.dockerenv") {
+		return "docker"
+	}
+	if fileExists("/run/.containerenv") {
+		return "podman"
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+
+	// Set by systemd-nspawn, LXC and podman, see the container interface of systemd
+	if runtime := os.Getenv("container"); runtime != "" {
+		return runtime
+	}
+
+	cgroup, err := os.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return ""
+	}
+	for _, r := range cgroupRuntimes {
+		if strings.Contains(string(cgroup), r.marker) {
+			return r.runtime
+		}
+	}
+
+	return ""
+}
+
+// fileExists reports whether a file exists at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,74 @@
+package sysinfo
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Coreutils flavors, which decide the flags sed, date, stat and friends accept
+const (
+	CoreutilsGNU     = "gnu"
+	CoreutilsBSD     = "bsd"
+	CoreutilsBusyBox = "busybox"
+)
+
+// gnuPrefixedTools are the GNU tools Homebrew and MacPorts install with a g prefix next to
+// the BSD ones on macOS
+var gnuPrefixedTools = []string{"gsed", "gdate", "gstat", "greadlink", "gfind", "gxargs", "ggrep", "gawk", "gtimeout"}
+
+// bsdSystems are the uname names of systems whose base tools are BSD flavored
+var bsdSystems = map[string]bool{
+	"darwin": true, "freebsd": true, "openbsd": true, "netbsd": true, "dragonfly": true,
+}
+
+// detectedCoreutils caches DetectCoreutils, since the system prompt and the checks of the
+// generated command both need it
+var detectedCoreutils struct {
+	once   sync.Once
+	flavor string
+}
+
+// DetectCoreutils returns CoreutilsGNU when date on PATH is GNU date, CoreutilsBusyBox when it
+// is a BusyBox applet, CoreutilsBSD on BSD systems such as macOS without GNU date first on
+// PATH, or "" when unknown. The result is cached for the life of the process.
+func DetectCoreutils(timeout time.Duration) string {
+	detectedCoreutils.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		// Only GNU date understands --version, BSD date fails with a usage message and
+		// BusyBox date with one naming BusyBox
+		out, _ := exec.CommandContext(ctx, "date", "--version").CombinedOutput()
+		detectedCoreutils.flavor = coreutilsFlavor(runtime.GOOS, string(out))
+	})
+	return detectedCoreutils.flavor
+}
+
+// coreutilsFlavor classifies the output of date --version on a system with the given uname name
+func coreutilsFlavor(system string, dateVersion string) string {
+	if strings.Contains(dateVersion, "GNU coreutils") {
+		return CoreutilsGNU
+	}
+	if strings.Contains(dateVersion, "BusyBox") {
+		return CoreutilsBusyBox
+	}
+	if bsdSystems[strings.ToLower(system)] {
+		return CoreutilsBSD
+	}
+	return ""
+}
+
+// DetectGNUPrefixed lists the g-prefixed GNU tools installed on PATH, e.g. gsed and gdate
+func DetectGNUPrefixed() []string {
+	var installed []string
+	for _, tool := range gnuPrefixedTools {
+		if _, err := exec.LookPath(tool); err == nil {
+			installed = append(installed, tool)
+		}
+	}
+	return installed
+}
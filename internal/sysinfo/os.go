@@ -0,0 +1,130 @@
+package sysinfo
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// osReleasePaths are read in order to identify a Linux distribution, see os-release(5)
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// OSInfo describes the operating system tell is running on
+type OSInfo struct {
+	// OS is the GOOS name, e.g. linux or darwin
+	OS string
+	// Platform is the result of DetectPlatform
+	Platform string
+	// Arch is the GOARCH name, e.g. amd64 or arm64
+	Arch string
+	// Distro is the human readable distribution name, e.g. "Fedora Linux 40 (Workstation Edition)"
+	Distro string
+	// DistroID is the lower case distribution identifier, e.g. fedora
+	DistroID string
+	// DistroLike lists the distributions this one derives from, e.g. [rhel fedora]
+	DistroLike []string
+	// Container describes the container tell runs in, nil outside a container
+	Container *ContainerInfo
+	// Coreutils is CoreutilsGNU, CoreutilsBSD, CoreutilsBusyBox or empty when unknown. DetectOS leaves it empty,
+	// see DetectCoreutils.
+	Coreutils string
+	// GNUPrefixed lists GNU tools installed next to BSD ones with a g prefix, e.g. gsed
+	GNUPrefixed []string
+	// PackageManager installs software, e.g. apt or brew; empty when unknown. DetectOS leaves it
+	// empty, see DetectPackageManager.
+	PackageManager string
+}
+
+// DetectOS returns the operating system, architecture and, on Linux, the distribution
+func DetectOS() OSInfo {
+	info := OSInfo{
+		OS:       runtime.GOOS,
+		Platform: DetectPlatform(),
+		Arch:     runtime.GOARCH,
+	}
+
+	if runtime.GOOS != "linux" {
+		return info
+	}
+
+	info.Container = DetectContainer()
+
+	for _, path := range osReleasePaths {
+		fields, err := readOSRelease(path)
+		if err != nil {
+			continue
+		}
+		info.setDistro(fields)
+		break
+	}
+
+	return info
+}
+
+// setDistro fills in the distribution from the fields of an os-release file
+func (i *OSInfo) setDistro(fields map[string]string) {
+	i.Distro = fields["PRETTY_NAME"]
+	if i.Distro == "" {
+		i.Distro = strings.TrimSpace(fields["NAME"] + " " + fields["VERSION"])
+	}
+	i.DistroID = fields["ID"]
+	i.DistroLike = strings.Fields(fields["ID_LIKE"])
+}
+
+// String describes the system in one line, e.g. "Linux (Fedora Linux 40), amd64"
+func (i OSInfo) String() string {
+	var name string
+	switch i.Platform {
+	case PlatformMacOS:
+		name = "macOS"
+	case PlatformLinux:
+		name = "Linux"
+	case PlatformWSL:
+		name = "Linux under WSL"
+	case PlatformWindows:
+		name = "Windows"
+	default:
+		name = i.OS
+	}
+
+	if i.Distro != "" {
+		name += " (" + i.Distro + ")"
+	}
+	if i.Arch == "" {
+		return name
+	}
+	return name + ", " + i.Arch
+}
+
+// readOSRelease parses the os-release file at path
+func readOSRelease(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseOSRelease(file)
+}
+
+// parseOSRelease parses the KEY=value lines of an os-release file
+func parseOSRelease(r io.Reader) (map[string]string, error) {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+
+	return fields, scanner.Err()
+}
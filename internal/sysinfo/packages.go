@@ -0,0 +1,74 @@
+package sysinfo
+
+import (
+	"os/exec"
+)
+
+// PackageManagers are the package managers tell knows, in the order they are looked for when
+// the distribution doesn't say which one it uses
+var PackageManagers = []string{"apt", "dnf", "yum", "zypper", "pacman", "apk", "xbps-install", "emerge", "nix-env", "brew", "port", "pkg", "winget", "choco", "scoop"}
+
+// distroPackageManagers maps distribution IDs from os-release, including those in ID_LIKE,
+// to their package manager
+var distroPackageManagers = map[string]string{
+	"debian": "apt", "ubuntu": "apt",
+	"fedora": "dnf", "rhel": "dnf", "centos": "dnf", "rocky": "dnf", "almalinux": "dnf", "amzn": "dnf",
+	"opensuse": "zypper", "suse": "zypper", "opensuse-leap": "zypper", "opensuse-tumbleweed": "zypper",
+	"arch": "pacman", "manjaro": "pacman",
+	"alpine": "apk",
+	"void":   "xbps-install",
+	"gentoo": "emerge",
+	"nixos":  "nix-env",
+}
+
+// platformPackageManagers are looked for, in order, on systems without a distribution
+var platformPackageManagers = map[string][]string{
+	PlatformMacOS:   {"brew", "port"},
+	PlatformWindows: {"winget", "choco", "scoop"},
+	"freebsd":       {"pkg"},
+}
+
+// DetectPackageManager returns the package manager of the local system described by info:
+// the one of its distribution when installed, otherwise the first known one found on PATH.
+// Empty when none is found.
+func DetectPackageManager(info OSInfo) string {
+	installed := func(name string) bool {
+		_, err := exec.LookPath(name)
+		return err == nil
+	}
+
+	// Older Red Hat releases only have yum
+	if manager := DistroPackageManager(info); manager != "" {
+		if installed(manager) {
+			return manager
+		}
+		if manager == "dnf" && installed("yum") {
+			return "yum"
+		}
+	}
+
+	candidates := PackageManagers
+	if platform, ok := platformPackageManagers[info.Platform]; ok {
+		candidates = platform
+	} else if platform, ok := platformPackageManagers[info.OS]; ok {
+		candidates = platform
+	}
+	for _, manager := range candidates {
+		if installed(manager) {
+			return manager
+		}
+	}
+
+	return ""
+}
+
+// DistroPackageManager returns the package manager of info's distribution or of one it derives
+// from, without checking that it is installed. Empty for an unknown distribution.
+func DistroPackageManager(info OSInfo) string {
+	for _, id := range append([]string{info.DistroID}, info.DistroLike...) {
+		if manager, ok := distroPackageManagers[id]; ok {
+			return manager
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package sysinfo
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// Platform identifiers returned by DetectPlatform
+const (
+	PlatformMacOS   = "macos"
+	PlatformLinux   = "linux"
+	PlatformWSL     = "wsl"
+	PlatformWindows = "windows"
+)
+
+// DetectPlatform returns the platform tell is running on. Linux running under the
+// Windows Subsystem for Linux is reported as PlatformWSL. Other operating systems
+// are reported by their GOOS name.
+func DetectPlatform() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return PlatformMacOS
+	case "windows":
+		return PlatformWindows
+	case "linux":
+		if isWSL() {
+			return PlatformWSL
+		}
+		return PlatformLinux
+	default:
+		return runtime.GOOS
+	}
+}
+
+// isWSL reports whether the Linux kernel is the one shipped with WSL
+func isWSL() bool {
+	if os.Getenv("WSL_DISTRO_NAME") != "" {
+		return true
+	}
+
+	data, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return false
+	}
+	release := strings.ToLower(string(data))
+	return strings.Contains(release, "microsoft") || strings.Contains(release, "wsl")
+}
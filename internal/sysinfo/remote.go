@@ -0,0 +1,151 @@
+package sysinfo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// remoteSeparator separates the parts of the remote probe script's output
+const remoteSeparator = "--- tell ---"
+
+// RemoteHost describes a machine reached over SSH that generated commands will run on
+type RemoteHost struct {
+	// Name is the host as given to ssh, e.g. prod-web1 or admin@10.0.0.5, empty for a machine
+	// known only by its operating system (see TargetOS)
+	Name string
+	OS   OSInfo
+	// Installed and Missing are the looked up tools found and not found on the host's PATH
+	Installed []string
+	Missing   []string
+}
+
+// DetectRemote describes the operating system of host and which of the named tools are
+// installed there, with a single ssh connection. ssh runs in batch mode so it fails instead
+// of prompting for a password; keys or an agent must be set up for the host.
+func DetectRemote(host string, tools []string, timeout time.Duration) (*RemoteHost, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ssh",
+		"-o", "BatchMode=yes",
+		"-o", fmt.Sprintf("ConnectTimeout=%d", max(1, int(timeout.Seconds()))),
+		host, "sh", "-s")
+	cmd.Stdin = strings.NewReader(remoteScript(tools))
+
+	start := time.Now()
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("could not reach %s: %s", host, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("could not reach %s: %w", host, err)
+	}
+	slog.Debug("Probed remote host", "host", host, "duration", time.Since(start))
+
+	return parseRemote(host, tools, string(out))
+}
+
+// remoteScript builds the POSIX sh script run on the remote host: uname and the first lines of
+// date --version (GNU date only, BusyBox names itself in the error), the os-release file, the names of the tools found on PATH,
+// then the package managers found, separated by remoteSeparator
+func remoteScript(tools []string) string {
+	var sb strings.Builder
+
+	sb.WriteString("uname -s; uname -m; date --version 2>&1 | head -n 2\n")
+	fmt.Fprintf(&sb, "echo '%s'\n", remoteSeparator)
+	sb.WriteString("cat /etc/os-release 2>/dev/null || cat /usr/lib/os-release 2>/dev/null\n")
+	fmt.Fprintf(&sb, "echo '%s'\n", remoteSeparator)
+	for _, tool := range tools {
+		quoted := "'" + strings.ReplaceAll(tool, "'", `'\''`) + "'"
+		fmt.Fprintf(&sb, "command -v %s >/dev/null 2>&1 && echo %s\n", quoted, quoted)
+	}
+	fmt.Fprintf(&sb, "echo '%s'\n", remoteSeparator)
+	fmt.Fprintf(&sb, "for m in %s; do command -v $m >/dev/null 2>&1 && echo $m; done\n", strings.Join(PackageManagers, " "))
+	sb.WriteString("exit 0\n")
+
+	return sb.String()
+}
+
+// parseRemote reads the output of remoteScript
+func parseRemote(host string, tools []string, out string) (*RemoteHost, error) {
+	parts := strings.Split(out, remoteSeparator+"\n")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("unexpected output from %s, is sh its login shell?", host)
+	}
+
+	uname := strings.Fields(parts[0])
+	if len(uname) < 2 {
+		return nil, fmt.Errorf("unexpected uname output from %s: %q", host, parts[0])
+	}
+
+	remote := &RemoteHost{
+		Name: host,
+		OS: OSInfo{
+			OS:   strings.ToLower(uname[0]),
+			Arch: goArch(uname[1]),
+		},
+	}
+	switch remote.OS.OS {
+	case "linux":
+		remote.OS.Platform = PlatformLinux
+	case "darwin":
+		remote.OS.Platform = PlatformMacOS
+	}
+
+	remote.OS.Coreutils = coreutilsFlavor(remote.OS.OS, parts[0])
+
+	fields, err := parseOSRelease(strings.NewReader(parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse os-release from %s: %w", host, err)
+	}
+	remote.OS.setDistro(fields)
+
+	// The distribution's package manager when it is installed, otherwise the first one found
+	managers := strings.Fields(parts[3])
+	for _, manager := range managers {
+		if manager == DistroPackageManager(remote.OS) {
+			remote.OS.PackageManager = manager
+		}
+	}
+	if remote.OS.PackageManager == "" && len(managers) > 0 {
+		remote.OS.PackageManager = managers[0]
+	}
+
+	found := make(map[string]bool)
+	for _, name := range strings.Fields(parts[2]) {
+		found[name] = true
+	}
+	seen := make(map[string]bool)
+	for _, tool := range tools {
+		if tool == "" || seen[tool] {
+			continue
+		}
+		seen[tool] = true
+
+		if found[tool] {
+			remote.Installed = append(remote.Installed, tool)
+		} else {
+			remote.Missing = append(remote.Missing, tool)
+		}
+	}
+
+	return remote, nil
+}
+
+// goArch converts a uname -m machine name to the GOARCH name used for the local system
+func goArch(machine string) string {
+	switch machine {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "i386", "i686":
+		return "386"
+	default:
+		return machine
+	}
+}
@@ -0,0 +1,76 @@
+package sysinfo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// targetSystem describes an operating system commands can be generated for with --target-os
+type targetSystem struct {
+	os        string
+	platform  string
+	distro    string
+	coreutils string
+	// packageManager is used when the distribution doesn't imply one
+	packageManager string
+}
+
+// targetSystems are the names --target-os accepts. Distributions imply Linux, with their
+// package manager; Alpine's core utilities are BusyBox applets.
+var targetSystems = map[string]targetSystem{
+	"linux":    {os: "linux", platform: PlatformLinux, coreutils: CoreutilsGNU},
+	"macos":    {os: "darwin", platform: PlatformMacOS, coreutils: CoreutilsBSD, packageManager: "brew"},
+	"darwin":   {os: "darwin", platform: PlatformMacOS, coreutils: CoreutilsBSD, packageManager: "brew"},
+	"freebsd":  {os: "freebsd", coreutils: CoreutilsBSD, packageManager: "pkg"},
+	"openbsd":  {os: "openbsd", coreutils: CoreutilsBSD},
+	"netbsd":   {os: "netbsd", coreutils: CoreutilsBSD},
+	"ubuntu":   {os: "linux", platform: PlatformLinux, distro: "Ubuntu", coreutils: CoreutilsGNU},
+	"debian":   {os: "linux", platform: PlatformLinux, distro: "Debian GNU/Linux", coreutils: CoreutilsGNU},
+	"fedora":   {os: "linux", platform: PlatformLinux, distro: "Fedora Linux", coreutils: CoreutilsGNU},
+	"rhel":     {os: "linux", platform: PlatformLinux, distro: "Red Hat Enterprise Linux", coreutils: CoreutilsGNU},
+	"centos":   {os: "linux", platform: PlatformLinux, distro: "CentOS Stream", coreutils: CoreutilsGNU},
+	"rocky":    {os: "linux", platform: PlatformLinux, distro: "Rocky Linux", coreutils: CoreutilsGNU},
+	"amzn":     {os: "linux", platform: PlatformLinux, distro: "Amazon Linux", coreutils: CoreutilsGNU},
+	"arch":     {os: "linux", platform: PlatformLinux, distro: "Arch Linux", coreutils: CoreutilsGNU},
+	"opensuse": {os: "linux", platform: PlatformLinux, distro: "openSUSE", coreutils: CoreutilsGNU},
+	"alpine":   {os: "linux", platform: PlatformLinux, distro: "Alpine Linux", coreutils: CoreutilsBusyBox},
+}
+
+// TargetOS describes a machine known only by its operating system, for generating commands
+// meant for another system than the local one. name is an OS (linux, macos, freebsd, ...) or
+// a Linux distribution (ubuntu, alpine, ...), optionally with a version after a colon, e.g.
+// ubuntu:22.04. The returned host has no name and no known tools.
+func TargetOS(name string) (*RemoteHost, error) {
+	id, version, _ := strings.Cut(strings.ToLower(strings.TrimSpace(name)), ":")
+	system, ok := targetSystems[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown target OS %q (supported: %s)", name, strings.Join(TargetOSNames(), ", "))
+	}
+
+	info := OSInfo{
+		OS:        system.os,
+		Platform:  system.platform,
+		Distro:    strings.TrimSpace(system.distro + " " + version),
+		Coreutils: system.coreutils,
+	}
+	if system.distro != "" {
+		info.DistroID = id
+	}
+	info.PackageManager = DistroPackageManager(info)
+	if info.PackageManager == "" {
+		info.PackageManager = system.packageManager
+	}
+
+	return &RemoteHost{OS: info}, nil
+}
+
+// TargetOSNames returns the names TargetOS accepts
+func TargetOSNames() []string {
+	names := make([]string, 0, len(targetSystems))
+	for name := range targetSystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
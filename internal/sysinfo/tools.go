@@ -0,0 +1,143 @@
+package sysinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/jonfk/tell/internal/xdg"
+)
+
+// toolsCacheFile is the file under the cache directory holding tool lookups
+const toolsCacheFile = "tools.json"
+
+// toolsCache records which tools were found on PATH
+type toolsCache struct {
+	// Path is the PATH the tools were looked up in, the cache is discarded when it changes
+	Path  string               `json:"path"`
+	Tools map[string]toolEntry `json:"tools"`
+}
+
+type toolEntry struct {
+	Installed bool      `json:"installed"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// DetectTools reports which of the named tools are installed on PATH, keeping the given order.
+// Lookups are cached for ttl so tell starts fast even with a long list; a ttl of 0 disables the cache.
+func DetectTools(names []string, ttl time.Duration) (installed []string, missing []string) {
+	path := os.Getenv("PATH")
+
+	var cache *toolsCache
+	if ttl > 0 {
+		cache = loadToolsCache(path)
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	changed := false
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		var found bool
+		if entry, ok := cache.lookup(name, now, ttl); ok {
+			found = entry.Installed
+		} else {
+			_, err := exec.LookPath(name)
+			found = err == nil
+			if cache != nil {
+				cache.Tools[name] = toolEntry{Installed: found, CheckedAt: now}
+				changed = true
+			}
+		}
+
+		if found {
+			installed = append(installed, name)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+
+	if changed {
+		if err := saveToolsCache(cache); err != nil {
+			slog.Debug("Failed to save tools cache", "error", err)
+		}
+	}
+
+	slog.Debug("Detected tools", "installed", installed, "missing", missing)
+	return installed, missing
+}
+
+// lookup returns the cached result for a tool if it was checked within ttl
+func (c *toolsCache) lookup(name string, now time.Time, ttl time.Duration) (toolEntry, bool) {
+	if c == nil {
+		return toolEntry{}, false
+	}
+	entry, ok := c.Tools[name]
+	if !ok || now.Sub(entry.CheckedAt) > ttl {
+		return toolEntry{}, false
+	}
+	return entry, true
+}
+
+// loadToolsCache reads the tools cache, starting a fresh one if it is missing,
+// unreadable or was built for a different PATH
+func loadToolsCache(path string) *toolsCache {
+	fresh := &toolsCache{Path: path, Tools: make(map[string]toolEntry)}
+
+	cacheFile, err := toolsCachePath()
+	if err != nil {
+		slog.Debug("Failed to locate tools cache", "error", err)
+		return fresh
+	}
+
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return fresh
+	}
+
+	var cache toolsCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		slog.Debug("Ignoring invalid tools cache", "path", cacheFile, "error", err)
+		return fresh
+	}
+	if cache.Path != path || cache.Tools == nil {
+		return fresh
+	}
+
+	return &cache
+}
+
+// saveToolsCache writes the tools cache
+func saveToolsCache(cache *toolsCache) error {
+	cacheFile, err := toolsCachePath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("could not encode tools cache: %w", err)
+	}
+
+	if err := os.WriteFile(cacheFile, data, 0644); err != nil {
+		return fmt.Errorf("could not write tools cache: %w", err)
+	}
+	return nil
+}
+
+// toolsCachePath returns the path of the tools cache file
+func toolsCachePath() (string, error) {
+	cacheDir, err := xdg.CacheDir()
+	if err != nil {
+		return "", fmt.Errorf("could not get cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, toolsCacheFile), nil
+}
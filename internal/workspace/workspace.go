@@ -0,0 +1,34 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Root returns the workspace containing dir: the closest ancestor holding a .git
+// entry, or dir itself when it isn't inside a repository
+func Root(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for current := dir; ; current = filepath.Dir(current) {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current, nil
+		}
+
+		if parent := filepath.Dir(current); parent == current {
+			return dir, nil
+		}
+	}
+}
+
+// Current returns the workspace containing the working directory
+func Current() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return Root(cwd)
+}
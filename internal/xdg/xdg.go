@@ -0,0 +1,74 @@
+package xdg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// appDirName is the directory name used for tell under each XDG base directory
+const appDirName = "tell-llm"
+
+// ConfigDir returns the directory for configuration files,
+// $XDG_CONFIG_HOME/tell-llm or ~/.config/tell-llm, %APPDATA%\tell-llm on Windows
+func ConfigDir() (string, error) {
+	return resolve("XDG_CONFIG_HOME", windowsDir("APPDATA", appDirName), ".config")
+}
+
+// DataDir returns the directory for persistent user data such as the history database,
+// $XDG_DATA_HOME/tell-llm or ~/.local/share/tell-llm, %LOCALAPPDATA%\tell-llm on Windows
+func DataDir() (string, error) {
+	return resolve("XDG_DATA_HOME", windowsDir("LOCALAPPDATA", appDirName), ".local", "share")
+}
+
+// StateDir returns the directory for state that should persist across restarts
+// but is not important enough to back up, such as logs and runtime files,
+// $XDG_STATE_HOME/tell-llm or ~/.local/state/tell-llm, %LOCALAPPDATA%\tell-llm\state on Windows
+func StateDir() (string, error) {
+	return resolve("XDG_STATE_HOME", windowsDir("LOCALAPPDATA", appDirName, "state"), ".local", "state")
+}
+
+// CacheDir returns the directory for non-essential cached data that can be regenerated,
+// $XDG_CACHE_HOME/tell-llm or ~/.cache/tell-llm, %LOCALAPPDATA%\tell-llm\cache on Windows
+func CacheDir() (string, error) {
+	return resolve("XDG_CACHE_HOME", windowsDir("LOCALAPPDATA", appDirName, "cache"), ".cache")
+}
+
+// windowsDir returns the directory under the Windows known folder named by envVar, or "" on
+// other systems or when the variable isn't set. State and cache live under the data directory,
+// since Windows has no separate folders for them.
+func windowsDir(envVar string, elem ...string) string {
+	if runtime.GOOS != "windows" {
+		return ""
+	}
+	base := os.Getenv(envVar)
+	if base == "" {
+		return ""
+	}
+	return filepath.Join(append([]string{base}, elem...)...)
+}
+
+// resolve returns the tell directory under the base directory named by envVar, or windowsPath
+// when it isn't empty, falling back to the given path relative to the home directory. The
+// directory is created if it doesn't exist.
+func resolve(envVar string, windowsPath string, homeFallback ...string) (string, error) {
+	dir := windowsPath
+	if baseDir := os.Getenv(envVar); baseDir != "" || dir == "" {
+		if baseDir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("could not determine home directory: %w", err)
+			}
+			baseDir = filepath.Join(append([]string{home}, homeFallback...)...)
+		}
+		dir = filepath.Join(baseDir, appDirName)
+	}
+
+	// Ensure the directory exists
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("could not create directory %s: %w", dir, err)
+	}
+
+	return dir, nil
+}